@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AccountHandler handles deactivating and reactivating user accounts
+type AccountHandler struct {
+	db     *sql.DB
+	stores *Stores
+}
+
+// NewAccountHandler creates a new AccountHandler instance
+func NewAccountHandler(db *sql.DB, stores *Stores) *AccountHandler {
+	return &AccountHandler{db: db, stores: stores}
+}
+
+// Deactivate disables the account and signs it out everywhere. The account can be
+// reactivated until the retention period ends, after which it is deleted.
+func (h *AccountHandler) Deactivate(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var req DeactivateAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	if req.Password == "" {
+		return SendCustomError(c, ErrorMissingFields, "Password is required", http.StatusBadRequest)
+	}
+
+	var hashedPassword string
+	if err := h.db.QueryRow(`SELECT password FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&hashedPassword); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)) != nil {
+		return SendCustomError(c, ErrorInvalidCredentials, "Password is incorrect", http.StatusBadRequest)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE users SET is_active = false, deactivated_at = $2, updated_at = $2 WHERE id = $1`, userID, now); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET is_active = false WHERE user_id = $1 AND is_active = true`, userID); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err := recordAudit(tx, newAuditEntry(c, "account.deactivate", "user", userID)); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Account deactivated. You can reactivate it until it is permanently deleted",
+		"deactivated_at":      now.Format("02-01-2006 03:04:05 PM"),
+		"permanent_delete_at": now.Add(accountRetentionPeriod()).Format("02-01-2006 03:04:05 PM"),
+	})
+}
+
+// Reactivate restores a deactivated account that is still inside the retention period.
+// It does not sign the user in; they log in normally afterwards. Accounts suspended
+// by an administrator are refused.
+func (h *AccountHandler) Reactivate(c echo.Context) error {
+	var req ReactivateAccountRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" || req.Password == "" {
+		return SendCustomError(c, ErrorMissingFields, "Email and password are required", http.StatusBadRequest)
+	}
+
+	// Reactivation checks a password, so it shares the login lockout
+	client := clientInfoFromContext(c)
+	if wait, err := loginLockout(h.stores.Users, req.Email, client.IPAddress); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	} else if wait > 0 {
+		return sendAccountLocked(c, wait)
+	}
+
+	var userID uuid.UUID
+	var hashedPassword string
+	var suspendedAt sql.NullTime
+	err := h.db.QueryRow(
+		`SELECT id, password, suspended_at FROM users WHERE LOWER(email) = LOWER($1) AND is_active = false AND (deactivated_at > $2 OR suspended_at IS NOT NULL)`,
+		req.Email, time.Now().Add(-accountRetentionPeriod()),
+	).Scan(&userID, &hashedPassword, &suspendedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err == sql.ErrNoRows || bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)) != nil {
+		if err := recordLoginAttempt(h.stores.Users, req.Email, loginMethodPassword, client, false); err != nil {
+			log.Printf("Failed to record login attempt: %v", err)
+		}
+		return SendStandardError(c, ErrorInvalidCredentials)
+	}
+	// Only an administrator can lift a suspension
+	if suspendedAt.Valid {
+		return SendCustomError(c, ErrorForbidden, "This account was suspended by an administrator", http.StatusForbidden)
+	}
+
+	if _, err := h.db.Exec(`UPDATE users SET is_active = true, deactivated_at = NULL, updated_at = $2 WHERE id = $1 AND suspended_at IS NULL`, userID, time.Now()); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	entry := newAuditEntry(c, "account.reactivate", "user", userID)
+	entry.ActorID = userID
+	logAudit(h.stores.Audit, entry)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Account reactivated. Please login to continue",
+	})
+}
+
+// purgeDeactivatedAccounts permanently deletes accounts deactivated before the
+// retention period; suspended accounts are kept until an administrator acts. Related
+// rows go with them through ON DELETE CASCADE and their audit entries are redacted;
+// the files attached to their expenses are removed from blobs once the rows are gone.
+func purgeDeactivatedAccounts(db *sql.DB, blobs BlobStore, retention time.Duration) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const expired = `is_active = false AND deactivated_at IS NOT NULL AND deactivated_at < $1 AND suspended_at IS NULL`
+	cutoff := time.Now().Add(-retention)
+	rows, err := tx.Query(`SELECT user_id, storage_key FROM expense_attachments WHERE user_id IN (SELECT id FROM users WHERE `+expired+`)`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	keysByUser := make(map[uuid.UUID][]string)
+	for rows.Next() {
+		var userID uuid.UUID
+		var key string
+		if err := rows.Scan(&userID, &key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keysByUser[userID] = append(keysByUser[userID], key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Only remove the files of accounts actually deleted, in case one was reactivated meanwhile
+	rows, err = tx.Query(`DELETE FROM users WHERE `+expired+` RETURNING id`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	var keys []string
+	var deletedIDs []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		deleted++
+		keys = append(keys, keysByUser[userID]...)
+		deletedIDs = append(deletedIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, userID := range deletedIDs {
+		if err := redactAuditEntries(tx, userID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	removeAttachmentBlobs(blobs, keys)
+	return deleted, nil
+}
+
+// runAccountPurger purges expired accounts every ACCOUNT_PURGE_INTERVAL until ctx is done
+func runAccountPurger(ctx context.Context, db *sql.DB, blobs BlobStore) {
+	ticker := time.NewTicker(accountPurgeInterval())
+	defer ticker.Stop()
+
+	for {
+		n, err := purgeDeactivatedAccounts(db, blobs, accountRetentionPeriod())
+		if err != nil {
+			log.Printf("Account purge failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Permanently deleted %d deactivated account(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// accountRetentionPeriod returns how long a deactivated account is kept (ACCOUNT_RETENTION_PERIOD, default 720h)
+func accountRetentionPeriod() time.Duration {
+	return config().Accounts.RetentionPeriod
+}
+
+// accountPurgeInterval returns how often expired accounts are purged (ACCOUNT_PURGE_INTERVAL, default 1h)
+func accountPurgeInterval() time.Duration {
+	return config().Accounts.PurgeInterval
+}
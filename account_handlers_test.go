@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountHandler_DeactivateAndReactivate(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "leaving@example.com")
+		_, pat := createAPIToken(t, app, token, ScopeExpensesRead)
+
+		code, _ := app.do(t, http.MethodPost, "/api/profile/deactivate", token, map[string]string{"password": "wrong"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, body := app.do(t, http.MethodPost, "/api/profile/deactivate", token, map[string]string{"password": "password123"})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.NotEmpty(t, body["permanent_delete_at"])
+
+		// Every session and token stops working, and the password no longer signs in
+		code, _ = app.do(t, http.MethodGet, "/api/tokens", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = app.do(t, http.MethodGet, "/api/expenses", pat, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		credentials := map[string]string{"email": "leaving@example.com", "password": "password123"}
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", credentials)
+		assert.NotEqual(t, http.StatusOK, code)
+
+		code, body = app.do(t, http.MethodPost, "/api/account/reactivate", "", map[string]string{"email": "leaving@example.com", "password": "wrong"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidCredentials, body["error"])
+
+		// Reactivation does not sign in; a normal login follows
+		code, body = app.do(t, http.MethodPost, "/api/account/reactivate", "", map[string]string{"email": "LEAVING@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Nil(t, body["token"])
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", credentials)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, app.audit.actions, "account.reactivate")
+
+		// An active account has nothing to reactivate
+		code, _ = app.do(t, http.MethodPost, "/api/account/reactivate", "", credentials)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
+
+func TestAccountHandler_PurgeAfterRetention(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		withConfig(t, func(cfg *Config) { cfg.Accounts.RetentionPeriod = 24 * time.Hour })
+		expired, _ := app.signUp(t, "expired@example.com")
+		recent, _ := app.signUp(t, "recent@example.com")
+		active, _ := app.signUp(t, "active@example.com")
+
+		// The expired account has an expense with a receipt in blob storage
+		code, body := app.do(t, http.MethodPost, "/api/expenses", expired, map[string]interface{}{
+			"title": "Dinner", "amount": 42, "expense_date": "15-01-2024", "expense_time": "08:30 PM", "categories": []string{app.createCategory(t, expired, "Food")},
+		})
+		require.Equal(t, http.StatusCreated, code, body)
+		expenseID := body["expense"].(map[string]interface{})["id"].(string)
+		png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+		code, _ = app.upload(t, "/api/expenses/"+expenseID+"/attachments", expired, "receipt.png", png)
+		require.Equal(t, http.StatusCreated, code)
+		keys := attachmentKeys(t, app, expenseID)
+		require.Len(t, keys, 1)
+
+		for _, token := range []string{expired, recent} {
+			code, _ = app.do(t, http.MethodPost, "/api/profile/deactivate", token, map[string]string{"password": "password123"})
+			require.Equal(t, http.StatusOK, code)
+		}
+		activeID := app.userID(t, "active@example.com")
+		_, err := app.db.Exec(`UPDATE users SET deactivated_at = $2 WHERE LOWER(email) = $1`, "expired@example.com", time.Now().Add(-48*time.Hour))
+		require.NoError(t, err)
+
+		// Past the retention period the account can no longer be reactivated
+		code, _ = app.do(t, http.MethodPost, "/api/account/reactivate", "", map[string]string{"email": "expired@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		n, err := purgeDeactivatedAccounts(app.db, app.stores.Blobs, accountRetentionPeriod())
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, n)
+
+		var users int
+		require.NoError(t, app.db.QueryRow(`SELECT COUNT(*) FROM users WHERE LOWER(email) = $1`, "expired@example.com").Scan(&users))
+		assert.Zero(t, users)
+		var expenses int
+		require.NoError(t, app.db.QueryRow(`SELECT COUNT(*) FROM expenses WHERE id = $1`, expenseID).Scan(&expenses))
+		assert.Zero(t, expenses)
+		_, err = app.stores.Blobs.Get(context.Background(), keys[0])
+		assert.Error(t, err)
+
+		// The recently deactivated account is kept and can still come back; active ones are untouched
+		code, _ = app.do(t, http.MethodPost, "/api/account/reactivate", "", map[string]string{"email": "recent@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, activeID, app.userID(t, "active@example.com"))
+		code, _ = app.do(t, http.MethodGet, "/api/tokens", active, nil)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// AdminHandler handles the admin user-management API
+type AdminHandler struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(db *sql.DB, mailer Mailer) *AdminHandler {
+	return &AdminHandler{db: db, mailer: mailer}
+}
+
+// ListUsers returns a page of users. Supports ?q= (name or email), ?status=active|deactivated|suspended and ?role=.
+func (h *AdminHandler) ListUsers(c echo.Context) error {
+	page := 1
+	limit := 20
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	var where strings.Builder
+	where.WriteString("1 = 1")
+	args := []interface{}{}
+	argIndex := 1
+
+	if q := strings.TrimSpace(c.QueryParam("q")); q != "" {
+		where.WriteString(fmt.Sprintf(" AND (LOWER(name) LIKE $%d OR LOWER(email) LIKE $%d)", argIndex, argIndex))
+		args = append(args, "%"+strings.ToLower(q)+"%")
+		argIndex++
+	}
+	switch c.QueryParam("status") {
+	case "":
+	case "active":
+		where.WriteString(" AND is_active = true")
+	case "deactivated":
+		where.WriteString(" AND is_active = false")
+	case "suspended":
+		where.WriteString(" AND suspended_at IS NOT NULL")
+	default:
+		return SendCustomError(c, ErrorValidationFailed, "status must be active, deactivated or suspended", http.StatusBadRequest)
+	}
+	if role := c.QueryParam("role"); role != "" {
+		if role != RoleUser && role != RoleAdmin {
+			return SendCustomError(c, ErrorValidationFailed, "role must be user or admin", http.StatusBadRequest)
+		}
+		where.WriteString(fmt.Sprintf(" AND role = $%d", argIndex))
+		args = append(args, role)
+		argIndex++
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM users WHERE "+where.String(), args...).Scan(&total); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, name, email, role, is_active, email_verified, totp_enabled, created_at, deactivated_at, suspended_at
+		FROM users
+		WHERE %s
+		ORDER BY created_at DESC
+		LIMIT %d OFFSET %d`, where.String(), limit, (page-1)*limit)
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer rows.Close()
+
+	users := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+		users = append(users, user)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":        users,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": (total + limit - 1) / limit,
+	})
+}
+
+// GetUser returns one user with their usage counts
+func (h *AdminHandler) GetUser(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid user ID", http.StatusBadRequest)
+	}
+
+	row := h.db.QueryRow(`
+		SELECT id, name, email, role, is_active, email_verified, totp_enabled, created_at, deactivated_at, suspended_at
+		FROM users WHERE id = $1`, userID)
+	user, err := scanAdminUser(row)
+	if err == sql.ErrNoRows {
+		return SendCustomError(c, ErrorNotFound, "User not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	var expenseCount, categoryCount, activeSessions, apiTokens int
+	var lastLogin dbTime
+	err = h.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM expenses WHERE user_id = $1),
+			(SELECT COUNT(*) FROM categories WHERE user_id = $1),
+			(SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND is_active = true AND expires_at > $2),
+			(SELECT COUNT(*) FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL),
+			(SELECT MAX(login_at) FROM login_history WHERE user_id = $1 AND success = true)`,
+		userID, time.Now(),
+	).Scan(&expenseCount, &categoryCount, &activeSessions, &apiTokens, &lastLogin)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	// Totals stay in the currency the expenses were paid in
+	expenseTotals := make(map[string]Money)
+	rows, err := h.db.Query(`SELECT currency, SUM(amount_minor) FROM expenses WHERE user_id = $1 GROUP BY currency`, userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency string
+		var total Money
+		if err := rows.Scan(&currency, &total); err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+		expenseTotals[currency] = total
+	}
+	if err := rows.Err(); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	usage := map[string]interface{}{
+		"expense_count":   expenseCount,
+		"expense_totals":  expenseTotals,
+		"category_count":  categoryCount,
+		"active_sessions": activeSessions,
+		"api_tokens":      apiTokens,
+		"last_login_at":   nil,
+	}
+	if lastLogin.Valid {
+		usage["last_login_at"] = lastLogin.Time.Format("02-01-2006 03:04:05 PM")
+	}
+	user["usage"] = usage
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "User retrieved successfully",
+		"user":    user,
+	})
+}
+
+// DeactivateUser suspends an account and revokes its sessions. Unlike a self-service
+// deactivation, the user cannot reactivate a suspended account and it is never purged.
+func (h *AdminHandler) DeactivateUser(c echo.Context) error {
+	adminID := getUserIDFromContext(c)
+	return h.changeUser(c, "user.deactivate", func(tx *sql.Tx, userID uuid.UUID) (int64, error) {
+		now := time.Now()
+		result, err := tx.Exec(`UPDATE users SET is_active = false, suspended_at = $2, suspended_by = $3, updated_at = $2 WHERE id = $1 AND suspended_at IS NULL`, userID, now, adminID)
+		if err != nil {
+			return 0, err
+		}
+		if err := revokeUserAccess(tx, userID); err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}, "User deactivated successfully")
+}
+
+// ReactivateUser lifts a suspension, or restores a deactivated account that has not been purged yet
+func (h *AdminHandler) ReactivateUser(c echo.Context) error {
+	return h.changeUser(c, "user.reactivate", func(tx *sql.Tx, userID uuid.UUID) (int64, error) {
+		result, err := tx.Exec(`UPDATE users SET is_active = true, deactivated_at = NULL, suspended_at = NULL, suspended_by = NULL, updated_at = $2 WHERE id = $1 AND is_active = false`, userID, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}, "User reactivated successfully")
+}
+
+// RevokeUserSessions signs the user out of every device and revokes their personal access tokens
+func (h *AdminHandler) RevokeUserSessions(c echo.Context) error {
+	return h.changeUser(c, "user.revoke_sessions", func(tx *sql.Tx, userID uuid.UUID) (int64, error) {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil || !exists {
+			return 0, err
+		}
+		if err := revokeUserAccess(tx, userID); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}, "All sessions revoked")
+}
+
+// ForcePasswordReset replaces the password with an unusable one, signs the user
+// out everywhere, revokes their personal access tokens and emails them a reset link
+func (h *AdminHandler) ForcePasswordReset(c echo.Context) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid user ID", http.StatusBadRequest)
+	}
+
+	var name, email string
+	err = h.db.QueryRow(`SELECT name, email FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&name, &email)
+	if err == sql.ErrNoRows {
+		return SendCustomError(c, ErrorNotFound, "User not found or deactivated", http.StatusNotFound)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	random, err := generateSecureToken()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+	unusable, err := bcrypt.GenerateFromPassword([]byte(random), bcrypt.DefaultCost)
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+
+	err = h.inAdminTx(c, "user.force_password_reset", userID, nil, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE users SET password = $2, updated_at = $3 WHERE id = $1`, userID, string(unusable), time.Now()); err != nil {
+			return err
+		}
+		return revokeUserAccess(tx, userID)
+	})
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	token, err := createResetToken(h.db, userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	emailSent := true
+	if err := sendPasswordResetEmail(h.mailer, name, email, token); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+		emailSent = false
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":    "Password reset forced. The user has been signed out and must choose a new password",
+		"email_sent": emailSent,
+	})
+}
+
+// UpdateUserRole promotes or demotes a user
+func (h *AdminHandler) UpdateUserRole(c echo.Context) error {
+	var req UpdateRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	if req.Role != RoleUser && req.Role != RoleAdmin {
+		return SendCustomError(c, ErrorValidationFailed, "role must be user or admin", http.StatusBadRequest)
+	}
+
+	details := map[string]interface{}{"role": req.Role}
+	return h.changeUserWithDetails(c, "user.update_role", details, func(tx *sql.Tx, userID uuid.UUID) (int64, error) {
+		result, err := tx.Exec(`UPDATE users SET role = $2, updated_at = $3 WHERE id = $1`, userID, req.Role, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}, "Role updated successfully")
+}
+
+// revokeUserAccess ends every session of the user and revokes their personal access tokens
+func revokeUserAccess(exec sqlExecutor, userID uuid.UUID) error {
+	if _, err := exec.Exec(`UPDATE sessions SET is_active = false WHERE user_id = $1 AND is_active = true`, userID); err != nil {
+		return err
+	}
+	_, err := exec.Exec(`UPDATE api_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, userID, time.Now())
+	return err
+}
+
+// changeUser runs an audited change against the user in :id. Admins cannot target themselves,
+// so they cannot lock themselves out.
+func (h *AdminHandler) changeUser(c echo.Context, action string, apply func(*sql.Tx, uuid.UUID) (int64, error), message string) error {
+	return h.changeUserWithDetails(c, action, nil, apply, message)
+}
+
+func (h *AdminHandler) changeUserWithDetails(c echo.Context, action string, details map[string]interface{}, apply func(*sql.Tx, uuid.UUID) (int64, error), message string) error {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid user ID", http.StatusBadRequest)
+	}
+	if userID == getUserIDFromContext(c) {
+		return SendCustomError(c, ErrorForbidden, "Admins cannot perform this action on their own account", http.StatusForbidden)
+	}
+
+	var affected int64
+	err = h.inAdminTx(c, action, userID, details, func(tx *sql.Tx) error {
+		var err error
+		affected, err = apply(tx, userID)
+		if err == nil && affected == 0 {
+			return sql.ErrNoRows
+		}
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return SendCustomError(c, ErrorNotFound, "User not found or already in that state", http.StatusNotFound)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": message,
+	})
+}
+
+// inAdminTx runs fn and writes its audit entry in the same transaction
+func (h *AdminHandler) inAdminTx(c echo.Context, action string, userID uuid.UUID, details map[string]interface{}, fn func(*sql.Tx) error) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	entry := newAuditEntry(c, "admin."+action, "user", userID)
+	entry.Details = details
+	if err := recordAudit(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanAdminUser scans the user columns shared by the admin list and detail queries
+func scanAdminUser(row interface{ Scan(...interface{}) error }) (map[string]interface{}, error) {
+	var id uuid.UUID
+	var name, email, role string
+	var isActive, emailVerified, twoFactor bool
+	var createdAt time.Time
+	var deactivatedAt, suspendedAt sql.NullTime
+	if err := row.Scan(&id, &name, &email, &role, &isActive, &emailVerified, &twoFactor, &createdAt, &deactivatedAt, &suspendedAt); err != nil {
+		return nil, err
+	}
+
+	user := map[string]interface{}{
+		"id":                 id,
+		"name":               name,
+		"email":              email,
+		"role":               role,
+		"is_active":          isActive,
+		"email_verified":     emailVerified,
+		"two_factor_enabled": twoFactor,
+		"created_at":         createdAt.Format("02-01-2006 03:04:05 PM"),
+		"deactivated_at":     nil,
+		"suspended_at":       nil,
+	}
+	if deactivatedAt.Valid {
+		user["deactivated_at"] = deactivatedAt.Time.Format("02-01-2006 03:04:05 PM")
+	}
+	if suspendedAt.Valid {
+		user["suspended_at"] = suspendedAt.Time.Format("02-01-2006 03:04:05 PM")
+	}
+	return user, nil
+}
+
+// promoteConfiguredAdmins grants the admin role to the accounts listed in ADMIN_EMAILS
+func promoteConfiguredAdmins(db *sql.DB, emails []string) error {
+	for _, email := range emails {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE users SET role = $2 WHERE LOWER(email) = LOWER($1) AND role <> $2`, email, RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
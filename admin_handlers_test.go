@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signUpAdmin registers an account, grants it the admin role and returns a fresh login token
+func signUpAdmin(t *testing.T, app *testApp, email string) string {
+	t.Helper()
+	app.signUp(t, email)
+	app.setRole(t, email, RoleAdmin)
+	code, body := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": email, "password": "password123"})
+	require.Equal(t, http.StatusOK, code, body)
+	return body["token"].(string)
+}
+
+// listedEmails returns the emails on one page of the admin user list
+func listedEmails(t *testing.T, app *testApp, admin, query string) []string {
+	t.Helper()
+	code, body := app.do(t, http.MethodGet, "/api/admin/users"+query, admin, nil)
+	require.Equal(t, http.StatusOK, code, body)
+	var emails []string
+	for _, user := range body["data"].([]interface{}) {
+		emails = append(emails, user.(map[string]interface{})["email"].(string))
+	}
+	return emails
+}
+
+// auditCount counts the audit log entries for an action. Admin changes are audited
+// inside their transaction, so they bypass the recorder.
+func auditCount(t *testing.T, app *testApp, action string) int {
+	t.Helper()
+	var n int
+	require.NoError(t, app.db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action = $1`, action).Scan(&n))
+	return n
+}
+
+func TestAdminHandler_ListUsersFilters(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		admin := signUpAdmin(t, app, "admin@example.com")
+		member, _ := app.signUp(t, "alice@example.com")
+		app.signUp(t, "bob@example.com")
+		code, _ := app.do(t, http.MethodPost, "/api/admin/users/"+app.userID(t, "bob@example.com").String()+"/deactivate", admin, nil)
+		require.Equal(t, http.StatusOK, code)
+
+		assert.ElementsMatch(t, []string{"admin@example.com", "alice@example.com", "bob@example.com"}, listedEmails(t, app, admin, ""))
+		assert.Equal(t, []string{"alice@example.com"}, listedEmails(t, app, admin, "?q=ALICE"))
+		assert.ElementsMatch(t, []string{"admin@example.com", "alice@example.com"}, listedEmails(t, app, admin, "?status=active"))
+		assert.Equal(t, []string{"bob@example.com"}, listedEmails(t, app, admin, "?status=suspended"))
+		assert.Equal(t, []string{"bob@example.com"}, listedEmails(t, app, admin, "?status=deactivated"))
+		assert.Equal(t, []string{"admin@example.com"}, listedEmails(t, app, admin, "?role=admin"))
+		assert.Equal(t, []string{"alice@example.com"}, listedEmails(t, app, admin, "?role=user&status=active&q=example"))
+
+		code, body := app.do(t, http.MethodGet, "/api/admin/users?limit=1&page=2", admin, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, body["data"], 1)
+		assert.EqualValues(t, 3, body["total"])
+		assert.EqualValues(t, 3, body["total_pages"])
+
+		for _, query := range []string{"?status=gone", "?role=owner"} {
+			code, body = app.do(t, http.MethodGet, "/api/admin/users"+query, admin, nil)
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, ErrorValidationFailed, body["error"])
+		}
+
+		// Only admins may list users
+		code, _ = app.do(t, http.MethodGet, "/api/admin/users", member, nil)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+}
+
+func TestAdminHandler_ForcePasswordReset(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		admin := signUpAdmin(t, app, "admin@example.com")
+		session, _ := app.signUp(t, "reset@example.com")
+		_, pat := createAPIToken(t, app, session, ScopeExpensesRead)
+		userID := app.userID(t, "reset@example.com").String()
+
+		code, body := app.do(t, http.MethodPost, "/api/admin/users/"+userID+"/password-reset", admin, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, true, body["email_sent"])
+		assert.Equal(t, 1, auditCount(t, app, "admin.user.force_password_reset"))
+
+		// The old password, the sessions and the personal access tokens all stop working
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "reset@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = app.do(t, http.MethodGet, "/api/sessions", session, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = app.do(t, http.MethodGet, "/api/expenses", pat, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, _ = app.do(t, http.MethodPost, "/api/admin/users/"+userID+"/password-reset", session, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
+
+func TestAdminHandler_RevokeUserSessions(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		admin := signUpAdmin(t, app, "admin@example.com")
+		session, _ := app.signUp(t, "signed-in@example.com")
+		_, pat := createAPIToken(t, app, session, ScopeExpensesRead)
+		userID := app.userID(t, "signed-in@example.com").String()
+
+		code, body := app.do(t, http.MethodDelete, "/api/admin/users/"+userID+"/sessions", admin, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		code, _ = app.do(t, http.MethodGet, "/api/sessions", session, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = app.do(t, http.MethodGet, "/api/expenses", pat, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// The password still signs in
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "signed-in@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = app.do(t, http.MethodGet, "/api/admin/users/"+userID, admin, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, _ = app.do(t, http.MethodDelete, "/api/admin/users/00000000-0000-0000-0000-000000000001/sessions", admin, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestAdminHandler_UpdateUserRole(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		admin := signUpAdmin(t, app, "admin@example.com")
+		member, _ := app.signUp(t, "member@example.com")
+		userID := app.userID(t, "member@example.com").String()
+
+		code, _ := app.do(t, http.MethodGet, "/api/admin/users", member, nil)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, body := app.do(t, http.MethodPut, "/api/admin/users/"+userID+"/role", admin, map[string]string{"role": "owner"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorValidationFailed, body["error"])
+
+		// The role is read on every request, so the existing session gains and loses access
+		code, _ = app.do(t, http.MethodPut, "/api/admin/users/"+userID+"/role", admin, map[string]string{"role": RoleAdmin})
+		require.Equal(t, http.StatusOK, code)
+		code, _ = app.do(t, http.MethodGet, "/api/admin/users", member, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = app.do(t, http.MethodPut, "/api/admin/users/"+userID+"/role", admin, map[string]string{"role": RoleUser})
+		require.Equal(t, http.StatusOK, code)
+		code, _ = app.do(t, http.MethodGet, "/api/admin/users", member, nil)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, 2, auditCount(t, app, "admin.user.update_role"))
+	})
+}
+
+func TestAdminHandler_CannotTargetSelf(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		admin := signUpAdmin(t, app, "admin@example.com")
+		self := "/api/admin/users/" + app.userID(t, "admin@example.com").String()
+
+		requests := []struct {
+			method, path string
+			body         interface{}
+		}{
+			{http.MethodPost, self + "/deactivate", nil},
+			{http.MethodPost, self + "/reactivate", nil},
+			{http.MethodDelete, self + "/sessions", nil},
+			{http.MethodPut, self + "/role", map[string]string{"role": RoleUser}},
+		}
+		for _, req := range requests {
+			code, body := app.do(t, req.method, req.path, admin, req.body)
+			assert.Equal(t, http.StatusForbidden, code, req.path)
+			assert.Equal(t, ErrorForbidden, body["error"], req.path)
+		}
+
+		// Still an active admin
+		code, _ := app.do(t, http.MethodGet, "/api/admin/users", admin, nil)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
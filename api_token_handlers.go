@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// apiTokenPrefix marks personal access tokens so they are never mistaken for session JWTs
+const apiTokenPrefix = "etk_"
+
+// Scopes that can be granted to personal access tokens
+const (
+	ScopeExpensesRead    = "expenses:read"
+	ScopeExpensesWrite   = "expenses:write"
+	ScopeCategoriesRead  = "categories:read"
+	ScopeCategoriesWrite = "categories:write"
+)
+
+var validAPITokenScopes = map[string]bool{
+	ScopeExpensesRead:    true,
+	ScopeExpensesWrite:   true,
+	ScopeCategoriesRead:  true,
+	ScopeCategoriesWrite: true,
+}
+
+// APITokenHandler handles creating, listing and revoking personal access tokens
+type APITokenHandler struct {
+	tokens APITokenStore
+}
+
+// NewAPITokenHandler creates a new APITokenHandler instance
+func NewAPITokenHandler(tokens APITokenStore) *APITokenHandler {
+	return &APITokenHandler{tokens: tokens}
+}
+
+// GetTokens lists the user's personal access tokens (never the token values)
+func (h *APITokenHandler) GetTokens(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	list, err := h.tokens.ListAPITokens(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	tokens := make([]map[string]interface{}, 0, len(list))
+	for _, t := range list {
+		token := map[string]interface{}{
+			"id":           t.ID,
+			"name":         t.Name,
+			"scopes":       t.Scopes,
+			"created_at":   t.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+			"last_used_at": nil,
+			"expires_at":   nil,
+		}
+		if t.LastUsedAt != nil {
+			token["last_used_at"] = t.LastUsedAt.Format("02-01-2006 03:04:05 PM")
+		}
+		if t.ExpiresAt != nil {
+			token["expires_at"] = t.ExpiresAt.Format("02-01-2006 03:04:05 PM")
+		}
+		tokens = append(tokens, token)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "API tokens retrieved successfully",
+		"count":   len(tokens),
+		"tokens":  tokens,
+	})
+}
+
+// CreateToken issues a new personal access token; its value is only returned here
+func (h *APITokenHandler) CreateToken(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var req CreateAPITokenRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return SendCustomError(c, ErrorValidationFailed, "Name is required (max 100 characters)", http.StatusBadRequest)
+	}
+	if len(req.Scopes) == 0 {
+		return SendCustomError(c, ErrorValidationFailed, "At least one scope is required", http.StatusBadRequest)
+	}
+	scopeSet := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !validAPITokenScopes[scope] {
+			return SendCustomError(c, ErrorValidationFailed, "Unknown scope: "+scope, http.StatusBadRequest)
+		}
+		scopeSet[scope] = true
+	}
+	scopes := make([]string, 0, len(scopeSet))
+	for scope := range scopeSet {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	if req.ExpiresInDays < 0 {
+		return SendCustomError(c, ErrorValidationFailed, "expires_in_days cannot be negative", http.StatusBadRequest)
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+	token := apiTokenPrefix + secret
+
+	record := &APIToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := h.tokens.CreateAPIToken(record); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":  "API token created. Copy it now, it will not be shown again",
+		"token_id": record.ID,
+		"name":     req.Name,
+		"scopes":   scopes,
+		"token":    token,
+	})
+}
+
+// RevokeToken permanently disables one of the user's personal access tokens
+func (h *APITokenHandler) RevokeToken(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid token ID", http.StatusBadRequest)
+	}
+
+	err = h.tokens.RevokeAPIToken(userID, tokenID)
+	if errors.Is(err, errNotFound) {
+		return SendCustomError(c, ErrorNotFound, "API token not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "API token revoked successfully",
+	})
+}
+
+// splitScopes parses the comma-separated scopes column
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createAPIToken creates a personal access token and returns its ID and value
+func createAPIToken(t *testing.T, app *testApp, session string, scopes ...string) (string, string) {
+	t.Helper()
+	code, body := app.do(t, http.MethodPost, "/api/tokens", session, map[string]interface{}{"name": "script", "scopes": scopes})
+	require.Equal(t, http.StatusCreated, code, body)
+	return body["token_id"].(string), body["token"].(string)
+}
+
+func TestAPITokenHandler_ScopesAreEnforced(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		session, _ := app.signUp(t, "pat@example.com")
+		_, readOnly := createAPIToken(t, app, session, ScopeExpensesRead)
+		assert.True(t, strings.HasPrefix(readOnly, apiTokenPrefix))
+
+		code, _ := app.do(t, http.MethodGet, "/api/expenses", readOnly, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		expense := map[string]interface{}{"title": "Coffee", "amount": "3.50", "expense_date": "15-01-2024", "expense_time": "09:00 AM"}
+		code, body := app.do(t, http.MethodPost, "/api/expenses", readOnly, expense)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, ErrorInsufficientScope, body["error"])
+
+		// A personal access token cannot manage tokens or reach session-only routes
+		code, _ = app.do(t, http.MethodGet, "/api/tokens", readOnly, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = app.do(t, http.MethodPost, "/api/tokens", readOnly, map[string]interface{}{"name": "escalate", "scopes": []string{ScopeExpensesWrite}})
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// Session tokens carry every scope
+		code, _ = app.do(t, http.MethodGet, "/api/expenses", session, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, body = app.do(t, http.MethodPost, "/api/tokens", session, map[string]interface{}{"name": "bad", "scopes": []string{"admin"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorValidationFailed, body["error"])
+	})
+}
+
+func TestAPITokenHandler_RevokedAndExpiredTokens(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		session, _ := app.signUp(t, "revoke@example.com")
+		other, _ := app.signUp(t, "other@example.com")
+		tokenID, token := createAPIToken(t, app, session, ScopeExpensesRead)
+
+		// Only the owner can revoke a token
+		code, _ := app.do(t, http.MethodDelete, "/api/tokens/"+tokenID, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = app.do(t, http.MethodGet, "/api/expenses", token, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = app.do(t, http.MethodDelete, "/api/tokens/"+tokenID, session, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, body := app.do(t, http.MethodGet, "/api/expenses", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidToken, body["error"])
+
+		_, expiring := createAPIToken(t, app, session, ScopeExpensesRead)
+		_, err := app.db.Exec(`UPDATE api_tokens SET expires_at = $2 WHERE token_hash = $1`, hashToken(expiring), time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		code, _ = app.do(t, http.MethodGet, "/api/expenses", expiring, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// attachmentTypes are the file types accepted as attachments, as detected from the content
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"image/heic":      true,
+	"application/pdf": true,
+}
+
+// AttachmentHandler manages the files, such as receipts, attached to expenses
+type AttachmentHandler struct {
+	stores *Stores
+}
+
+// NewAttachmentHandler creates a new AttachmentHandler instance
+func NewAttachmentHandler(stores *Stores) *AttachmentHandler {
+	return &AttachmentHandler{stores: stores}
+}
+
+// UploadAttachment attaches the file sent as the "file" form field to the expense. The
+// type is detected from the content, whatever the client claims it is.
+func (h *AttachmentHandler) UploadAttachment(c echo.Context) error {
+	expenseID, err := h.ownedExpense(c)
+	if err != nil || expenseID == uuid.Nil {
+		return err
+	}
+
+	existing, err := h.stores.Attachments.ListAttachments(expenseID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if len(existing) >= config().Attachments.MaxPerExpense {
+		return SendCustomError(c, ErrorValidationFailed,
+			fmt.Sprintf("An expense can have at most %d attachments", config().Attachments.MaxPerExpense), http.StatusBadRequest)
+	}
+
+	data, filename, err := readAttachmentUpload(c)
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, errAttachmentTooLarge) || errors.As(err, &tooLarge) {
+		return SendCustomError(c, ErrorFileTooLarge,
+			fmt.Sprintf("Attachments can be at most %s", formatBytes(config().Attachments.MaxSize)), http.StatusRequestEntityTooLarge)
+	}
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Upload the file as the \"file\" form field", http.StatusBadRequest)
+	}
+	contentType := detectAttachmentType(data)
+	if !attachmentTypes[contentType] {
+		return SendCustomError(c, ErrorUnsupportedMediaType, "Attachments must be JPEG, PNG, WebP or HEIC images or PDF documents", http.StatusUnsupportedMediaType)
+	}
+
+	sum := sha256.Sum256(data)
+	userID := getUserIDFromContext(c)
+	attachment := &Attachment{
+		ID:          uuid.New(),
+		ExpenseID:   expenseID,
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now(),
+	}
+	attachment.StorageKey = path.Join(userID.String(), expenseID.String(), attachment.ID.String())
+
+	ctx := c.Request().Context()
+	if err := h.stores.Blobs.Put(ctx, attachment.StorageKey, data, contentType); err != nil {
+		log.Printf("Failed to store attachment %s: %v", attachment.ID, err)
+		return SendCustomError(c, ErrorInternalServer, "Failed to store attachment", http.StatusInternalServerError)
+	}
+	if err := h.stores.Attachments.CreateAttachment(attachment); err != nil {
+		removeAttachmentBlobs(h.stores.Blobs, []string{attachment.StorageKey})
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	entry := newAuditEntry(c, "attachment.create", "attachment", attachment.ID)
+	entry.After = attachmentView(attachment)
+	logAudit(h.stores.Audit, entry)
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message":    "Attachment uploaded successfully",
+		"attachment": attachmentView(attachment),
+	})
+}
+
+// GetAttachments lists the expense's attachments, oldest first
+func (h *AttachmentHandler) GetAttachments(c echo.Context) error {
+	expenseID, err := h.ownedExpense(c)
+	if err != nil || expenseID == uuid.Nil {
+		return err
+	}
+
+	attachments, err := h.stores.Attachments.ListAttachments(expenseID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	views := make([]map[string]interface{}, 0, len(attachments))
+	for i := range attachments {
+		views = append(views, attachmentView(&attachments[i]))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":     "Attachments retrieved successfully",
+		"count":       len(views),
+		"attachments": views,
+	})
+}
+
+// DownloadAttachment sends the file. It is always offered as a download so that a
+// browser never renders an uploaded document on the API's origin.
+func (h *AttachmentHandler) DownloadAttachment(c echo.Context) error {
+	attachment, err := h.loadOwned(c)
+	if err != nil || attachment == nil {
+		return err
+	}
+
+	content, err := h.stores.Blobs.Get(c.Request().Context(), attachment.StorageKey)
+	if errors.Is(err, errBlobNotFound) {
+		return SendCustomError(c, ErrorNotFound, "Attachment content not found", http.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to read attachment %s: %v", attachment.ID, err)
+		return SendCustomError(c, ErrorInternalServer, "Failed to read attachment", http.StatusInternalServerError)
+	}
+	defer content.Close()
+
+	header := c.Response().Header()
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	header.Set(echo.HeaderContentDisposition, disposition)
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(attachment.Size, 10))
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set("ETag", `"`+attachment.SHA256+`"`)
+	header.Set("Cache-Control", "private")
+	return c.Stream(http.StatusOK, attachment.ContentType, content)
+}
+
+// DeleteAttachment removes the attachment and its stored file
+func (h *AttachmentHandler) DeleteAttachment(c echo.Context) error {
+	attachment, err := h.loadOwned(c)
+	if err != nil || attachment == nil {
+		return err
+	}
+
+	if err := h.stores.Attachments.DeleteAttachment(attachment.ID); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	removeAttachmentBlobs(h.stores.Blobs, []string{attachment.StorageKey})
+
+	entry := newAuditEntry(c, "attachment.delete", "attachment", attachment.ID)
+	entry.Before = attachmentView(attachment)
+	logAudit(h.stores.Audit, entry)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// ownedExpense returns the expense named by the :id parameter. When it does not exist
+// or belongs to someone else the error response has been sent and the ID is uuid.Nil.
+func (h *AttachmentHandler) ownedExpense(c echo.Context) (uuid.UUID, error) {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return uuid.Nil, SendStandardError(c, ErrorUnauthorized)
+	}
+	expenseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, SendCustomError(c, ErrorValidationFailed, "Invalid expense ID", http.StatusBadRequest)
+	}
+	owned, err := h.stores.Expenses.ExpenseBelongsTo(expenseID, userID)
+	if err != nil {
+		return uuid.Nil, SendStandardError(c, ErrorDatabaseError)
+	}
+	if !owned {
+		return uuid.Nil, SendCustomError(c, ErrorNotFound, "Expense not found", http.StatusNotFound)
+	}
+	return expenseID, nil
+}
+
+// loadOwned returns the attachment named by the :attachment_id parameter on the user's
+// expense. When there is none the error response has been sent and both are nil.
+func (h *AttachmentHandler) loadOwned(c echo.Context) (*Attachment, error) {
+	expenseID, err := h.ownedExpense(c)
+	if err != nil || expenseID == uuid.Nil {
+		return nil, err
+	}
+	id, err := uuid.Parse(c.Param("attachment_id"))
+	if err != nil {
+		return nil, SendCustomError(c, ErrorValidationFailed, "Invalid attachment ID", http.StatusBadRequest)
+	}
+	attachment, err := h.stores.Attachments.GetAttachment(expenseID, id)
+	if errors.Is(err, errNotFound) {
+		return nil, SendCustomError(c, ErrorNotFound, "Attachment not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, SendStandardError(c, ErrorDatabaseError)
+	}
+	return attachment, nil
+}
+
+var errAttachmentTooLarge = errors.New("attachment too large")
+
+// readAttachmentUpload reads the "file" form field and its cleaned-up name. The request
+// body is capped so an oversized upload is refused without being read in full.
+func readAttachmentUpload(c echo.Context) ([]byte, string, error) {
+	maxSize := int64(config().Attachments.MaxSize)
+	// Leave room for the multipart boundaries and headers around the file
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxSize+1<<20)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	if file.Size > maxSize {
+		return nil, "", errAttachmentTooLarge
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, "", errAttachmentTooLarge
+	}
+	if len(data) == 0 {
+		return nil, "", errors.New("empty upload")
+	}
+	return data, cleanAttachmentName(file.Filename), nil
+}
+
+// detectAttachmentType sniffs the content type from the first bytes of the file
+func detectAttachmentType(data []byte) string {
+	// http.DetectContentType does not know HEIC, the format iPhone cameras save
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch string(data[8:12]) {
+		case "heic", "heix", "heim", "heis", "mif1":
+			return "image/heic"
+		}
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return contentType
+}
+
+// cleanAttachmentName keeps the base name of an uploaded file, without control
+// characters, shortened to 255 bytes
+func cleanAttachmentName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name))
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// formatBytes writes a size limit the way people read it, e.g. 10 MB
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%d KB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// removeAttachmentBlobs deletes stored files whose attachment rows are already gone. A
+// failure is only logged: it leaves an unreferenced file behind, not a broken attachment.
+func removeAttachmentBlobs(blobs BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete attachment file %s: %v", key, err)
+		}
+	}
+}
+
+// attachmentView formats an attachment for responses and audit snapshots
+func attachmentView(a *Attachment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           a.ID,
+		"expense_id":   a.ExpenseID,
+		"filename":     a.Filename,
+		"content_type": a.ContentType,
+		"size":         a.Size,
+		"sha256":       a.SHA256,
+		"download_url": "/api/expenses/" + a.ExpenseID.String() + "/attachments/" + a.ID.String(),
+		"created_at":   a.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// auditEntry is one row of the audit trail. Before and After are JSON snapshots
+// of the entity around the change; either is nil for creates and deletes.
+type auditEntry struct {
+	ActorID    uuid.UUID
+	Action     string
+	EntityType string
+	EntityID   uuid.UUID
+	Before     interface{}
+	After      interface{}
+	Details    map[string]interface{}
+	IPAddress  string
+	RequestID  string
+}
+
+// newAuditEntry starts an entry for the current request: the authenticated user,
+// their IP and the X-Request-ID assigned by the request ID middleware
+func newAuditEntry(c echo.Context, action, entityType string, entityID uuid.UUID) auditEntry {
+	return auditEntry{
+		ActorID:    getUserIDFromContext(c),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IPAddress:  c.RealIP(),
+		RequestID:  c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+}
+
+// setBefore and setAfter attach a snapshot taken with expenseSnapshot or profileSnapshot.
+// A snapshot that could not be taken is logged and marked in Details, so the entry
+// shows the change without claiming what the entity looked like.
+func (e *auditEntry) setBefore(snapshot map[string]interface{}, err error) {
+	e.Before = e.snapshot("before", snapshot, err)
+}
+
+func (e *auditEntry) setAfter(snapshot map[string]interface{}, err error) {
+	e.After = e.snapshot("after", snapshot, err)
+}
+
+func (e *auditEntry) snapshot(side string, snapshot map[string]interface{}, err error) interface{} {
+	if err == nil {
+		return snapshot
+	}
+	log.Printf("AUDIT: %s snapshot of %s %s for %s failed: %v", side, e.EntityType, e.EntityID, e.Action, err)
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[side+"_snapshot_error"] = err.Error()
+	return nil
+}
+
+// recordAudit appends an entry to the audit trail. Pass the transaction making
+// the change so the entry is only kept when the change is.
+func recordAudit(exec sqlExecutor, entry auditEntry) error {
+	before, err := auditJSON(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(entry.After)
+	if err != nil {
+		return err
+	}
+	details, err := auditJSON(entry.Details)
+	if err != nil {
+		return err
+	}
+
+	var actorID interface{}
+	if entry.ActorID != uuid.Nil {
+		actorID = entry.ActorID
+	}
+
+	_, err = exec.Exec(
+		`INSERT INTO audit_log (id, actor_id, action, entity_type, entity_id, before_data, after_data, details, ip_address, request_id, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		uuid.New(), actorID, entry.Action, entry.EntityType, entry.EntityID, before, after, details, entry.IPAddress, entry.RequestID, time.Now(),
+	)
+	return err
+}
+
+// logAudit records an entry for a change that has already been committed.
+// A failure is logged with the AUDIT prefix rather than undoing the user's change.
+func logAudit(audit AuditStore, entry auditEntry) {
+	if err := audit.RecordAudit(entry); err != nil {
+		log.Printf("AUDIT: failed to write entry %s %s: %v", entry.Action, entry.EntityID, err)
+	}
+}
+
+// redactAuditEntries blanks the personal data kept in the audit entries about a purged
+// account: snapshots and details of everything the user did or that was done to their
+// account, and the IP addresses the user acted from. Actor, action, entity and time stay.
+func redactAuditEntries(exec sqlExecutor, userID uuid.UUID) error {
+	_, err := exec.Exec(`
+		UPDATE audit_log
+		SET before_data = NULL, after_data = NULL, details = NULL,
+			ip_address = CASE WHEN actor_id = $1 THEN NULL ELSE ip_address END,
+			redacted_at = $2
+		WHERE (actor_id = $1 OR (entity_type = 'user' AND entity_id = $1)) AND redacted_at IS NULL`,
+		userID, time.Now(),
+	)
+	return err
+}
+
+// auditJSON encodes a snapshot as text; lib/pq would send []byte as bytea, which JSONB rejects
+func auditJSON(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if m, ok := v.(map[string]interface{}); ok && m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// expenseSnapshot captures an expense and its category links for the audit trail
+func expenseSnapshot(expenses ExpenseStore, expenseID uuid.UUID) (map[string]interface{}, error) {
+	expense, err := expenses.GetExpense(expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs := make([]uuid.UUID, 0, len(expense.Categories))
+	shares := make(map[string]Money, len(expense.Categories))
+	for _, cat := range expense.Categories {
+		categoryIDs = append(categoryIDs, cat.ID)
+		shares[cat.ID.String()] = cat.Amount
+	}
+	sort.Slice(categoryIDs, func(i, j int) bool { return categoryIDs[i].String() < categoryIDs[j].String() })
+
+	return map[string]interface{}{
+		"id":              expenseID,
+		"title":           expense.Title,
+		"description":     expense.Description,
+		"amount":          expense.Amount,
+		"currency":        expense.Currency,
+		"expense_date":    expense.ExpenseDate.Format("2006-01-02"),
+		"expense_time":    expense.ExpenseTime.Format("15:04:05"),
+		"categories":      categoryIDs,
+		"category_shares": shares,
+	}, nil
+}
+
+// profileSnapshot captures the editable profile fields; secrets are never included
+func profileSnapshot(users UserStore, userID uuid.UUID) (map[string]interface{}, error) {
+	user, err := users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"id":            userID,
+		"name":          user.Name,
+		"email":         user.Email,
+		"profile_image": user.ProfileImage,
+		"home_currency": user.HomeCurrency,
+	}, nil
+}
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	users UserStore
+	audit AuditStore
+}
+
+// NewAuditHandler creates a new AuditHandler instance
+func NewAuditHandler(users UserStore, audit AuditStore) *AuditHandler {
+	return &AuditHandler{users: users, audit: audit}
+}
+
+// GetAuditLog returns a page of audit events, newest first. Users see the events
+// they performed; admins see everyone's and may filter by actor_id.
+// Filters: entity_type, entity_id, action, actor_id, start_date and end_date (DD-MM-YYYY).
+func (h *AuditHandler) GetAuditLog(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	user, err := h.users.GetUser(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	page := 1
+	limit := 50
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 200 {
+			limit = l
+		}
+	}
+
+	filter := AuditFilter{
+		EntityType: c.QueryParam("entity_type"),
+		Action:     c.QueryParam("action"),
+		Limit:      limit,
+		Offset:     (page - 1) * limit,
+	}
+	if user.Role == RoleAdmin {
+		if actor := c.QueryParam("actor_id"); actor != "" {
+			actorID, err := uuid.Parse(actor)
+			if err != nil {
+				return SendCustomError(c, ErrorValidationFailed, "Invalid actor_id", http.StatusBadRequest)
+			}
+			filter.ActorID = actorID
+		}
+	} else {
+		filter.ActorID = userID
+	}
+	if entity := c.QueryParam("entity_id"); entity != "" {
+		entityID, err := uuid.Parse(entity)
+		if err != nil {
+			return SendCustomError(c, ErrorValidationFailed, "Invalid entity_id", http.StatusBadRequest)
+		}
+		filter.EntityID = entityID
+	}
+	if start := c.QueryParam("start_date"); start != "" {
+		startDate, err := time.Parse("02-01-2006", start)
+		if err != nil {
+			return SendCustomError(c, ErrorValidationFailed, "Invalid start_date format. Use DD-MM-YYYY", http.StatusBadRequest)
+		}
+		filter.From = startDate
+	}
+	if end := c.QueryParam("end_date"); end != "" {
+		endDate, err := time.Parse("02-01-2006", end)
+		if err != nil {
+			return SendCustomError(c, ErrorValidationFailed, "Invalid end_date format. Use DD-MM-YYYY", http.StatusBadRequest)
+		}
+		filter.To = endDate.AddDate(0, 0, 1)
+	}
+
+	list, total, err := h.audit.ListAudit(filter)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	events := make([]map[string]interface{}, 0, len(list))
+	for _, e := range list {
+		event := map[string]interface{}{
+			"id":          e.ID,
+			"actor_id":    nil,
+			"action":      e.Action,
+			"entity_type": e.EntityType,
+			"entity_id":   nil,
+			"before":      e.Before,
+			"after":       e.After,
+			"details":     e.Details,
+			"ip_address":  e.IPAddress,
+			"request_id":  e.RequestID,
+			"created_at":  e.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+			"redacted_at": nil,
+		}
+		if e.ActorID != uuid.Nil {
+			event["actor_id"] = e.ActorID
+		}
+		if e.EntityID != uuid.Nil {
+			event["entity_id"] = e.EntityID
+		}
+		if e.RedactedAt != nil {
+			event["redacted_at"] = e.RedactedAt.Format("02-01-2006 03:04:05 PM")
+		}
+		events = append(events, event)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":        events,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": (total + limit - 1) / limit,
+	})
+}
+
+// rawJSON passes a stored JSON column through to the response unchanged
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return nil
+	}
+	return json.RawMessage(s.String)
+}
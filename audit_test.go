@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditPage fetches /api/audit with the given query and returns the response
+func auditPage(t *testing.T, app *testApp, token string, query url.Values) map[string]interface{} {
+	t.Helper()
+	code, body := app.do(t, http.MethodGet, "/api/audit?"+query.Encode(), token, nil)
+	require.Equal(t, http.StatusOK, code, body)
+	return body
+}
+
+// auditEvents returns the events of one page
+func auditEvents(t *testing.T, app *testApp, token string, query url.Values) []map[string]interface{} {
+	t.Helper()
+	var events []map[string]interface{}
+	for _, e := range auditPage(t, app, token, query)["data"].([]interface{}) {
+		events = append(events, e.(map[string]interface{}))
+	}
+	return events
+}
+
+// auditActors returns the distinct actor IDs on one page
+func auditActors(t *testing.T, app *testApp, token string, query url.Values) []string {
+	t.Helper()
+	seen := map[string]bool{}
+	var actors []string
+	for _, e := range auditEvents(t, app, token, query) {
+		actor, _ := e["actor_id"].(string)
+		if !seen[actor] {
+			seen[actor] = true
+			actors = append(actors, actor)
+		}
+	}
+	return actors
+}
+
+func TestAuditHandler_MembersOnlySeeTheirOwnEvents(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		alice, _ := app.signUp(t, "alice@example.com")
+		bob, _ := app.signUp(t, "bob@example.com")
+		app.createCategory(t, alice, "Food")
+		app.createCategory(t, bob, "Travel")
+		admin, _ := app.signUp(t, "admin@example.com")
+		app.setRole(t, "admin@example.com", RoleAdmin)
+		aliceID, bobID := app.userID(t, "alice@example.com").String(), app.userID(t, "bob@example.com").String()
+
+		assert.Equal(t, []string{aliceID}, auditActors(t, app, alice, nil))
+		// A member cannot read someone else's trail by naming them
+		assert.Equal(t, []string{aliceID}, auditActors(t, app, alice, url.Values{"actor_id": {bobID}}))
+
+		assert.Equal(t, []string{bobID}, auditActors(t, app, admin, url.Values{"actor_id": {bobID}}))
+		assert.Subset(t, auditActors(t, app, admin, nil), []string{aliceID, bobID})
+
+		code, body := app.do(t, http.MethodGet, "/api/audit?actor_id=nope", admin, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorValidationFailed, body["error"])
+	})
+}
+
+func TestAuditHandler_Filters(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "filters@example.com")
+		food := app.createCategory(t, token, "Food")
+		app.createCategory(t, token, "Travel")
+
+		events := auditEvents(t, app, token, url.Values{"entity_type": {"category"}})
+		assert.Len(t, events, 2)
+		for _, e := range events {
+			assert.Equal(t, "category.create", e["action"])
+		}
+
+		events = auditEvents(t, app, token, url.Values{"entity_id": {food}})
+		require.Len(t, events, 1)
+		assert.Equal(t, food, events[0]["entity_id"])
+
+		// Dates are whole days; the end date is inclusive
+		yesterday := time.Now().AddDate(0, 0, -1).Format("02-01-2006")
+		tomorrow := time.Now().AddDate(0, 0, 1).Format("02-01-2006")
+		assert.Len(t, auditEvents(t, app, token, url.Values{"start_date": {yesterday}, "end_date": {tomorrow}}), 3)
+		assert.Empty(t, auditEvents(t, app, token, url.Values{"start_date": {tomorrow}}))
+		assert.Empty(t, auditEvents(t, app, token, url.Values{"end_date": {yesterday}}))
+
+		for _, query := range []string{"entity_id=nope", "start_date=2024-01-15", "end_date=15/01/2024"} {
+			code, body := app.do(t, http.MethodGet, "/api/audit?"+query, token, nil)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+			assert.Equal(t, ErrorValidationFailed, body["error"], query)
+		}
+	})
+}
+
+func TestAuditHandler_Pagination(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "pages@example.com")
+		var categories []string
+		for _, name := range []string{"Food", "Travel", "Bills", "Rent"} {
+			categories = append(categories, app.createCategory(t, token, name))
+		}
+
+		// One login and four categories, newest first
+		body := auditPage(t, app, token, url.Values{"limit": {"2"}})
+		assert.EqualValues(t, 1, body["page"])
+		assert.EqualValues(t, 2, body["limit"])
+		assert.EqualValues(t, 5, body["total"])
+		assert.EqualValues(t, 3, body["total_pages"])
+		events := auditEvents(t, app, token, url.Values{"limit": {"2"}})
+		require.Len(t, events, 2)
+		assert.Equal(t, categories[3], events[0]["entity_id"])
+		assert.Equal(t, categories[2], events[1]["entity_id"])
+
+		events = auditEvents(t, app, token, url.Values{"limit": {"2"}, "page": {"3"}})
+		require.Len(t, events, 1)
+		assert.Equal(t, "auth.login", events[0]["action"])
+		assert.Empty(t, auditEvents(t, app, token, url.Values{"limit": {"2"}, "page": {"4"}}))
+
+		// Out of range values fall back to the defaults
+		body = auditPage(t, app, token, url.Values{"limit": {"500"}, "page": {"0"}})
+		assert.EqualValues(t, 1, body["page"])
+		assert.EqualValues(t, 50, body["limit"])
+	})
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"net/http"
 	"strings"
 	"time"
@@ -12,12 +11,12 @@ import (
 
 // CategoryHandler handles category-related requests
 type CategoryHandler struct {
-	db *sql.DB
+	stores *Stores
 }
 
 // NewCategoryHandler creates a new CategoryHandler instance
-func NewCategoryHandler(db *sql.DB) *CategoryHandler {
-	return &CategoryHandler{db: db}
+func NewCategoryHandler(stores *Stores) *CategoryHandler {
+	return &CategoryHandler{stores: stores}
 }
 
 // GetCategories handles getting all available categories for dropdown
@@ -27,7 +26,7 @@ func (h *CategoryHandler) GetCategories(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
 	}
 
-	categories, err := h.getAllCategories(userID)
+	categories, err := h.stores.Categories.ListCategories(userID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch categories"})
 	}
@@ -49,45 +48,6 @@ func (h *CategoryHandler) GetCategories(c echo.Context) error {
 	})
 }
 
-// getAllCategories gets all categories (default + user-specific)
-func (h *CategoryHandler) getAllCategories(userID uuid.UUID) ([]Category, error) {
-	query := `
-		SELECT id, name, user_id, is_default, created_at, updated_at 
-		FROM categories 
-		WHERE user_id = $1 
-		ORDER BY is_default DESC, name ASC
-	`
-
-	rows, err := h.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var categories []Category
-	for rows.Next() {
-		var category Category
-		var userIDPtr *uuid.UUID
-
-		err := rows.Scan(
-			&category.ID, &category.Name, &userIDPtr, &category.IsDefault,
-			&category.CreatedAt, &category.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		// Handle NULL user_id for default categories
-		if userIDPtr != nil {
-			category.UserID = *userIDPtr
-		}
-
-		categories = append(categories, category)
-	}
-
-	return categories, nil
-}
-
 // CreateCategory handles creating a new custom category
 func (h *CategoryHandler) CreateCategory(c echo.Context) error {
 	userID := getUserIDFromContext(c)
@@ -106,22 +66,22 @@ func (h *CategoryHandler) CreateCategory(c echo.Context) error {
 	}
 
 	// Check if category already exists for this user
-	if h.categoryExists(userID, req.Name) {
+	if taken, err := h.stores.Categories.CategoryNameTaken(userID, req.Name, uuid.Nil); err == nil && taken {
 		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Category already exists"})
 	}
 
 	// Create new category with requested flag
 	categoryID := uuid.New()
 	now := time.Now()
-	_, err := h.db.Exec(
-		`INSERT INTO categories (id, name, user_id, is_default, created_at, updated_at)
-         VALUES ($1,$2,$3,$4,$5,$6)`,
-		categoryID, req.Name, userID, req.IsDefault, now, now,
-	)
-	if err != nil {
+	category := Category{ID: categoryID, Name: req.Name, UserID: userID, IsDefault: req.IsDefault, CreatedAt: now, UpdatedAt: now}
+	if err := h.stores.Categories.CreateCategory(&category); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create category"})
 	}
 
+	entry := newAuditEntry(c, "category.create", "category", categoryID)
+	entry.After = category
+	logAudit(h.stores.Audit, entry)
+
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"message":     "Category created successfully",
 		"category_id": categoryID,
@@ -130,26 +90,6 @@ func (h *CategoryHandler) CreateCategory(c echo.Context) error {
 	})
 }
 
-// categoryExists checks if a category name already exists for the user
-func (h *CategoryHandler) categoryExists(userID uuid.UUID, name string) bool {
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM categories WHERE LOWER(name) = LOWER($1) AND (user_id = $2 OR is_default = true))`
-	err := h.db.QueryRow(query, name, userID).Scan(&exists)
-	return err == nil && exists
-}
-
-// createCategory creates a new user-specific category
-func (h *CategoryHandler) createCategory(id, userID uuid.UUID, name string) error { // legacy wrapper
-	return h.createCategoryWithFlag(id, userID, name, false)
-}
-
-func (h *CategoryHandler) createCategoryWithFlag(id, userID uuid.UUID, name string, isDefault bool) error {
-	query := `INSERT INTO categories (id, name, user_id, is_default, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`
-	now := time.Now()
-	_, err := h.db.Exec(query, id, name, userID, isDefault, now, now)
-	return err
-}
-
 // UpdateCategory allows updating name and (for user-owned) is_default
 func (h *CategoryHandler) UpdateCategory(c echo.Context) error {
 	userID := getUserIDFromContext(c)
@@ -172,12 +112,8 @@ func (h *CategoryHandler) UpdateCategory(c echo.Context) error {
 	}
 
 	// Load existing
-	var existing Category
-	err = h.db.QueryRow(
-		`SELECT id, name, user_id, is_default, created_at, updated_at FROM categories WHERE id = $1`,
-		catID,
-	).Scan(&existing.ID, &existing.Name, &existing.UserID, &existing.IsDefault, &existing.CreatedAt, &existing.UpdatedAt)
-	if err == sql.ErrNoRows {
+	existing, err := h.stores.Categories.GetCategory(catID)
+	if err == errNotFound {
 		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "Category not found"})
 	}
 	if err != nil {
@@ -190,16 +126,7 @@ func (h *CategoryHandler) UpdateCategory(c echo.Context) error {
 	}
 
 	// Duplicate name check
-	var conflict bool
-	err = h.db.QueryRow(
-		`SELECT EXISTS(
-            SELECT 1 FROM categories
-            WHERE LOWER(name)=LOWER($1)
-              AND id <> $2
-              AND (user_id = $3 OR is_default = true)
-        )`,
-		req.Name, catID, userID,
-	).Scan(&conflict)
+	conflict, err := h.stores.Categories.CategoryNameTaken(userID, req.Name, catID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Validation failed"})
 	}
@@ -212,14 +139,18 @@ func (h *CategoryHandler) UpdateCategory(c echo.Context) error {
 		newIsDefault = *req.IsDefault
 	}
 
-	_, err = h.db.Exec(
-		`UPDATE categories SET name = $1, is_default = $2, updated_at = $3 WHERE id = $4`,
-		req.Name, newIsDefault, time.Now(), catID,
-	)
-	if err != nil {
+	updated := *existing
+	updated.Name = req.Name
+	updated.IsDefault = newIsDefault
+	updated.UpdatedAt = time.Now()
+	if err := h.stores.Categories.UpdateCategory(&updated); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update category"})
 	}
 
+	entry := newAuditEntry(c, "category.update", "category", catID)
+	entry.Before, entry.After = *existing, updated
+	logAudit(h.stores.Audit, entry)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message":     "Category updated successfully",
 		"category_id": catID,
@@ -240,25 +171,26 @@ func (h *CategoryHandler) DeleteCategory(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid category ID"})
 	}
 
-	var owner uuid.UUID
-	var isDefault bool
-	err = h.db.QueryRow(`SELECT user_id, is_default FROM categories WHERE id = $1`, catID).Scan(&owner, &isDefault)
-	if err == sql.ErrNoRows {
+	existing, err := h.stores.Categories.GetCategory(catID)
+	if err == errNotFound {
 		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "Category not found"})
 	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to load category"})
 	}
-	if owner != userID {
+	if existing.UserID != userID {
 		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "Cannot delete this category"})
 	}
 
-	// (ON DELETE CASCADE will remove expense_categories rows)
-	_, err = h.db.Exec(`DELETE FROM categories WHERE id = $1`, catID)
-	if err != nil {
+	// Links to expenses are removed with the category
+	if err := h.stores.Categories.DeleteCategory(catID); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete category"})
 	}
 
+	entry := newAuditEntry(c, "category.delete", "category", catID)
+	entry.Before = *existing
+	logAudit(h.stores.Audit, entry)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Category deleted successfully.",
 	})
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the application configuration. Each setting is read, in increasing priority,
+// from the defaults in defaultConfig, the YAML file named by CONFIG_FILE, a .env file in
+// the working directory and the process environment. The env tag names the variable;
+// config.example.yaml documents every key.
+type Config struct {
+	// Env is development (also dev, local or test) or anything else, including unset, for production
+	Env string `yaml:"env" env:"APP_ENV"`
+	// Port is the HTTP listen port
+	Port string `yaml:"port" env:"PORT"`
+	// BaseURL is the public URL used to build links in emails
+	BaseURL string `yaml:"base_url" env:"APP_BASE_URL"`
+	// CORSOrigins are the browser origins allowed to call the API; "*" allows any
+	CORSOrigins []string `yaml:"cors_origins" env:"CORS_ORIGINS"`
+	// AdminEmails are promoted to admin at startup
+	AdminEmails []string `yaml:"admin_emails" env:"ADMIN_EMAILS"`
+	// ShutdownDelay is how long /readyz fails after SIGTERM before the listener closes
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	// ShutdownTimeout is how long in-flight requests may run after SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+
+	Database    DatabaseConfig   `yaml:"database"`
+	Auth        AuthConfig       `yaml:"auth"`
+	Login       LoginConfig      `yaml:"login"`
+	Accounts    AccountConfig    `yaml:"accounts"`
+	Export      ExportConfig     `yaml:"export"`
+	Mail        MailConfig       `yaml:"mail"`
+	OIDC        OIDCConfig       `yaml:"oidc"`
+	Currency    CurrencyConfig   `yaml:"currency"`
+	Recurring   RecurringConfig  `yaml:"recurring"`
+	Attachments AttachmentConfig `yaml:"attachments"`
+}
+
+// DatabaseConfig selects and tunes the database connection
+type DatabaseConfig struct {
+	// Driver is postgres or sqlite
+	Driver     string `yaml:"driver" env:"DB_DRIVER"`
+	SQLitePath string `yaml:"sqlite_path" env:"SQLITE_PATH"`
+	Host       string `yaml:"host" env:"DB_HOST"`
+	Port       string `yaml:"port" env:"DB_PORT"`
+	Name       string `yaml:"name" env:"DB_NAME"`
+	User       string `yaml:"user" env:"DB_USER"`
+	Password   string `yaml:"password" env:"DB_PASSWORD"`
+	// SSLMode is the libpq sslmode: disable, allow, prefer, require, verify-ca or verify-full
+	SSLMode string `yaml:"sslmode" env:"DB_SSLMODE"`
+	// MaxOpenConns caps the connection pool (0 means unlimited)
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	// ConnectAttempts is how often startup tries to reach the database, waiting
+	// ConnectBackoff after the first failure and twice as long after each next one
+	ConnectAttempts int           `yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectBackoff  time.Duration `yaml:"connect_backoff" env:"DB_CONNECT_BACKOFF"`
+}
+
+// AuthConfig holds signing keys and token lifetimes
+type AuthConfig struct {
+	// JWTSecret signs HS256 tokens; empty falls back to a placeholder in development only
+	JWTSecret    string `yaml:"jwt_secret" env:"JWT_SECRET"`
+	JWTSecretKID string `yaml:"jwt_secret_kid" env:"JWT_SECRET_KID"`
+	// JWTKeysDir holds RSA or Ed25519 PEM keys, see api-details.md
+	JWTKeysDir    string `yaml:"jwt_keys_dir" env:"JWT_KEYS_DIR"`
+	JWTSigningKID string `yaml:"jwt_signing_kid" env:"JWT_SIGNING_KID"`
+	// JWTAudience is the aud claim of access tokens, which services verifying them should require
+	JWTAudience string `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+	// SessionTokenKey keys the stored session token hashes; defaults to the JWT secret
+	SessionTokenKey       string        `yaml:"session_token_key" env:"SESSION_TOKEN_KEY"`
+	AccessTokenTTL        time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL       time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	TwoFactorChallengeTTL time.Duration `yaml:"two_factor_challenge_ttl" env:"TWO_FACTOR_CHALLENGE_TTL"`
+	TOTPIssuer            string        `yaml:"totp_issuer" env:"TOTP_ISSUER"`
+	EmailVerificationTTL  time.Duration `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL"`
+	PasswordResetTTL      time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+}
+
+// LoginConfig tunes the brute-force lockout
+type LoginConfig struct {
+	MaxAttempts      int           `yaml:"max_attempts" env:"LOGIN_MAX_ATTEMPTS"`
+	MaxAttemptsPerIP int           `yaml:"max_attempts_per_ip" env:"LOGIN_MAX_ATTEMPTS_PER_IP"`
+	AttemptWindow    time.Duration `yaml:"attempt_window" env:"LOGIN_ATTEMPT_WINDOW"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION"`
+}
+
+// AccountConfig covers deactivated and unverified accounts
+type AccountConfig struct {
+	RetentionPeriod        time.Duration `yaml:"retention_period" env:"ACCOUNT_RETENTION_PERIOD"`
+	PurgeInterval          time.Duration `yaml:"purge_interval" env:"ACCOUNT_PURGE_INTERVAL"`
+	UnverifiedExpenseLimit int           `yaml:"unverified_expense_limit" env:"UNVERIFIED_EXPENSE_LIMIT"`
+}
+
+// ExportConfig tunes personal data exports
+type ExportConfig struct {
+	SyncMaxExpenses int           `yaml:"sync_max_expenses" env:"EXPORT_SYNC_MAX_EXPENSES"`
+	TTL             time.Duration `yaml:"ttl" env:"EXPORT_TTL"`
+}
+
+// MailConfig selects the mailer
+type MailConfig struct {
+	// Mailer is log (write emails to LogFile or the application log) or smtp
+	Mailer       string `yaml:"mailer" env:"MAILER"`
+	LogFile      string `yaml:"log_file" env:"MAIL_LOG_FILE"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+}
+
+// OIDCConfig enables single sign-on when IssuerURL is set
+type OIDCConfig struct {
+	IssuerURL    string   `yaml:"issuer_url" env:"OIDC_ISSUER_URL"`
+	ClientID     string   `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" env:"OIDC_SCOPES"`
+	// AllowSignup creates accounts for unknown users
+	AllowSignup bool `yaml:"allow_signup" env:"OIDC_ALLOW_SIGNUP"`
+}
+
+// CurrencyConfig covers home currencies and the exchange rates used to convert to them
+type CurrencyConfig struct {
+	// Default is the home currency of new accounts
+	Default string `yaml:"default" env:"DEFAULT_CURRENCY"`
+	// RatesProvider fetches daily rates in the background: empty (off), fake or frankfurter
+	RatesProvider    string `yaml:"rates_provider" env:"RATES_PROVIDER"`
+	RatesProviderURL string `yaml:"rates_provider_url" env:"RATES_PROVIDER_URL"`
+	// RatesBase is the currency the provider quotes every rate against
+	RatesBase         string        `yaml:"rates_base" env:"RATES_BASE"`
+	RatesSyncInterval time.Duration `yaml:"rates_sync_interval" env:"RATES_SYNC_INTERVAL"`
+	// RatesBackfill is how far back the first sync fetches
+	RatesBackfill time.Duration `yaml:"rates_backfill" env:"RATES_BACKFILL"`
+}
+
+// RecurringConfig tunes the recurring expense scheduler
+type RecurringConfig struct {
+	// Interval is how often due occurrences are turned into expenses
+	Interval time.Duration `yaml:"interval" env:"RECURRING_INTERVAL"`
+	// MaxBackfill is how far in the past a schedule may start; its past occurrences are created at once
+	MaxBackfill time.Duration `yaml:"max_backfill" env:"RECURRING_MAX_BACKFILL"`
+}
+
+// AttachmentConfig selects where expense attachments are kept and what may be uploaded
+type AttachmentConfig struct {
+	// Storage is local (files under Dir) or s3 (Amazon S3 or a compatible service such as MinIO)
+	Storage string `yaml:"storage" env:"ATTACHMENT_STORAGE"`
+	Dir     string `yaml:"dir" env:"ATTACHMENT_DIR"`
+	// MaxSize is the largest file accepted, in bytes
+	MaxSize int `yaml:"max_size" env:"ATTACHMENT_MAX_SIZE"`
+	// MaxPerExpense caps how many files one expense can have
+	MaxPerExpense int `yaml:"max_per_expense" env:"ATTACHMENT_MAX_PER_EXPENSE"`
+	// S3Endpoint defaults to Amazon S3 in S3Region
+	S3Endpoint        string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region          string `yaml:"s3_region" env:"S3_REGION"`
+	S3Bucket          string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKeyID     string `yaml:"s3_access_key_id" env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `yaml:"s3_secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	// S3PathStyle addresses the bucket as endpoint/bucket, as MinIO expects, instead of bucket.endpoint
+	S3PathStyle bool `yaml:"s3_path_style" env:"S3_PATH_STYLE"`
+}
+
+// defaultConfig returns the settings used when nothing overrides them
+func defaultConfig() *Config {
+	return &Config{
+		Env:             "production",
+		Port:            "3000",
+		BaseURL:         "http://localhost:3000",
+		CORSOrigins:     []string{"*"},
+		ShutdownDelay:   5 * time.Second,
+		ShutdownTimeout: 20 * time.Second,
+		Database: DatabaseConfig{
+			Driver:          "postgres",
+			SQLitePath:      "expense_tracker.db",
+			Host:            "localhost",
+			Port:            "5432",
+			Name:            "expense_tracker",
+			User:            "postgres",
+			Password:        defaultDBPassword,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectAttempts: 10,
+			ConnectBackoff:  time.Second,
+		},
+		Auth: AuthConfig{
+			JWTSecretKID:          "hs256",
+			JWTAudience:           "expense-tracker-api",
+			AccessTokenTTL:        15 * time.Minute,
+			RefreshTokenTTL:       30 * 24 * time.Hour,
+			TwoFactorChallengeTTL: 5 * time.Minute,
+			TOTPIssuer:            "Expense Tracker",
+			EmailVerificationTTL:  24 * time.Hour,
+			PasswordResetTTL:      time.Hour,
+		},
+		Login: LoginConfig{
+			MaxAttempts:      5,
+			MaxAttemptsPerIP: 20,
+			AttemptWindow:    15 * time.Minute,
+			LockoutDuration:  15 * time.Minute,
+		},
+		Accounts: AccountConfig{
+			RetentionPeriod:        30 * 24 * time.Hour,
+			PurgeInterval:          time.Hour,
+			UnverifiedExpenseLimit: 10,
+		},
+		Export: ExportConfig{
+			SyncMaxExpenses: 1000,
+			TTL:             24 * time.Hour,
+		},
+		Mail: MailConfig{
+			Mailer:   "log",
+			SMTPPort: "587",
+		},
+		OIDC: OIDCConfig{
+			Scopes:      []string{"openid", "email", "profile"},
+			AllowSignup: true,
+		},
+		Currency: CurrencyConfig{
+			Default:           "USD",
+			RatesProviderURL:  "https://api.frankfurter.app",
+			RatesBase:         "EUR",
+			RatesSyncInterval: 24 * time.Hour,
+			RatesBackfill:     90 * 24 * time.Hour,
+		},
+		Recurring: RecurringConfig{
+			Interval:    time.Hour,
+			MaxBackfill: 366 * 24 * time.Hour,
+		},
+		Attachments: AttachmentConfig{
+			Storage:       "local",
+			Dir:           "attachments",
+			MaxSize:       10 << 20,
+			MaxPerExpense: 10,
+			S3Region:      "us-east-1",
+			S3PathStyle:   true,
+		},
+	}
+}
+
+// defaultDBPassword is the development database password; production refuses it
+const defaultDBPassword = "password"
+
+// appConfig is the configuration in effect. main replaces it with loadConfig's result
+// before anything else runs; until then (and in tests) it holds the defaults.
+var appConfig = defaultConfig()
+
+// config returns the configuration in effect
+func config() *Config {
+	return appConfig
+}
+
+// loadConfig reads the configuration from every source and validates it
+func loadConfig() (*Config, error) {
+	if err := godotenv.Load(); errors.Is(err, os.ErrNotExist) {
+		log.Println("No .env file found, using system environment variables")
+	} else if err != nil {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
+
+	cfg := defaultConfig()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.readYAML(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+	cfg.normalize()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// normalize lower-cases enumerated settings and resolves their aliases
+func (c *Config) normalize() {
+	c.Env = strings.ToLower(c.Env)
+	c.Database.Driver = strings.ToLower(c.Database.Driver)
+	switch c.Database.Driver {
+	case "postgresql":
+		c.Database.Driver = "postgres"
+	case "sqlite3":
+		c.Database.Driver = "sqlite"
+	}
+	c.Mail.Mailer = strings.ToLower(c.Mail.Mailer)
+	c.Currency.Default = strings.ToUpper(c.Currency.Default)
+	c.Currency.RatesProvider = strings.ToLower(c.Currency.RatesProvider)
+	c.Currency.RatesBase = strings.ToUpper(c.Currency.RatesBase)
+	c.Attachments.Storage = strings.ToLower(c.Attachments.Storage)
+}
+
+// readYAML overrides the settings present in the file; unknown keys are an error
+func (c *Config) readYAML(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv overrides every field tagged env with its variable, when that is set and not empty
+func applyEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(value); err != nil {
+				return err
+			}
+			continue
+		}
+		name := field.Tag.Get("env")
+		raw := strings.TrimSpace(os.Getenv(name))
+		if name == "" || raw == "" {
+			continue
+		}
+
+		switch {
+		case field.Type == durationType:
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%s: invalid duration %q", name, raw)
+			}
+			value.SetInt(int64(d))
+		case field.Type.Kind() == reflect.String:
+			value.SetString(raw)
+		case field.Type.Kind() == reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: invalid number %q", name, raw)
+			}
+			value.SetInt(int64(n))
+		case field.Type.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("%s: invalid boolean %q", name, raw)
+			}
+			value.SetBool(b)
+		case field.Type.Kind() == reflect.Slice:
+			// Lists are comma- or space-separated
+			value.Set(reflect.ValueOf(strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' })))
+		default:
+			return fmt.Errorf("%s: unsupported setting type %s", name, field.Type)
+		}
+	}
+	return nil
+}
+
+// IsDevelopment reports whether Env marks a development environment. An empty Env is
+// production, so a deployment that forgets APP_ENV still gets the production checks.
+func (c *Config) IsDevelopment() bool {
+	switch strings.ToLower(c.Env) {
+	case "dev", "development", "local", "test":
+		return true
+	}
+	return false
+}
+
+var sslModes = map[string]bool{"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true}
+
+// validate reports every invalid setting at once. Outside development it also refuses
+// the placeholder secrets and permissive defaults that are only meant for a laptop.
+func (c *Config) validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problem("PORT must be a TCP port, got %q", c.Port)
+	}
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problem("APP_BASE_URL must be an absolute URL, got %q", c.BaseURL)
+	}
+	if len(c.CORSOrigins) == 0 {
+		problem("CORS_ORIGINS must list at least one origin")
+	}
+	for _, origin := range c.CORSOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+			problem("CORS_ORIGINS entry %q must be \"*\" or an origin such as https://app.example.com", origin)
+		}
+	}
+
+	db := c.Database
+	switch db.Driver {
+	case "postgres":
+		if !sslModes[db.SSLMode] {
+			problem("DB_SSLMODE %q is not a valid sslmode", db.SSLMode)
+		}
+	case "sqlite":
+		if db.SQLitePath == "" {
+			problem("SQLITE_PATH must be set when DB_DRIVER is sqlite")
+		}
+	default:
+		problem("DB_DRIVER must be postgres or sqlite, got %q", db.Driver)
+	}
+	if db.MaxOpenConns < 0 || db.MaxIdleConns < 0 {
+		problem("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		problem("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", db.MaxIdleConns, db.MaxOpenConns)
+	}
+	if db.ConnectAttempts < 1 {
+		problem("DB_CONNECT_ATTEMPTS must be at least 1")
+	}
+
+	durations := map[string]time.Duration{
+		"ACCESS_TOKEN_TTL":         c.Auth.AccessTokenTTL,
+		"REFRESH_TOKEN_TTL":        c.Auth.RefreshTokenTTL,
+		"TWO_FACTOR_CHALLENGE_TTL": c.Auth.TwoFactorChallengeTTL,
+		"EMAIL_VERIFICATION_TTL":   c.Auth.EmailVerificationTTL,
+		"PASSWORD_RESET_TTL":       c.Auth.PasswordResetTTL,
+		"LOGIN_ATTEMPT_WINDOW":     c.Login.AttemptWindow,
+		"LOGIN_LOCKOUT_DURATION":   c.Login.LockoutDuration,
+		"ACCOUNT_RETENTION_PERIOD": c.Accounts.RetentionPeriod,
+		"ACCOUNT_PURGE_INTERVAL":   c.Accounts.PurgeInterval,
+		"EXPORT_TTL":               c.Export.TTL,
+		"DB_CONN_MAX_LIFETIME":     c.Database.ConnMaxLifetime,
+		"DB_CONNECT_BACKOFF":       c.Database.ConnectBackoff,
+		"SHUTDOWN_TIMEOUT":         c.ShutdownTimeout,
+		"RATES_SYNC_INTERVAL":      c.Currency.RatesSyncInterval,
+		"RATES_BACKFILL":           c.Currency.RatesBackfill,
+		"RECURRING_INTERVAL":       c.Recurring.Interval,
+		"RECURRING_MAX_BACKFILL":   c.Recurring.MaxBackfill,
+	}
+	for name, d := range durations {
+		if d <= 0 {
+			problem("%s must be a positive duration such as 15m", name)
+		}
+	}
+	if c.ShutdownDelay < 0 {
+		problem("SHUTDOWN_DELAY must not be negative; use 0 to close the listener right away")
+	}
+	if c.Auth.AccessTokenTTL >= c.Auth.RefreshTokenTTL {
+		problem("ACCESS_TOKEN_TTL must be shorter than REFRESH_TOKEN_TTL")
+	}
+	if strings.TrimSpace(c.Auth.JWTAudience) == "" {
+		problem("JWT_AUDIENCE must not be empty")
+	}
+	if c.Login.MaxAttempts < 0 || c.Login.MaxAttemptsPerIP < 0 || c.Accounts.UnverifiedExpenseLimit < 0 || c.Export.SyncMaxExpenses < 0 {
+		problem("LOGIN_MAX_ATTEMPTS, LOGIN_MAX_ATTEMPTS_PER_IP, UNVERIFIED_EXPENSE_LIMIT and EXPORT_SYNC_MAX_EXPENSES must not be negative")
+	}
+
+	switch c.Mail.Mailer {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" || c.Mail.From == "" {
+			problem("SMTP_HOST and MAIL_FROM are required when MAILER is smtp")
+		}
+	default:
+		problem("MAILER must be log or smtp, got %q", c.Mail.Mailer)
+	}
+
+	if !currencyCodes[c.Currency.Default] {
+		problem("DEFAULT_CURRENCY must be an ISO 4217 code such as USD, got %q", c.Currency.Default)
+	}
+	switch c.Currency.RatesProvider {
+	case "", "fake":
+	case "frankfurter":
+		if u, err := url.Parse(c.Currency.RatesProviderURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problem("RATES_PROVIDER_URL must be an absolute URL, got %q", c.Currency.RatesProviderURL)
+		}
+		if !currencyCodes[c.Currency.RatesBase] {
+			problem("RATES_BASE must be an ISO 4217 code such as EUR, got %q", c.Currency.RatesBase)
+		}
+	default:
+		problem("RATES_PROVIDER must be empty, fake or frankfurter, got %q", c.Currency.RatesProvider)
+	}
+
+	att := c.Attachments
+	switch att.Storage {
+	case "local":
+		if att.Dir == "" {
+			problem("ATTACHMENT_DIR must be set when ATTACHMENT_STORAGE is local")
+		}
+	case "s3":
+		if att.S3Bucket == "" || att.S3Region == "" || att.S3AccessKeyID == "" || att.S3SecretAccessKey == "" {
+			problem("S3_BUCKET, S3_REGION, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required when ATTACHMENT_STORAGE is s3")
+		}
+		if u, err := url.Parse(att.S3Endpoint); att.S3Endpoint != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+			problem("S3_ENDPOINT must be an absolute URL such as http://localhost:9000, got %q", att.S3Endpoint)
+		}
+	default:
+		problem("ATTACHMENT_STORAGE must be local or s3, got %q", att.Storage)
+	}
+	if att.MaxSize < 1 || att.MaxPerExpense < 1 {
+		problem("ATTACHMENT_MAX_SIZE and ATTACHMENT_MAX_PER_EXPENSE must be at least 1")
+	}
+
+	if c.OIDC.IssuerURL != "" && (c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		problem("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
+
+	if !c.IsDevelopment() {
+		if insecureJWTSecrets[c.Auth.JWTSecret] {
+			problem("JWT_SECRET uses a placeholder value; set a strong secret or APP_ENV=development")
+		}
+		if c.Auth.JWTSecret == "" && c.Auth.JWTKeysDir == "" {
+			problem("JWT_SECRET or JWT_KEYS_DIR must be set")
+		}
+		if c.Auth.SessionTokenKey == "" && (c.Auth.JWTSecret == "" || insecureJWTSecrets[c.Auth.JWTSecret]) {
+			problem("SESSION_TOKEN_KEY must be set when JWT_SECRET is not")
+		}
+		if db.Driver == "postgres" && (db.Password == "" || db.Password == defaultDBPassword) {
+			problem("DB_PASSWORD must be set to a real password")
+		}
+		if db.Driver == "postgres" && db.SSLMode == "disable" && !isLocalHost(db.Host) {
+			problem("DB_SSLMODE=disable sends credentials in clear text to %s; use require or verify-full", db.Host)
+		}
+		for _, origin := range c.CORSOrigins {
+			if origin == "*" {
+				problem("CORS_ORIGINS must list the allowed origins instead of \"*\"")
+			}
+		}
+		if u, err := url.Parse(c.BaseURL); err == nil && isLocalHost(u.Hostname()) {
+			problem("APP_BASE_URL still points at %s; emails would link there", u.Host)
+		}
+		if c.Mail.Mailer == "log" {
+			problem("MAILER=log writes password reset and verification links to a file instead of sending them; use smtp or APP_ENV=development")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// isLocalHost reports whether host is this machine (or a Unix socket directory)
+func isLocalHost(host string) bool {
+	if host == "localhost" || strings.HasPrefix(host, "/") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the tests with the development placeholders, as APP_ENV=test would
+func TestMain(m *testing.M) {
+	appConfig.Env = "test"
+	os.Exit(m.Run())
+}
+
+func TestConfig_DefaultsAreValidInDevelopment(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Env = "development"
+	assert.NoError(t, cfg.validate())
+}
+
+func TestConfig_UnsetEnvIsProduction(t *testing.T) {
+	cfg := defaultConfig()
+	assert.False(t, cfg.IsDevelopment())
+	assert.ErrorContains(t, cfg.validate(), "JWT_SECRET")
+
+	cfg.Env = ""
+	assert.False(t, cfg.IsDevelopment())
+}
+
+func TestLoadConfig_EnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+port: "8080"
+cors_origins: ["https://app.example.com"]
+database:
+  driver: sqlite
+  max_open_conns: 4
+  max_idle_conns: 2
+auth:
+  access_token_ttl: 5m
+login:
+  max_attempts: 3
+`), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("APP_ENV", "development")
+	t.Setenv("DB_MAX_OPEN_CONNS", "8")
+	t.Setenv("REFRESH_TOKEN_TTL", "48h")
+	t.Setenv("CORS_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := loadConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, "sqlite", cfg.Database.Driver)
+	assert.Equal(t, 8, cfg.Database.MaxOpenConns)
+	assert.Equal(t, 2, cfg.Database.MaxIdleConns)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.AccessTokenTTL)
+	assert.Equal(t, 48*time.Hour, cfg.Auth.RefreshTokenTTL)
+	assert.Equal(t, 3, cfg.Login.MaxAttempts)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.CORSOrigins)
+	// Settings in neither source keep their defaults
+	assert.Equal(t, 15*time.Minute, cfg.Login.LockoutDuration)
+}
+
+func TestLoadConfig_ExampleFileMatchesDefaults(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "config.example.yaml")
+	t.Setenv("APP_ENV", "development")
+	cfg, err := loadConfig()
+	require.NoError(t, err)
+	want := defaultConfig()
+	want.Env = "development"
+	assert.Equal(t, want, cfg)
+}
+
+func TestLoadConfig_RejectsBadValues(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "fifteen minutes")
+	_, err := loadConfig()
+	assert.ErrorContains(t, err, "ACCESS_TOKEN_TTL")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("databse:\n  driver: sqlite\n"), 0o600))
+	t.Setenv("ACCESS_TOKEN_TTL", "")
+	t.Setenv("CONFIG_FILE", path)
+	_, err = loadConfig()
+	assert.ErrorContains(t, err, "databse")
+}
+
+func TestConfig_ProductionRejectsInsecureDefaults(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Env = "production"
+	cfg.Database.Host = "db.internal"
+
+	err := cfg.validate()
+	require.Error(t, err)
+	for _, setting := range []string{"JWT_SECRET", "SESSION_TOKEN_KEY", "DB_PASSWORD", "DB_SSLMODE", "CORS_ORIGINS", "APP_BASE_URL", "MAILER"} {
+		assert.Contains(t, err.Error(), setting)
+	}
+
+	cfg.Mail.Mailer = "smtp"
+	cfg.Mail.SMTPHost = "smtp.example.com"
+	cfg.Mail.From = "noreply@example.com"
+	cfg.Auth.JWTSecret = "a-long-random-production-secret"
+	cfg.Database.Password = "s3cret"
+	cfg.Database.SSLMode = "verify-full"
+	cfg.CORSOrigins = []string{"https://app.example.com"}
+	cfg.BaseURL = "https://api.example.com"
+	assert.NoError(t, cfg.validate())
+}
+
+func TestConfig_ValidateReportsEveryProblem(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.MaxIdleConns = 50
+	cfg.Auth.AccessTokenTTL = 60 * 24 * time.Hour
+	cfg.Mail.Mailer = "smtp"
+
+	err := cfg.validate()
+	require.Error(t, err)
+	for _, setting := range []string{"DB_SSLMODE", "DB_MAX_IDLE_CONNS", "ACCESS_TOKEN_TTL", "SMTP_HOST"} {
+		assert.Contains(t, err.Error(), setting)
+	}
+}
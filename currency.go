@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// currencyCodes holds the active ISO 4217 currency codes
+var currencyCodes = func() map[string]bool {
+	codes := strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL
+		BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP
+		ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR
+		IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT LAK LBP LKR LRD LSL
+		LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR
+		NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD
+		SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX
+		USD UYU UZS VES VND VUV WST XAF XCD XOF XPF YER ZAR ZMW ZWL`)
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}()
+
+// errInvalidCurrency is returned for codes that are not ISO 4217 currencies
+var errInvalidCurrency = errors.New("currency must be an ISO 4217 code such as USD or EUR")
+
+// normalizeCurrency upper-cases a currency code and reports whether it is an ISO 4217 code
+func normalizeCurrency(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, currencyCodes[code]
+}
+
+// defaultCurrency returns the home currency given to new accounts (DEFAULT_CURRENCY, default USD)
+func defaultCurrency() string {
+	return config().Currency.Default
+}
+
+// ExchangeRate says that on Date one unit of Base buys Rate units of Quote.
+// Rate is a decimal string so no precision is lost on the way to the database.
+type ExchangeRate struct {
+	Date   time.Time
+	Base   string
+	Quote  string
+	Rate   string
+	Source string
+}
+
+// exchangeRateLookback is how far back the rate for a day may come from. Reference
+// rates are not published at weekends or on holidays, so the last one before is used.
+const exchangeRateLookback = 7 * 24 * time.Hour
+
+// errInvalidRate is returned for rates that are not positive decimals
+var errInvalidRate = errors.New("rate must be a positive decimal number with at most 12 decimal places")
+
+// parseRate reads a rate such as "1.0956" exactly
+func parseRate(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	units, fraction, hasPoint := strings.Cut(s, ".")
+	if units == "" || !isDigits(units) || (hasPoint && (fraction == "" || !isDigits(fraction))) {
+		return nil, errInvalidRate
+	}
+	if len(fraction) > 12 || len(strings.TrimLeft(units, "0")) > 12 {
+		return nil, errInvalidRate
+	}
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok || rate.Sign() <= 0 {
+		return nil, errInvalidRate
+	}
+	return rate, nil
+}
+
+// missingRateError reports an amount that could not be converted to the home currency
+type missingRateError struct {
+	From string
+	To   string
+	Date time.Time
+}
+
+func (e *missingRateError) Error() string {
+	return fmt.Sprintf("no exchange rate from %s to %s for %s or the %d days before it",
+		e.From, e.To, e.Date.Format("2006-01-02"), int(exchangeRateLookback.Hours()/24))
+}
+
+type currencyPair struct{ base, quote string }
+
+type datedRate struct {
+	date time.Time
+	rate *big.Rat
+}
+
+// rateTable converts between currencies using a set of stored rates. A pair is
+// converted with its own rate, the inverse of the opposite pair, or a cross rate
+// through a currency both are quoted against (for example USD→EUR→INR).
+type rateTable struct {
+	series map[currencyPair][]datedRate
+	bases  []string
+}
+
+func newRateTable(rates []ExchangeRate) (*rateTable, error) {
+	t := &rateTable{series: make(map[currencyPair][]datedRate)}
+	bases := make(map[string]bool)
+	for _, r := range rates {
+		rate, err := parseRate(r.Rate)
+		if err != nil {
+			return nil, fmt.Errorf("rate %s/%s on %s: %w", r.Base, r.Quote, r.Date.Format("2006-01-02"), err)
+		}
+		pair := currencyPair{r.Base, r.Quote}
+		t.series[pair] = append(t.series[pair], datedRate{date: r.Date, rate: rate})
+		bases[r.Base] = true
+	}
+	for _, series := range t.series {
+		sort.Slice(series, func(i, j int) bool { return series[i].date.Before(series[j].date) })
+	}
+	for base := range bases {
+		t.bases = append(t.bases, base)
+	}
+	sort.Strings(t.bases)
+	return t, nil
+}
+
+// lookup returns the latest rate for the pair on or shortly before the day
+func (t *rateTable) lookup(base, quote string, on time.Time) (*big.Rat, bool) {
+	series := t.series[currencyPair{base, quote}]
+	i := sort.Search(len(series), func(i int) bool { return series[i].date.After(on) })
+	if i == 0 || on.Sub(series[i-1].date) > exchangeRateLookback {
+		return nil, false
+	}
+	return series[i-1].rate, true
+}
+
+// rate returns how many units of to one unit of from buys on the day
+func (t *rateTable) rate(from, to string, on time.Time) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	if r, ok := t.lookup(from, to, on); ok {
+		return r, nil
+	}
+	if r, ok := t.lookup(to, from, on); ok {
+		return new(big.Rat).Inv(r), nil
+	}
+	for _, base := range t.bases {
+		toFrom, ok := t.lookup(base, from, on)
+		if !ok {
+			continue
+		}
+		toTo, ok := t.lookup(base, to, on)
+		if !ok {
+			continue
+		}
+		return new(big.Rat).Quo(toTo, toFrom), nil
+	}
+	return nil, &missingRateError{From: from, To: to, Date: on}
+}
+
+// convert returns amount in the target currency, unrounded
+func (t *rateTable) convert(amount Money, from, to string, on time.Time) (*big.Rat, error) {
+	rate, err := t.rate(from, to, on)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Mul(new(big.Rat).SetInt64(int64(amount)), rate), nil
+}
+
+// roundMoney rounds minor units to the nearest whole unit, halves away from zero
+func roundMoney(r *big.Rat) Money {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	// (2*num + den) / (2*den) rounds a non-negative fraction half up
+	q := new(big.Int).Add(new(big.Int).Lsh(num, 1), den)
+	q.Quo(q, new(big.Int).Lsh(den, 1))
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+	return Money(q.Int64())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestRateTable_Conversions(t *testing.T) {
+	table, err := newRateTable([]ExchangeRate{
+		{Date: day("2024-01-15"), Base: "EUR", Quote: "USD", Rate: "1.0945"},
+		{Date: day("2024-01-15"), Base: "EUR", Quote: "INR", Rate: "90.50"},
+		{Date: day("2024-01-16"), Base: "EUR", Quote: "USD", Rate: "1.0880"},
+	})
+	require.NoError(t, err)
+
+	convert := func(amount Money, from, to, on string) Money {
+		t.Helper()
+		converted, err := table.convert(amount, from, to, day(on))
+		require.NoError(t, err)
+		return roundMoney(converted)
+	}
+	assert.Equal(t, Money(1000), convert(1000, "USD", "USD", "2020-01-01"))
+	assert.Equal(t, Money(10945), convert(10000, "EUR", "USD", "2024-01-15"))
+	assert.Equal(t, Money(10880), convert(10000, "EUR", "USD", "2024-01-16"))
+	// The inverse pair: 100 USD / 1.0945
+	assert.Equal(t, Money(9137), convert(10000, "USD", "EUR", "2024-01-15"))
+	// A cross rate through EUR: 100 USD * 90.50 / 1.0945
+	assert.Equal(t, Money(826862), convert(10000, "USD", "INR", "2024-01-15"))
+	// Weekends and holidays fall back to the last published day
+	assert.Equal(t, Money(10880), convert(10000, "EUR", "USD", "2024-01-21"))
+
+	var missing *missingRateError
+	_, err = table.convert(10000, "EUR", "USD", day("2024-01-14"))
+	assert.ErrorAs(t, err, &missing)
+	_, err = table.convert(10000, "EUR", "USD", day("2024-01-24"))
+	assert.ErrorAs(t, err, &missing)
+	_, err = table.convert(10000, "GBP", "USD", day("2024-01-15"))
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, "GBP", missing.From)
+}
+
+func TestRoundMoney(t *testing.T) {
+	cases := map[string]Money{"0": 0, "12.49": 12, "12.5": 13, "-12.5": -13, "-12.49": -12, "1/3": 0, "2/3": 1}
+	for input, want := range cases {
+		r, ok := new(big.Rat).SetString(input)
+		require.True(t, ok, input)
+		assert.Equal(t, want, roundMoney(r), input)
+	}
+}
+
+func TestParseRateAndCurrency(t *testing.T) {
+	for _, valid := range []string{"1", "1.0945", "0.000000000001", "90.50"} {
+		_, err := parseRate(valid)
+		assert.NoError(t, err, valid)
+	}
+	for _, invalid := range []string{"", "0", "0.0", "-1.2", "1e3", "1/3", ".5", "1.0000000000001"} {
+		_, err := parseRate(invalid)
+		assert.ErrorIs(t, err, errInvalidRate, invalid)
+	}
+
+	code, ok := normalizeCurrency(" eur ")
+	assert.True(t, ok)
+	assert.Equal(t, "EUR", code)
+	_, ok = normalizeCurrency("EURO")
+	assert.False(t, ok)
+}
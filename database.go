@@ -4,39 +4,129 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
-// initDB initializes the database and creates all necessary tables
-func initDB() (*sql.DB, error) {
-	// Database connection parameters
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		host = "localhost"
+// sqlDialect holds the SQL that differs between the supported databases
+type sqlDialect struct {
+	// Driver is the DB_DRIVER value that selects this dialect
+	Driver string
+	// MigrationsDir is the embedded directory with this database's migrations
+	MigrationsDir string
+	// AdvisoryLocks reports whether migrations can hold pg_advisory_lock
+	AdvisoryLocks bool
+	// ForUpdate is appended to a SELECT to lock its rows until the transaction ends
+	ForUpdate string
+}
+
+var postgresDialect = &sqlDialect{
+	Driver:        "postgres",
+	MigrationsDir: "migrations",
+	AdvisoryLocks: true,
+	ForUpdate:     " FOR UPDATE",
+}
+
+// sqliteDialect has no row locks; openSQLite begins every transaction IMMEDIATE,
+// which takes the database write lock up front instead
+var sqliteDialect = &sqlDialect{
+	Driver:        "sqlite",
+	MigrationsDir: "migrations/sqlite",
+}
+
+// databaseDialect returns the dialect selected by DB_DRIVER: postgres (default) or sqlite
+func databaseDialect(driver string) (*sqlDialect, error) {
+	switch driver {
+	case "", "postgres":
+		return postgresDialect, nil
+	case "sqlite":
+		return sqliteDialect, nil
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q (use postgres or sqlite)", driver)
 	}
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		port = "5432"
+}
+
+// initDB connects to the configured database and brings its schema up to date
+func initDB(cfg DatabaseConfig) (*sql.DB, *sqlDialect, error) {
+	dialect, err := databaseDialect(cfg.Driver)
+	if err != nil {
+		return nil, nil, err
 	}
-	dbname := os.Getenv("DB_NAME")
-	if dbname == "" {
-		dbname = "expense_tracker"
+	db, err := connectWithRetry(dialect, cfg)
+	if err != nil {
+		return nil, nil, err
 	}
-	user := os.Getenv("DB_USER")
-	if user == "" {
-		user = "postgres"
+
+	// Apply pending schema migrations
+	if _, err := migrateUp(db, dialect, 0); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to apply migrations: %v", err)
 	}
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		password = "password"
+
+	log.Printf("Database (%s) connected and migrations applied successfully", dialect.Driver)
+	return db, dialect, nil
+}
+
+// maxConnectBackoff caps the wait between two connection attempts
+const maxConnectBackoff = 30 * time.Second
+
+// connectWithRetry opens the database, retrying with exponential backoff while it is
+// unreachable (a database container that is still starting, say)
+func connectWithRetry(dialect *sqlDialect, cfg DatabaseConfig) (*sql.DB, error) {
+	var db *sql.DB
+	err := retryWithBackoff(cfg.ConnectAttempts, cfg.ConnectBackoff, func() error {
+		var err error
+		db, err = openDB(dialect, cfg)
+		return err
+	})
+	return db, err
+}
+
+// retryWithBackoff calls fn up to attempts times, sleeping backoff after the first
+// failure and doubling the wait (up to maxConnectBackoff) after each one that follows
+func retryWithBackoff(attempts int, backoff time.Duration, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("giving up after %d attempt(s): %v", attempt, err)
+		}
+		log.Printf("Database not ready (attempt %d of %d): %v; retrying in %s", attempt, attempts, err, backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
+
+// openDB connects to the database for dialect and sizes its connection pool
+func openDB(dialect *sqlDialect, cfg DatabaseConfig) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	if dialect == sqliteDialect {
+		db, err = openSQLite(cfg.SQLitePath)
+	} else {
+		db, err = openPostgres(cfg)
 	}
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// openPostgres connects to the database, creating it if it does not exist yet
+func openPostgres(cfg DatabaseConfig) (*sql.DB, error) {
+	// Database connection parameters
+	host, port, dbname, user, password, sslmode := cfg.Host, cfg.Port, cfg.Name, cfg.User, cfg.Password, cfg.SSLMode
 
 	// Connection string
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname)
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		host, port, user, password, dbname, sslmode)
 
 	// Try to connect to the database
 	db, err := sql.Open("postgres", psqlInfo)
@@ -46,108 +136,134 @@ func initDB() (*sql.DB, error) {
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
+
 		// If database doesn't exist, try to create it
-		if err := createDatabaseIfNotExists(host, port, user, password, dbname); err != nil {
+		if err := createDatabaseIfNotExists(host, port, user, password, dbname, sslmode); err != nil {
 			return nil, fmt.Errorf("failed to create database: %v", err)
 		}
 		
 		// Try connecting again
-		db.Close()
 		db, err = sql.Open("postgres", psqlInfo)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open database after creation: %v", err)
 		}
 		
 		if err := db.Ping(); err != nil {
+			db.Close()
 			return nil, fmt.Errorf("failed to ping database: %v", err)
 		}
 	}
 
-	// Create all tables
-	if err := createAllTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %v", err)
+	return db, nil
+}
+
+// hashLegacySessionTokens is Postgres migration 0013. It moves plaintext tokens
+// from sessions.token / sessions.refresh_token into their hash columns and
+// drops the plaintext columns. It is a no-op once those columns are gone;
+// SQLite databases never had them.
+func hashLegacySessionTokens(tx *sql.Tx) error {
+	legacyColumns := []struct {
+		plain  string
+		hashed string
+	}{
+		{plain: "token", hashed: "token_hash"},
+		{plain: "refresh_token", hashed: "refresh_token_hash"},
 	}
 
-	log.Println("Database connected and tables created successfully")
-	return db, nil
+	for _, col := range legacyColumns {
+		var exists bool
+		err := tx.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM information_schema.columns WHERE table_name = 'sessions' AND column_name = $1)`,
+			col.plain,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		// Tokens only held user_id, iat and exp, so two logins in the same second could
+		// share one. The newest row keeps the hash; the others are deactivated and left
+		// without one, as the unique index allows a single row per hash.
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, %s FROM sessions WHERE %s IS NOT NULL ORDER BY created_at DESC, id`, col.plain, col.plain))
+		if err != nil {
+			return err
+		}
+		hashes := make(map[string]string)
+		seen := make(map[string]bool)
+		var duplicates []string
+		for rows.Next() {
+			var id, token string
+			if err := rows.Scan(&id, &token); err != nil {
+				rows.Close()
+				return err
+			}
+			hash := hashToken(token)
+			if seen[hash] {
+				duplicates = append(duplicates, id)
+				continue
+			}
+			seen[hash] = true
+			hashes[id] = hash
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range duplicates {
+			if _, err := tx.Exec(`UPDATE sessions SET is_active = false WHERE id = $1`, id); err != nil {
+				return err
+			}
+		}
+		for id, hash := range hashes {
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE sessions SET %s = $2 WHERE id = $1`, col.hashed), id, hash); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE sessions DROP COLUMN %s`, col.plain)); err != nil {
+			return err
+		}
+		log.Printf("Hashed %d legacy values of sessions.%s, deactivated %d duplicate(s)", len(hashes), col.plain, len(duplicates))
+	}
+	return nil
+}
+
+// dbTime scans a timestamp the query computed, e.g. with MAX or COALESCE. Postgres
+// returns these as time.Time; SQLite only types plain columns, so they arrive as text.
+type dbTime struct {
+	sql.NullTime
+}
+
+// Scan implements sql.Scanner
+func (t *dbTime) Scan(value interface{}) error {
+	text, ok := value.(string)
+	if !ok {
+		return t.NullTime.Scan(value)
+	}
+	parsed, err := time.Parse(sqliteTimeLayout, text)
+	if err != nil {
+		return fmt.Errorf("parsing time %q: %w", text, err)
+	}
+	t.Time, t.Valid = parsed, true
+	return nil
 }
 
-// createAllTables creates all tables required for the application
-func createAllTables(db *sql.DB) error {
-	query := `
-	-- Enable pgcrypto for gen_random_uuid if not already enabled
-	CREATE EXTENSION IF NOT EXISTS "pgcrypto";
-
-	-- USERS TABLE
-	CREATE TABLE IF NOT EXISTS users (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		name VARCHAR(999) NOT NULL,
-		email VARCHAR(255) UNIQUE NOT NULL,
-		password TEXT NOT NULL,
-		profile_image TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		is_active BOOLEAN DEFAULT TRUE,
-		deactivated_at TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-
-	-- CATEGORIES TABLE
-	CREATE TABLE IF NOT EXISTS categories (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		name VARCHAR(255) NOT NULL,
-		user_id UUID REFERENCES users(id) ON DELETE CASCADE,
-		is_default BOOLEAN DEFAULT FALSE,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- EXPENSES TABLE (legacy category_id/name removed; multi-category via expense_categories)
-	CREATE TABLE IF NOT EXISTS expenses (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		user_id UUID REFERENCES users(id) ON DELETE CASCADE,
-		title VARCHAR(255) NOT NULL,
-		description TEXT,
-		amount DECIMAL(10, 2) NOT NULL,
-		expense_date DATE NOT NULL,
-		expense_time TIME NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- EXPENSE_CATEGORIES TABLE
-	CREATE TABLE IF NOT EXISTS expense_categories (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		expense_id UUID REFERENCES expenses(id) ON DELETE CASCADE,
-		category_id UUID REFERENCES categories(id) ON DELETE CASCADE
-	);
-
-	-- LOGIN_HISTORY TABLE
-	CREATE TABLE IF NOT EXISTS login_history (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		user_id UUID REFERENCES users(id) ON DELETE CASCADE,
-		login_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	-- SESSIONS TABLE
-	CREATE TABLE IF NOT EXISTS sessions (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		user_id UUID REFERENCES users(id) ON DELETE CASCADE,
-		token TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		expires_at TIMESTAMP,
-		is_active BOOLEAN DEFAULT TRUE
-	);
-	`
-	_, err := db.Exec(query)
-	return err
+// sqlExecutor is satisfied by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // createDatabaseIfNotExists creates the database if it doesn't exist
-func createDatabaseIfNotExists(host, port, user, password, dbname string) error {
+func createDatabaseIfNotExists(host, port, user, password, dbname, sslmode string) error {
 	// Connect to postgres database to create our target database
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=postgres sslmode=disable",
-		host, port, user, password)
+	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=postgres sslmode=%s",
+		host, port, user, password, sslmode)
 	
 	db, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
@@ -18,16 +18,27 @@ const (
 	ErrorUnauthorized      = "unauthorized"
 	ErrorInvalidToken      = "invalid_token"
 	ErrorInvalidCredentials = "invalid_credentials"
+	ErrorInvalidRefreshToken = "invalid_refresh_token"
+	ErrorRefreshTokenReused  = "refresh_token_reused"
+	ErrorInvalidResetToken   = "invalid_reset_token"
+	ErrorInvalidVerificationToken = "invalid_verification_token"
+	ErrorEmailNotVerified    = "email_not_verified"
+	ErrorInvalidTwoFactorCode = "invalid_two_factor_code"
+	ErrorAccountLocked       = "account_locked"
 	
 	// Validation errors
 	ErrorValidationFailed  = "validation_failed"
 	ErrorInvalidRequest    = "invalid_request"
 	ErrorMissingFields     = "missing_fields"
+	ErrorFileTooLarge      = "file_too_large"
+	ErrorUnsupportedMediaType = "unsupported_media_type"
 	
 	// Resource errors
 	ErrorNotFound          = "not_found"
 	ErrorAlreadyExists     = "already_exists"
 	ErrorForbidden         = "forbidden"
+	ErrorInsufficientScope = "insufficient_scope"
+	ErrorExchangeRateMissing = "exchange_rate_missing"
 	
 	// Server errors
 	ErrorInternalServer    = "internal_server_error"
@@ -57,6 +68,41 @@ var ErrorResponses = map[string]StandardErrorResponse{
 		Message:    "Invalid email or password",
 		StatusCode: http.StatusUnauthorized,
 	},
+	ErrorInvalidRefreshToken: {
+		Error:      ErrorInvalidRefreshToken,
+		Message:    "Refresh token is invalid or expired, please login again",
+		StatusCode: http.StatusUnauthorized,
+	},
+	ErrorRefreshTokenReused: {
+		Error:      ErrorRefreshTokenReused,
+		Message:    "Refresh token was already used, all related sessions have been revoked",
+		StatusCode: http.StatusUnauthorized,
+	},
+	ErrorInvalidResetToken: {
+		Error:      ErrorInvalidResetToken,
+		Message:    "Password reset link is invalid, expired or already used",
+		StatusCode: http.StatusBadRequest,
+	},
+	ErrorInvalidVerificationToken: {
+		Error:      ErrorInvalidVerificationToken,
+		Message:    "Verification link is invalid or expired",
+		StatusCode: http.StatusBadRequest,
+	},
+	ErrorEmailNotVerified: {
+		Error:      ErrorEmailNotVerified,
+		Message:    "Please verify your email address to continue",
+		StatusCode: http.StatusForbidden,
+	},
+	ErrorInvalidTwoFactorCode: {
+		Error:      ErrorInvalidTwoFactorCode,
+		Message:    "Invalid two-factor authentication code",
+		StatusCode: http.StatusUnauthorized,
+	},
+	ErrorAccountLocked: {
+		Error:      ErrorAccountLocked,
+		Message:    "Too many failed login attempts. Please try again later",
+		StatusCode: http.StatusTooManyRequests,
+	},
 	ErrorValidationFailed: {
 		Error:      ErrorValidationFailed,
 		Message:    "Request validation failed",
@@ -72,6 +118,16 @@ var ErrorResponses = map[string]StandardErrorResponse{
 		Message:    "Required fields are missing",
 		StatusCode: http.StatusBadRequest,
 	},
+	ErrorFileTooLarge: {
+		Error:      ErrorFileTooLarge,
+		Message:    "Uploaded file is too large",
+		StatusCode: http.StatusRequestEntityTooLarge,
+	},
+	ErrorUnsupportedMediaType: {
+		Error:      ErrorUnsupportedMediaType,
+		Message:    "File type is not supported",
+		StatusCode: http.StatusUnsupportedMediaType,
+	},
 	ErrorNotFound: {
 		Error:      ErrorNotFound,
 		Message:    "Requested resource not found",
@@ -87,6 +143,16 @@ var ErrorResponses = map[string]StandardErrorResponse{
 		Message:    "Access to this resource is forbidden",
 		StatusCode: http.StatusForbidden,
 	},
+	ErrorInsufficientScope: {
+		Error:      ErrorInsufficientScope,
+		Message:    "API token does not have the required scope",
+		StatusCode: http.StatusForbidden,
+	},
+	ErrorExchangeRateMissing: {
+		Error:      ErrorExchangeRateMissing,
+		Message:    "An exchange rate needed to convert to your home currency is missing",
+		StatusCode: http.StatusUnprocessableEntity,
+	},
 	ErrorInternalServer: {
 		Error:      ErrorInternalServer,
 		Message:    "Internal server error occurred",
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// ExchangeRateHandler manages the stored exchange rates
+type ExchangeRateHandler struct {
+	stores *Stores
+}
+
+// NewExchangeRateHandler creates a new ExchangeRateHandler instance
+func NewExchangeRateHandler(stores *Stores) *ExchangeRateHandler {
+	return &ExchangeRateHandler{stores: stores}
+}
+
+// ImportRates stores the rates in a CSV file sent as a multipart "file" field or as
+// the raw body. Rates already held for the same day and pair are replaced.
+func (h *ExchangeRateHandler) ImportRates(c echo.Context) error {
+	data, err := readImportUpload(c)
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Send the rates as a CSV file", http.StatusBadRequest)
+	}
+	rates, err := parseRatesCSV(bytes.NewReader(data), importRateSource)
+	if err != nil {
+		return SendCustomError(c, ErrorValidationFailed, "Invalid rates file: "+err.Error(), http.StatusBadRequest)
+	}
+	if err := h.stores.Rates.SaveRates(rates); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	first, last := rates[0].Date, rates[0].Date
+	for _, r := range rates {
+		if r.Date.Before(first) {
+			first = r.Date
+		}
+		if r.Date.After(last) {
+			last = r.Date
+		}
+	}
+
+	entry := newAuditEntry(c, "exchange_rates.import", "exchange_rates", uuid.Nil)
+	entry.Details = map[string]interface{}{"count": len(rates), "from": first.Format("2006-01-02"), "to": last.Format("2006-01-02")}
+	logAudit(h.stores.Audit, entry)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "Exchange rates imported successfully",
+		"imported": len(rates),
+		"from":     first.Format("2006-01-02"),
+		"to":       last.Format("2006-01-02"),
+	})
+}
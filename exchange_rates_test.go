@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRatesCSV(t *testing.T) {
+	rates, err := parseRatesCSV(strings.NewReader("Date,Base,Quote,Rate\n2024-01-15, eur, usd, 1.0945\n2024-01-15,EUR,INR,90.50\n"), importRateSource)
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, ExchangeRate{Date: day("2024-01-15"), Base: "EUR", Quote: "USD", Rate: "1.0945", Source: "import"}, rates[0])
+
+	bad := map[string]string{
+		"":                       "empty",
+		"day,from,to,rate\n":     "header",
+		"date,base,quote,rate\n": "no rates",
+		"date,base,quote,rate\n15-01-2024,EUR,USD,1.1\n": "line 2: date",
+		"date,base,quote,rate\n2024-01-15,EUR,XYZ,1.1\n": "line 2: \"XYZ\"",
+		"date,base,quote,rate\n2024-01-15,EUR,EUR,1\n":   "line 2: base and quote",
+		"date,base,quote,rate\n2024-01-15,EUR,USD,-1\n":  "line 2: rate",
+		"date,base,quote,rate\n2024-01-15,EUR,USD\n":     "wrong number of fields",
+	}
+	for input, want := range bad {
+		_, err := parseRatesCSV(strings.NewReader(input), importRateSource)
+		if assert.Error(t, err, input) {
+			assert.Contains(t, err.Error(), want, input)
+		}
+	}
+}
+
+func TestFrankfurterProvider(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"amount":1.0,"base":"EUR","start_date":"2024-01-15","end_date":"2024-01-16",
+			"rates":{"2024-01-15":{"USD":1.0945,"INR":90.5},"2024-01-16":{"USD":1.088}}}`))
+	}))
+	defer server.Close()
+
+	provider := newRateProvider(CurrencyConfig{RatesProvider: "frankfurter", RatesProviderURL: server.URL + "/", RatesBase: "EUR"})
+	rates, err := provider.Rates(context.Background(), day("2024-01-15"), day("2024-01-16"))
+	require.NoError(t, err)
+	assert.Equal(t, "/2024-01-15..2024-01-16?from=EUR", requested)
+	require.Len(t, rates, 3)
+	assert.Equal(t, ExchangeRate{Date: day("2024-01-15"), Base: "EUR", Quote: "INR", Rate: "90.5", Source: "frankfurter"}, rates[0])
+	assert.Equal(t, "1.088", rates[2].Rate)
+}
+
+func TestSyncRates(t *testing.T) {
+	store := newMemoryStore()
+	provider := fakeRateProvider{}
+
+	// The first run backfills, later runs start from the newest stored day
+	n, err := syncRates(context.Background(), store, provider, 3*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 4*len(fakeRates), n)
+	latest, err := store.LatestRateDate("fake")
+	require.NoError(t, err)
+	assert.Equal(t, today(), latest)
+
+	n, err = syncRates(context.Background(), store, provider, 3*24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, len(fakeRates), n)
+	rates, err := store.ListRates([]string{"USD"}, today().AddDate(0, 0, -10), today())
+	require.NoError(t, err)
+	assert.Len(t, rates, 4)
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings" // Add this line
@@ -14,12 +15,12 @@ import (
 
 // ExpenseHandler handles expense-related requests
 type ExpenseHandler struct {
-	db *sql.DB
+	stores *Stores
 }
 
 // NewExpenseHandler creates a new ExpenseHandler instance
-func NewExpenseHandler(db *sql.DB) *ExpenseHandler {
-	return &ExpenseHandler{db: db}
+func NewExpenseHandler(stores *Stores) *ExpenseHandler {
+	return &ExpenseHandler{stores: stores}
 }
 
 // AddExpense handles adding a new expense
@@ -33,18 +34,52 @@ func (h *ExpenseHandler) AddExpense(c echo.Context) error {
 
 	var req AddExpenseRequest
 	if err := c.Bind(&req); err != nil {
+		if errors.Is(err, errInvalidAmount) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "Amount must be a number with at most two decimal places",
+			})
+		}
+		if errors.Is(err, errInvalidPercentage) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "Split percentages must be above 0 and at most 100 with at most two decimal places",
+			})
+		}
 		return c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error: "Invalid request body",
 		})
 	}
 
 	// Validate request
-	if strings.TrimSpace(req.Title) == "" || req.Amount <= 0 || len(req.Categories) == 0 || strings.TrimSpace(req.ExpenseDate) == "" || strings.TrimSpace(req.ExpenseTime) == "" {
+	if strings.TrimSpace(req.Title) == "" || req.Amount <= 0 || req.Amount > maxMoney || len(req.Categories) == 0 || strings.TrimSpace(req.ExpenseDate) == "" || strings.TrimSpace(req.ExpenseTime) == "" {
 		return c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error: "Missing or invalid fields",
 		})
 	}
 
+	// Divide the amount between the categories
+	shares, err := splitExpense(req.Amount, req.Categories, req.Splits)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "Invalid splits: " + err.Error(),
+		})
+	}
+
+	// Expenses without a currency are in the user's home currency
+	currency := req.Currency
+	if currency == "" {
+		user, err := h.stores.Users.GetUser(userID)
+		if err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+		currency = user.HomeCurrency
+	}
+	currency, ok := normalizeCurrency(currency)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "Currency must be an ISO 4217 code such as USD or EUR",
+		})
+	}
+
 	// Parse date and time
 	expenseDate, expenseTime, err := parseDateTime(req.ExpenseDate, req.ExpenseTime)
 	if err != nil {
@@ -53,34 +88,42 @@ func (h *ExpenseHandler) AddExpense(c echo.Context) error {
 		})
 	}
 
-	// Create expense
+	// Unverified accounts may only create a limited number of expenses
+	allowed, err := h.canCreateExpense(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if !allowed {
+		return SendCustomError(c, ErrorEmailNotVerified,
+			fmt.Sprintf("Please verify your email address to add more than %d expenses", unverifiedExpenseLimit()), http.StatusForbidden)
+	}
+
+	// Create expense and link its categories
 	expenseID := uuid.New()
 	now := time.Now()
-	query := `INSERT INTO expenses (id, user_id, title, description, amount, expense_date, expense_time, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	_, err = h.db.Exec(query, expenseID, userID, req.Title, req.Description, req.Amount, expenseDate, expenseTime, now, now)
-	if err != nil {
+	expense := &Expense{
+		ID:          expenseID,
+		UserID:      userID,
+		Title:       req.Title,
+		Description: req.Description,
+		Amount:      req.Amount,
+		Currency:    currency,
+		ExpenseDate: expenseDate,
+		ExpenseTime: expenseTime,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.stores.Expenses.CreateExpense(expense, shares); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: fmt.Sprintf("Failed to create expense: %v", err),
 		})
 	}
 
-	// Link categories
-	var categoryDetails []ExpenseCategoryDetail
-	for _, catID := range req.Categories {
-		// Insert into expense_categories
-		_, err := h.db.Exec(`INSERT INTO expense_categories (id, expense_id, category_id) VALUES ($1, $2, $3)`, uuid.New(), expenseID, catID)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Error: fmt.Sprintf("Failed to link category: %v", err),
-			})
-		}
-		// Get category details
-		var cat ExpenseCategoryDetail
-		err = h.db.QueryRow(`SELECT id, name, is_default FROM categories WHERE id = $1`, catID).Scan(&cat.ID, &cat.Name, &cat.IsDefault)
-		if err == nil {
-			categoryDetails = append(categoryDetails, cat)
-		}
-	}
+	categoryDetails := h.expenseCategories(expenseID)
+
+	entry := newAuditEntry(c, "expense.create", "expense", expenseID)
+	entry.setAfter(expenseSnapshot(h.stores.Expenses, expenseID))
+	logAudit(h.stores.Audit, entry)
 
 	// Build response
 	resp := ExpenseDetailResponse{}
@@ -90,6 +133,7 @@ func (h *ExpenseHandler) AddExpense(c echo.Context) error {
 	resp.Expense.Title = req.Title
 	resp.Expense.Description = req.Description
 	resp.Expense.Amount = req.Amount
+	resp.Expense.Currency = currency
 	resp.Expense.ExpenseDate = req.ExpenseDate
 	resp.Expense.ExpenseTime = req.ExpenseTime
 	resp.Expense.CreatedAt = now.Format(time.RFC3339)
@@ -117,18 +161,36 @@ func (h *ExpenseHandler) UpdateExpense(c echo.Context) error {
 
 	var req UpdateExpenseRequest
 	if err := c.Bind(&req); err != nil {
+		if errors.Is(err, errInvalidAmount) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "Amount must be a number with at most two decimal places",
+			})
+		}
+		if errors.Is(err, errInvalidPercentage) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "Split percentages must be above 0 and at most 100 with at most two decimal places",
+			})
+		}
 		return c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error: "Invalid request body",
 		})
 	}
 
 	// Validate request
-	if strings.TrimSpace(req.Title) == "" || req.Amount <= 0 || len(req.Categories) == 0 || strings.TrimSpace(req.ExpenseDate) == "" || strings.TrimSpace(req.ExpenseTime) == "" {
+	if strings.TrimSpace(req.Title) == "" || req.Amount <= 0 || req.Amount > maxMoney || len(req.Categories) == 0 || strings.TrimSpace(req.ExpenseDate) == "" || strings.TrimSpace(req.ExpenseTime) == "" {
 		return c.JSON(http.StatusBadRequest, ErrorResponse{
 			Error: "Missing or invalid fields",
 		})
 	}
 
+	// Divide the amount between the categories
+	shares, err := splitExpense(req.Amount, req.Categories, req.Splits)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "Invalid splits: " + err.Error(),
+		})
+	}
+
 	// Check if expense exists and belongs to user
 	exists, err := h.expenseExistsForUser(expenseID, userID)
 	if err != nil {
@@ -142,6 +204,22 @@ func (h *ExpenseHandler) UpdateExpense(c echo.Context) error {
 		})
 	}
 
+	// Without a currency the expense keeps the one it has
+	currency := req.Currency
+	if currency == "" {
+		current, err := h.stores.Expenses.GetExpense(expenseID)
+		if err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+		currency = current.Currency
+	}
+	currency, ok := normalizeCurrency(currency)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "Currency must be an ISO 4217 code such as USD or EUR",
+		})
+	}
+
 	// Parse date and time
 	expenseDate, expenseTime, err := parseDateTime(req.ExpenseDate, req.ExpenseTime)
 	if err != nil {
@@ -150,36 +228,31 @@ func (h *ExpenseHandler) UpdateExpense(c echo.Context) error {
 		})
 	}
 
-	// Update expense fields
-	query := `UPDATE expenses SET title = $2, description = $3, amount = $4, expense_date = $5, expense_time = $6, updated_at = $7 WHERE id = $1`
-	_, err = h.db.Exec(query, expenseID, req.Title, req.Description, req.Amount, expenseDate, expenseTime, time.Now())
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: "Failed to update expense",
-		})
-	}
+	entry := newAuditEntry(c, "expense.update", "expense", expenseID)
+	entry.setBefore(expenseSnapshot(h.stores.Expenses, expenseID))
 
-	// Update categories: remove old links, add new ones
-	_, err = h.db.Exec(`DELETE FROM expense_categories WHERE expense_id = $1`, expenseID)
-	if err != nil {
+	// Update expense fields and replace its category links
+	expense := &Expense{
+		ID:          expenseID,
+		UserID:      userID,
+		Title:       req.Title,
+		Description: req.Description,
+		Amount:      req.Amount,
+		Currency:    currency,
+		ExpenseDate: expenseDate,
+		ExpenseTime: expenseTime,
+		UpdatedAt:   time.Now(),
+	}
+	if err := h.stores.Expenses.UpdateExpense(expense, shares); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: "Failed to update expense categories",
+			Error: fmt.Sprintf("Failed to update expense: %v", err),
 		})
 	}
-	var categoryDetails []ExpenseCategoryDetail
-	for _, catID := range req.Categories {
-		_, err := h.db.Exec(`INSERT INTO expense_categories (id, expense_id, category_id) VALUES ($1, $2, $3)`, uuid.New(), expenseID, catID)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{
-				Error: fmt.Sprintf("Failed to link category: %v", err),
-			})
-		}
-		var cat ExpenseCategoryDetail
-		err = h.db.QueryRow(`SELECT id, name, is_default FROM categories WHERE id = $1`, catID).Scan(&cat.ID, &cat.Name, &cat.IsDefault)
-		if err == nil {
-			categoryDetails = append(categoryDetails, cat)
-		}
-	}
+
+	categoryDetails := h.expenseCategories(expenseID)
+
+	entry.setAfter(expenseSnapshot(h.stores.Expenses, expenseID))
+	logAudit(h.stores.Audit, entry)
 
 	// Build response
 	resp := ExpenseDetailResponse{}
@@ -189,6 +262,7 @@ func (h *ExpenseHandler) UpdateExpense(c echo.Context) error {
 	resp.Expense.Title = req.Title
 	resp.Expense.Description = req.Description
 	resp.Expense.Amount = req.Amount
+	resp.Expense.Currency = currency
 	resp.Expense.ExpenseDate = req.ExpenseDate
 	resp.Expense.ExpenseTime = req.ExpenseTime
 	resp.Expense.UpdatedAt = time.Now().Format(time.RFC3339)
@@ -227,13 +301,18 @@ func (h *ExpenseHandler) DeleteExpense(c echo.Context) error {
 		})
 	}
 
-	// Delete expense
-	err = h.deleteExpense(expenseID)
+	entry := newAuditEntry(c, "expense.delete", "expense", expenseID)
+	entry.setBefore(expenseSnapshot(h.stores.Expenses, expenseID))
+
+	// Delete expense; the attachment rows go with it and their files are removed afterwards
+	keys, err := h.stores.Expenses.DeleteExpense(expenseID)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: "Failed to delete expense",
 		})
 	}
+	removeAttachmentBlobs(h.stores.Blobs, keys)
+	logAudit(h.stores.Audit, entry)
 
 	return c.JSON(http.StatusOK, DeleteExpenseResponse{
 		Message: "Expense deleted successfully",
@@ -330,19 +409,33 @@ func parseDateTime(dateStr, timeStr string) (time.Time, time.Time, error) {
 	return expenseDate, expenseTime, nil
 }
 
-// createExpense / updateExpense legacy helpers removed (multi-category handled separately)
+// expenseCategories returns the categories now linked to an expense for the response body
+func (h *ExpenseHandler) expenseCategories(expenseID uuid.UUID) []ExpenseCategoryDetail {
+	expense, err := h.stores.Expenses.GetExpense(expenseID)
+	if err != nil {
+		return nil
+	}
+	return expense.Categories
+}
 
-func (h *ExpenseHandler) deleteExpense(id uuid.UUID) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	_, err := h.db.Exec(query, id)
-	return err
+// canCreateExpense reports whether the user may add another expense
+func (h *ExpenseHandler) canCreateExpense(userID uuid.UUID) (bool, error) {
+	user, err := h.stores.Users.GetUser(userID)
+	if err != nil {
+		return false, err
+	}
+	if user.EmailVerified {
+		return true, nil
+	}
+	count, err := h.stores.Expenses.CountExpenses(userID)
+	if err != nil {
+		return false, err
+	}
+	return count < unverifiedExpenseLimit(), nil
 }
 
 func (h *ExpenseHandler) expenseExistsForUser(expenseID, userID uuid.UUID) (bool, error) {
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM expenses WHERE id = $1 AND user_id = $2)`
-	err := h.db.QueryRow(query, expenseID, userID).Scan(&exists)
-	return exists, err
+	return h.stores.Expenses.ExpenseBelongsTo(expenseID, userID)
 }
 
 // ExpenseFilters holds the filtering criteria for expense queries
@@ -350,8 +443,10 @@ type ExpenseFilters struct {
 	CategoryID *uuid.UUID
 	StartDate  *time.Time
 	EndDate    *time.Time
-	MinAmount  *float64
-	MaxAmount  *float64
+	MinAmount  *Money
+	MaxAmount  *Money
+	// Limit caps the number of expenses returned; 0 means no limit
+	Limit int
 }
 
 // parseExpenseFilters extracts and validates filter parameters from query string
@@ -387,8 +482,8 @@ func (h *ExpenseHandler) parseExpenseFilters(c echo.Context) (*ExpenseFilters, e
 
 	// Parse min_amount filter
 	if minAmountStr := c.QueryParam("min_amount"); minAmountStr != "" {
-		var minAmount float64
-		if _, err := fmt.Sscanf(minAmountStr, "%f", &minAmount); err != nil || minAmount < 0 {
+		minAmount, err := ParseMoney(minAmountStr)
+		if err != nil || minAmount < 0 {
 			return nil, fmt.Errorf("invalid min_amount value")
 		}
 		filters.MinAmount = &minAmount
@@ -396,8 +491,8 @@ func (h *ExpenseHandler) parseExpenseFilters(c echo.Context) (*ExpenseFilters, e
 
 	// Parse max_amount filter
 	if maxAmountStr := c.QueryParam("max_amount"); maxAmountStr != "" {
-		var maxAmount float64
-		if _, err := fmt.Sscanf(maxAmountStr, "%f", &maxAmount); err != nil || maxAmount < 0 {
+		maxAmount, err := ParseMoney(maxAmountStr)
+		if err != nil || maxAmount < 0 {
 			return nil, fmt.Errorf("invalid max_amount value")
 		}
 		filters.MaxAmount = &maxAmount
@@ -418,150 +513,50 @@ func (h *ExpenseHandler) parseExpenseFilters(c echo.Context) (*ExpenseFilters, e
 
 // getUserExpensesWithFilters retrieves user expenses with applied filters
 func (h *ExpenseHandler) getUserExpensesWithFilters(userID uuid.UUID, filters *ExpenseFilters) ([]map[string]interface{}, error) {
-	// Build dynamic query based on provided filters
-	queryBuilder := strings.Builder{}
-	args := []interface{}{userID}
-	argIndex := 2
-
-	// Base query with potential JOIN for category filtering
-	if filters.CategoryID != nil {
-		queryBuilder.WriteString(`
-			SELECT DISTINCT e.id, e.user_id, e.title, COALESCE(e.description, '') as description, 
-			       e.amount, e.expense_date, e.expense_time, e.created_at, e.updated_at 
-			FROM expenses e 
-			JOIN expense_categories ec ON e.id = ec.expense_id 
-			WHERE e.user_id = $1`)
-	} else {
-		queryBuilder.WriteString(`
-			SELECT e.id, e.user_id, e.title, COALESCE(e.description, '') as description, 
-			       e.amount, e.expense_date, e.expense_time, e.created_at, e.updated_at 
-			FROM expenses e 
-			WHERE e.user_id = $1`)
-	}
-
-	// Add category filter if specified
-	if filters.CategoryID != nil {
-		queryBuilder.WriteString(fmt.Sprintf(" AND ec.category_id = $%d", argIndex))
-		args = append(args, *filters.CategoryID)
-		argIndex++
-	}
-
-	// Add date range filters
-	if filters.StartDate != nil {
-		queryBuilder.WriteString(fmt.Sprintf(" AND e.expense_date >= $%d", argIndex))
-		args = append(args, *filters.StartDate)
-		argIndex++
-	}
-	if filters.EndDate != nil {
-		queryBuilder.WriteString(fmt.Sprintf(" AND e.expense_date <= $%d", argIndex))
-		args = append(args, *filters.EndDate)
-		argIndex++
-	}
-
-	// Add amount range filters
-	if filters.MinAmount != nil {
-		queryBuilder.WriteString(fmt.Sprintf(" AND e.amount >= $%d", argIndex))
-		args = append(args, *filters.MinAmount)
-		argIndex++
-	}
-	if filters.MaxAmount != nil {
-		queryBuilder.WriteString(fmt.Sprintf(" AND e.amount <= $%d", argIndex))
-		args = append(args, *filters.MaxAmount)
-		argIndex++
-	}
-
-	// Always order by creation date (newest first)
-	queryBuilder.WriteString(" ORDER BY e.created_at DESC")
-
-	// Execute the dynamically built query
-	rows, err := h.db.Query(queryBuilder.String(), args...)
+	rows, err := h.stores.Expenses.ListExpenses(userID, filters)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	// Process results same as before
-	expenses := make([]map[string]interface{}, 0)
-	idOrder := make([]uuid.UUID, 0)
-	indexByID := make(map[uuid.UUID]int)
-
-	for rows.Next() {
-		var expID, uID uuid.UUID
-		var title, description string
-		var amount float64
-		var expenseDate, expenseTime, createdAt, updatedAt time.Time
-		if err := rows.Scan(&expID, &uID, &title, &description, &amount, &expenseDate, &expenseTime, &createdAt, &updatedAt); err != nil {
-			return nil, err
+	expenses := make([]map[string]interface{}, 0, len(rows))
+	for _, e := range rows {
+		description := ""
+		if e.Description != nil {
+			description = *e.Description
 		}
-		expMap := map[string]interface{}{
-			"id":           expID,
-			"user_id":      uID,
-			"title":        title,
-			"description":  description,
-			"amount":       amount,
-			"expense_date": expenseDate.Format("02-01-2006"),
-			"expense_time": expenseTime.Format("03:04 PM"),
-			"created_at":   createdAt.Format("02-01-2006 03:04:05 PM"),
-			"updated_at":   updatedAt.Format("02-01-2006 03:04:05 PM"),
-			"categories":   []map[string]interface{}{},
+		categories := make([]map[string]interface{}, 0, len(e.Categories))
+		for _, cat := range e.Categories {
+			category := map[string]interface{}{
+				"id":         cat.ID,
+				"name":       cat.Name,
+				"is_default": cat.IsDefault,
+				"amount":     cat.Amount,
+			}
+			if cat.Percentage != nil {
+				category["percentage"] = cat.Percentage
+			}
+			categories = append(categories, category)
 		}
-		indexByID[expID] = len(expenses)
-		idOrder = append(idOrder, expID)
-		expenses = append(expenses, expMap)
-	}
-
-	if len(idOrder) == 0 {
-		return expenses, nil
-	}
-
-	// Fetch and attach category information for each expense
-	if err := h.attachCategoriesToExpenses(expenses, idOrder, indexByID); err != nil {
-		return nil, err
+		expenses = append(expenses, map[string]interface{}{
+			"id":           e.ID,
+			"user_id":      e.UserID,
+			"title":        e.Title,
+			"description":  description,
+			"amount":       e.Amount,
+			"currency":     e.Currency,
+			"expense_date": e.ExpenseDate.Format("02-01-2006"),
+			"expense_time": e.ExpenseTime.Format("03:04 PM"),
+			"created_at":   e.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+			"updated_at":   e.UpdatedAt.Format("02-01-2006 03:04:05 PM"),
+			"categories":   categories,
+
+			"recurring_expense_id": e.RecurringExpenseID,
+		})
 	}
 
 	return expenses, nil
 }
 
-// attachCategoriesToExpenses fetches and attaches category data to expense records
-func (h *ExpenseHandler) attachCategoriesToExpenses(expenses []map[string]interface{}, idOrder []uuid.UUID, indexByID map[uuid.UUID]int) error {
-	// Build dynamic IN clause for categories
-	placeholders := make([]string, len(idOrder))
-	args := make([]interface{}, len(idOrder))
-	for i, id := range idOrder {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-		args[i] = id
-	}
-	catQuery := fmt.Sprintf(`SELECT ec.expense_id, c.id, c.name, c.is_default FROM expense_categories ec JOIN categories c ON c.id = ec.category_id WHERE ec.expense_id IN (%s) ORDER BY c.name ASC`, strings.Join(placeholders, ","))
-
-	catRows, err := h.db.Query(catQuery, args...)
-	if err != nil {
-		return err
-	}
-	defer catRows.Close()
-
-	// Attach categories to their respective expenses
-	for catRows.Next() {
-		var expID, catID uuid.UUID
-		var catName string
-		var isDefault bool
-		if err := catRows.Scan(&expID, &catID, &catName, &isDefault); err != nil {
-			return err
-		}
-		if idx, ok := indexByID[expID]; ok {
-			expense := expenses[idx]
-			cats := expense["categories"].([]map[string]interface{})
-			cats = append(cats, map[string]interface{}{
-				"id":         catID,
-				"name":       catName,
-				"is_default": isDefault,
-			})
-			expense["categories"] = cats
-		}
-	}
-
-	return nil
-}
-
 // GetMonthlyExpenseSummary handles getting monthly expense totals for chart display
 func (h *ExpenseHandler) GetMonthlyExpenseSummary(c echo.Context) error {
 	// Verify user authentication
@@ -573,127 +568,87 @@ func (h *ExpenseHandler) GetMonthlyExpenseSummary(c echo.Context) error {
 	}
 
 	// Get monthly summary data from database
-	summary, err := h.getMonthlyExpenseSummary(userID)
+	spent, err := loadSpending(h.stores, userID, time.Time{}, time.Time{})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: fmt.Sprintf("Failed to get monthly summary: %v", err),
-		})
+		return sendSpendingError(c, "monthly summary", err)
 	}
 
 	// Return summary data directly as array
-	return c.JSON(http.StatusOK, summary)
+	return c.JSON(http.StatusOK, monthlyExpenseSummary(spent))
 }
 
-// getMonthlyExpenseSummary aggregates expenses by month for the user
-func (h *ExpenseHandler) getMonthlyExpenseSummary(userID uuid.UUID) ([]map[string]interface{}, error) {
-	// SQL query to group expenses by month and sum amounts
-	query := `
-		SELECT 
-			TO_CHAR(expense_date, 'Mon YYYY') as month,
-			SUM(amount) as total
-		FROM expenses 
-		WHERE user_id = $1 
-		GROUP BY TO_CHAR(expense_date, 'YYYY-MM'), TO_CHAR(expense_date, 'Mon YYYY')
-		ORDER BY TO_CHAR(expense_date, 'YYYY-MM') DESC
-	`
-
-	rows, err := h.db.Query(query, userID)
-	if err != nil {
-		return nil, err
+// sendSpendingError reports a failed summary. A missing exchange rate is not a
+// server fault: the rates need importing before the totals can be converted.
+func sendSpendingError(c echo.Context, what string, err error) error {
+	var missing *missingRateError
+	if errors.As(err, &missing) {
+		return SendCustomError(c, ErrorExchangeRateMissing,
+			fmt.Sprintf("Cannot convert to your home currency: %v", err), http.StatusUnprocessableEntity)
 	}
-	defer rows.Close()
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{
+		Error: fmt.Sprintf("Failed to get %s: %v", what, err),
+	})
+}
 
-	// Build response array with month and total pairs
-	summary := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var month string
-		var total float64
-		if err := rows.Scan(&month, &total); err != nil {
-			return nil, err
-		}
+// monthlyExpenseSummary lists the total of every month
+func monthlyExpenseSummary(spent *spending) []map[string]interface{} {
+	months := spent.monthly()
 
-		// Add formatted entry to summary
+	// Build response array with month and total pairs
+	summary := make([]map[string]interface{}, 0, len(months))
+	for _, m := range months {
 		summary = append(summary, map[string]interface{}{
-			"month": month,
-			"total": total,
+			"month": monthLabel(m.Month),
+			"total": m.Total,
 		})
 	}
 
-	return summary, nil
+	return summary
 }
 
-// getWeeklySummary aggregates expenses by week for the last 4 weeks
-func (h *ExpenseHandler) getWeeklySummary(userID uuid.UUID) ([]map[string]interface{}, error) {
-	query := `
-		SELECT 
-			'Week ' || EXTRACT(WEEK FROM expense_date) || ', ' || EXTRACT(YEAR FROM expense_date) as week,
-			SUM(amount) as total
-		FROM expenses 
-		WHERE user_id = $1 
-		AND expense_date >= CURRENT_DATE - INTERVAL '4 weeks'
-		GROUP BY EXTRACT(YEAR FROM expense_date), EXTRACT(WEEK FROM expense_date)
-		ORDER BY EXTRACT(YEAR FROM expense_date) DESC, EXTRACT(WEEK FROM expense_date) DESC
-		LIMIT 4
-	`
-
-	rows, err := h.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	weeklySummary := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var week string
-		var total float64
-		if err := rows.Scan(&week, &total); err != nil {
-			return nil, err
-		}
+// weeklySummary lists the weeks with expenses in the last 4 weeks
+func weeklySummary(spent *spending) []map[string]interface{} {
+	weeks := paginate(spent.between(today().AddDate(0, 0, -28), time.Time{}).weekly(), 4, 0)
 
+	weeklySummary := make([]map[string]interface{}, 0, len(weeks))
+	for _, w := range weeks {
 		weeklySummary = append(weeklySummary, map[string]interface{}{
-			"week":  week,
-			"total": total,
+			"week":  fmt.Sprintf("Week %d, %d", w.Week, w.Year),
+			"total": w.Total,
 		})
 	}
 
-	return weeklySummary, nil
+	return weeklySummary
 }
 
-// getDailySummary aggregates expenses by day for the last 7 days
-func (h *ExpenseHandler) getDailySummary(userID uuid.UUID) ([]map[string]interface{}, error) {
-	query := `
-		SELECT 
-			TO_CHAR(expense_date, 'DD Mon') as day,
-			SUM(amount) as total
-		FROM expenses 
-		WHERE user_id = $1 
-		AND expense_date >= CURRENT_DATE - INTERVAL '7 days'
-		GROUP BY expense_date
-		ORDER BY expense_date DESC
-		LIMIT 7
-	`
-
-	rows, err := h.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	dailySummary := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var day string
-		var total float64
-		if err := rows.Scan(&day, &total); err != nil {
-			return nil, err
-		}
+// dailySummary lists the days with expenses in the last 7 days
+func dailySummary(spent *spending) []map[string]interface{} {
+	days := paginate(spent.between(today().AddDate(0, 0, -7), time.Time{}).daily(), 7, 0)
 
+	dailySummary := make([]map[string]interface{}, 0, len(days))
+	for _, d := range days {
 		dailySummary = append(dailySummary, map[string]interface{}{
-			"day":   day,
-			"total": total,
+			"day":   d.Date.Format("02 Jan"),
+			"total": d.Total,
 		})
 	}
 
-	return dailySummary, nil
+	return dailySummary
+}
+
+// today returns the current local date as midnight UTC, the form expense dates are parsed into
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// monthLabel turns a YYYY-MM key into "Jan 2006"
+func monthLabel(key string) string {
+	month, err := time.Parse("2006-01", key)
+	if err != nil {
+		return key
+	}
+	return month.Format("Jan 2006")
 }
 
 // GetDailySummaryPaginated handles getting paginated daily expense summary
@@ -721,15 +676,15 @@ func (h *ExpenseHandler) GetDailySummaryPaginated(c echo.Context) error {
 	}
 
 	// Get paginated daily summary
-	summary, total, err := h.getDailySummaryPaginated(userID, page, limit)
+	spent, err := loadSpending(h.stores, userID, time.Time{}, time.Time{})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: fmt.Sprintf("Failed to get daily summary: %v", err),
-		})
+		return sendSpendingError(c, "daily summary", err)
 	}
+	summary, total := dailySummaryPage(spent, page, limit)
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data":        summary,
+		"currency":    spent.Currency,
 		"page":        page,
 		"limit":       limit,
 		"total":       total,
@@ -762,15 +717,15 @@ func (h *ExpenseHandler) GetMonthlySummaryPaginated(c echo.Context) error {
 	}
 
 	// Get paginated monthly summary
-	summary, total, err := h.getMonthlySummaryPaginated(userID, page, limit)
+	spent, err := loadSpending(h.stores, userID, time.Time{}, time.Time{})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: fmt.Sprintf("Failed to get monthly summary: %v", err),
-		})
+		return sendSpendingError(c, "monthly summary", err)
 	}
+	summary, total := monthlySummaryPage(spent, page, limit)
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data":        summary,
+		"currency":    spent.Currency,
 		"page":        page,
 		"limit":       limit,
 		"total":       total,
@@ -810,17 +765,22 @@ func (h *ExpenseHandler) GetWeeklySummaryPaginated(c echo.Context) error {
 		}
 	}
 
-	// Get paginated weekly summary for the month
-	summary, total, err := h.getWeeklySummaryPaginated(userID, month, page, limit)
+	// Get paginated weekly summary for the month; an unparseable month matches no expenses
+	from, err := time.Parse("2006-01", month)
+	to := from.AddDate(0, 1, 0)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: fmt.Sprintf("Failed to get weekly summary: %v", err),
-		})
+		from, to = today(), today()
+	}
+	spent, err := loadSpending(h.stores, userID, from, to)
+	if err != nil {
+		return sendSpendingError(c, "weekly summary", err)
 	}
+	summary, total := weeklySummaryPage(spent, page, limit)
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data":        summary,
 		"month":       month,
+		"currency":    spent.Currency,
 		"page":        page,
 		"limit":       limit,
 		"total":       total,
@@ -830,176 +790,140 @@ func (h *ExpenseHandler) GetWeeklySummaryPaginated(c echo.Context) error {
 
 // Helper functions for paginated summaries
 
-// getDailySummaryPaginated gets paginated daily expense summary
-func (h *ExpenseHandler) getDailySummaryPaginated(userID uuid.UUID, page, limit int) ([]map[string]interface{}, int, error) {
-	// Get total count
-	countQuery := `
-		SELECT COUNT(DISTINCT expense_date) 
-		FROM expenses 
-		WHERE user_id = $1
-	`
-	var total int
-	err := h.db.QueryRow(countQuery, userID).Scan(&total)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Get paginated data
-	offset := (page - 1) * limit
-	query := `
-		SELECT 
-			TO_CHAR(expense_date, 'DD Mon YYYY') as day,
-			expense_date,
-			SUM(amount) as total,
-			COUNT(*) as expense_count
-		FROM expenses 
-		WHERE user_id = $1 
-		GROUP BY expense_date
-		ORDER BY expense_date DESC
-		LIMIT $2 OFFSET $3
-	`
-
-	rows, err := h.db.Query(query, userID, limit, offset)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
-
-	summary := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var day string
-		var expenseDate time.Time
-		var total float64
-		var count int
-		if err := rows.Scan(&day, &expenseDate, &total, &count); err != nil {
-			return nil, 0, err
-		}
+// dailySummaryPage gets a page of the daily expense summary and the number of days
+func dailySummaryPage(spent *spending, page, limit int) ([]map[string]interface{}, int) {
+	all := spent.daily()
+	days := paginate(all, limit, (page-1)*limit)
 
+	summary := make([]map[string]interface{}, 0, len(days))
+	for _, d := range days {
 		summary = append(summary, map[string]interface{}{
-			"day":           day,
-			"date":          expenseDate.Format("2006-01-02"),
-			"total":         total,
-			"expense_count": count,
+			"day":           d.Date.Format("02 Jan 2006"),
+			"date":          d.Date.Format("2006-01-02"),
+			"total":         d.Total,
+			"expense_count": d.Count,
 		})
 	}
 
-	return summary, total, nil
+	return summary, len(all)
 }
 
-// getMonthlySummaryPaginated gets paginated monthly expense summary
-func (h *ExpenseHandler) getMonthlySummaryPaginated(userID uuid.UUID, page, limit int) ([]map[string]interface{}, int, error) {
-	// Get total count
-	countQuery := `
-		SELECT COUNT(DISTINCT TO_CHAR(expense_date, 'YYYY-MM')) 
-		FROM expenses 
-		WHERE user_id = $1
-	`
-	var total int
-	err := h.db.QueryRow(countQuery, userID).Scan(&total)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Get paginated data
-	offset := (page - 1) * limit
-	query := `
-		SELECT 
-			TO_CHAR(expense_date, 'Mon YYYY') as month,
-			TO_CHAR(expense_date, 'YYYY-MM') as month_key,
-			SUM(amount) as total,
-			COUNT(*) as expense_count
-		FROM expenses 
-		WHERE user_id = $1 
-		GROUP BY TO_CHAR(expense_date, 'YYYY-MM'), TO_CHAR(expense_date, 'Mon YYYY')
-		ORDER BY TO_CHAR(expense_date, 'YYYY-MM') DESC
-		LIMIT $2 OFFSET $3
-	`
-
-	rows, err := h.db.Query(query, userID, limit, offset)
-	if err != nil {
-		return nil, 0, err
+// monthlySummaryPage gets a page of the monthly expense summary and the number of months
+func monthlySummaryPage(spent *spending, page, limit int) ([]map[string]interface{}, int) {
+	all := spent.monthly()
+	months := paginate(all, limit, (page-1)*limit)
+
+	summary := make([]map[string]interface{}, 0, len(months))
+	for _, m := range months {
+		summary = append(summary, map[string]interface{}{
+			"month":         monthLabel(m.Month),
+			"month_key":     m.Month,
+			"total":         m.Total,
+			"expense_count": m.Count,
+		})
 	}
-	defer rows.Close()
 
-	summary := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var month, monthKey string
-		var total float64
-		var count int
-		if err := rows.Scan(&month, &monthKey, &total, &count); err != nil {
-			return nil, 0, err
-		}
+	return summary, len(all)
+}
+
+// weeklySummaryPage gets a page of the weekly expense summary and the number of weeks
+func weeklySummaryPage(spent *spending, page, limit int) ([]map[string]interface{}, int) {
+	all := spent.weekly()
+	weeks := paginate(all, limit, (page-1)*limit)
 
+	summary := make([]map[string]interface{}, 0, len(weeks))
+	for _, w := range weeks {
 		summary = append(summary, map[string]interface{}{
-			"month":         month,
-			"month_key":     monthKey,
-			"total":         total,
-			"expense_count": count,
+			"week":          fmt.Sprintf("Week %d", w.Week),
+			"week_number":   w.Week,
+			"total":         w.Total,
+			"expense_count": w.Count,
+			"week_start":    w.Start.Format("2006-01-02"),
+			"week_end":      w.End.Format("2006-01-02"),
 		})
 	}
 
-	return summary, total, nil
+	return summary, len(all)
 }
 
-// getWeeklySummaryPaginated gets paginated weekly expense summary for a specific month
-func (h *ExpenseHandler) getWeeklySummaryPaginated(userID uuid.UUID, month string, page, limit int) ([]map[string]interface{}, int, error) {
-	// Get total count for the month
-	countQuery := `
-		SELECT COUNT(DISTINCT EXTRACT(WEEK FROM expense_date)) 
-		FROM expenses 
-		WHERE user_id = $1 AND TO_CHAR(expense_date, 'YYYY-MM') = $2
-	`
-	var total int
-	err := h.db.QueryRow(countQuery, userID, month).Scan(&total)
+// GetCategorySummary handles getting the spending per category between optional
+// start_date and end_date (both inclusive). A multi-category expense counts only its
+// share in each category, so the category totals add up to the period's total.
+func (h *ExpenseHandler) GetCategorySummary(c echo.Context) error {
+	// Verify user authentication
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{
+			Error: "Unauthorized",
+		})
+	}
+
+	// Parse the date range
+	var from, to time.Time
+	if startDateStr := c.QueryParam("start_date"); startDateStr != "" {
+		startDate, err := time.Parse("02-01-2006", startDateStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "invalid date format. Use dd-mm-yyyy",
+			})
+		}
+		from = startDate
+	}
+	if endDateStr := c.QueryParam("end_date"); endDateStr != "" {
+		endDate, err := time.Parse("02-01-2006", endDateStr)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "invalid date format. Use dd-mm-yyyy",
+			})
+		}
+		to = endDate.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{
+			Error: "start_date cannot be after end_date",
+		})
+	}
+
+	spent, err := loadSpending(h.stores, userID, from, to)
 	if err != nil {
-		return nil, 0, err
-	}
-
-	// Get paginated data
-	offset := (page - 1) * limit
-	query := `
-		SELECT 
-			'Week ' || EXTRACT(WEEK FROM expense_date) as week,
-			EXTRACT(WEEK FROM expense_date) as week_number,
-			SUM(amount) as total,
-			COUNT(*) as expense_count,
-			MIN(expense_date) as week_start,
-			MAX(expense_date) as week_end
-		FROM expenses 
-		WHERE user_id = $1 AND TO_CHAR(expense_date, 'YYYY-MM') = $2
-		GROUP BY EXTRACT(WEEK FROM expense_date)
-		ORDER BY EXTRACT(WEEK FROM expense_date) DESC
-		LIMIT $3 OFFSET $4
-	`
-
-	rows, err := h.db.Query(query, userID, month, limit, offset)
+		return sendSpendingError(c, "category summary", err)
+	}
+	categories, err := loadCategorySpending(h.stores, userID, from, to)
 	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
-
-	summary := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var week string
-		var weekNumber int
-		var total float64
-		var count int
-		var weekStart, weekEnd time.Time
-		if err := rows.Scan(&week, &weekNumber, &total, &count, &weekStart, &weekEnd); err != nil {
-			return nil, 0, err
-		}
+		return sendSpendingError(c, "category summary", err)
+	}
+	count, total := spent.total()
 
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":          categorySummary(categories, total, 0),
+		"currency":      spent.Currency,
+		"total_amount":  total,
+		"expense_count": count,
+	})
+}
+
+// categorySummary lists the category totals with their percentage of total, at most
+// limit of them unless limit is 0
+func categorySummary(categories []CategoryTotal, total Money, limit int) []map[string]interface{} {
+	categories = paginate(categories, limit, 0)
+
+	summary := make([]map[string]interface{}, 0, len(categories))
+	for _, cat := range categories {
+		var percentage Percent
+		if total > 0 {
+			share := new(big.Rat).SetFrac(big.NewInt(int64(cat.Total)), big.NewInt(int64(total)))
+			percentage = Percent(roundMoney(share.Mul(share, big.NewRat(10000, 1))))
+		}
 		summary = append(summary, map[string]interface{}{
-			"week":          week,
-			"week_number":   weekNumber,
-			"total":         total,
-			"expense_count": count,
-			"week_start":    weekStart.Format("2006-01-02"),
-			"week_end":      weekEnd.Format("2006-01-02"),
+			"category_id":   cat.CategoryID,
+			"category_name": cat.Name,
+			"total_amount":  cat.Total,
+			"expense_count": cat.Count,
+			"percentage":    percentage,
 		})
 	}
 
-	return summary, total, nil
+	return summary
 }
 
 // GetDashboard handles getting comprehensive dashboard data for the user
@@ -1015,123 +939,66 @@ func (h *ExpenseHandler) GetDashboard(c echo.Context) error {
 	// Get dashboard data from database
 	dashboard, err := h.getDashboardData(userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: fmt.Sprintf("Failed to get dashboard data: %v", err),
-		})
+		return sendSpendingError(c, "dashboard data", err)
 	}
 
 	// Return comprehensive dashboard data
 	return c.JSON(http.StatusOK, dashboard)
 }
 
-// getDashboardData aggregates all dashboard metrics for the user
+// getDashboardData aggregates all dashboard metrics for the user. Amounts are in
+// the user's home currency, each expense converted at the rate for its date.
 func (h *ExpenseHandler) getDashboardData(userID uuid.UUID) (map[string]interface{}, error) {
-	// Get total expenses count and amount
-	totalQuery := `SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM expenses WHERE user_id = $1`
-	var totalCount int
-	var totalAmount float64
-	err := h.db.QueryRow(totalQuery, userID).Scan(&totalCount, &totalAmount)
+	day := today()
+	monthStart := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	// Weeks start on Monday
+	weekStart := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+
+	spent, err := loadSpending(h.stores, userID, time.Time{}, time.Time{})
 	if err != nil {
 		return nil, err
 	}
 
+	// Get total expenses count and amount
+	totalCount, totalAmount := spent.total()
+
 	// Get current month expenses
-	currentMonthQuery := `
-		SELECT COUNT(*), COALESCE(SUM(amount), 0) 
-		FROM expenses 
-		WHERE user_id = $1 
-		AND EXTRACT(MONTH FROM expense_date) = EXTRACT(MONTH FROM CURRENT_DATE)
-		AND EXTRACT(YEAR FROM expense_date) = EXTRACT(YEAR FROM CURRENT_DATE)
-	`
-	var currentMonthCount int
-	var currentMonthAmount float64
-	err = h.db.QueryRow(currentMonthQuery, userID).Scan(&currentMonthCount, &currentMonthAmount)
-	if err != nil {
-		return nil, err
-	}
+	currentMonthCount, currentMonthAmount := spent.between(monthStart, monthStart.AddDate(0, 1, 0)).total()
 
 	// Get current week expenses
-	currentWeekQuery := `
-		SELECT COUNT(*), COALESCE(SUM(amount), 0) 
-		FROM expenses 
-		WHERE user_id = $1 
-		AND expense_date >= DATE_TRUNC('week', CURRENT_DATE)
-		AND expense_date < DATE_TRUNC('week', CURRENT_DATE) + INTERVAL '1 week'
-	`
-	var currentWeekCount int
-	var currentWeekAmount float64
-	err = h.db.QueryRow(currentWeekQuery, userID).Scan(&currentWeekCount, &currentWeekAmount)
-	if err != nil {
-		return nil, err
-	}
+	currentWeekCount, currentWeekAmount := spent.between(weekStart, weekStart.AddDate(0, 0, 7)).total()
 
 	// Get today's expenses
-	todayQuery := `
-		SELECT COUNT(*), COALESCE(SUM(amount), 0) 
-		FROM expenses 
-		WHERE user_id = $1 
-		AND DATE(expense_date) = CURRENT_DATE
-	`
-	var todayCount int
-	var todayAmount float64
-	err = h.db.QueryRow(todayQuery, userID).Scan(&todayCount, &todayAmount)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get monthly summary for charts
-	monthlySummary, err := h.getMonthlyExpenseSummary(userID)
-	if err != nil {
-		return nil, err
-	}
+	todayCount, todayAmount := spent.between(day, day.AddDate(0, 0, 1)).total()
 
-	// Get weekly summary for the last 4 weeks
-	weeklySummary, err := h.getWeeklySummary(userID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get daily summary for the last 7 days
-	dailySummary, err := h.getDailySummary(userID)
+	// Get the categories with the most spending
+	categories, err := loadCategorySpending(h.stores, userID, time.Time{}, time.Time{})
 	if err != nil {
 		return nil, err
 	}
 
 	// Get recent expenses (last 5)
-	recentQuery := `
-		SELECT id, title, amount, expense_date, expense_time 
-		FROM expenses 
-		WHERE user_id = $1 
-		ORDER BY created_at DESC 
-		LIMIT 5
-	`
-	rows, err := h.db.Query(recentQuery, userID)
+	recent, err := h.stores.Expenses.ListExpenses(userID, &ExpenseFilters{Limit: 5})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	recentExpenses := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var id uuid.UUID
-		var title string
-		var amount float64
-		var expenseDate, expenseTime time.Time
-		if err := rows.Scan(&id, &title, &amount, &expenseDate, &expenseTime); err != nil {
-			return nil, err
-		}
+	recentExpenses := make([]map[string]interface{}, 0, len(recent))
+	for _, e := range recent {
 		recentExpenses = append(recentExpenses, map[string]interface{}{
-			"id":           id,
-			"title":        title,
-			"amount":       amount,
-			"expense_date": expenseDate.Format("02-01-2006"),
-			"expense_time": expenseTime.Format("03:04 PM"),
+			"id":           e.ID,
+			"title":        e.Title,
+			"amount":       e.Amount,
+			"currency":     e.Currency,
+			"expense_date": e.ExpenseDate.Format("02-01-2006"),
+			"expense_time": e.ExpenseTime.Format("03:04 PM"),
 		})
 	}
 
 	// Build comprehensive dashboard response
 	dashboard := map[string]interface{}{
 		"summary": map[string]interface{}{
+			"currency":             spent.Currency,
 			"total_expenses":       totalCount,
 			"total_amount":         totalAmount,
 			"current_month_count":  currentMonthCount,
@@ -1141,9 +1008,10 @@ func (h *ExpenseHandler) getDashboardData(userID uuid.UUID) (map[string]interfac
 			"today_count":          todayCount,
 			"today_amount":         todayAmount,
 		},
-		"monthly_summary": monthlySummary,
-		"weekly_summary":  weeklySummary,
-		"daily_summary":   dailySummary,
+		"monthly_summary": monthlyExpenseSummary(spent),
+		"weekly_summary":  weeklySummary(spent),
+		"daily_summary":   dailySummary(spent),
+		"top_categories":  categorySummary(categories, totalAmount, 5),
 		"recent_expenses": recentExpenses,
 	}
 
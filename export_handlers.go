@@ -0,0 +1,913 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Export archive format. Bump exportFormatVersion when a file changes shape.
+const (
+	exportFormat        = "expense-tracker-export"
+	// Version 2 added attachments and recurring expenses; version 1 archives still import
+	exportFormatVersion = 2
+	maxImportSize       = 50 << 20
+	// maxImportEntrySize caps each file once decompressed, so a small ZIP cannot expand without limit
+	maxImportEntrySize = 100 << 20
+)
+
+// A running export job refreshes its heartbeat every exportHeartbeatInterval; a
+// pending job not heard from for exportStaleAfter was left behind by a stopped server.
+const (
+	exportHeartbeatInterval = 15 * time.Second
+	exportStaleAfter        = 4 * exportHeartbeatInterval
+)
+
+// exportInterruptedMessage is shown for jobs stopped by a shutdown or a lost server
+const exportInterruptedMessage = "Export was interrupted, please try again"
+
+// Export job states
+const (
+	exportStatusPending   = "pending"
+	exportStatusCompleted = "completed"
+	exportStatusFailed    = "failed"
+)
+
+var errInvalidArchive = errors.New("invalid export archive")
+
+// exportManifest describes the archive so imports can check what they are reading
+type exportManifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	UserID     uuid.UUID `json:"user_id"`
+}
+
+type exportProfile struct {
+	ID               uuid.UUID `json:"id"`
+	Name             string    `json:"name"`
+	Email            string    `json:"email"`
+	ProfileImage     *string   `json:"profile_image"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	HomeCurrency     string    `json:"home_currency"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type exportCategory struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type exportExpense struct {
+	ID          uuid.UUID `json:"id"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	Amount      Money     `json:"amount"`
+	Currency    string    `json:"currency"`     // ISO 4217; archives from before currencies omit it
+	ExpenseDate string    `json:"expense_date"` // YYYY-MM-DD
+	ExpenseTime string    `json:"expense_time"` // HH:MM:SS
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type exportExpenseCategory struct {
+	ID         uuid.UUID `json:"id"`
+	ExpenseID  uuid.UUID `json:"expense_id"`
+	CategoryID uuid.UUID `json:"category_id"`
+	Amount     *Money    `json:"amount"`     // the expense's share; archives from before shares omit it
+	Percentage *Percent  `json:"percentage"` // set when the share was given as a percentage
+}
+
+// exportAttachment describes an attachment; its content is in the archive under File
+type exportAttachment struct {
+	ID          uuid.UUID `json:"id"`
+	ExpenseID   uuid.UUID `json:"expense_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	File        string    `json:"file"`
+	CreatedAt   time.Time `json:"created_at"`
+	storageKey  string
+}
+
+type exportRecurringExpense struct {
+	ID          uuid.UUID   `json:"id"`
+	Title       string      `json:"title"`
+	Description *string     `json:"description"`
+	Amount      Money       `json:"amount"`
+	Currency    string      `json:"currency"`
+	ExpenseTime string      `json:"expense_time"` // HH:MM:SS
+	Frequency   string      `json:"frequency"`
+	Interval    int         `json:"interval"`
+	StartDate   string      `json:"start_date"` // YYYY-MM-DD, like the other dates
+	EndDate     *string     `json:"end_date"`
+	Count       *int        `json:"count"`
+	NextDate    *string     `json:"next_date"` // null once the schedule has ended
+	Paused      bool        `json:"paused"`
+	CategoryIDs []uuid.UUID `json:"category_ids"`
+	Skipped     []string    `json:"skipped"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+type exportSession struct {
+	ID        uuid.UUID  `json:"id"`
+	UserAgent *string    `json:"user_agent"`
+	IPAddress *string    `json:"ip_address"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at"`
+	IsActive  bool       `json:"is_active"`
+}
+
+type exportLogin struct {
+	ID        uuid.UUID `json:"id"`
+	LoginAt   time.Time `json:"login_at"`
+	IPAddress *string   `json:"ip_address"`
+	UserAgent *string   `json:"user_agent"`
+	Method    string    `json:"method"`
+	Success   bool      `json:"success"`
+}
+
+// ExportHandler handles personal data export and import. Background export jobs
+// run until ctx is cancelled; Wait blocks until they have all returned.
+type ExportHandler struct {
+	db     *sql.DB
+	stores *Stores
+	ctx    context.Context
+	jobs   sync.WaitGroup
+}
+
+// NewExportHandler creates a new ExportHandler instance
+func NewExportHandler(ctx context.Context, db *sql.DB, stores *Stores) *ExportHandler {
+	return &ExportHandler{db: db, stores: stores, ctx: ctx}
+}
+
+// Wait blocks until every background export job has finished or given up
+func (h *ExportHandler) Wait() {
+	h.jobs.Wait()
+}
+
+// Export returns the user's data as a ZIP archive. Large accounts (or ?async=true)
+// get a background job instead, polled through ExportStatus.
+func (h *ExportHandler) Export(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var expenseCount int
+	if err := h.db.QueryRow(`SELECT COUNT(*) FROM expenses WHERE user_id = $1`, userID).Scan(&expenseCount); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	async, _ := strconv.ParseBool(c.QueryParam("async"))
+	if !async && expenseCount <= exportSyncMaxExpenses() {
+		archive, err := buildExportArchive(c.Request().Context(), h.db, h.stores.Blobs, userID)
+		if err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+		return sendExportArchive(c, archive, time.Now())
+	}
+
+	// Reuse a job that is still running rather than starting another, after failing
+	// any left behind by a server that stopped
+	if err := failStaleExports(h.stores.Exports); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	job, created, err := h.stores.Exports.StartExport(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if created {
+		h.jobs.Add(1)
+		go func() {
+			defer h.jobs.Done()
+			runExportJob(h.ctx, h.db, h.stores, job.ID, userID)
+		}()
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message":    "Export started. Check its status and download it when completed",
+		"export_id":  job.ID,
+		"status":     exportStatusPending,
+		"status_url": "/api/profile/export/" + job.ID.String(),
+	})
+}
+
+// ExportStatus reports the state of an export job
+func (h *ExportHandler) ExportStatus(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid export ID", http.StatusBadRequest)
+	}
+
+	job, err := h.stores.Exports.GetExport(userID, jobID)
+	if errors.Is(err, errNotFound) {
+		return SendCustomError(c, ErrorNotFound, "Export not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	resp := map[string]interface{}{
+		"export_id":  jobID,
+		"status":     job.Status,
+		"created_at": job.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+	}
+	if job.Error != nil {
+		resp["error"] = *job.Error
+	}
+	if job.CompletedAt != nil {
+		resp["completed_at"] = job.CompletedAt.Format("02-01-2006 03:04:05 PM")
+	}
+	if job.Status == exportStatusCompleted && job.ExpiresAt != nil {
+		resp["download_url"] = "/api/profile/export/" + jobID.String() + "/download"
+		resp["expires_at"] = job.ExpiresAt.Format("02-01-2006 03:04:05 PM")
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// DownloadExport returns the archive produced by a completed export job
+func (h *ExportHandler) DownloadExport(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid export ID", http.StatusBadRequest)
+	}
+
+	job, err := h.stores.Exports.ExportArchive(userID, jobID)
+	if errors.Is(err, errNotFound) {
+		return SendCustomError(c, ErrorNotFound, "Export not found, not finished or expired", http.StatusNotFound)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	completedAt := job.CreatedAt
+	if job.CompletedAt != nil {
+		completedAt = *job.CompletedAt
+	}
+	return sendExportArchive(c, job.Archive, completedAt)
+}
+
+// Import loads an export archive into the current account. Only categories and
+// expenses are imported; attachments, recurring expenses, sessions and login history
+// are kept for reference only.
+// The account must not have any expenses or custom categories yet.
+func (h *ExportHandler) Import(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	data, err := readImportUpload(c)
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Upload the export ZIP as the \"file\" form field or as the request body", http.StatusBadRequest)
+	}
+
+	var hasData bool
+	err = h.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM expenses WHERE user_id = $1)
+		    OR EXISTS(SELECT 1 FROM categories WHERE user_id = $1)`, userID).Scan(&hasData)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if hasData {
+		return SendCustomError(c, ErrorAlreadyExists, "Imports are only allowed into an account without expenses or custom categories", http.StatusConflict)
+	}
+
+	categories, expenses, links, err := readExportArchive(data)
+	if err != nil {
+		return SendCustomError(c, ErrorValidationFailed, err.Error(), http.StatusBadRequest)
+	}
+
+	// Imports must not get round the unverified expense limit
+	var verified bool
+	if err := h.db.QueryRow(`SELECT email_verified FROM users WHERE id = $1`, userID).Scan(&verified); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if !verified && len(expenses) > unverifiedExpenseLimit() {
+		return SendCustomError(c, ErrorEmailNotVerified,
+			fmt.Sprintf("Please verify your email address to import more than %d expenses", unverifiedExpenseLimit()), http.StatusForbidden)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer tx.Rollback()
+
+	imported, err := importArchiveData(tx, userID, categories, expenses, links)
+	if errors.Is(err, errInvalidArchive) {
+		return SendCustomError(c, ErrorValidationFailed, "Archive contains invalid expense data", http.StatusBadRequest)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":             "Import completed successfully",
+		"categories_imported": imported.categories,
+		"expenses_imported":   imported.expenses,
+	})
+}
+
+// runExportJob builds the archive for a queued job and stores the result. The job's
+// heartbeat is kept fresh meanwhile; if ctx is cancelled the job is failed so the
+// user can start another.
+func runExportJob(ctx context.Context, db *sql.DB, stores *Stores, jobID, userID uuid.UUID) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(exportHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := stores.Exports.HeartbeatExport(jobID); err != nil {
+					log.Printf("Export %s heartbeat failed: %v", jobID, err)
+				}
+			}
+		}
+	}()
+	archive, err := buildExportArchive(ctx, db, stores.Blobs, userID)
+	close(done)
+
+	if ctx.Err() != nil {
+		stores.Exports.FailExport(jobID, exportInterruptedMessage)
+		return
+	}
+	if err != nil {
+		log.Printf("Export %s failed: %v", jobID, err)
+		stores.Exports.FailExport(jobID, "Export failed, please try again")
+		return
+	}
+
+	if err := stores.Exports.CompleteExport(jobID, archive, time.Now().Add(exportTTL())); err != nil {
+		log.Printf("Failed to store export %s: %v", jobID, err)
+	}
+}
+
+// failStaleExports marks pending jobs whose heartbeat stopped as failed. Jobs still
+// running on this or another server keep their heartbeat fresh and are left alone.
+func failStaleExports(exports ExportStore) error {
+	return exports.FailStaleExports(time.Now().Add(-exportStaleAfter), exportInterruptedMessage)
+}
+
+// sendExportArchive writes archive as a ZIP download
+func sendExportArchive(c echo.Context, archive []byte, at time.Time) error {
+	filename := fmt.Sprintf("expense-tracker-export-%s.zip", at.Format("2006-01-02"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, "application/zip", archive)
+}
+
+// buildExportArchive collects all of the user's data into a ZIP of JSON files, with
+// the content of each attachment alongside
+func buildExportArchive(ctx context.Context, db *sql.DB, blobs BlobStore, userID uuid.UUID) ([]byte, error) {
+	var profile exportProfile
+	var profileImage sql.NullString
+	err := db.QueryRowContext(ctx,
+		`SELECT id, name, email, profile_image, email_verified, totp_enabled, home_currency, created_at, updated_at FROM users WHERE id = $1`,
+		userID,
+	).Scan(&profile.ID, &profile.Name, &profile.Email, &profileImage, &profile.EmailVerified, &profile.TwoFactorEnabled, &profile.HomeCurrency, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	profile.ProfileImage = nullStringPtr(profileImage)
+
+	categories := make([]exportCategory, 0)
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, COALESCE(is_default, false), created_at, updated_at
+		FROM categories
+		WHERE user_id = $1 OR id IN (
+			SELECT ec.category_id FROM expense_categories ec JOIN expenses e ON e.id = ec.expense_id WHERE e.user_id = $1
+		) OR id IN (
+			SELECT rc.category_id FROM recurring_expense_categories rc JOIN recurring_expenses r ON r.id = rc.recurring_expense_id WHERE r.user_id = $1
+		)
+		ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var cat exportCategory
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.IsDefault, &cat.CreatedAt, &cat.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	rows.Close()
+
+	expenses := make([]exportExpense, 0)
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, title, description, amount_minor, currency, expense_date, expense_time, created_at, updated_at
+		FROM expenses WHERE user_id = $1 ORDER BY expense_date, expense_time`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var exp exportExpense
+		var description sql.NullString
+		var expenseDate, expenseTime time.Time
+		if err := rows.Scan(&exp.ID, &exp.Title, &description, &exp.Amount, &exp.Currency, &expenseDate, &expenseTime, &exp.CreatedAt, &exp.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		exp.Description = nullStringPtr(description)
+		exp.ExpenseDate = expenseDate.Format("2006-01-02")
+		exp.ExpenseTime = expenseTime.Format("15:04:05")
+		expenses = append(expenses, exp)
+	}
+	rows.Close()
+
+	links := make([]exportExpenseCategory, 0)
+	rows, err = db.QueryContext(ctx, `
+		SELECT ec.id, ec.expense_id, ec.category_id, ec.share_minor, ec.share_percent
+		FROM expense_categories ec JOIN expenses e ON e.id = ec.expense_id
+		WHERE e.user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var link exportExpenseCategory
+		if err := rows.Scan(&link.ID, &link.ExpenseID, &link.CategoryID, &link.Amount, &link.Percentage); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	rows.Close()
+
+	attachments := make([]exportAttachment, 0)
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, expense_id, filename, content_type, size_bytes, sha256, storage_key, created_at
+		FROM expense_attachments WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a exportAttachment
+		if err := rows.Scan(&a.ID, &a.ExpenseID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.storageKey, &a.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.File = "attachments/" + a.ID.String() + "/" + cleanAttachmentName(a.Filename)
+		attachments = append(attachments, a)
+	}
+	rows.Close()
+
+	recurring := make([]exportRecurringExpense, 0)
+	byID := make(map[uuid.UUID]*exportRecurringExpense)
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, title, description, amount_minor, currency, expense_time, frequency, interval_count,
+		       start_date, end_date, occurrence_count, next_date, paused, created_at, updated_at
+		FROM recurring_expenses WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r exportRecurringExpense
+		var description sql.NullString
+		var expenseTime, startDate time.Time
+		var endDate, nextDate sql.NullTime
+		var count sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.Title, &description, &r.Amount, &r.Currency, &expenseTime, &r.Frequency, &r.Interval,
+			&startDate, &endDate, &count, &nextDate, &r.Paused, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Description = nullStringPtr(description)
+		r.ExpenseTime = expenseTime.Format("15:04:05")
+		r.StartDate = startDate.Format("2006-01-02")
+		r.EndDate, r.NextDate = nullDatePtr(endDate), nullDatePtr(nextDate)
+		if count.Valid {
+			n := int(count.Int64)
+			r.Count = &n
+		}
+		r.CategoryIDs, r.Skipped = []uuid.UUID{}, []string{}
+		recurring = append(recurring, r)
+	}
+	rows.Close()
+	for i := range recurring {
+		byID[recurring[i].ID] = &recurring[i]
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT rc.recurring_expense_id, rc.category_id
+		FROM recurring_expense_categories rc JOIN recurring_expenses r ON r.id = rc.recurring_expense_id
+		WHERE r.user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var recurringID, categoryID uuid.UUID
+		if err := rows.Scan(&recurringID, &categoryID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if r, ok := byID[recurringID]; ok {
+			r.CategoryIDs = append(r.CategoryIDs, categoryID)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT sk.recurring_expense_id, sk.occurrence_date
+		FROM recurring_expense_skips sk JOIN recurring_expenses r ON r.id = sk.recurring_expense_id
+		WHERE r.user_id = $1 ORDER BY sk.occurrence_date`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var recurringID uuid.UUID
+		var date time.Time
+		if err := rows.Scan(&recurringID, &date); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if r, ok := byID[recurringID]; ok {
+			r.Skipped = append(r.Skipped, date.Format("2006-01-02"))
+		}
+	}
+	rows.Close()
+
+	sessions := make([]exportSession, 0)
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, user_agent, ip_address, created_at, expires_at, rotated_at, is_active
+		FROM sessions WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s exportSession
+		var userAgent, ipAddress sql.NullString
+		var rotatedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &userAgent, &ipAddress, &s.CreatedAt, &s.ExpiresAt, &rotatedAt, &s.IsActive); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.UserAgent, s.IPAddress = nullStringPtr(userAgent), nullStringPtr(ipAddress)
+		if rotatedAt.Valid {
+			s.RotatedAt = &rotatedAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+	rows.Close()
+
+	logins := make([]exportLogin, 0)
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, login_at, ip_address, user_agent, method, success
+		FROM login_history WHERE user_id = $1 ORDER BY login_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var l exportLogin
+		var ipAddress, userAgent sql.NullString
+		if err := rows.Scan(&l.ID, &l.LoginAt, &ipAddress, &userAgent, &l.Method, &l.Success); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		l.IPAddress, l.UserAgent = nullStringPtr(ipAddress), nullStringPtr(userAgent)
+		logins = append(logins, l)
+	}
+	rows.Close()
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"manifest.json", exportManifest{Format: exportFormat, Version: exportFormatVersion, ExportedAt: time.Now(), UserID: userID}},
+		{"profile.json", profile},
+		{"categories.json", categories},
+		{"expenses.json", expenses},
+		{"expense_categories.json", links},
+		{"attachments.json", attachments},
+		{"recurring_expenses.json", recurring},
+		{"sessions.json", sessions},
+		{"login_history.json", logins},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, err
+		}
+	}
+	for _, a := range attachments {
+		if err := copyAttachmentToArchive(ctx, zw, blobs, a); err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", a.ID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// copyAttachmentToArchive stores the attachment's content as a.File
+func copyAttachmentToArchive(ctx context.Context, zw *zip.Writer, blobs BlobStore, a exportAttachment) error {
+	r, err := blobs.Get(ctx, a.storageKey)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Most attachments are already compressed images or PDFs
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: a.File, Method: zip.Store, Modified: a.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// readExportArchive parses the importable parts of an export archive
+func readExportArchive(data []byte) ([]exportCategory, []exportExpense, []exportExpenseCategory, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, nil, errors.New("file is not a ZIP archive")
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("archive is missing %s", name)
+		}
+		if f.UncompressedSize64 > maxImportEntrySize {
+			return fmt.Errorf("%s is too large", name)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		// The size in the header is not trusted; stop reading at the limit as well
+		limited := &io.LimitedReader{R: r, N: maxImportEntrySize + 1}
+		if err := json.NewDecoder(limited).Decode(v); err != nil {
+			if limited.N <= 0 {
+				return fmt.Errorf("%s is too large", name)
+			}
+			return fmt.Errorf("%s is not valid JSON", name)
+		}
+		return nil
+	}
+
+	var manifest exportManifest
+	if err := decode("manifest.json", &manifest); err != nil {
+		return nil, nil, nil, err
+	}
+	if manifest.Format != exportFormat || manifest.Version < 1 || manifest.Version > exportFormatVersion {
+		return nil, nil, nil, errors.New("unsupported export format or version")
+	}
+
+	var categories []exportCategory
+	var expenses []exportExpense
+	var links []exportExpenseCategory
+	if err := decode("categories.json", &categories); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := decode("expenses.json", &expenses); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := decode("expense_categories.json", &links); err != nil {
+		return nil, nil, nil, err
+	}
+	return categories, expenses, links, nil
+}
+
+type importCounts struct {
+	categories int
+	expenses   int
+}
+
+// importArchiveData recreates categories and expenses under new IDs for userID.
+// Default categories are matched by name to this server's defaults.
+func importArchiveData(tx *sql.Tx, userID uuid.UUID, categories []exportCategory, expenses []exportExpense, links []exportExpenseCategory) (importCounts, error) {
+	var counts importCounts
+	now := time.Now()
+
+	defaults := make(map[string]uuid.UUID)
+	rows, err := tx.Query(`SELECT id, name FROM categories WHERE is_default = true`)
+	if err != nil {
+		return counts, err
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return counts, err
+		}
+		defaults[name] = id
+	}
+	rows.Close()
+
+	categoryIDs := make(map[uuid.UUID]uuid.UUID)
+	for _, cat := range categories {
+		if id, ok := defaults[cat.Name]; ok && cat.IsDefault {
+			categoryIDs[cat.ID] = id
+			continue
+		}
+		id := uuid.New()
+		_, err := tx.Exec(
+			`INSERT INTO categories (id, name, user_id, is_default, created_at, updated_at) VALUES ($1, $2, $3, false, $4, $5)`,
+			id, cat.Name, userID, cat.CreatedAt, now,
+		)
+		if err != nil {
+			return counts, err
+		}
+		categoryIDs[cat.ID] = id
+		counts.categories++
+	}
+
+	// Expenses exported before currencies were recorded are in the home currency
+	var homeCurrency string
+	if err := tx.QueryRow(`SELECT home_currency FROM users WHERE id = $1`, userID).Scan(&homeCurrency); err != nil {
+		return counts, err
+	}
+
+	expenseIDs := make(map[uuid.UUID]uuid.UUID)
+	amounts := make(map[uuid.UUID]Money)
+	for _, exp := range expenses {
+		if exp.Amount <= 0 || exp.Amount > maxMoney {
+			return counts, errInvalidArchive
+		}
+		currency := homeCurrency
+		if exp.Currency != "" {
+			var ok bool
+			if currency, ok = normalizeCurrency(exp.Currency); !ok {
+				return counts, errInvalidArchive
+			}
+		}
+		expenseDate, err := time.Parse("2006-01-02", exp.ExpenseDate)
+		if err != nil {
+			return counts, errInvalidArchive
+		}
+		expenseTime, err := time.Parse("15:04:05", exp.ExpenseTime)
+		if err != nil {
+			return counts, errInvalidArchive
+		}
+		id := uuid.New()
+		_, err = tx.Exec(
+			`INSERT INTO expenses (id, user_id, title, description, amount_minor, currency, expense_date, expense_time, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			id, userID, exp.Title, exp.Description, exp.Amount, currency, expenseDate, expenseTime, exp.CreatedAt, now,
+		)
+		if err != nil {
+			return counts, err
+		}
+		expenseIDs[exp.ID] = id
+		amounts[exp.ID] = exp.Amount
+		counts.expenses++
+	}
+
+	linksByExpense := make(map[uuid.UUID][]exportExpenseCategory)
+	for _, link := range links {
+		_, ok := expenseIDs[link.ExpenseID]
+		_, ok2 := categoryIDs[link.CategoryID]
+		if !ok || !ok2 {
+			return counts, errInvalidArchive
+		}
+		linksByExpense[link.ExpenseID] = append(linksByExpense[link.ExpenseID], link)
+	}
+	for exportedID, expenseLinks := range linksByExpense {
+		shares, err := importedShares(amounts[exportedID], expenseLinks, categoryIDs)
+		if err != nil {
+			return counts, err
+		}
+		if err := linkExpenseCategories(tx, expenseIDs[exportedID], shares); err != nil {
+			return counts, err
+		}
+	}
+
+	return counts, nil
+}
+
+// importedShares maps an expense's exported links to shares in the imported
+// categories. Archives from before shares are split evenly; an expense without links
+// gets none. Linking an expense to the same category twice makes the archive invalid.
+func importedShares(total Money, links []exportExpenseCategory, categoryIDs map[uuid.UUID]uuid.UUID) ([]CategoryShare, error) {
+	shares := make([]CategoryShare, 0, len(links))
+	ids := make([]uuid.UUID, 0, len(links))
+	seen := make(map[uuid.UUID]bool, len(links))
+	var sum Money
+	for _, link := range links {
+		categoryID := categoryIDs[link.CategoryID]
+		if seen[categoryID] {
+			return nil, errInvalidArchive
+		}
+		seen[categoryID] = true
+		ids = append(ids, categoryID)
+		if link.Amount == nil {
+			continue
+		}
+		if *link.Amount < 0 {
+			return nil, errInvalidArchive
+		}
+		sum += *link.Amount
+		shares = append(shares, CategoryShare{CategoryID: categoryIDs[link.CategoryID], Amount: *link.Amount, Percentage: link.Percentage})
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+	if len(shares) == 0 {
+		return evenShares(total, ids)
+	}
+	// Shares in deleted categories were removed with them, so they may add up to less
+	if len(shares) != len(links) || sum > total {
+		return nil, errInvalidArchive
+	}
+	return shares, nil
+}
+
+// readImportUpload accepts the archive as a multipart "file" field or as the raw body
+func readImportUpload(c echo.Context) ([]byte, error) {
+	var r io.Reader = c.Request().Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data) > maxImportSize {
+		return nil, errors.New("missing or oversized upload")
+	}
+	return data, nil
+}
+
+// nullDatePtr formats a nullable DATE column as YYYY-MM-DD
+func nullDatePtr(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	date := t.Time.Format("2006-01-02")
+	return &date
+}
+
+// nullStringPtr converts a nullable column into an optional JSON value
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// exportSyncMaxExpenses returns the largest account exported inline (EXPORT_SYNC_MAX_EXPENSES, default 1000)
+func exportSyncMaxExpenses() int {
+	return config().Export.SyncMaxExpenses
+}
+
+// exportTTL returns how long a finished export can be downloaded (EXPORT_TTL, default 24h)
+func exportTTL() time.Duration {
+	return config().Export.TTL
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadExportArchive_RefusesOversizedEntries(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{Name: "manifest.json", Method: zip.Store, UncompressedSize64: maxImportEntrySize + 1, CompressedSize64: 2})
+	require.NoError(t, err)
+	_, err = w.Write([]byte("{}"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	_, _, _, err = readExportArchive(buf.Bytes())
+	assert.EqualError(t, err, "manifest.json is too large")
+}
+
+func TestFailStaleExports_LeavesRunningJobsAlone(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "exporter@example.com")
+		app.signUp(t, "other@example.com")
+
+		// One job is still beating, for example on another replica; the other stopped
+		running, stale := uuid.New(), uuid.New()
+		now := time.Now()
+		for id, job := range map[uuid.UUID]struct {
+			email     string
+			heartbeat time.Time
+		}{running: {"exporter@example.com", now}, stale: {"other@example.com", now.Add(-2 * exportStaleAfter)}} {
+			_, err := app.db.Exec(`INSERT INTO data_exports (id, user_id, status, created_at, heartbeat_at) VALUES ($1, $2, $3, $4, $4)`,
+				id, app.userID(t, job.email), exportStatusPending, job.heartbeat)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, failStaleExports(app.stores.Exports))
+		for id, want := range map[uuid.UUID]string{running: exportStatusPending, stale: exportStatusFailed} {
+			var status string
+			require.NoError(t, app.db.QueryRow(`SELECT status FROM data_exports WHERE id = $1`, id).Scan(&status))
+			assert.Equal(t, want, status)
+		}
+	})
+}
+
+// downloadExport fetches the user's archive from the inline export
+func downloadExport(t *testing.T, app *testApp, token string) []byte {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/profile/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+	return rec.Body.Bytes()
+}
+
+// rewriteArchiveEntry returns a copy of archive with the JSON in name replaced by edit's result
+func rewriteArchiveEntry(t *testing.T, archive []byte, name string, edit func(data []byte) interface{}) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		if f.Name == name {
+			data, err = json.Marshal(edit(data))
+			require.NoError(t, err)
+		}
+		w, err := zw.Create(f.Name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestExportHandler_ImportRestoresExport(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "source@example.com")
+		food := app.createCategory(t, token, "Food")
+		travel := app.createCategory(t, token, "Travel")
+		code, body := app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+			"title": "Dinner in Paris", "amount": "50.00", "currency": "EUR", "expense_date": "15-01-2024", "expense_time": "08:30 PM",
+			"categories": []string{food, travel}, "splits": []map[string]interface{}{{"category_id": food, "amount": "35.00"}},
+		})
+		require.Equal(t, http.StatusCreated, code, body)
+		code, body = app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+			"title": "Groceries", "amount": "12.34", "expense_date": "16-01-2024", "expense_time": "10:00 AM", "categories": []string{food},
+		})
+		require.Equal(t, http.StatusCreated, code, body)
+		archive := downloadExport(t, app, token)
+
+		target, _ := app.signUp(t, "target@example.com")
+		code, body = app.upload(t, "/api/profile/import", target, "export.zip", archive)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.EqualValues(t, 2, body["categories_imported"])
+		assert.EqualValues(t, 2, body["expenses_imported"])
+
+		// Importing twice would duplicate everything
+		code, _ = app.upload(t, "/api/profile/import", target, "export.zip", archive)
+		assert.Equal(t, http.StatusConflict, code)
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses", target, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		type imported struct {
+			amount, currency string
+			shares           map[string]interface{}
+		}
+		got := map[string]imported{}
+		for _, e := range body["expenses"].([]interface{}) {
+			expense := e.(map[string]interface{})
+			shares := map[string]interface{}{}
+			for _, c := range expense["categories"].([]interface{}) {
+				category := c.(map[string]interface{})
+				shares[category["name"].(string)] = category["amount"]
+			}
+			got[expense["title"].(string)] = imported{expense["amount"].(string), expense["currency"].(string), shares}
+		}
+		assert.Equal(t, map[string]imported{
+			"Dinner in Paris": {"50.00", "EUR", map[string]interface{}{"Food": "35.00", "Travel": "15.00"}},
+			"Groceries":       {"12.34", "USD", map[string]interface{}{"Food": "12.34"}},
+		}, got)
+	})
+}
+
+func TestExportHandler_ImportRejectsRepeatedLinks(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "source@example.com")
+		food := app.createCategory(t, token, "Food")
+		code, _ := app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+			"title": "Lunch", "amount": "10.00", "expense_date": "15-01-2024", "expense_time": "12:00 PM", "categories": []string{food},
+		})
+		require.Equal(t, http.StatusCreated, code)
+
+		// The same link twice, as a hand-edited archive might have it
+		archive := rewriteArchiveEntry(t, downloadExport(t, app, token), "expense_categories.json", func(data []byte) interface{} {
+			var links []exportExpenseCategory
+			require.NoError(t, json.Unmarshal(data, &links))
+			require.Len(t, links, 1)
+			half := Money(500)
+			links[0].Amount = &half
+			return append(links, links[0])
+		})
+
+		target, _ := app.signUp(t, "target@example.com")
+		code, body := app.upload(t, "/api/profile/import", target, "export.zip", archive)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+		assert.Equal(t, ErrorValidationFailed, body["error"])
+		code, body = app.do(t, http.MethodGet, "/api/expenses", target, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 0, body["count"])
+	})
+}
+
+func TestExportStore_OnePendingJobPerUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "exporter@example.com")
+		userID := app.userID(t, "exporter@example.com")
+
+		job, created, err := app.stores.Exports.StartExport(userID)
+		require.NoError(t, err)
+		assert.True(t, created)
+		again, created, err := app.stores.Exports.StartExport(userID)
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, job.ID, again.ID)
+
+		// The database refuses a second pending job even if a request raced past the check
+		if app.db != nil {
+			_, err = app.db.Exec(`INSERT INTO data_exports (id, user_id, status, created_at, heartbeat_at) VALUES ($1, $2, $3, $4, $4)`,
+				uuid.New(), userID, exportStatusPending, time.Now())
+			assert.Error(t, err)
+		}
+
+		require.NoError(t, app.stores.Exports.FailExport(job.ID, exportInterruptedMessage))
+		_, created, err = app.stores.Exports.StartExport(userID)
+		require.NoError(t, err)
+		assert.True(t, created)
+	})
+}
+
+func TestExportHandler_IncludesAttachmentsAndRecurring(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "keeper@example.com")
+		app.setEmailVerified(t, "keeper@example.com", true)
+		bills := app.createCategory(t, token, "Bills")
+		code, body := app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+			"title": "Dinner", "amount": 42, "expense_date": "15-01-2024", "expense_time": "08:30 PM", "categories": []string{bills},
+		})
+		require.Equal(t, http.StatusCreated, code)
+		expenseID := body["expense"].(map[string]interface{})["id"].(string)
+		receipt := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("x"), 100)...)
+		code, body = app.upload(t, "/api/expenses/"+expenseID+"/attachments", token, "receipt.pdf", receipt)
+		require.Equal(t, http.StatusCreated, code, body)
+
+		start := time.Now().AddDate(0, 0, 10)
+		code, body = app.do(t, http.MethodPost, "/api/recurring-expenses", token, map[string]interface{}{
+			"title": "Rent", "amount": 900, "currency": "eur", "expense_time": "09:00 AM", "categories": []string{bills},
+			"frequency": "monthly", "start_date": start.Format("02-01-2006"),
+		})
+		require.Equal(t, http.StatusCreated, code, body)
+		rent := body["recurring_expense"].(map[string]interface{})["id"].(string)
+		code, _ = app.do(t, http.MethodPost, "/api/recurring-expenses/"+rent+"/skip", token, nil)
+		require.Equal(t, http.StatusOK, code)
+
+		archive := downloadExport(t, app, token)
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		require.NoError(t, err)
+		read := func(name string) []byte {
+			f, err := zr.Open(name)
+			require.NoError(t, err, name)
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			return data
+		}
+
+		var manifest exportManifest
+		require.NoError(t, json.Unmarshal(read("manifest.json"), &manifest))
+		assert.Equal(t, exportFormatVersion, manifest.Version)
+
+		var attachments []exportAttachment
+		require.NoError(t, json.Unmarshal(read("attachments.json"), &attachments))
+		require.Len(t, attachments, 1)
+		assert.Equal(t, expenseID, attachments[0].ExpenseID.String())
+		assert.Equal(t, "receipt.pdf", attachments[0].Filename)
+		assert.Equal(t, "application/pdf", attachments[0].ContentType)
+		assert.Equal(t, receipt, read(attachments[0].File))
+
+		var recurring []exportRecurringExpense
+		require.NoError(t, json.Unmarshal(read("recurring_expenses.json"), &recurring))
+		require.Len(t, recurring, 1)
+		assert.Equal(t, rent, recurring[0].ID.String())
+		assert.Equal(t, Money(90000), recurring[0].Amount)
+		assert.Equal(t, "EUR", recurring[0].Currency)
+		assert.Equal(t, "monthly", recurring[0].Frequency)
+		assert.Equal(t, start.Format("2006-01-02"), recurring[0].StartDate)
+		assert.Equal(t, []uuid.UUID{uuid.MustParse(bills)}, recurring[0].CategoryIDs)
+		assert.Equal(t, []string{start.Format("2006-01-02")}, recurring[0].Skipped)
+
+		// The extra files are for reference; the archive still imports
+		target, _ := app.signUp(t, "copy@example.com")
+		code, body = app.upload(t, "/api/profile/import", target, "export.zip", archive)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.EqualValues(t, 1, body["expenses_imported"])
+	})
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
-	"database/sql"
+	"log"
 	"net/http"
-	"os"
+	"net/mail"
 	"strings"
 	"time"
 
@@ -15,12 +15,13 @@ import (
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	db *sql.DB
+	stores *Stores
+	mailer Mailer
 }
 
 // NewAuthHandler creates a new AuthHandler instance
-func NewAuthHandler(db *sql.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(stores *Stores, mailer Mailer) *AuthHandler {
+	return &AuthHandler{stores: stores, mailer: mailer}
 }
 
 // Register handles user registration
@@ -31,6 +32,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return SendStandardError(c, ErrorInvalidRequest)
 	}
+	req.Email = normalizeEmail(req.Email)
 
 	// Validate request
 	if err := validateRegisterRequest(req); err != nil {
@@ -38,7 +40,7 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	}
 
 	// Check if email already exists
-	exists, err := h.emailExists(req.Email)
+	exists, err := h.stores.Users.EmailExists(req.Email)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: "Internal server error",
@@ -56,20 +58,22 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		})
 	}
 
-	// Generate UUID for user
-	userID := uuid.New()
-
 	// Insert user into database
-	user, err := h.createUser(userID, req.Name, req.Email, string(passwordHash))
-	if err != nil {
+	user := &User{ID: uuid.New(), Name: req.Name, Email: req.Email, Password: string(passwordHash), HomeCurrency: defaultCurrency()}
+	if err := h.stores.Users.CreateUser(user); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: "Internal server error",
 		})
 	}
 
+	// Send verification link; the account works in a limited mode until verified
+	if err := sendVerificationEmail(h.mailer, user.ID, user.Name, user.Email); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+
 	// Return success response
 	return c.JSON(http.StatusCreated, RegisterResponse{
-		Message: "User registered successfully.",
+		Message: "User registered successfully. Please check your email to verify your address.",
 		User:    *user,
 	})
 }
@@ -100,33 +104,6 @@ func validateRegisterRequest(req RegisterRequest) error {
 	return nil
 }
 
-// emailExists checks if an email already exists in the database
-func (h *AuthHandler) emailExists(email string) (bool, error) {
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)`
-	err := h.db.QueryRow(query, email).Scan(&exists)
-	return exists, err
-}
-
-// createUser creates a new user in the database
-func (h *AuthHandler) createUser(id uuid.UUID, name, email, passwordHash string) (*User, error) {
-	query := `
-		INSERT INTO users (id, name, email, password)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, name, email, created_at, updated_at, is_active
-	`
-
-	user := &User{}
-	err := h.db.QueryRow(query, id, name, email, passwordHash).Scan(
-		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.IsActive,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return user, nil
-}
-
 // Login handles user login
 func (h *AuthHandler) Login(c echo.Context) error {
 	var req LoginRequest
@@ -136,22 +113,31 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return SendStandardError(c, ErrorInvalidRequest)
 	}
 
+	client := clientInfoFromContext(c)
+
+	// Refuse to check the password while the email or IP is locked out
+	if wait, err := loginLockout(h.stores.Users, req.Email, client.IPAddress); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	} else if wait > 0 {
+		return sendAccountLocked(c, wait)
+	}
+
 	// Validate credentials
 	user, err := h.validateCredentials(req.Email, req.Password)
 	if err != nil {
+		if err := recordLoginAttempt(h.stores.Users, req.Email, loginMethodPassword, client, false); err != nil {
+			log.Printf("Failed to record login attempt: %v", err)
+		}
 		return SendStandardError(c, ErrorInvalidCredentials)
 	}
 
-	// Generate JWT token
-	token, err := h.generateJWT(user.ID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{
-			Error: "Internal server error",
-		})
+	// With 2FA enabled the session is only created after /api/login/2fa
+	if user.TwoFactorEnabled {
+		return sendTwoFactorChallenge(c, user.ID)
 	}
 
-	// Create session record
-	sessionID, err := h.createSession(user.ID, token)
+	// Create session record with access and refresh tokens
+	tokens, err := startSession(h.stores.Sessions, user.ID, client)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: "Failed to create session",
@@ -159,25 +145,23 @@ func (h *AuthHandler) Login(c echo.Context) error {
 	}
 
 	// Record login history
-	if err := h.recordLoginHistory(user.ID); err != nil {
+	if err := recordLoginAttempt(h.stores.Users, user.Email, loginMethodPassword, client, true); err != nil {
 		// Log error but don't fail the login
 	}
+	auditLogin(h.stores.Audit, c, user.ID, tokens.SessionID, loginMethodPassword)
 
 	return c.JSON(http.StatusOK, LoginResponse{
-		Message:   "Login successful.",
-		Token:     token,
-		SessionID: sessionID.String(),
+		Message:      "Login successful.",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		SessionID:    tokens.SessionID.String(),
 	})
 }
 
 // validateCredentials validates user credentials
 func (h *AuthHandler) validateCredentials(email, password string) (*User, error) {
-	var user User
-	query := `SELECT id, name, email, password, created_at, updated_at, is_active FROM users WHERE email = $1 AND is_active = true`
-
-	err := h.db.QueryRow(query, email).Scan(
-		&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.IsActive,
-	)
+	user, err := h.stores.Users.GetUserByEmail(email)
 	if err != nil {
 		return nil, err
 	}
@@ -187,54 +171,33 @@ func (h *AuthHandler) validateCredentials(email, password string) (*User, error)
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// generateJWT generates a JWT token for the user
-func (h *AuthHandler) generateJWT(userID uuid.UUID) (string, error) {
+// generateJWT generates a short-lived access token for the user's session
+func generateJWT(userID, sessionID uuid.UUID) (string, error) {
 	claims := jwt.MapClaims{
+		"typ":     tokenTypeAccess,
+		"aud":     jwtAudience(),
 		"user_id": userID.String(),
-		"exp":     time.Now().Add(time.Hour * 48).Unix(), // 2 days
+		"sid":     sessionID.String(),
+		"exp":     time.Now().Add(accessTokenTTL()).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	// Get JWT secret from environment
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key" // Default secret - should be in .env
-	}
-
-	return token.SignedString([]byte(secret))
+	return signJWT(claims)
 }
 
-// createSession creates a new session record
-func (h *AuthHandler) createSession(userID uuid.UUID, token string) (uuid.UUID, error) {
-	sessionID := uuid.New()
-	expiresAt := time.Now().Add(time.Hour * 48) // 2 days
-	
-	query := `INSERT INTO sessions (id, user_id, token, created_at, expires_at, is_active) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := h.db.Exec(query, sessionID, userID, token, time.Now(), expiresAt, true)
+// startSession starts a new login session and issues its access and refresh tokens
+func startSession(sessions SessionStore, userID uuid.UUID, client clientInfo) (*sessionTokens, error) {
+	session, tokens, err := newSession(userID, uuid.Nil, nil, client)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
-	
-	return sessionID, nil
-}
-
-// deactivateSession deactivates a session
-func (h *AuthHandler) deactivateSession(sessionID uuid.UUID) error {
-	query := `UPDATE sessions SET is_active = false WHERE id = $1`
-	_, err := h.db.Exec(query, sessionID)
-	return err
-}
-
-// recordLoginHistory records user login in history table
-func (h *AuthHandler) recordLoginHistory(userID uuid.UUID) error {
-	query := `INSERT INTO login_history (id, user_id, login_at) VALUES ($1, $2, $3)`
-	_, err := h.db.Exec(query, uuid.New(), userID, time.Now())
-	return err
+	if err := sessions.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return tokens, nil
 }
 
 // Logout handles user logout and session cleanup
@@ -253,26 +216,38 @@ func (h *AuthHandler) Logout(c echo.Context) error {
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 	
 	// Deactivate session
-	if err := h.deactivateSessionByToken(token); err != nil {
+	if err := h.stores.Sessions.DeactivateSessionByTokenHash(hashToken(token)); err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: "Failed to logout",
 		})
 	}
+	logAudit(h.stores.Audit, newAuditEntry(c, "auth.logout", "session", getSessionIDFromContext(c)))
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "Logout successful",
 	})
 }
 
-// deactivateSessionByToken deactivates session by token
-func (h *AuthHandler) deactivateSessionByToken(token string) error {
-	query := `UPDATE sessions SET is_active = false WHERE token = $1`
-	_, err := h.db.Exec(query, token)
-	return err
+// auditLogin records a successful login; the user is not in the request context yet
+func auditLogin(audit AuditStore, c echo.Context, userID, sessionID uuid.UUID, method string) {
+	entry := newAuditEntry(c, "auth.login", "session", sessionID)
+	entry.ActorID = userID
+	entry.Details = map[string]interface{}{"method": method}
+	logAudit(audit, entry)
+}
+
+// normalizeEmail is the form addresses are stored and compared in: trimmed and lower-cased
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
-// isValidEmail performs basic email validation
+// isValidEmail checks that email is a bare RFC 5322 address with a dotted domain
 func isValidEmail(email string) bool {
-	// Basic email validation - you might want to use a more robust library
-	return strings.Contains(email, "@") && strings.Contains(email, ".")
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	return at > 0 && strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
 }
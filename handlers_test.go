@@ -0,0 +1,1106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testApp serves main's routes on one storage backend. On SQL backends db is set;
+// the handlers that query the database directly can only be used there.
+type testApp struct {
+	e      *echo.Echo
+	stores *Stores
+	audit  *auditRecorder
+	db     *sql.DB
+	// mailLog is the file the LogMailer writes sent mail to
+	mailLog string
+}
+
+// testBackend builds the stores for one test, and the database behind them if any
+type testBackend struct {
+	name   string
+	stores func(t *testing.T) (*Stores, *sql.DB)
+}
+
+// testBackends lists the backends every handler test runs on. Postgres joins them when
+// TEST_POSTGRES_URL points at a database the tests may create schemas in.
+func testBackends() []testBackend {
+	backends := []testBackend{
+		{name: "memory", stores: func(*testing.T) (*Stores, *sql.DB) { return newMemoryStores(), nil }},
+		{name: "sqlite", stores: newSQLiteTestStores},
+	}
+	if os.Getenv("TEST_POSTGRES_URL") != "" {
+		backends = append(backends, testBackend{name: "postgres", stores: newPostgresTestStores})
+	}
+	return backends
+}
+
+// newSQLiteTestStores migrates a fresh database file in the test's temp dir
+func newSQLiteTestStores(t *testing.T) (*Stores, *sql.DB) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = migrateUp(db, sqliteDialect, 0)
+	require.NoError(t, err)
+	return newSQLStores(db, sqliteDialect), db
+}
+
+// newPostgresTestStores migrates a throwaway schema, dropped when the test ends
+func newPostgresTestStores(t *testing.T) (*Stores, *sql.DB) {
+	admin, err := sql.Open("postgres", os.Getenv("TEST_POSTGRES_URL"))
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	dsn, err := url.Parse(os.Getenv("TEST_POSTGRES_URL"))
+	require.NoError(t, err)
+	query := dsn.Query()
+	query.Set("search_path", schema+",public")
+	dsn.RawQuery = query.Encode()
+	db, err := sql.Open("postgres", dsn.String())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = migrateUp(db, postgresDialect, 0)
+	require.NoError(t, err)
+	return newSQLStores(db, postgresDialect), db
+}
+
+// forEachBackend runs test as a subtest on every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, app *testApp)) {
+	for _, backend := range testBackends() {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			stores, db := backend.stores(t)
+			test(t, newTestApp(t, stores, db))
+		})
+	}
+}
+
+// forEachSQLBackend runs test on the backends with a database, for the handlers that query it directly
+func forEachSQLBackend(t *testing.T, test func(t *testing.T, app *testApp)) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		if app.db == nil {
+			t.Skip("needs a database")
+		}
+		test(t, app)
+	})
+}
+
+// withConfig runs the rest of the test with a modified copy of the default test configuration
+func withConfig(t *testing.T, modify func(cfg *Config)) {
+	cfg := defaultConfig()
+	cfg.Env = "test"
+	modify(cfg)
+	previous := appConfig
+	appConfig = cfg
+	t.Cleanup(func() { appConfig = previous })
+}
+
+// auditRecorder remembers the audited actions before storing them
+type auditRecorder struct {
+	AuditStore
+	actions []string
+}
+
+func (r *auditRecorder) RecordAudit(entry auditEntry) error {
+	r.actions = append(r.actions, entry.Action)
+	return r.AuditStore.RecordAudit(entry)
+}
+
+func newTestApp(t *testing.T, stores *Stores, db *sql.DB) *testApp {
+	t.Helper()
+	audit := &auditRecorder{AuditStore: stores.Audit}
+	stores.Audit = audit
+	stores.Blobs = &localBlobStore{Dir: t.TempDir()}
+
+	mailer := &LogMailer{Path: t.TempDir() + "/mail.log"}
+	e := echo.New()
+	registerRoutes(e, stores, newAppHandlers(context.Background(), db, sqliteDialect, stores, mailer, nil))
+	return &testApp{e: e, stores: stores, audit: audit, db: db, mailLog: mailer.Path}
+}
+
+// do sends a JSON request and decodes the JSON response
+func (a *testApp) do(t *testing.T, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var payload string
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		payload = string(data)
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(payload))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.e.ServeHTTP(rec, req)
+
+	var out map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+// upload sends data as the "file" field of a multipart form
+func (a *testApp) upload(t *testing.T, path, token, filename string, data []byte) (int, map[string]interface{}) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	a.e.ServeHTTP(rec, req)
+
+	var out map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+// signUp registers and logs in a user, returning the access and refresh tokens
+func (a *testApp) signUp(t *testing.T, email string) (string, string) {
+	t.Helper()
+	code, _ := a.do(t, http.MethodPost, "/api/register", "", map[string]string{"name": "Test User", "email": email, "password": "password123"})
+	require.Equal(t, http.StatusCreated, code)
+	code, body := a.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": email, "password": "password123"})
+	require.Equal(t, http.StatusOK, code)
+	return body["token"].(string), body["refresh_token"].(string)
+}
+
+// setEmailVerified marks the account's email address as verified or not
+func (a *testApp) setEmailVerified(t *testing.T, email string, verified bool) {
+	t.Helper()
+	if a.db != nil {
+		_, err := a.db.Exec(`UPDATE users SET email_verified = $2 WHERE LOWER(email) = LOWER($1)`, email, verified)
+		require.NoError(t, err)
+		return
+	}
+	user, err := a.stores.Users.GetUserByEmail(email)
+	require.NoError(t, err)
+	store := a.stores.Users.(*memoryStore)
+	store.mu.Lock()
+	store.users[user.ID].EmailVerified = verified
+	store.mu.Unlock()
+}
+
+// mailedToken returns the token in the link of the latest message sent to address,
+// or "" when none was sent
+func (a *testApp) mailedToken(t *testing.T, address string) string {
+	t.Helper()
+	data, err := os.ReadFile(a.mailLog)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	token := ""
+	for _, message := range strings.Split(string(data), "\n--- ") {
+		if !strings.Contains(message, "\nTo: "+address+"\n") {
+			continue
+		}
+		match := regexp.MustCompile(`token=(\S+)`).FindStringSubmatch(message)
+		require.NotNil(t, match, message)
+		token, err = url.QueryUnescape(match[1])
+		require.NoError(t, err)
+	}
+	return token
+}
+
+// setRole changes a user's role directly in the store
+func (a *testApp) setRole(t *testing.T, email, role string) {
+	t.Helper()
+	if a.db != nil {
+		_, err := a.db.Exec(`UPDATE users SET role = $2 WHERE LOWER(email) = LOWER($1)`, email, role)
+		require.NoError(t, err)
+		return
+	}
+	user, err := a.stores.Users.GetUserByEmail(email)
+	require.NoError(t, err)
+	store := a.stores.Users.(*memoryStore)
+	store.mu.Lock()
+	store.users[user.ID].Role = role
+	store.mu.Unlock()
+}
+
+func (a *testApp) createCategory(t *testing.T, token, name string) string {
+	t.Helper()
+	code, body := a.do(t, http.MethodPost, "/api/categories", token, map[string]interface{}{"name": name})
+	require.Equal(t, http.StatusCreated, code)
+	return body["category_id"].(string)
+}
+
+func TestAuthHandler_RegisterLoginLogout(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		code, body := app.do(t, http.MethodPost, "/api/register", "", map[string]string{"name": "Test User", "email": "user@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, false, body["user"].(map[string]interface{})["email_verified"])
+
+		code, _ = app.do(t, http.MethodPost, "/api/register", "", map[string]string{"name": "Test User", "email": "user@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusConflict, code)
+
+		code, body = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "user@example.com", "password": "wrong-password"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidCredentials, body["error"])
+
+		code, body = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "user@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, code)
+		token := body["token"].(string)
+
+		refresh := body["refresh_token"].(string)
+
+		code, _ = app.do(t, http.MethodPost, "/api/logout", token, nil)
+		assert.Equal(t, http.StatusOK, code)
+		code, body = app.do(t, http.MethodGet, "/api/profile", token, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorSessionExpired, body["error"])
+		code, body = app.do(t, http.MethodPost, "/api/token/refresh", "", map[string]string{"refresh_token": refresh})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidRefreshToken, body["error"])
+
+		assert.Equal(t, []string{"auth.login", "auth.logout"}, app.audit.actions)
+	})
+}
+
+func TestAuthHandler_EmailIsCaseInsensitive(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		code, body := app.do(t, http.MethodPost, "/api/register", "", map[string]string{"name": "Test User", "email": " Mixed.Case@Example.com", "password": "password123"})
+		require.Equal(t, http.StatusCreated, code, body)
+		assert.Equal(t, "mixed.case@example.com", body["user"].(map[string]interface{})["email"])
+
+		code, _ = app.do(t, http.MethodPost, "/api/register", "", map[string]string{"name": "Test User", "email": "MIXED.CASE@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusConflict, code)
+
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "Mixed.Case@EXAMPLE.com", "password": "password123"})
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
+
+func TestAuthHandler_LoginLockout(t *testing.T) {
+	withConfig(t, func(cfg *Config) { cfg.Login.MaxAttempts = 2 })
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "locked@example.com")
+
+		for i := 0; i < 2; i++ {
+			code, _ := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "locked@example.com", "password": "nope"})
+			assert.Equal(t, http.StatusUnauthorized, code)
+		}
+
+		// The right password is refused while locked
+		code, body := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "locked@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusTooManyRequests, code)
+		assert.Equal(t, ErrorAccountLocked, body["error"])
+	})
+}
+
+func TestAuthHandler_RefreshTokenReuseRevokesFamily(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		_, refresh := app.signUp(t, "refresh@example.com")
+
+		code, body := app.do(t, http.MethodPost, "/api/token/refresh", "", map[string]string{"refresh_token": refresh})
+		require.Equal(t, http.StatusOK, code)
+		rotated := body["refresh_token"].(string)
+		assert.NotEqual(t, refresh, rotated)
+
+		// A refresh is not a sign-in, so only the password login is in the history
+		code, history := app.do(t, http.MethodGet, "/api/profile/login-history", body["token"].(string), nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 1, history["total"])
+
+		code, body = app.do(t, http.MethodPost, "/api/token/refresh", "", map[string]string{"refresh_token": refresh})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorRefreshTokenReused, body["error"])
+
+		// The reuse ended the rotated session too
+		code, body = app.do(t, http.MethodPost, "/api/token/refresh", "", map[string]string{"refresh_token": rotated})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidRefreshToken, body["error"])
+	})
+}
+
+func TestSessionHandler_RevokeOtherSessionsKeepsCurrent(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		first, _ := app.signUp(t, "sessions@example.com")
+		code, body := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "sessions@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, code)
+		second := body["token"].(string)
+
+		// A token without a sid claim, as issued before sessions had IDs
+		userID := app.userID(t, "sessions@example.com")
+		legacy, err := signJWT(jwt.MapClaims{
+			"typ": tokenTypeAccess, "aud": jwtAudience(), "user_id": userID.String(),
+			"exp": time.Now().Add(time.Hour).Unix(), "iat": time.Now().Unix(),
+		})
+		require.NoError(t, err)
+		_, err = app.db.Exec(
+			`INSERT INTO sessions (id, user_id, token_hash, created_at, expires_at, is_active) VALUES ($1, $2, $3, $4, $5, true)`,
+			uuid.New(), userID, hashToken(legacy), time.Now(), time.Now().Add(time.Hour),
+		)
+		require.NoError(t, err)
+
+		code, body = app.do(t, http.MethodDelete, "/api/sessions/others", legacy, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, float64(2), body["revoked"])
+
+		code, _ = app.do(t, http.MethodGet, "/api/sessions", legacy, nil)
+		assert.Equal(t, http.StatusOK, code)
+		for _, token := range []string{first, second} {
+			code, _ = app.do(t, http.MethodGet, "/api/sessions", token, nil)
+			assert.Equal(t, http.StatusUnauthorized, code)
+		}
+	})
+}
+
+// userID looks up an active account's ID
+func (a *testApp) userID(t *testing.T, email string) uuid.UUID {
+	t.Helper()
+	user, err := a.stores.Users.GetUserByEmail(email)
+	require.NoError(t, err)
+	return user.ID
+}
+
+func TestAdminHandler_SuspensionIsNotSelfService(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "admin@example.com")
+		require.NoError(t, promoteConfiguredAdmins(app.db, []string{"admin@example.com"}))
+		code, body := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "admin@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, code)
+		admin := body["token"].(string)
+		app.signUp(t, "suspended@example.com")
+		userID := app.userID(t, "suspended@example.com").String()
+
+		code, _ = app.do(t, http.MethodPost, "/api/admin/users/"+userID+"/deactivate", admin, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, body = app.do(t, http.MethodGet, "/api/admin/users/"+userID, admin, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.NotNil(t, body["user"].(map[string]interface{})["suspended_at"])
+		assert.Nil(t, body["user"].(map[string]interface{})["deactivated_at"])
+
+		// The user cannot lift the suspension with their password
+		reactivate := map[string]string{"email": "suspended@example.com", "password": "password123"}
+		code, body = app.do(t, http.MethodPost, "/api/account/reactivate", "", reactivate)
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, ErrorForbidden, body["error"])
+
+		// Nor is the account purged, even after deactivating it long ago
+		_, err := app.db.Exec(`UPDATE users SET deactivated_at = $2 WHERE id = $1`, userID, time.Now().AddDate(-1, 0, 0))
+		require.NoError(t, err)
+		n, err := purgeDeactivatedAccounts(app.db, app.stores.Blobs, time.Hour)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+
+		code, _ = app.do(t, http.MethodPost, "/api/admin/users/"+userID+"/reactivate", admin, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", reactivate)
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
+
+func TestAccountHandler_PurgeRedactsAuditEntries(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "leaving@example.com")
+		other, _ := app.signUp(t, "staying@example.com")
+		for _, tok := range []string{token, other} {
+			code, _ := app.do(t, http.MethodPut, "/api/profile", tok, map[string]interface{}{"name": "Renamed"})
+			require.Equal(t, http.StatusOK, code)
+		}
+		userID, otherID := app.userID(t, "leaving@example.com"), app.userID(t, "staying@example.com")
+
+		code, _ := app.do(t, http.MethodPost, "/api/profile/deactivate", token, map[string]string{"password": "password123"})
+		require.Equal(t, http.StatusOK, code)
+		_, err := app.db.Exec(`UPDATE users SET deactivated_at = $2 WHERE id = $1`, userID, time.Now().AddDate(-1, 0, 0))
+		require.NoError(t, err)
+		n, err := purgeDeactivatedAccounts(app.db, app.stores.Blobs, time.Hour)
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, n)
+
+		// The purged user's entries keep what happened but lose the personal data
+		var entries, redacted int
+		require.NoError(t, app.db.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE actor_id = $1`, userID).Scan(&entries))
+		require.NoError(t, app.db.QueryRow(
+			`SELECT COUNT(*) FROM audit_log WHERE actor_id = $1 AND redacted_at IS NOT NULL AND before_data IS NULL AND after_data IS NULL AND details IS NULL AND ip_address IS NULL`,
+			userID,
+		).Scan(&redacted))
+		assert.NotZero(t, entries)
+		assert.Equal(t, entries, redacted)
+
+		var email sql.NullString
+		require.NoError(t, app.db.QueryRow(`SELECT after_data FROM audit_log WHERE actor_id = $1 AND action = 'profile.update'`, otherID).Scan(&email))
+		assert.Contains(t, email.String, "staying@example.com")
+
+		// Anything but a redaction is still refused
+		_, err = app.db.Exec(`UPDATE audit_log SET action = 'rewritten' WHERE actor_id = $1`, otherID)
+		assert.Error(t, err)
+		_, err = app.db.Exec(`UPDATE audit_log SET ip_address = '198.51.100.1', redacted_at = $2 WHERE actor_id = $1`, otherID, time.Now())
+		assert.Error(t, err)
+		_, err = app.db.Exec(`DELETE FROM audit_log WHERE actor_id = $1`, userID)
+		assert.Error(t, err)
+	})
+}
+
+func TestCategoryHandler_DuplicateAndOwnership(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		alice, _ := app.signUp(t, "alice@example.com")
+		bob, _ := app.signUp(t, "bob@example.com")
+
+		foodID := app.createCategory(t, alice, "Food")
+
+		code, _ := app.do(t, http.MethodPost, "/api/categories", alice, map[string]interface{}{"name": "food"})
+		assert.Equal(t, http.StatusConflict, code)
+
+		// Bob may use the same name and may not touch Alice's category
+		app.createCategory(t, bob, "Food")
+		code, _ = app.do(t, http.MethodPut, "/api/categories/"+foodID, bob, map[string]interface{}{"name": "Mine"})
+		assert.Equal(t, http.StatusForbidden, code)
+		code, _ = app.do(t, http.MethodDelete, "/api/categories/"+foodID, bob, nil)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, _ = app.do(t, http.MethodPut, "/api/categories/"+foodID, alice, map[string]interface{}{"name": "Groceries"})
+		assert.Equal(t, http.StatusOK, code)
+
+		code, body := app.do(t, http.MethodGet, "/api/categories", alice, nil)
+		require.Equal(t, http.StatusOK, code)
+		categories := body["categories"].([]interface{})
+		require.Len(t, categories, 1)
+		assert.Equal(t, "Groceries", categories[0].(map[string]interface{})["name"])
+	})
+}
+
+func TestExpenseHandler_CRUDAndSummaries(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "spender@example.com")
+		food := app.createCategory(t, token, "Food")
+		travel := app.createCategory(t, token, "Travel")
+
+		add := func(title string, amount float64, date string, categories ...string) string {
+			code, body := app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+				"title": title, "amount": amount, "expense_date": date, "expense_time": "09:30 AM", "categories": categories,
+			})
+			require.Equal(t, http.StatusCreated, code)
+			return body["expense"].(map[string]interface{})["id"].(string)
+		}
+		lunch := add("Lunch", 12.5, "15-01-2024", food)
+		add("Train", 40, "16-01-2024", travel)
+		add("Dinner", 30, "02-02-2024", food, travel)
+
+		code, _ := app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+			"title": "Bad", "amount": 1, "expense_date": "2024-01-01", "expense_time": "09:30 AM", "categories": []string{food},
+		})
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, body := app.do(t, http.MethodGet, "/api/expenses?category_id="+food, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 2, body["count"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses?start_date=01-02-2024", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		expenses := body["expenses"].([]interface{})
+		require.Len(t, expenses, 1)
+		assert.Len(t, expenses[0].(map[string]interface{})["categories"], 2)
+
+		code, body = app.do(t, http.MethodPut, "/api/expenses/"+lunch, token, map[string]interface{}{
+			"title": "Team lunch", "amount": 20, "expense_date": "15-01-2024", "expense_time": "12:00 PM", "categories": []string{travel},
+		})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "Travel", body["expense"].(map[string]interface{})["categories"].([]interface{})[0].(map[string]interface{})["name"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/monthly", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 2, body["total"])
+		months := body["data"].([]interface{})
+		assert.Equal(t, "Feb 2024", months[0].(map[string]interface{})["month"])
+		assert.Equal(t, "60.00", months[1].(map[string]interface{})["total"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/daily?limit=1&page=2", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 3, body["total_pages"])
+		assert.Equal(t, "16 Jan 2024", body["data"].([]interface{})[0].(map[string]interface{})["day"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/weekly?month=2024-01", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		weeks := body["data"].([]interface{})
+		require.Len(t, weeks, 1)
+		assert.EqualValues(t, 3, weeks[0].(map[string]interface{})["week_number"])
+		assert.EqualValues(t, 2, weeks[0].(map[string]interface{})["expense_count"])
+
+		code, body = app.do(t, http.MethodGet, "/api/dashboard", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		summary := body["summary"].(map[string]interface{})
+		assert.EqualValues(t, 3, summary["total_expenses"])
+		assert.Equal(t, "90.00", summary["total_amount"])
+		assert.Len(t, body["recent_expenses"], 3)
+
+		// Deleting a category unlinks it from its expenses
+		code, _ = app.do(t, http.MethodDelete, "/api/categories/"+travel, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, body = app.do(t, http.MethodGet, "/api/expenses?category_id="+travel, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 0, body["count"])
+
+		code, _ = app.do(t, http.MethodDelete, "/api/expenses/"+lunch, token, nil)
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = app.do(t, http.MethodDelete, "/api/expenses/"+lunch, token, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
+
+func TestExpenseHandler_ExactAmounts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "cents@example.com")
+		food := app.createCategory(t, token, "Food")
+
+		add := func(amount interface{}) (int, map[string]interface{}) {
+			return app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+				"title": "Snack", "amount": amount, "expense_date": "15-01-2024", "expense_time": "09:30 AM", "categories": []string{food},
+			})
+		}
+
+		// Strings and numbers are both accepted; the response always carries a string
+		code, body := add("0.10")
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, "0.10", body["expense"].(map[string]interface{})["amount"])
+		code, _ = add(0.2)
+		require.Equal(t, http.StatusCreated, code)
+		code, _ = add("123456789012.34")
+		require.Equal(t, http.StatusCreated, code)
+
+		for _, amount := range []interface{}{"12.345", 0.005, "1e3", "abc", "0", "-5", "1234567890123.00"} {
+			code, _ = add(amount)
+			assert.Equal(t, http.StatusBadRequest, code, "amount %v", amount)
+		}
+
+		code, body = app.do(t, http.MethodGet, "/api/dashboard", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "123456789012.64", body["summary"].(map[string]interface{})["total_amount"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses?min_amount=0.15&max_amount=1", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		require.EqualValues(t, 1, body["count"])
+		assert.Equal(t, "0.20", body["expenses"].([]interface{})[0].(map[string]interface{})["amount"])
+
+		code, _ = app.do(t, http.MethodGet, "/api/expenses?min_amount=0.155", token, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestExpenseHandler_MultiCurrency(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "traveller@example.com")
+		app.setRole(t, "traveller@example.com", RoleAdmin)
+		travel := app.createCategory(t, token, "Travel")
+
+		// 20 January 2024 is a Saturday, so it uses Friday's rates
+		csv := "date,base,quote,rate\n2024-01-15,EUR,USD,1.0945\n2024-01-19,EUR,USD,1.0887\n2024-01-19,EUR,INR,90.50\n"
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/exchange-rates", strings.NewReader(csv))
+		req.Header.Set(echo.HeaderContentType, "text/csv")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		app.e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, app.audit.actions, "exchange_rates.import")
+
+		add := func(amount, currency, date string) (int, map[string]interface{}) {
+			return app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+				"title": "Trip", "amount": amount, "currency": currency, "expense_date": date, "expense_time": "09:30 AM", "categories": []string{travel},
+			})
+		}
+		code, body := add("20.00", "", "15-01-2024")
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, "USD", body["expense"].(map[string]interface{})["currency"])
+		code, body = add("100.00", "eur", "15-01-2024")
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, "EUR", body["expense"].(map[string]interface{})["currency"])
+		code, _ = add("500.00", "INR", "20-01-2024")
+		require.Equal(t, http.StatusCreated, code)
+		code, _ = add("5.00", "XYZ", "20-01-2024")
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		// 20 + 100 EUR at 1.0945 + 500 INR crossed through EUR (500 * 1.0887 / 90.50 = 6.0149)
+		code, body = app.do(t, http.MethodGet, "/api/dashboard", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		summary := body["summary"].(map[string]interface{})
+		assert.Equal(t, "USD", summary["currency"])
+		assert.Equal(t, "135.46", summary["total_amount"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/daily", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		days := body["data"].([]interface{})
+		require.Len(t, days, 2)
+		assert.Equal(t, "6.01", days[0].(map[string]interface{})["total"])
+		assert.Equal(t, "129.45", days[1].(map[string]interface{})["total"])
+
+		// Switching the home currency converts the other way
+		code, _ = app.do(t, http.MethodPut, "/api/profile", token, map[string]interface{}{"name": "Traveller", "home_currency": "eur"})
+		require.Equal(t, http.StatusOK, code)
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/weekly?month=2024-01", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "EUR", body["currency"])
+		weeks := body["data"].([]interface{})
+		require.Len(t, weeks, 1)
+		assert.Equal(t, "123.80", weeks[0].(map[string]interface{})["total"])
+
+		code, _ = app.do(t, http.MethodPut, "/api/profile", token, map[string]interface{}{"name": "Traveller", "home_currency": "EURO"})
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		// Nothing converts GBP, so the totals cannot be built
+		code, _ = add("10.00", "GBP", "16-01-2024")
+		require.Equal(t, http.StatusCreated, code)
+		code, body = app.do(t, http.MethodGet, "/api/dashboard", token, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		assert.Equal(t, ErrorExchangeRateMissing, body["error"])
+	})
+}
+
+func TestExpenseHandler_CategorySplits(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "splitter@example.com")
+		food := app.createCategory(t, token, "Food")
+		travel := app.createCategory(t, token, "Travel")
+		bills := app.createCategory(t, token, "Bills")
+
+		add := func(title, amount, date string, categories []string, splits ...map[string]interface{}) (int, map[string]interface{}) {
+			return app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+				"title": title, "amount": amount, "expense_date": date, "expense_time": "09:30 AM", "categories": categories, "splits": splits,
+			})
+		}
+		shares := func(body map[string]interface{}) map[string]interface{} {
+			byName := map[string]interface{}{}
+			for _, c := range body["expense"].(map[string]interface{})["categories"].([]interface{}) {
+				category := c.(map[string]interface{})
+				byName[category["name"].(string)] = category["amount"]
+			}
+			return byName
+		}
+
+		// Without splits the amount is shared evenly, the odd cent going to the first category
+		code, body := add("Dinner", "10.00", "15-01-2024", []string{food, travel, bills})
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, map[string]interface{}{"Food": "3.34", "Travel": "3.33", "Bills": "3.33"}, shares(body))
+
+		// Categories without a split share what the others leave
+		code, body = add("Groceries", "50.00", "16-01-2024", []string{food, bills}, map[string]interface{}{"category_id": food, "amount": "30.00"})
+		require.Equal(t, http.StatusCreated, code)
+		groceries := body["expense"].(map[string]interface{})["id"].(string)
+		assert.Equal(t, map[string]interface{}{"Food": "30.00", "Bills": "20.00"}, shares(body))
+
+		code, body = add("Trip", "20.00", "02-02-2024", []string{travel, food},
+			map[string]interface{}{"category_id": travel, "percentage": 75},
+			map[string]interface{}{"category_id": food, "percentage": "25"})
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, map[string]interface{}{"Travel": "15.00", "Food": "5.00"}, shares(body))
+
+		for name, splits := range map[string][]map[string]interface{}{
+			"short of the amount":  {{"category_id": travel, "percentage": 75}, {"category_id": food, "percentage": 20}},
+			"over the amount":      {{"category_id": travel, "amount": "15.00"}, {"category_id": food, "amount": "6.00"}},
+			"unlisted category":    {{"category_id": bills, "amount": "5.00"}},
+			"amount and percent":   {{"category_id": travel, "amount": "5.00", "percentage": 25}},
+			"neither":              {{"category_id": travel}},
+			"duplicate":            {{"category_id": travel, "amount": "5.00"}, {"category_id": travel, "amount": "5.00"}},
+			"percentage above 100": {{"category_id": travel, "percentage": 120}},
+			"negative amount":      {{"category_id": travel, "amount": "-5.00"}},
+		} {
+			code, _ := add("Bad", "20.00", "02-02-2024", []string{travel, food}, splits...)
+			assert.Equal(t, http.StatusBadRequest, code, name)
+		}
+
+		// Category reports count each expense's share, so they add up to what was spent
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/categories", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "80.00", body["total_amount"])
+		data := body["data"].([]interface{})
+		require.Len(t, data, 3)
+		first := data[0].(map[string]interface{})
+		assert.Equal(t, "Food", first["category_name"])
+		assert.Equal(t, "38.34", first["total_amount"])
+		assert.EqualValues(t, 3, first["expense_count"])
+		assert.EqualValues(t, 47.93, first["percentage"])
+		assert.Equal(t, "23.33", data[1].(map[string]interface{})["total_amount"])
+		assert.Equal(t, "18.33", data[2].(map[string]interface{})["total_amount"])
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses/summary/categories?start_date=01-02-2024&end_date=29-02-2024", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		data = body["data"].([]interface{})
+		require.Len(t, data, 2)
+		assert.Equal(t, "Travel", data[0].(map[string]interface{})["category_name"])
+		assert.EqualValues(t, 75, data[0].(map[string]interface{})["percentage"])
+
+		code, _ = app.do(t, http.MethodGet, "/api/expenses/summary/categories?start_date=2024-02-01", token, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, body = app.do(t, http.MethodGet, "/api/dashboard", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		top := body["top_categories"].([]interface{})
+		require.Len(t, top, 3)
+		assert.Equal(t, "38.34", top[0].(map[string]interface{})["total_amount"])
+
+		// Updating without splits shares the new amount evenly again
+		code, body = app.do(t, http.MethodPut, "/api/expenses/"+groceries, token, map[string]interface{}{
+			"title": "Groceries", "amount": "40.00", "expense_date": "16-01-2024", "expense_time": "09:30 AM", "categories": []string{food, bills},
+		})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, map[string]interface{}{"Food": "20.00", "Bills": "20.00"}, shares(body))
+
+		code, body = app.do(t, http.MethodGet, "/api/expenses?category_id="+travel, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		for _, e := range body["expenses"].([]interface{}) {
+			expense := e.(map[string]interface{})
+			if expense["title"] == "Trip" {
+				category := expense["categories"].([]interface{})[1].(map[string]interface{})
+				assert.Equal(t, "Travel", category["name"])
+				assert.Equal(t, "15.00", category["amount"])
+				assert.EqualValues(t, 75, category["percentage"])
+			}
+		}
+	})
+}
+
+func TestRecurringExpenseHandler_Schedule(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "subscriber@example.com")
+		app.setEmailVerified(t, "subscriber@example.com", true)
+		bills := app.createCategory(t, token, "Bills")
+		date := func(days int) string { return today().AddDate(0, 0, days).Format("02-01-2006") }
+
+		// A daily schedule that started two days ago creates its past occurrences at once
+		code, body := app.do(t, http.MethodPost, "/api/recurring-expenses", token, map[string]interface{}{
+			"title": "Parking", "amount": "4.50", "expense_time": "08:00 AM", "categories": []string{bills},
+			"frequency": "daily", "start_date": date(-2), "count": 5,
+		})
+		require.Equal(t, http.StatusCreated, code, body)
+		assert.EqualValues(t, 3, body["created_expenses"])
+		recurring := body["recurring_expense"].(map[string]interface{})
+		id := recurring["id"].(string)
+		assert.Equal(t, date(1), recurring["next_date"])
+		assert.Equal(t, "USD", recurring["currency"])
+
+		// Running the scheduler again for today adds nothing
+		n, err := materializeDueRecurring(app.stores, today())
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		code, body = app.do(t, http.MethodGet, "/api/expenses", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		require.EqualValues(t, 3, body["count"])
+		expense := body["expenses"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, id, expense["recurring_expense_id"])
+		assert.Equal(t, "4.50", expense["amount"])
+		assert.Equal(t, "Bills", expense["categories"].([]interface{})[0].(map[string]interface{})["name"])
+
+		// Skip tomorrow; the preview still lists it, marked as skipped
+		code, body = app.do(t, http.MethodPost, "/api/recurring-expenses/"+id+"/skip", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, date(1), body["date"])
+		code, _ = app.do(t, http.MethodPost, "/api/recurring-expenses/"+id+"/skip", token, map[string]string{"date": date(5)})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, body = app.do(t, http.MethodGet, "/api/recurring-expenses/"+id+"/preview?count=10", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		occurrences := body["occurrences"].([]interface{})
+		require.Len(t, occurrences, 2)
+		assert.Equal(t, map[string]interface{}{"date": date(1), "skipped": true}, occurrences[0])
+		assert.Equal(t, map[string]interface{}{"date": date(2), "skipped": false}, occurrences[1])
+
+		// Two days on, the skipped occurrence is passed over and the schedule ends
+		n, err = materializeDueRecurring(app.stores, today().AddDate(0, 0, 2))
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		code, body = app.do(t, http.MethodGet, "/api/recurring-expenses/"+id, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Nil(t, body["recurring_expense"].(map[string]interface{})["next_date"])
+
+		// A paused schedule creates nothing
+		code, body = app.do(t, http.MethodPost, "/api/recurring-expenses", token, map[string]interface{}{
+			"title": "Rent", "amount": 900, "currency": "eur", "expense_time": "09:00 AM", "categories": []string{bills},
+			"frequency": "monthly", "start_date": date(1),
+		})
+		require.Equal(t, http.StatusCreated, code)
+		assert.EqualValues(t, 0, body["created_expenses"])
+		rent := body["recurring_expense"].(map[string]interface{})["id"].(string)
+		code, body = app.do(t, http.MethodPost, "/api/recurring-expenses/"+rent+"/pause", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, true, body["recurring_expense"].(map[string]interface{})["paused"])
+		n, err = materializeDueRecurring(app.stores, today().AddDate(0, 2, 0))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		code, body = app.do(t, http.MethodPost, "/api/recurring-expenses/"+rent+"/resume", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, false, body["recurring_expense"].(map[string]interface{})["paused"])
+
+		code, body = app.do(t, http.MethodGet, "/api/recurring-expenses", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 2, body["count"])
+
+		// An end date and a count cannot both be set
+		code, _ = app.do(t, http.MethodPut, "/api/recurring-expenses/"+rent, token, map[string]interface{}{
+			"title": "Rent", "amount": 900, "expense_time": "09:00 AM", "categories": []string{bills},
+			"frequency": "monthly", "start_date": date(1), "end_date": date(400), "count": 12,
+		})
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		// Other users cannot see the schedule
+		other, _ := app.signUp(t, "someone-else@example.com")
+		code, _ = app.do(t, http.MethodGet, "/api/recurring-expenses/"+rent, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		// Deleting a schedule keeps the expenses it created
+		code, _ = app.do(t, http.MethodDelete, "/api/recurring-expenses/"+id, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, body = app.do(t, http.MethodGet, "/api/expenses", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		require.EqualValues(t, 4, body["count"])
+		assert.Nil(t, body["expenses"].([]interface{})[0].(map[string]interface{})["recurring_expense_id"])
+		assert.Contains(t, app.audit.actions, "recurring_expense.skip")
+	})
+}
+
+func TestRecurringExpenseHandler_CategoriesDeleted(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "gym@example.com")
+		app.setEmailVerified(t, "gym@example.com", true)
+		sport := app.createCategory(t, token, "Sport")
+		date := func(days int) string { return today().AddDate(0, 0, days).Format("02-01-2006") }
+
+		code, body := app.do(t, http.MethodPost, "/api/recurring-expenses", token, map[string]interface{}{
+			"title": "Gym", "amount": 30, "expense_time": "07:00 AM", "categories": []string{sport},
+			"frequency": "daily", "start_date": date(1),
+		})
+		require.Equal(t, http.StatusCreated, code, body)
+		id := body["recurring_expense"].(map[string]interface{})["id"].(string)
+
+		// With its only category gone the schedule is paused instead of creating expenses
+		code, _ = app.do(t, http.MethodDelete, "/api/categories/"+sport, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		n, err := materializeDueRecurring(app.stores, today().AddDate(0, 0, 3))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		code, body = app.do(t, http.MethodGet, "/api/recurring-expenses/"+id, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, true, body["recurring_expense"].(map[string]interface{})["paused"])
+		assert.Contains(t, app.audit.actions, "recurring_expense.pause")
+
+		// It cannot be resumed until it is filed under a category again
+		code, _ = app.do(t, http.MethodPost, "/api/recurring-expenses/"+id+"/resume", token, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, body = app.do(t, http.MethodGet, "/api/expenses", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 0, body["count"])
+	})
+}
+
+func TestRecurringExpenseHandler_VerificationAndCategories(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "backfill@example.com")
+		other, _ := app.signUp(t, "neighbour@example.com")
+		bills := app.createCategory(t, token, "Bills")
+		theirs := app.createCategory(t, other, "Theirs")
+		schedule := func(categories ...string) map[string]interface{} {
+			return map[string]interface{}{
+				"title": "Parking", "amount": 4, "expense_time": "08:00 AM", "categories": categories,
+				"frequency": "daily", "start_date": today().AddDate(0, 0, -30).Format("02-01-2006"),
+			}
+		}
+
+		// Unverified accounts cannot backfill past the expense limit with a schedule
+		code, body := app.do(t, http.MethodPost, "/api/recurring-expenses", token, schedule(bills))
+		assert.Equal(t, http.StatusForbidden, code)
+		assert.Equal(t, ErrorEmailNotVerified, body["error"])
+
+		// Categories must be the caller's own, each named once
+		app.setEmailVerified(t, "backfill@example.com", true)
+		for _, categories := range [][]string{{theirs}, {uuid.NewString()}, {bills, bills}} {
+			code, body = app.do(t, http.MethodPost, "/api/recurring-expenses", token, schedule(categories...))
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, ErrorValidationFailed, body["error"])
+		}
+		code, body = app.do(t, http.MethodGet, "/api/expenses", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 0, body["count"])
+
+		code, body = app.do(t, http.MethodPost, "/api/recurring-expenses", token, schedule(bills))
+		require.Equal(t, http.StatusCreated, code, body)
+		assert.EqualValues(t, 31, body["created_expenses"])
+		id := body["recurring_expense"].(map[string]interface{})["id"].(string)
+
+		code, body = app.do(t, http.MethodPut, "/api/recurring-expenses/"+id, token, schedule(theirs))
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorValidationFailed, body["error"])
+
+		// Nor does the scheduler add expenses for an account that is no longer verified
+		app.setEmailVerified(t, "backfill@example.com", false)
+		n, err := materializeDueRecurring(app.stores, today().AddDate(0, 0, 5))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+}
+
+func TestExpenseHandler_OtherUsersExpense(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		alice, _ := app.signUp(t, "alice@example.com")
+		bob, _ := app.signUp(t, "bob@example.com")
+		food := app.createCategory(t, alice, "Food")
+
+		code, body := app.do(t, http.MethodPost, "/api/expenses", alice, map[string]interface{}{
+			"title": "Lunch", "amount": 10, "expense_date": "15-01-2024", "expense_time": "09:30 AM", "categories": []string{food},
+		})
+		require.Equal(t, http.StatusCreated, code)
+		id := body["expense"].(map[string]interface{})["id"].(string)
+
+		code, _ = app.do(t, http.MethodDelete, "/api/expenses/"+id, bob, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, body = app.do(t, http.MethodGet, "/api/expenses", bob, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 0, body["count"])
+	})
+}
+
+func TestAttachmentHandler_UploadDownloadDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		withConfig(t, func(cfg *Config) { cfg.Attachments.MaxSize = 1 << 10; cfg.Attachments.MaxPerExpense = 2 })
+		token, _ := app.signUp(t, "receipts@example.com")
+		other, _ := app.signUp(t, "someone-else@example.com")
+		food := app.createCategory(t, token, "Food")
+		code, body := app.do(t, http.MethodPost, "/api/expenses", token, map[string]interface{}{
+			"title": "Dinner", "amount": 42, "expense_date": "15-01-2024", "expense_time": "08:30 PM", "categories": []string{food},
+		})
+		require.Equal(t, http.StatusCreated, code)
+		expenseID := body["expense"].(map[string]interface{})["id"].(string)
+		path := "/api/expenses/" + expenseID + "/attachments"
+
+		// The type comes from the content, not the file name
+		png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+		code, body = app.upload(t, path, token, `C:\Users\me\receipt.txt`, png)
+		require.Equal(t, http.StatusCreated, code, body)
+		attachment := body["attachment"].(map[string]interface{})
+		sum := sha256.Sum256(png)
+		assert.Equal(t, "receipt.txt", attachment["filename"])
+		assert.Equal(t, "image/png", attachment["content_type"])
+		assert.EqualValues(t, len(png), attachment["size"])
+		assert.Equal(t, hex.EncodeToString(sum[:]), attachment["sha256"])
+		downloadURL := attachment["download_url"].(string)
+
+		code, body = app.upload(t, path, token, "notes.txt", []byte("just some text"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, code)
+		assert.Equal(t, ErrorUnsupportedMediaType, body["error"])
+		code, body = app.upload(t, path, token, "big.pdf", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("x"), 2<<10)...))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+		assert.Equal(t, "Attachments can be at most 1 KB", body["message"])
+		code, _ = app.upload(t, path, token, "empty.pdf", nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = app.upload(t, path, other, "receipt.png", png)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, body = app.do(t, http.MethodGet, path, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 1, body["count"])
+		code, _ = app.do(t, http.MethodGet, path, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		req := httptest.NewRequest(http.MethodGet, downloadURL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		app.e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, png, rec.Body.Bytes())
+		assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename=receipt.txt`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, `"`+hex.EncodeToString(sum[:])+`"`, rec.Header().Get("ETag"))
+		code, _ = app.do(t, http.MethodGet, downloadURL, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		// Deleting an attachment removes its file
+		pdf := []byte("%PDF-1.4\n%receipt")
+		code, body = app.upload(t, path, token, "receipt.pdf", pdf)
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, "application/pdf", body["attachment"].(map[string]interface{})["content_type"])
+		pdfURL := body["attachment"].(map[string]interface{})["download_url"].(string)
+		code, body = app.upload(t, path, token, "third.pdf", pdf)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "An expense can have at most 2 attachments", body["message"])
+
+		keys := attachmentKeys(t, app, expenseID)
+		require.Len(t, keys, 2)
+		code, _ = app.do(t, http.MethodDelete, pdfURL, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = app.do(t, http.MethodDelete, pdfURL, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, _ = app.do(t, http.MethodGet, pdfURL, token, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		_, err := app.stores.Blobs.Get(context.Background(), keys[1])
+		assert.ErrorIs(t, err, errBlobNotFound)
+
+		// Deleting the expense removes the rest
+		content, err := app.stores.Blobs.Get(context.Background(), keys[0])
+		require.NoError(t, err)
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, png, data)
+		code, _ = app.do(t, http.MethodDelete, "/api/expenses/"+expenseID, token, nil)
+		require.Equal(t, http.StatusOK, code)
+		_, err = app.stores.Blobs.Get(context.Background(), keys[0])
+		assert.ErrorIs(t, err, errBlobNotFound)
+		assert.Empty(t, attachmentKeys(t, app, expenseID))
+		assert.Subset(t, app.audit.actions, []string{"attachment.create", "attachment.delete"})
+	})
+}
+
+// attachmentKeys returns the storage keys of the expense's attachments, oldest first
+func attachmentKeys(t *testing.T, app *testApp, expenseID string) []string {
+	t.Helper()
+	attachments, err := app.stores.Attachments.ListAttachments(uuid.MustParse(expenseID))
+	require.NoError(t, err)
+	keys := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		keys = append(keys, a.StorageKey)
+	}
+	return keys
+}
+
+func TestProfileHandler_UpdateAndChangePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "profile@example.com")
+
+		code, _ := app.do(t, http.MethodPut, "/api/profile", token, map[string]interface{}{"name": "New Name"})
+		require.Equal(t, http.StatusOK, code)
+		code, body := app.do(t, http.MethodGet, "/api/profile", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "New Name", body["profile"].(map[string]interface{})["name"])
+
+		code, _ = app.do(t, http.MethodPut, "/api/profile/password", token, map[string]string{"current_password": "wrong-password", "new_password": "newpassword1"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = app.do(t, http.MethodPut, "/api/profile/password", token, map[string]string{"current_password": "password123", "new_password": "newpassword1"})
+		require.Equal(t, http.StatusOK, code)
+
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "profile@example.com", "password": "newpassword1"})
+		assert.Equal(t, http.StatusOK, code)
+
+		code, body = app.do(t, http.MethodGet, "/api/profile/login-history?success=true", token, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 2, body["total"])
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readinessTimeout bounds the database checks of one readiness probe
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	db       *sql.DB
+	dialect  *sqlDialect
+	draining atomic.Bool
+}
+
+// NewHealthHandler creates a new HealthHandler instance
+func NewHealthHandler(db *sql.DB, dialect *sqlDialect) *HealthHandler {
+	return &HealthHandler{db: db, dialect: dialect}
+}
+
+// StartDraining makes the readiness probe fail so load balancers stop sending new
+// requests while the server finishes the ones in flight
+func (h *HealthHandler) StartDraining() {
+	h.draining.Store(true)
+}
+
+// Liveness reports that the process is up and serving HTTP
+func (h *HealthHandler) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readiness reports whether the server can take traffic: it is not shutting down,
+// the database answers and every migration has been applied
+func (h *HealthHandler) Readiness(c echo.Context) error {
+	if h.draining.Load() {
+		return SendCustomError(c, ErrorServiceUnavailable, "Server is shutting down", http.StatusServiceUnavailable)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readinessTimeout)
+	defer cancel()
+
+	if err := h.db.PingContext(ctx); err != nil {
+		log.Printf("Readiness check: database unreachable: %v", err)
+		return SendCustomError(c, ErrorServiceUnavailable, "Database is unreachable", http.StatusServiceUnavailable)
+	}
+	pending, err := pendingMigrations(ctx, h.db, h.dialect)
+	if err != nil {
+		log.Printf("Readiness check: reading migration state failed: %v", err)
+		return SendCustomError(c, ErrorServiceUnavailable, "Migration state is unavailable", http.StatusServiceUnavailable)
+	}
+	if pending > 0 {
+		return SendCustomError(c, ErrorServiceUnavailable, fmt.Sprintf("%d migration(s) pending", pending), http.StatusServiceUnavailable)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "ready"})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler_LivenessAndReadiness(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	h := NewHealthHandler(db, sqliteDialect)
+	e := echo.New()
+	e.GET("/healthz", h.Liveness)
+	e.GET("/readyz", h.Readiness)
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, probe("/healthz"))
+
+	// Not ready until the schema is migrated
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/readyz"))
+	_, err = migrateUp(db, sqliteDialect, 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, probe("/readyz"))
+
+	// A rolled back migration makes it pending again
+	_, err = migrateDown(db, sqliteDialect, 1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/readyz"))
+	_, err = migrateUp(db, sqliteDialect, 0)
+	require.NoError(t, err)
+
+	h.StartDraining()
+	assert.Equal(t, http.StatusServiceUnavailable, probe("/readyz"))
+	assert.Equal(t, http.StatusOK, probe("/healthz"))
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	calls := 0
+	err := retryWithBackoff(5, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = retryWithBackoff(2, time.Millisecond, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	assert.ErrorContains(t, err, "giving up after 2 attempt(s): connection refused")
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// defaultJWTSecret is the development fallback for JWT_SECRET; it must never be used in production
+const defaultJWTSecret = "your-secret-key"
+
+// insecureJWTSecrets are placeholder secrets that are refused outside dev mode
+var insecureJWTSecrets = map[string]bool{
+	defaultJWTSecret:           true,
+	"your_jwt_secret_key_here": true,
+}
+
+// Token types, carried in the typ claim of every token we sign. Services verifying
+// tokens with the published keys cannot look up sessions, so typ and aud are what
+// keeps them from accepting a 2FA challenge or an email link as an access token.
+const (
+	tokenTypeAccess  = "access"
+	tokenTypePurpose = "purpose"
+)
+
+// signingKey is one entry of the JWT keyring. Keys without a private part
+// only verify tokens, which lets a retired key keep old tokens valid.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// keyring holds every key that may verify a JWT and the one that signs new ones
+type keyring struct {
+	keys    map[string]*signingKey
+	current *signingKey
+	legacy  *signingKey // verifies HMAC tokens issued before kid headers existed
+}
+
+var (
+	keyringOnce   sync.Once
+	loadedKeys    *keyring
+	loadedKeysErr error
+)
+
+// jwtKeyring returns the process-wide keyring, loading it from the configuration on first use
+func jwtKeyring() (*keyring, error) {
+	keyringOnce.Do(func() {
+		loadedKeys, loadedKeysErr = loadKeyring(config().Auth)
+	})
+	return loadedKeys, loadedKeysErr
+}
+
+// loadKeyring builds the keyring from JWT_SECRET and the PEM files in JWT_KEYS_DIR.
+// Placeholder secrets are refused in production by Config.validate.
+//
+//   - JWT_SECRET adds an HS256 key with kid JWT_SECRET_KID (default "hs256")
+//   - JWT_KEYS_DIR/<kid>.pem holds an RSA (RS256) or Ed25519 (EdDSA) private key
+//   - JWT_KEYS_DIR/<kid>.pub.pem holds a verify-only public key
+//   - JWT_SIGNING_KID picks the key that signs new tokens
+func loadKeyring(cfg AuthConfig) (*keyring, error) {
+	ring := &keyring{keys: make(map[string]*signingKey)}
+
+	secret := cfg.JWTSecret
+	if secret == "" && isDevMode() {
+		secret = defaultJWTSecret
+	}
+	if secret != "" {
+		kid := cfg.JWTSecretKID
+		ring.legacy = &signingKey{ID: kid, Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}
+		ring.keys[kid] = ring.legacy
+	}
+
+	var asymmetric []string
+	if dir := cfg.JWTKeysDir; dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			key, err := loadPEMKey(file)
+			if err != nil {
+				return nil, fmt.Errorf("loading %s: %w", file, err)
+			}
+			if _, exists := ring.keys[key.ID]; exists {
+				return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+			}
+			ring.keys[key.ID] = key
+			if key.Private != nil {
+				asymmetric = append(asymmetric, key.ID)
+			}
+		}
+	}
+
+	switch kid := cfg.JWTSigningKID; {
+	case kid != "":
+		ring.current = ring.keys[kid]
+		if ring.current == nil || ring.current.Private == nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KID %q does not name a private key", kid)
+		}
+	case len(asymmetric) == 1:
+		ring.current = ring.keys[asymmetric[0]]
+	case len(asymmetric) > 1:
+		return nil, errors.New("several private keys found in JWT_KEYS_DIR; set JWT_SIGNING_KID to choose one")
+	case ring.legacy != nil:
+		ring.current = ring.legacy
+	default:
+		return nil, errors.New("no JWT signing key configured; set JWT_SECRET or JWT_KEYS_DIR")
+	}
+
+	return ring, nil
+}
+
+// loadPEMKey reads a private or public key; the kid is the file name without extension
+func loadPEMKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	name := filepath.Base(path)
+	if strings.HasSuffix(name, ".pub.pem") {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			if pub, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+		return newSigningKey(strings.TrimSuffix(name, ".pub.pem"), nil, pub)
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if priv, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return newSigningKey(strings.TrimSuffix(name, ".pem"), priv, signer.Public())
+}
+
+// newSigningKey picks the signing method matching the key type
+func newSigningKey(kid string, priv, pub interface{}) (*signingKey, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodRS256, Private: priv, Public: pub}, nil
+	case ed25519.PublicKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}, nil
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+}
+
+// signJWT signs claims with the current key and stamps its kid in the header
+func signJWT(claims jwt.MapClaims) (string, error) {
+	ring, err := jwtKeyring()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(ring.current.Method, claims)
+	token.Header["kid"] = ring.current.ID
+	return token.SignedString(ring.current.Private)
+}
+
+// parseJWT verifies a token against the key named by its kid header
+func parseJWT(tokenString string, options ...jwt.ParserOption) (*jwt.Token, error) {
+	ring, err := jwtKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		key := ring.legacy
+		if kid, ok := token.Header["kid"].(string); ok {
+			key = ring.keys[kid]
+		}
+		if key == nil {
+			return nil, errors.New("unknown signing key")
+		}
+		// The algorithm must match the key so a public key is never used as an HMAC secret
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("invalid signing method")
+		}
+		return key.Public, nil
+	}, options...)
+}
+
+// parseAccessToken verifies an access token: its typ must be access and its
+// audience JWT_AUDIENCE, so purpose tokens signed by the same keys are refused
+func parseAccessToken(tokenString string) (*jwt.Token, error) {
+	token, err := parseJWT(tokenString, jwt.WithAudience(jwtAudience()))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || claims["typ"] != tokenTypeAccess {
+		return nil, errors.New("not an access token")
+	}
+	return token, nil
+}
+
+// jwtAudience returns the aud claim of access tokens (JWT_AUDIENCE, default expense-tracker-api)
+func jwtAudience() string {
+	return config().Auth.JWTAudience
+}
+
+// purposeAudience is the aud claim of tokens for one purpose, never the access token audience
+func purposeAudience(purpose string) string {
+	return jwtAudience() + "/" + purpose
+}
+
+// JWKS publishes the public keys so other services can verify our tokens.
+// HMAC keys are secret and never listed.
+func JWKS(c echo.Context) error {
+	ring, err := jwtKeyring()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+
+	ids := make([]string, 0, len(ring.keys))
+	for kid := range ring.keys {
+		ids = append(ids, kid)
+	}
+	sort.Strings(ids)
+
+	keys := make([]map[string]string, 0, len(ids))
+	for _, kid := range ids {
+		key := ring.keys[kid]
+		jwk := map[string]string{"kid": kid, "use": "sig", "alg": key.Method.Alg()}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// isDevMode reports whether APP_ENV marks a development environment
+func isDevMode() bool {
+	return config().IsDevelopment()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAccessToken_RefusesOtherTokens(t *testing.T) {
+	userID := uuid.New()
+
+	access, err := generateJWT(userID, uuid.New())
+	require.NoError(t, err)
+	_, err = parseAccessToken(access)
+	assert.NoError(t, err)
+
+	// A 2FA challenge is signed by the same key but is not an access token
+	challenge, err := signPurposeToken(twoFactorChallengePurpose, userID, nil, accessTokenTTL())
+	require.NoError(t, err)
+	_, err = parseAccessToken(challenge)
+	assert.Error(t, err)
+	_, _, err = parsePurposeToken(challenge, twoFactorChallengePurpose)
+	assert.NoError(t, err)
+	_, _, err = parsePurposeToken(access, twoFactorChallengePurpose)
+	assert.Error(t, err)
+
+	// Nor is a token without the typ claim, or for another audience
+	for name, claims := range map[string]jwt.MapClaims{
+		"untyped":        {"user_id": userID.String(), "aud": jwtAudience()},
+		"other audience": {"typ": tokenTypeAccess, "user_id": userID.String(), "aud": "another-service"},
+	} {
+		token, err := signJWT(claims)
+		require.NoError(t, err)
+		_, err = parseAccessToken(token)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Ways a user can sign in, as recorded in login_history.method
+const (
+	loginMethodPassword  = "password"
+	loginMethodTwoFactor = "2fa"
+	loginMethodToken     = "token" // refreshes recorded by older versions; a refresh is not a sign-in
+	loginMethodOIDC      = "oidc"
+)
+
+// loginLockout checks recent failed logins for the email and the client IP.
+// It returns how long the caller must wait, or zero when login may proceed.
+func loginLockout(users UserStore, email, ip string) (time.Duration, error) {
+	// Failures for an email only count until the next successful interactive login
+	failures, err := users.FailedLogins(normalizeEmail(email), ip, time.Now().Add(-loginAttemptWindow()))
+	if err != nil {
+		return 0, err
+	}
+
+	// A threshold of zero disables that check
+	var wait time.Duration
+	if max := loginMaxAttempts(); max > 0 && failures.EmailCount >= max && failures.EmailLast != nil {
+		wait = lockoutRemaining(*failures.EmailLast)
+	}
+	if max := loginMaxAttemptsPerIP(); max > 0 && failures.IPCount >= max && failures.IPLast != nil {
+		if w := lockoutRemaining(*failures.IPLast); w > wait {
+			wait = w
+		}
+	}
+	return wait, nil
+}
+
+// sendAccountLocked responds with the lockout error and a Retry-After header
+func sendAccountLocked(c echo.Context, wait time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return SendStandardError(c, ErrorAccountLocked)
+}
+
+// lockoutRemaining returns how much of the lockout started by lastFailure is left
+func lockoutRemaining(lastFailure time.Time) time.Duration {
+	remaining := time.Until(lastFailure.Add(loginLockoutDuration()))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// recordLoginAttempt stores a login attempt in the history table. The user is
+// looked up by email so failed attempts against a real account show in its history.
+func recordLoginAttempt(users UserStore, email, method string, client clientInfo, success bool) error {
+	return users.RecordLogin(&LoginHistory{
+		Email:     normalizeEmail(email),
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		Method:    method,
+		Success:   success,
+		LoginAt:   time.Now(),
+	})
+}
+
+// loginMaxAttempts returns how many failures an email may have before it is locked (LOGIN_MAX_ATTEMPTS, default 5)
+func loginMaxAttempts() int {
+	return config().Login.MaxAttempts
+}
+
+// loginMaxAttemptsPerIP returns how many failures one IP may have before it is locked (LOGIN_MAX_ATTEMPTS_PER_IP, default 20)
+func loginMaxAttemptsPerIP() int {
+	return config().Login.MaxAttemptsPerIP
+}
+
+// loginAttemptWindow returns how far back failed attempts are counted (LOGIN_ATTEMPT_WINDOW, default 15m)
+func loginAttemptWindow() time.Duration {
+	return config().Login.AttemptWindow
+}
+
+// loginLockoutDuration returns how long a lockout lasts after the last failure (LOGIN_LOCKOUT_DURATION, default 15m)
+func loginLockoutDuration() time.Duration {
+	return config().Login.LockoutDuration
+}
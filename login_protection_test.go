@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// login posts to /api/login from ip and returns the raw response
+func login(t *testing.T, app *testApp, email, password, ip string) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{"email": email, "password": password})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(string(data)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRealIP, ip)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginProtection_RetryAfterAndReset(t *testing.T) {
+	withConfig(t, func(cfg *Config) {
+		cfg.Login.MaxAttempts = 2
+		cfg.Login.LockoutDuration = 10 * time.Minute
+	})
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "retry@example.com")
+
+		// A successful login clears the failures counted so far
+		assert.Equal(t, http.StatusUnauthorized, login(t, app, "retry@example.com", "nope", "198.51.100.1").Code)
+		assert.Equal(t, http.StatusOK, login(t, app, "retry@example.com", "password123", "198.51.100.1").Code)
+		assert.Equal(t, http.StatusUnauthorized, login(t, app, "retry@example.com", "nope", "198.51.100.1").Code)
+		assert.Equal(t, http.StatusOK, login(t, app, "retry@example.com", "password123", "198.51.100.1").Code)
+
+		// Failures count regardless of the email's case
+		assert.Equal(t, http.StatusUnauthorized, login(t, app, "retry@example.com", "nope", "198.51.100.1").Code)
+		assert.Equal(t, http.StatusUnauthorized, login(t, app, "RETRY@example.com", "nope", "198.51.100.2").Code)
+
+		rec := login(t, app, "retry@example.com", "password123", "198.51.100.3")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, (10 * time.Minute).Seconds(), retryAfter, 5)
+	})
+}
+
+func TestLoginProtection_PerIPLimit(t *testing.T) {
+	withConfig(t, func(cfg *Config) {
+		cfg.Login.MaxAttempts = 0
+		cfg.Login.MaxAttemptsPerIP = 3
+	})
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "victim@example.com")
+
+		// Spraying passwords across accounts from one address locks that address out
+		for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+			assert.Equal(t, http.StatusUnauthorized, login(t, app, email, "guess", "203.0.113.9").Code)
+		}
+		rec := login(t, app, "victim@example.com", "password123", "203.0.113.9")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		// Other addresses are unaffected
+		assert.Equal(t, http.StatusOK, login(t, app, "victim@example.com", "password123", "203.0.113.10").Code)
+	})
+}
+
+func TestLoginProtection_LockoutExpires(t *testing.T) {
+	withConfig(t, func(cfg *Config) {
+		cfg.Login.MaxAttempts = 1
+		cfg.Login.LockoutDuration = 500 * time.Millisecond
+	})
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "expires@example.com")
+
+		assert.Equal(t, http.StatusUnauthorized, login(t, app, "expires@example.com", "nope", "192.0.2.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, login(t, app, "expires@example.com", "password123", "192.0.2.1").Code)
+
+		time.Sleep(600 * time.Millisecond)
+		assert.Equal(t, http.StatusOK, login(t, app, "expires@example.com", "password123", "192.0.2.1").Code)
+	})
+}
@@ -1,75 +1,131 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
+	// Load and validate the configuration (defaults, CONFIG_FILE, .env, environment)
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	appConfig = cfg
+
+	// Schema migrations: `api migrate up|down|status`
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		return
+	}
+
+	// Exchange rates: `api rates import <file.csv>|sync`
+	if len(os.Args) > 1 && os.Args[1] == "rates" {
+		if err := runRatesCommand(os.Args[2:]); err != nil {
+			log.Fatal("Exchange rates: ", err)
+		}
+		return
 	}
 
+	// Refuse to start with placeholder secrets or a broken keyring
+	if _, err := jwtKeyring(); err != nil {
+		log.Fatal("Invalid JWT key configuration: ", err)
+	}
+	oidcProvider := newOIDCProvider(cfg.OIDC)
+
 	// Create Echo instance
 	e := echo.New()
 
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(middleware.RequestID())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{AllowOrigins: cfg.CORSOrigins}))
 
 	// Initialize database
-	db, err := initDB()
+	db, dialect, err := initDB(cfg.Database)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
-	defer db.Close()
+
+	// Cancelled by SIGINT or SIGTERM, which stops the background jobs and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize handlers
-	authHandler := NewAuthHandler(db)
-	expenseHandler := NewExpenseHandler(db)
-	categoryHandler := NewCategoryHandler(db)
-	profileHandler := NewProfileHandler(db)
+	stores := newSQLStores(db, dialect)
+	stores.Blobs, err = newBlobStore(cfg.Attachments)
+	if err != nil {
+		log.Fatal("Failed to set up attachment storage: ", err)
+	}
+	mailer := newMailer(cfg.Mail)
+	handlers := newAppHandlers(ctx, db, dialect, stores, mailer, oidcProvider)
+
+	if err := promoteConfiguredAdmins(db, cfg.AdminEmails); err != nil {
+		log.Println("Failed to promote ADMIN_EMAILS:", err)
+	}
+
+	// Background jobs
+	if err := failStaleExports(stores.Exports); err != nil {
+		log.Println("Failed to clean up interrupted exports:", err)
+	}
+	var workers sync.WaitGroup
+	runWorker := func(run func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run()
+		}()
+	}
+	runWorker(func() { runAccountPurger(ctx, db, stores.Blobs) })
+	runWorker(func() { runRecurringScheduler(ctx, stores) })
+	if provider := newRateProvider(cfg.Currency); provider != nil {
+		runWorker(func() { runRateSync(ctx, stores.Rates, provider, cfg.Currency) })
+	}
 
 	// Routes
-	api := e.Group("/api")
-
-	// Public routes
-	api.POST("/register", authHandler.Register)
-	api.POST("/login", authHandler.Login)
-
-	// Protected routes
-	protected := api.Group("", JWTMiddleware(db))
-	protected.POST("/logout", authHandler.Logout)
-	protected.GET("/categories", categoryHandler.GetCategories)
-	protected.POST("/categories", categoryHandler.CreateCategory)
-	protected.PUT("/categories/:id", categoryHandler.UpdateCategory)
-	protected.DELETE("/categories/:id", categoryHandler.DeleteCategory)
-	protected.POST("/expenses", expenseHandler.AddExpense)
-	protected.GET("/expenses/summary/daily", expenseHandler.GetDailySummaryPaginated)
-	protected.GET("/expenses/summary/monthly", expenseHandler.GetMonthlySummaryPaginated)
-	protected.GET("/expenses/summary/weekly", expenseHandler.GetWeeklySummaryPaginated)
-	protected.GET("/expenses", expenseHandler.GetExpenses)
-	protected.GET("/dashboard", expenseHandler.GetDashboard)
-	protected.GET("/profile", profileHandler.GetProfile)
-	protected.PUT("/profile", profileHandler.UpdateProfile)
-	protected.PUT("/profile/password", profileHandler.ChangePassword)
-	protected.PUT("/expenses/:id", expenseHandler.UpdateExpense)
-	protected.DELETE("/expenses/:id", expenseHandler.DeleteExpense)
+	registerRoutes(e, stores, handlers)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
-	}
+	go func() {
+		log.Printf("Server starting on port %s", cfg.Port)
+		if err := e.Start(":" + cfg.Port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
 
-	log.Printf("Server starting on port %s", port)
-	if err := e.Start(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// On a shutdown signal, fail readiness first so load balancers stop routing here, then
+	// stop accepting connections and let in-flight requests and background jobs finish.
+	// A second signal exits immediately.
+	<-ctx.Done()
+	stop()
+	handlers.health.StartDraining()
+	if cfg.ShutdownDelay > 0 {
+		log.Printf("Shutting down; readiness is failing, waiting %s before closing the listener", cfg.ShutdownDelay)
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	log.Printf("Waiting up to %s for in-flight requests", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Println("Graceful shutdown did not finish:", err)
+	}
+	workers.Wait()
+	handlers.export.Wait()
+	if err := db.Close(); err != nil {
+		log.Println("Failed to close the database:", err)
 	}
+	log.Println("Server stopped")
 }
@@ -1,9 +1,8 @@
 package main
 
 import (
-	"database/sql"
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,7 +11,7 @@ import (
 )
 
 // JWTMiddleware validates JWT tokens and checks session status
-func JWTMiddleware(db *sql.DB) echo.MiddlewareFunc {
+func JWTMiddleware(sessions SessionStore) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Get token from Authorization header
@@ -30,25 +29,16 @@ func JWTMiddleware(db *sql.DB) echo.MiddlewareFunc {
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 			// Check if session is still active
-			if !isSessionActive(db, tokenString) {
+			session, err := sessions.ActiveSessionByTokenHash(hashToken(tokenString))
+			if errors.Is(err, errNotFound) {
 				return SendStandardError(c, ErrorSessionExpired)
 			}
+			if err != nil {
+				return SendStandardError(c, ErrorDatabaseError)
+			}
 
-			// Parse and validate token
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				// Validate signing method
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid signing method")
-				}
-
-				// Get JWT secret
-				secret := os.Getenv("JWT_SECRET")
-				if secret == "" {
-					secret = "your-secret-key"
-				}
-				return []byte(secret), nil
-			})
-
+			// Parse and validate token against the keyring; only access tokens are accepted
+			token, err := parseAccessToken(tokenString)
 			if err != nil || !token.Valid {
 				return SendStandardError(c, ErrorInvalidToken)
 			}
@@ -56,9 +46,11 @@ func JWTMiddleware(db *sql.DB) echo.MiddlewareFunc {
 			// Extract user ID from claims
 			if claims, ok := token.Claims.(jwt.MapClaims); ok {
 				if userIDStr, ok := claims["user_id"].(string); ok {
-					if userID, err := uuid.Parse(userIDStr); err == nil {
-						// Store user ID in context
+					if userID, err := uuid.Parse(userIDStr); err == nil && userID == session.UserID {
+						// Store user ID and session ID in context. The session comes from the
+						// token hash, so tokens issued before they carried a sid have one too.
 						c.Set("user_id", userID)
+						c.Set("session_id", session.ID)
 						return next(c)
 					}
 				}
@@ -69,12 +61,77 @@ func JWTMiddleware(db *sql.DB) echo.MiddlewareFunc {
 	}
 }
 
-// isSessionActive checks if the session is still active in database
-func isSessionActive(db *sql.DB, token string) bool {
-	var isActive bool
-	query := `SELECT is_active FROM sessions WHERE token = $1 AND expires_at > NOW()`
-	err := db.QueryRow(query, token).Scan(&isActive)
-	return err == nil && isActive
+// TokenAuthMiddleware accepts either a session JWT or a personal access token
+// that was granted scope. Session JWTs carry every scope.
+func TokenAuthMiddleware(stores *Stores, scope string) echo.MiddlewareFunc {
+	jwtAuth := JWTMiddleware(stores.Sessions)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		sessionNext := jwtAuth(next)
+		return func(c echo.Context) error {
+			tokenString := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if !strings.HasPrefix(tokenString, apiTokenPrefix) {
+				return sessionNext(c)
+			}
+
+			token, err := stores.APITokens.AuthenticateAPIToken(hashToken(tokenString))
+			if errors.Is(err, errNotFound) {
+				return SendStandardError(c, ErrorInvalidToken)
+			}
+			if err != nil {
+				return SendStandardError(c, ErrorDatabaseError)
+			}
+			if !hasScope(token.Scopes, scope) {
+				return SendCustomError(c, ErrorInsufficientScope, "API token is missing the "+scope+" scope", http.StatusForbidden)
+			}
+
+			c.Set("user_id", token.UserID)
+			c.Set("api_token_id", token.ID)
+			return next(c)
+		}
+	}
+}
+
+// RequireRole only lets users holding role through. It must run after JWTMiddleware.
+// The role is read from the store so a demotion applies immediately.
+func RequireRole(users UserStore, role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := getUserIDFromContext(c)
+			if userID == uuid.Nil {
+				return SendStandardError(c, ErrorUnauthorized)
+			}
+
+			user, err := users.GetUser(userID)
+			if errors.Is(err, errNotFound) || (err == nil && user.Role != role) {
+				return SendStandardError(c, ErrorForbidden)
+			}
+			if err != nil {
+				return SendStandardError(c, ErrorDatabaseError)
+			}
+
+			c.Set("user_role", user.Role)
+			return next(c)
+		}
+	}
+}
+
+// hasScope reports whether scope is among the granted scopes
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtSecret returns the configured JWT_SECRET, or the development default
+func jwtSecret() string {
+	secret := config().Auth.JWTSecret
+	if secret == "" {
+		secret = defaultJWTSecret // Default secret - should be in .env
+	}
+	return secret
 }
 
 // getUserIDFromContext extracts user ID from echo context
@@ -84,3 +141,11 @@ func getUserIDFromContext(c echo.Context) uuid.UUID {
 	}
 	return uuid.Nil
 }
+
+// getSessionIDFromContext extracts the current session ID from echo context
+func getSessionIDFromContext(c echo.Context) uuid.UUID {
+	if sessionID, ok := c.Get("session_id").(uuid.UUID); ok {
+		return sessionID
+	}
+	return uuid.Nil
+}
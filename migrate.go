@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// migrationFiles holds the numbered schema migrations: NNNN_name.up.sql and NNNN_name.down.sql.
+// Postgres migrations live in migrations/, their SQLite counterparts in migrations/sqlite/.
+//
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so replicas
+// starting at the same time apply each migration once
+const migrationLockKey int64 = 7301812345017
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration is one schema version. Most are SQL scripts; a Go migration has UpFunc
+// instead, for data changes SQL cannot express.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	UpFunc  func(tx *sql.Tx) error
+}
+
+// goMigrations are the Go migrations, keyed by the migrations directory they belong to.
+// They cannot be undone: rolling one back only removes its record, so each must be
+// safe to run again.
+var goMigrations = map[string][]migration{
+	"migrations": {
+		{Version: 13, Name: "hash_legacy_session_tokens", UpFunc: hashLegacySessionTokens},
+	},
+}
+
+// Checksum identifies the up script so edits to applied migrations can be reported
+func (m migration) Checksum() string {
+	up := m.Up
+	if m.UpFunc != nil {
+		up = "go:" + m.Name
+	}
+	sum := sha256.Sum256([]byte(up))
+	return hex.EncodeToString(sum[:])
+}
+
+// apply runs the up step inside the migration's transaction
+func (m migration) apply(tx *sql.Tx) error {
+	if m.UpFunc != nil {
+		return m.UpFunc(tx)
+	}
+	_, err := tx.Exec(m.Up)
+	return err
+}
+
+// migrationState is a migration together with whether and when it was applied
+type migrationState struct {
+	migration
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+// loadMigrations reads and orders the migrations in dir. Every version needs an up script.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// dialectMigrations returns the SQL and Go migrations of dialect in order
+func dialectMigrations(dialect *sqlDialect) ([]migration, error) {
+	migrations, err := loadMigrations(migrationFiles, dialect.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range goMigrations[dialect.MigrationsDir] {
+		for _, m := range migrations {
+			if m.Version == g.Version {
+				return nil, fmt.Errorf("migration %04d is both the SQL migration %s and the Go migration %s", g.Version, m.Name, g.Name)
+			}
+		}
+		migrations = append(migrations, g)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// migrateUp applies pending migrations in order, stopping after target (0 applies all).
+// It returns the number of migrations applied.
+func migrateUp(db *sql.DB, dialect *sqlDialect, target int) (int, error) {
+	migrations, err := dialectMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withMigrationLock(db, dialect, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if target > 0 && m.Version > target {
+				break
+			}
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err := inMigrationTx(conn, func(tx *sql.Tx) error {
+				if err := m.apply(tx); err != nil {
+					return err
+				}
+				_, err := tx.Exec(
+					`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`,
+					m.Version, m.Name, m.Checksum(), time.Now(),
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// migrateDown rolls back the given number of most recently applied migrations
+func migrateDown(db *sql.DB, dialect *sqlDialect, steps int) (int, error) {
+	migrations, err := dialectMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	known := make(map[int]migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	rolledBack := 0
+	err = withMigrationLock(db, dialect, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(done))
+		for v := range done {
+			versions = append(versions, v)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, v := range versions {
+			if rolledBack >= steps {
+				break
+			}
+			m, ok := known[v]
+			if !ok {
+				return fmt.Errorf("migration %d is applied but its files are missing", v)
+			}
+			if m.Down == "" && m.UpFunc == nil {
+				return fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+			}
+			err := inMigrationTx(conn, func(tx *sql.Tx) error {
+				if m.Down != "" {
+					if _, err := tx.Exec(m.Down); err != nil {
+						return err
+					}
+				}
+				_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Rolled back migration %04d_%s", m.Version, m.Name)
+			rolledBack++
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// migrationStatus lists every known migration with its applied time
+func migrationStatus(db *sql.DB, dialect *sqlDialect) ([]migrationState, error) {
+	migrations, err := dialectMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := ensureMigrationsTable(conn); err != nil {
+		return nil, err
+	}
+	done, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]migrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := migrationState{migration: m}
+		if rec, ok := done[m.Version]; ok {
+			appliedAt := rec.AppliedAt
+			state.AppliedAt = &appliedAt
+			state.Modified = rec.Checksum != "" && rec.Checksum != m.Checksum()
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// pendingMigrations counts the known migrations that are not applied yet. Unlike
+// migrationStatus it only reads, so the readiness probe can call it.
+func pendingMigrations(ctx context.Context, db *sql.DB, dialect *sqlDialect) (int, error) {
+	migrations, err := dialectMigrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// appliedMigrations reads schema_migrations keyed by version
+func appliedMigrations(conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(context.Background(), `SELECT version, COALESCE(checksum, ''), applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var rec appliedMigration
+		if err := rows.Scan(&version, &rec.Checksum, &rec.AppliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = rec
+	}
+	return done, rows.Err()
+}
+
+// withMigrationLock runs fn on one connection holding the migration advisory lock.
+// The lock is session-scoped, so everything must go through that connection.
+// SQLite has no advisory locks; its migration transactions already hold the write lock.
+func withMigrationLock(db *sql.DB, dialect *sqlDialect, fn func(*sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !dialect.AdvisoryLocks {
+		if err := ensureMigrationsTable(conn); err != nil {
+			return err
+		}
+		return fn(conn)
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if err := ensureMigrationsTable(conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// ensureMigrationsTable creates schema_migrations on first use
+func ensureMigrationsTable(conn *sql.Conn) error {
+	_, err := conn.ExecContext(context.Background(), `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64),
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	return err
+}
+
+// inMigrationTx runs one migration and its bookkeeping atomically
+func inMigrationTx(conn *sql.Conn, fn func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runMigrateCommand implements `migrate up [version]`, `migrate down [steps]` and `migrate status`
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up [version] | down [steps] | status")
+	}
+
+	number := func(def int) (int, error) {
+		if len(args) < 2 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid number %q", args[1])
+		}
+		return n, nil
+	}
+
+	cfg := config().Database
+	dialect, err := databaseDialect(cfg.Driver)
+	if err != nil {
+		return err
+	}
+	db, err := connectWithRetry(dialect, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		target, err := number(0)
+		if err != nil {
+			return err
+		}
+		n, err := migrateUp(db, dialect, target)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", n)
+	case "down":
+		steps, err := number(1)
+		if err != nil {
+			return err
+		}
+		n, err := migrateDown(db, dialect, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", n)
+	case "status":
+		states, err := migrationStatus(db, dialect)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("02-01-2006 03:04:05 PM")
+				if s.Modified {
+					applied += " (modified since applied)"
+				}
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	return nil
+}
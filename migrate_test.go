@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations_AmountsMoveToMinorUnits(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = migrateUp(db, sqliteDialect, 1)
+	require.NoError(t, err)
+	userID, expenseID := uuid.New(), uuid.New()
+	_, err = db.Exec(`INSERT INTO users (id, name, email, password) VALUES ($1, 'Old', 'old@example.com', 'x')`, userID)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO expenses (id, user_id, title, amount, expense_date, expense_time) VALUES ($1, $2, 'Lunch', 12.34, '2024-01-15', '2024-01-15 09:30:00')`, expenseID, userID)
+	require.NoError(t, err)
+
+	_, err = migrateUp(db, sqliteDialect, 3)
+	require.NoError(t, err)
+	var amount Money
+	require.NoError(t, db.QueryRow(`SELECT amount_minor FROM expenses WHERE id = $1`, expenseID).Scan(&amount))
+	assert.Equal(t, Money(1234), amount)
+
+	_, err = migrateDown(db, sqliteDialect, 1)
+	require.NoError(t, err)
+	var restored string
+	require.NoError(t, db.QueryRow(`SELECT CAST(amount AS TEXT) FROM expenses WHERE id = $1`, expenseID).Scan(&restored))
+	assert.Equal(t, "12.34", restored)
+}
+
+func TestMigrations_CategorySharesSplitExistingExpenses(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = migrateUp(db, sqliteDialect, 6)
+	require.NoError(t, err)
+	userID, expenseID := uuid.New(), uuid.New()
+	_, err = db.Exec(`INSERT INTO users (id, name, email, password) VALUES ($1, 'Old', 'old@example.com', 'x')`, userID)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO expenses (id, user_id, title, amount_minor, expense_date, expense_time) VALUES ($1, $2, 'Dinner', 1000, '2024-01-15', '2024-01-15 09:30:00')`, expenseID, userID)
+	require.NoError(t, err)
+	for _, name := range []string{"Food", "Travel", "Bills"} {
+		categoryID := uuid.New()
+		_, err = db.Exec(`INSERT INTO categories (id, name, user_id) VALUES ($1, $2, $3)`, categoryID, name, userID)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO expense_categories (id, expense_id, category_id) VALUES ($1, $2, $3)`, uuid.New(), expenseID, categoryID)
+		require.NoError(t, err)
+	}
+
+	_, err = migrateUp(db, sqliteDialect, 7)
+	require.NoError(t, err)
+	rows, err := db.Query(`SELECT share_minor FROM expense_categories WHERE expense_id = $1 ORDER BY share_minor DESC`, expenseID)
+	require.NoError(t, err)
+	var shares []Money
+	for rows.Next() {
+		var share Money
+		require.NoError(t, rows.Scan(&share))
+		shares = append(shares, share)
+	}
+	require.NoError(t, rows.Err())
+	rows.Close()
+	assert.Equal(t, []Money{334, 333, 333}, shares)
+
+	_, err = migrateDown(db, sqliteDialect, 1)
+	require.NoError(t, err)
+	_, err = db.Exec(`SELECT share_minor FROM expense_categories`)
+	assert.Error(t, err)
+}
+
+func TestMigrations_EmailsBecomeCaseInsensitive(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = migrateUp(db, sqliteDialect, 10)
+	require.NoError(t, err)
+	userID := uuid.New()
+	_, err = db.Exec(`INSERT INTO users (id, name, email, password, pending_email) VALUES ($1, 'Old', 'Old.User@Example.com', 'x', 'Next@Example.com')`, userID)
+	require.NoError(t, err)
+
+	_, err = migrateUp(db, sqliteDialect, 11)
+	require.NoError(t, err)
+	var email, pending string
+	require.NoError(t, db.QueryRow(`SELECT email, pending_email FROM users WHERE id = $1`, userID).Scan(&email, &pending))
+	assert.Equal(t, "old.user@example.com", email)
+	assert.Equal(t, "next@example.com", pending)
+
+	_, err = db.Exec(`INSERT INTO users (id, name, email, password) VALUES ($1, 'Copy', 'OLD.USER@example.com', 'x')`, uuid.New())
+	assert.Error(t, err)
+}
+
+func TestMigrations_OnlyTheNewestPendingExportIsKept(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = migrateUp(db, sqliteDialect, 11)
+	require.NoError(t, err)
+	userID, older, newer := uuid.New(), uuid.New(), uuid.New()
+	_, err = db.Exec(`INSERT INTO users (id, name, email, password) VALUES ($1, 'Old', 'old@example.com', 'x')`, userID)
+	require.NoError(t, err)
+	for id, createdAt := range map[uuid.UUID]time.Time{older: time.Now().Add(-time.Hour), newer: time.Now()} {
+		_, err = db.Exec(`INSERT INTO data_exports (id, user_id, status, created_at, heartbeat_at) VALUES ($1, $2, 'pending', $3, $3)`, id, userID, createdAt)
+		require.NoError(t, err)
+	}
+
+	_, err = migrateUp(db, sqliteDialect, 12)
+	require.NoError(t, err)
+	for id, want := range map[uuid.UUID]string{older: exportStatusFailed, newer: exportStatusPending} {
+		var status string
+		require.NoError(t, db.QueryRow(`SELECT status FROM data_exports WHERE id = $1`, id).Scan(&status))
+		assert.Equal(t, want, status)
+	}
+}
+
+func TestMigrations_GoMigrationsAreVersioned(t *testing.T) {
+	postgres, err := dialectMigrations(postgresDialect)
+	require.NoError(t, err)
+	var names []string
+	for i, m := range postgres {
+		names = append(names, m.Name)
+		if i > 0 {
+			assert.Less(t, postgres[i-1].Version, m.Version)
+		}
+	}
+	assert.Contains(t, names, "hash_legacy_session_tokens")
+
+	// SQLite never stored plaintext tokens, and its status lists only its own migrations
+	db, err := openSQLite(filepath.Join(t.TempDir(), "expense_tracker.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = migrateUp(db, sqliteDialect, 0)
+	require.NoError(t, err)
+	states, err := migrationStatus(db, sqliteDialect)
+	require.NoError(t, err)
+	for _, state := range states {
+		assert.NotEqual(t, "hash_legacy_session_tokens", state.Name)
+		assert.NotNil(t, state.AppliedAt)
+	}
+}
+
+func TestHashLegacySessionTokens_DeactivatesDuplicates(t *testing.T) {
+	if os.Getenv("TEST_POSTGRES_URL") == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	_, db := newPostgresTestStores(t)
+
+	// Roll the Go migration back so it runs again on the legacy columns below
+	n, err := migrateDown(db, postgresDialect, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// Older versions stored the token itself; two logins in one second got the same JWT
+	_, err = db.Exec(`ALTER TABLE sessions ADD COLUMN token TEXT, ADD COLUMN refresh_token TEXT`)
+	require.NoError(t, err)
+	userID := uuid.New()
+	_, err = db.Exec(`INSERT INTO users (id, name, email, password) VALUES ($1, 'Old', 'old@example.com', 'x')`, userID)
+	require.NoError(t, err)
+	older, newer := uuid.New(), uuid.New()
+	for i, id := range []uuid.UUID{older, newer} {
+		_, err = db.Exec(
+			`INSERT INTO sessions (id, user_id, token, refresh_token, created_at, expires_at) VALUES ($1, $2, 'same-jwt', 'same-refresh', $3, $4)`,
+			id, userID, time.Now().Add(time.Duration(i)*time.Millisecond), time.Now().Add(time.Hour),
+		)
+		require.NoError(t, err)
+	}
+
+	n, err = migrateUp(db, postgresDialect, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	states, err := migrationStatus(db, postgresDialect)
+	require.NoError(t, err)
+	for _, state := range states {
+		if state.Name == "hash_legacy_session_tokens" {
+			assert.NotNil(t, state.AppliedAt)
+			assert.False(t, state.Modified)
+		}
+	}
+
+	var active bool
+	var tokenHash sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT is_active, token_hash FROM sessions WHERE id = $1`, newer).Scan(&active, &tokenHash))
+	assert.True(t, active)
+	assert.Equal(t, hashToken("same-jwt"), tokenHash.String)
+	require.NoError(t, db.QueryRow(`SELECT is_active, token_hash FROM sessions WHERE id = $1`, older).Scan(&active, &tokenHash))
+	assert.False(t, active)
+	assert.False(t, tokenHash.Valid)
+}
@@ -0,0 +1,204 @@
+-- Baseline schema. Every statement is idempotent so databases created by the
+-- old createAllTables script can adopt the migration system without changes.
+
+-- Enable pgcrypto for gen_random_uuid if not already enabled
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+
+-- USERS TABLE
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name VARCHAR(999) NOT NULL,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	profile_image TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	is_active BOOLEAN DEFAULT TRUE,
+	deactivated_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+
+-- Email verification: accounts that existed before verification count as verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
+
+-- TOTP two-factor authentication
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+CREATE INDEX IF NOT EXISTS idx_users_deactivated_at ON users(deactivated_at) WHERE deactivated_at IS NOT NULL;
+
+-- CATEGORIES TABLE
+CREATE TABLE IF NOT EXISTS categories (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name VARCHAR(255) NOT NULL,
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	is_default BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- EXPENSES TABLE (legacy category_id/name removed; multi-category via expense_categories)
+CREATE TABLE IF NOT EXISTS expenses (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	amount DECIMAL(10, 2) NOT NULL,
+	expense_date DATE NOT NULL,
+	expense_time TIME NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- EXPENSE_CATEGORIES TABLE
+CREATE TABLE IF NOT EXISTS expense_categories (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	expense_id UUID REFERENCES expenses(id) ON DELETE CASCADE,
+	category_id UUID REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- LOGIN_HISTORY TABLE
+CREATE TABLE IF NOT EXISTS login_history (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	login_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Failed attempts are kept alongside successful logins for brute-force protection
+ALTER TABLE login_history ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45);
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS success BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE INDEX IF NOT EXISTS idx_login_history_email ON login_history(email, login_at);
+CREATE INDEX IF NOT EXISTS idx_login_history_ip ON login_history(ip_address, login_at);
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS user_agent TEXT;
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS method VARCHAR(20) NOT NULL DEFAULT 'password';
+CREATE INDEX IF NOT EXISTS idx_login_history_user_id ON login_history(user_id, login_at);
+
+-- SESSIONS TABLE
+CREATE TABLE IF NOT EXISTS sessions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP,
+	is_active BOOLEAN DEFAULT TRUE
+);
+
+-- Refresh-token rotation: every refresh issues a new session row in the same family
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS family_id UUID;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS parent_id UUID;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions(family_id);
+
+-- Only keyed hashes of session tokens are stored (see hashLegacySessionTokens)
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS token_hash TEXT;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS refresh_token_hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions(token_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_refresh_token_hash ON sessions(refresh_token_hash);
+
+-- TWO_FACTOR_RECOVERY_CODES TABLE (hashed, single-use)
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_two_factor_recovery_codes_user_id ON two_factor_recovery_codes(user_id);
+
+-- API_TOKENS TABLE (personal access tokens; only the hash is stored)
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP,
+	expires_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+
+-- AUDIT_LOG TABLE (no foreign keys so entries outlive the accounts they mention)
+CREATE TABLE IF NOT EXISTS audit_log (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	actor_id UUID,
+	action VARCHAR(100) NOT NULL,
+	entity_type VARCHAR(50) NOT NULL,
+	entity_id UUID,
+	details JSONB,
+	ip_address VARCHAR(45),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS before_data JSONB;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS after_data JSONB;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS request_id VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+-- The audit log is append-only
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_log_no_update ON audit_log;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_immutable();
+
+-- DATA_EXPORTS TABLE (asynchronous personal data exports)
+CREATE TABLE IF NOT EXISTS data_exports (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	status VARCHAR(20) NOT NULL,
+	error TEXT,
+	archive BYTEA,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP,
+	expires_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports(user_id);
+
+-- USER_IDENTITIES TABLE (accounts linked to an OpenID Connect provider)
+CREATE TABLE IF NOT EXISTS user_identities (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	issuer VARCHAR(255) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP,
+	UNIQUE (issuer, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- OIDC_LOGIN_STATES TABLE (pending SSO logins: state, nonce and PKCE verifier)
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+	state_hash TEXT PRIMARY KEY,
+	code_verifier VARCHAR(128) NOT NULL,
+	nonce VARCHAR(128) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+
+-- PASSWORD_RESET_TOKENS TABLE (single-use, expiring)
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+-- Device details so users can recognise their sessions
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
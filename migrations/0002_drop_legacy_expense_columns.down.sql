@@ -0,0 +1,3 @@
+-- Restores the columns empty; the original values cannot be recovered
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS category_id UUID REFERENCES categories(id) ON DELETE SET NULL;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS category_name VARCHAR(255);
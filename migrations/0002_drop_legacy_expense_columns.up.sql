@@ -0,0 +1,3 @@
+-- Expenses used to hold a single category; categories now live in expense_categories
+ALTER TABLE expenses DROP COLUMN IF EXISTS category_id;
+ALTER TABLE expenses DROP COLUMN IF EXISTS category_name;
@@ -0,0 +1,5 @@
+-- Fails if an expense is 100 million or more, which DECIMAL(10, 2) cannot hold
+ALTER TABLE expenses ADD COLUMN amount DECIMAL(10, 2);
+UPDATE expenses SET amount = amount_minor / 100.0;
+ALTER TABLE expenses ALTER COLUMN amount SET NOT NULL;
+ALTER TABLE expenses DROP COLUMN amount_minor;
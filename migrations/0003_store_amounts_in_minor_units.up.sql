@@ -0,0 +1,6 @@
+-- Amounts are stored as whole minor units (cents) so sums are exact; BIGINT also lifts
+-- the DECIMAL(10, 2) cap of just under 100 million per expense
+ALTER TABLE expenses ADD COLUMN amount_minor BIGINT;
+UPDATE expenses SET amount_minor = ROUND(amount * 100)::bigint;
+ALTER TABLE expenses ALTER COLUMN amount_minor SET NOT NULL;
+ALTER TABLE expenses DROP COLUMN amount;
@@ -0,0 +1,17 @@
+-- Every expense records the ISO 4217 currency it was paid in and every user has a home
+-- currency that reports are converted to. Rows that exist already are taken to be USD.
+ALTER TABLE users ADD COLUMN home_currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE expenses ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+
+-- One unit of base_currency buys rate units of quote_currency on rate_date
+CREATE TABLE exchange_rates (
+    rate_date DATE NOT NULL,
+    base_currency VARCHAR(3) NOT NULL,
+    quote_currency VARCHAR(3) NOT NULL,
+    rate NUMERIC(24, 12) NOT NULL CHECK (rate > 0),
+    source VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (rate_date, base_currency, quote_currency)
+);
+
+CREATE INDEX idx_exchange_rates_quote ON exchange_rates (quote_currency, rate_date);
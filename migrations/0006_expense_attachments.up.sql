@@ -0,0 +1,15 @@
+-- Files such as receipt photos kept with an expense. The content lives in the blob
+-- store (ATTACHMENT_STORAGE) under storage_key; this table holds what we know about it.
+CREATE TABLE expense_attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    expense_id UUID NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    sha256 CHAR(64) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_expense_attachments_expense_id ON expense_attachments (expense_id);
+CREATE INDEX idx_expense_attachments_user_id ON expense_attachments (user_id);
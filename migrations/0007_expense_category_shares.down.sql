@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_expense_categories_category_id;
+ALTER TABLE expense_categories DROP COLUMN IF EXISTS share_percent;
+ALTER TABLE expense_categories DROP COLUMN IF EXISTS share_minor;
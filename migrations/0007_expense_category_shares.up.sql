@@ -0,0 +1,22 @@
+-- Each category an expense is filed under counts share_minor of its amount, so that
+-- category totals add up to what was spent instead of counting a multi-category
+-- expense in full in every category. share_percent keeps a share given as a
+-- percentage, in hundredths of a percent. Existing expenses are split evenly between
+-- their categories, the odd cents going to the first links.
+ALTER TABLE expense_categories ADD COLUMN share_minor BIGINT NOT NULL DEFAULT 0 CHECK (share_minor >= 0);
+ALTER TABLE expense_categories ADD COLUMN share_percent INTEGER CHECK (share_percent > 0 AND share_percent <= 10000);
+
+UPDATE expense_categories
+SET share_minor = shares.share_minor
+FROM (
+    SELECT ec.id,
+        e.amount_minor / COUNT(*) OVER w
+            + CASE WHEN ROW_NUMBER() OVER (w ORDER BY ec.id) <= e.amount_minor % COUNT(*) OVER w THEN 1 ELSE 0 END AS share_minor
+    FROM expense_categories ec
+    JOIN expenses e ON e.id = ec.expense_id
+    WINDOW w AS (PARTITION BY ec.expense_id)
+) shares
+WHERE shares.id = expense_categories.id;
+
+ALTER TABLE expense_categories ALTER COLUMN share_minor DROP DEFAULT;
+CREATE INDEX idx_expense_categories_category_id ON expense_categories (category_id);
@@ -0,0 +1,5 @@
+-- An administrator's suspension is kept apart from a self-service deactivation:
+-- a suspended account cannot reactivate itself and is never purged, while
+-- deactivated_at keeps any deactivation the user made before it was suspended.
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspended_by UUID REFERENCES users(id) ON DELETE SET NULL;
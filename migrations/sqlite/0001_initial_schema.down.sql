@@ -0,0 +1,15 @@
+-- Drops everything created by the baseline. All data is lost.
+
+DROP TABLE IF EXISTS password_reset_tokens;
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS data_exports;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS login_history;
+DROP TABLE IF EXISTS expense_categories;
+DROP TABLE IF EXISTS expenses;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,190 @@
+-- SQLite version of the Postgres schema after 0002_drop_legacy_expense_columns.
+-- SQLite has no UUID, JSONB or BYTEA types and no gen_random_uuid(): IDs are TEXT,
+-- generated by the application, with a random version 4 UUID as the column default.
+-- Times are TEXT written by the application in sqliteTimeFormat; the declared types
+-- (DATE, TIMESTAMP) tell the driver to read them back as time.Time. There is no
+-- migration 0002 because the legacy expense columns never existed here.
+
+-- USERS TABLE
+CREATE TABLE users (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	name VARCHAR(999) NOT NULL,
+	email VARCHAR(255) UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	profile_image TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	is_active BOOLEAN DEFAULT TRUE,
+	deactivated_at TIMESTAMP,
+	email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	pending_email VARCHAR(255),
+	totp_secret TEXT,
+	totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	totp_last_step BIGINT,
+	role VARCHAR(20) NOT NULL DEFAULT 'user'
+);
+CREATE INDEX idx_users_email ON users(email);
+CREATE INDEX idx_users_deactivated_at ON users(deactivated_at) WHERE deactivated_at IS NOT NULL;
+
+-- CATEGORIES TABLE
+CREATE TABLE categories (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	name VARCHAR(255) NOT NULL,
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	is_default BOOLEAN DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- EXPENSES TABLE (expense_time is a TIMESTAMP on 0000-01-01; SQLite has no TIME type the driver reads)
+CREATE TABLE expenses (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	amount DECIMAL(10, 2) NOT NULL,
+	expense_date DATE NOT NULL,
+	expense_time TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- EXPENSE_CATEGORIES TABLE
+CREATE TABLE expense_categories (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	expense_id TEXT REFERENCES expenses(id) ON DELETE CASCADE,
+	category_id TEXT REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- LOGIN_HISTORY TABLE (failed attempts are kept for brute-force protection)
+CREATE TABLE login_history (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	login_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	email VARCHAR(255),
+	ip_address VARCHAR(45),
+	success BOOLEAN NOT NULL DEFAULT TRUE,
+	user_agent TEXT,
+	method VARCHAR(20) NOT NULL DEFAULT 'password'
+);
+CREATE INDEX idx_login_history_email ON login_history(email, login_at);
+CREATE INDEX idx_login_history_ip ON login_history(ip_address, login_at);
+CREATE INDEX idx_login_history_user_id ON login_history(user_id, login_at);
+
+-- SESSIONS TABLE (only keyed hashes of the tokens are stored)
+CREATE TABLE sessions (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT,
+	refresh_token_hash TEXT,
+	family_id TEXT,
+	parent_id TEXT,
+	rotated_at TIMESTAMP,
+	user_agent TEXT,
+	ip_address VARCHAR(45),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP,
+	is_active BOOLEAN DEFAULT TRUE
+);
+CREATE INDEX idx_sessions_family_id ON sessions(family_id);
+CREATE UNIQUE INDEX idx_sessions_token_hash ON sessions(token_hash);
+CREATE UNIQUE INDEX idx_sessions_refresh_token_hash ON sessions(refresh_token_hash);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+
+-- TWO_FACTOR_RECOVERY_CODES TABLE (hashed, single-use)
+CREATE TABLE two_factor_recovery_codes (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	used_at TIMESTAMP
+);
+CREATE INDEX idx_two_factor_recovery_codes_user_id ON two_factor_recovery_codes(user_id);
+
+-- API_TOKENS TABLE (personal access tokens; only the hash is stored)
+CREATE TABLE api_tokens (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP,
+	expires_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+
+-- AUDIT_LOG TABLE (no foreign keys so entries outlive the accounts they mention; JSON kept as TEXT)
+CREATE TABLE audit_log (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	actor_id TEXT,
+	action VARCHAR(100) NOT NULL,
+	entity_type VARCHAR(50) NOT NULL,
+	entity_id TEXT,
+	details TEXT,
+	before_data TEXT,
+	after_data TEXT,
+	ip_address VARCHAR(45),
+	request_id VARCHAR(100),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_audit_log_entity ON audit_log(entity_type, entity_id);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_id, created_at);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+-- The audit log is append-only
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+-- DATA_EXPORTS TABLE (asynchronous personal data exports)
+CREATE TABLE data_exports (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	status VARCHAR(20) NOT NULL,
+	error TEXT,
+	archive BLOB,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP,
+	expires_at TIMESTAMP
+);
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id);
+
+-- USER_IDENTITIES TABLE (accounts linked to an OpenID Connect provider)
+CREATE TABLE user_identities (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	issuer VARCHAR(255) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP,
+	UNIQUE (issuer, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- OIDC_LOGIN_STATES TABLE (pending SSO logins: state, nonce and PKCE verifier)
+CREATE TABLE oidc_login_states (
+	state_hash TEXT PRIMARY KEY,
+	code_verifier VARCHAR(128) NOT NULL,
+	nonce VARCHAR(128) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+
+-- PASSWORD_RESET_TOKENS TABLE (single-use, expiring)
+CREATE TABLE password_reset_tokens (
+	id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE expenses ADD COLUMN amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+UPDATE expenses SET amount = amount_minor / 100.0;
+ALTER TABLE expenses DROP COLUMN amount_minor;
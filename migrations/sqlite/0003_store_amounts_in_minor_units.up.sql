@@ -0,0 +1,5 @@
+-- Amounts are stored as whole minor units (cents) so sums are exact; SQLite would
+-- otherwise keep DECIMAL values as floating point
+ALTER TABLE expenses ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0;
+UPDATE expenses SET amount_minor = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE expenses DROP COLUMN amount;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_expenses_recurring_occurrence;
+ALTER TABLE expenses DROP COLUMN occurrence_date;
+ALTER TABLE expenses DROP COLUMN recurring_expense_id;
+DROP TABLE IF EXISTS recurring_expense_skips;
+DROP TABLE IF EXISTS recurring_expense_categories;
+DROP TABLE IF EXISTS recurring_expenses;
@@ -0,0 +1,45 @@
+-- A recurring expense is a schedule (every interval days, weeks, months or years from
+-- start_date, until end_date or for occurrence_count occurrences) that creates a real
+-- expense when each occurrence comes due. next_date is the first occurrence not yet
+-- created or skipped; it is NULL once the schedule has ended.
+CREATE TABLE recurring_expenses (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title VARCHAR(255) NOT NULL,
+	description TEXT,
+	amount_minor INTEGER NOT NULL CHECK (amount_minor > 0),
+	currency VARCHAR(3) NOT NULL,
+	expense_time TIMESTAMP NOT NULL,
+	frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly', 'yearly')),
+	interval_count INTEGER NOT NULL DEFAULT 1 CHECK (interval_count > 0),
+	start_date DATE NOT NULL,
+	end_date DATE,
+	occurrence_count INTEGER CHECK (occurrence_count > 0),
+	next_date DATE,
+	paused BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_recurring_expenses_user_id ON recurring_expenses (user_id);
+CREATE INDEX idx_recurring_expenses_next_date ON recurring_expenses (next_date) WHERE next_date IS NOT NULL AND paused = false;
+
+CREATE TABLE recurring_expense_categories (
+	recurring_expense_id TEXT NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+	category_id TEXT NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+	PRIMARY KEY (recurring_expense_id, category_id)
+);
+
+-- Occurrences the user chose to skip; no expense is created for them
+CREATE TABLE recurring_expense_skips (
+	recurring_expense_id TEXT NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+	occurrence_date DATE NOT NULL,
+	PRIMARY KEY (recurring_expense_id, occurrence_date)
+);
+
+-- Expenses created by a schedule remember the occurrence they belong to. The unique
+-- index makes creating an occurrence twice a no-op; manual expenses leave both NULL.
+-- There is no foreign key because SQLite cannot drop a column that has one; deleting
+-- a schedule clears recurring_expense_id itself and keeps the expenses it created.
+ALTER TABLE expenses ADD COLUMN recurring_expense_id TEXT;
+ALTER TABLE expenses ADD COLUMN occurrence_date DATE;
+CREATE UNIQUE INDEX idx_expenses_recurring_occurrence ON expenses (recurring_expense_id, occurrence_date);
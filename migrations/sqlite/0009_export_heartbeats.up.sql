@@ -0,0 +1,4 @@
+-- A running export job touches heartbeat_at every few seconds. A pending job whose
+-- heartbeat has gone stale belonged to a server that stopped, so it can be failed
+-- without touching jobs that other replicas are still building.
+ALTER TABLE data_exports ADD COLUMN heartbeat_at TIMESTAMP;
@@ -0,0 +1,22 @@
+-- When an account is purged, the personal data in the audit entries about it (snapshots,
+-- details and the user's own IP addresses) is blanked and redacted_at set. That is the
+-- only change the append-only trigger lets through; who did what and when is kept.
+ALTER TABLE audit_log ADD COLUMN redacted_at TIMESTAMP;
+
+DROP TRIGGER audit_log_no_update;
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+WHEN NOT (
+	OLD.redacted_at IS NULL AND NEW.redacted_at IS NOT NULL
+	AND NEW.id = OLD.id
+	AND NEW.actor_id IS OLD.actor_id
+	AND NEW.action = OLD.action
+	AND NEW.entity_type = OLD.entity_type
+	AND NEW.entity_id IS OLD.entity_id
+	AND NEW.request_id IS OLD.request_id
+	AND NEW.created_at IS OLD.created_at
+	AND NEW.before_data IS NULL AND NEW.after_data IS NULL AND NEW.details IS NULL
+	AND (NEW.ip_address IS NULL OR NEW.ip_address = OLD.ip_address)
+)
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,10 @@
+-- Addresses are stored lower-cased and compared with LOWER(email), so the same
+-- mailbox cannot be registered twice in different case. Existing addresses are
+-- lower-cased where that collides with no other account; accounts that differ only
+-- in case make the index below fail and must be merged or renamed by hand first.
+UPDATE users SET email = LOWER(email)
+WHERE email <> LOWER(email)
+  AND NOT EXISTS (SELECT 1 FROM users other WHERE other.id <> users.id AND LOWER(other.email) = LOWER(users.email));
+UPDATE users SET pending_email = LOWER(pending_email) WHERE pending_email <> LOWER(pending_email);
+
+CREATE UNIQUE INDEX idx_users_email_lower ON users (LOWER(email));
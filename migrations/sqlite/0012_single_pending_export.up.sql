@@ -0,0 +1,11 @@
+-- A user has at most one pending export job, so two export requests racing each
+-- other cannot both start one. Duplicates left by earlier races are failed first.
+UPDATE data_exports SET status = 'failed', error = 'Export was interrupted, please try again', completed_at = CURRENT_TIMESTAMP
+WHERE status = 'pending'
+  AND EXISTS (
+	SELECT 1 FROM data_exports newer
+	WHERE newer.user_id = data_exports.user_id AND newer.status = 'pending'
+	  AND (newer.created_at > data_exports.created_at OR (newer.created_at = data_exports.created_at AND newer.id > data_exports.id))
+  );
+
+CREATE UNIQUE INDEX idx_data_exports_one_pending ON data_exports (user_id) WHERE status = 'pending';
@@ -8,15 +8,20 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID            uuid.UUID  `json:"id" db:"id"`
-	Name          string     `json:"name" db:"name"`
-	Email         string     `json:"email" db:"email"`
-	Password      string     `json:"-" db:"password"`
-	ProfileImage  *string    `json:"profile_image,omitempty" db:"profile_image"`
-	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
-	IsActive      bool       `json:"is_active" db:"is_active"`
-	DeactivatedAt *time.Time `json:"deactivated_at,omitempty" db:"deactivated_at"`
+	ID               uuid.UUID  `json:"id" db:"id"`
+	Name             string     `json:"name" db:"name"`
+	Email            string     `json:"email" db:"email"`
+	EmailVerified    bool       `json:"email_verified" db:"email_verified"`
+	PendingEmail     *string    `json:"pending_email,omitempty" db:"pending_email"`
+	Password         string     `json:"-" db:"password"`
+	ProfileImage     *string    `json:"profile_image,omitempty" db:"profile_image"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+	IsActive         bool       `json:"is_active" db:"is_active"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled" db:"totp_enabled"`
+	Role             string     `json:"role" db:"role"`
+	HomeCurrency     string     `json:"home_currency" db:"home_currency"`
+	DeactivatedAt    *time.Time `json:"deactivated_at,omitempty" db:"deactivated_at"`
 }
 
 // Category represents an expense category
@@ -29,17 +34,61 @@ type Category struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
-// Expense represents an expense record
+// Expense represents an expense record with the categories it is filed under
 type Expense struct {
+	ID          uuid.UUID               `json:"id" db:"id"`
+	UserID      uuid.UUID               `json:"user_id" db:"user_id"`
+	Title       string                  `json:"title" db:"title"`
+	Description *string                 `json:"description,omitempty" db:"description"`
+	Amount      Money                   `json:"amount" db:"amount_minor"`
+	Currency    string                  `json:"currency" db:"currency"`
+	ExpenseDate time.Time               `json:"expense_date" db:"expense_date"`
+	ExpenseTime time.Time               `json:"expense_time" db:"expense_time"`
+	CreatedAt   time.Time               `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at" db:"updated_at"`
+	Categories  []ExpenseCategoryDetail `json:"categories" db:"-"`
+	// RecurringExpenseID is set on expenses created by a recurring expense
+	RecurringExpenseID *uuid.UUID `json:"recurring_expense_id,omitempty" db:"recurring_expense_id"`
+}
+
+// RecurringExpense is a schedule that creates an expense on each of its occurrences.
+// Occurrences fall every Interval days, weeks, months or years from StartDate, until
+// EndDate or for Count occurrences.
+type RecurringExpense struct {
+	ID          uuid.UUID               `json:"id" db:"id"`
+	UserID      uuid.UUID               `json:"user_id" db:"user_id"`
+	Title       string                  `json:"title" db:"title"`
+	Description *string                 `json:"description,omitempty" db:"description"`
+	Amount      Money                   `json:"amount" db:"amount_minor"`
+	Currency    string                  `json:"currency" db:"currency"`
+	ExpenseTime time.Time               `json:"expense_time" db:"expense_time"`
+	Frequency   string                  `json:"frequency" db:"frequency"`
+	Interval    int                     `json:"interval" db:"interval_count"`
+	StartDate   time.Time               `json:"start_date" db:"start_date"`
+	EndDate     *time.Time              `json:"end_date,omitempty" db:"end_date"`
+	Count       *int                    `json:"count,omitempty" db:"occurrence_count"`
+	NextDate    *time.Time              `json:"next_date,omitempty" db:"next_date"`
+	Paused      bool                    `json:"paused" db:"paused"`
+	CreatedAt   time.Time               `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at" db:"updated_at"`
+	Categories  []ExpenseCategoryDetail `json:"categories" db:"-"`
+	// Skipped lists the occurrences from NextDate on that will not create an expense
+	Skipped []time.Time `json:"skipped" db:"-"`
+}
+
+// Attachment is a file, such as a receipt photo, kept with an expense. Its content is
+// stored in the BlobStore under StorageKey.
+type Attachment struct {
 	ID          uuid.UUID `json:"id" db:"id"`
+	ExpenseID   uuid.UUID `json:"expense_id" db:"expense_id"`
 	UserID      uuid.UUID `json:"user_id" db:"user_id"`
-	Title       string    `json:"title" db:"title"`
-	Description *string   `json:"description,omitempty" db:"description"`
-	Amount      float64   `json:"amount" db:"amount"`
-	ExpenseDate string    `json:"expense_date" db:"expense_date"`
-	ExpenseTime string    `json:"expense_time" db:"expense_time"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size_bytes"`
+	// SHA256 is the hex-encoded SHA-256 of the content
+	SHA256     string    `json:"sha256" db:"sha256"`
+	StorageKey string    `json:"-" db:"storage_key"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
 
 // ExpenseCategory represents the many-to-many relationship between expenses and categories
@@ -49,21 +98,61 @@ type ExpenseCategory struct {
 	CategoryID uuid.UUID `json:"category_id" db:"category_id"`
 }
 
-// LoginHistory represents user login history
+// LoginHistory represents one sign-in attempt. UserID is nil when the email
+// did not belong to an account.
 type LoginHistory struct {
-	ID      uuid.UUID `json:"id" db:"id"`
-	UserID  uuid.UUID `json:"user_id" db:"user_id"`
-	LoginAt time.Time `json:"login_at" db:"login_at"`
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	Email     string     `json:"email" db:"email"`
+	IPAddress string     `json:"ip_address" db:"ip_address"`
+	UserAgent string     `json:"user_agent" db:"user_agent"`
+	Method    string     `json:"method" db:"method"`
+	Success   bool       `json:"success" db:"success"`
+	LoginAt   time.Time  `json:"login_at" db:"login_at"`
 }
 
 // Session represents user session data
 type Session struct {
-	ID        uuid.UUID  `json:"id" db:"id"`
-	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
-	Token     string     `json:"token" db:"token"`
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
-	IsActive  bool       `json:"is_active" db:"is_active"`
+	ID               uuid.UUID  `json:"id" db:"id"`
+	UserID           uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash        string     `json:"-" db:"token_hash"`
+	RefreshTokenHash string     `json:"-" db:"refresh_token_hash"`
+	FamilyID         uuid.UUID  `json:"family_id" db:"family_id"`
+	ParentID         *uuid.UUID `json:"parent_id,omitempty" db:"parent_id"`
+	UserAgent        *string    `json:"user_agent,omitempty" db:"user_agent"`
+	IPAddress        *string    `json:"ip_address,omitempty" db:"ip_address"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RotatedAt        *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	IsActive         bool       `json:"is_active" db:"is_active"`
+	// SignedInAt is when the login that started the session's family happened
+	SignedInAt time.Time `json:"signed_in_at" db:"-"`
+}
+
+// APIToken is a personal access token; only its hash is stored
+type APIToken struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// DataExport is a background export job
+type DataExport struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Status      string     `json:"status" db:"status"`
+	Error       *string    `json:"error,omitempty" db:"error"`
+	Archive     []byte     `json:"-" db:"archive"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty" db:"heartbeat_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
 }
 
 // RegisterRequest represents the request payload for user registration
@@ -87,9 +176,43 @@ type LoginRequest struct {
 
 // LoginResponse represents the response for successful user login
 type LoginResponse struct {
-	Message   string `json:"message"`
-	Token     string `json:"token"`
-	SessionID string `json:"session_id,omitempty"`
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	SessionID    string `json:"session_id,omitempty"`
+}
+
+// TwoFactorChallengeResponse is returned by login when a second factor is required
+type TwoFactorChallengeResponse struct {
+	Message           string `json:"message"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+// TwoFactorLoginRequest represents the second step of a 2FA login
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// TwoFactorCodeRequest represents a request carrying a single TOTP code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6"`
+}
+
+// DisableTwoFactorRequest represents the request payload for turning 2FA off
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// RefreshTokenRequest represents the request payload for rotating a refresh token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 // AddExpenseRequest represents the request payload for adding an expense
@@ -97,16 +220,38 @@ type LoginResponse struct {
 type AddExpenseRequest struct {
 	Title       string      `json:"title" validate:"required"`
 	Description *string     `json:"description,omitempty"`
-	Amount      float64     `json:"amount" validate:"required,gt=0"`
+	Amount      Money       `json:"amount" validate:"required,gt=0"`
+	Currency    string      `json:"currency,omitempty"`
 	ExpenseDate string      `json:"expense_date" validate:"required"`
 	ExpenseTime string      `json:"expense_time" validate:"required"`
 	Categories  []uuid.UUID `json:"categories" validate:"required,dive,uuid"`
+	// Splits divide the amount between the categories; without them it is split evenly
+	Splits []CategorySplit `json:"splits,omitempty"`
+}
+
+// CategorySplit gives one of an expense's categories a fixed amount or a percentage
+// of the expense; categories without a split share what is left evenly
+type CategorySplit struct {
+	CategoryID uuid.UUID `json:"category_id"`
+	Amount     *Money    `json:"amount,omitempty"`
+	Percentage *Percent  `json:"percentage,omitempty"`
+}
+
+// CategoryShare links an expense to a category with the part of its amount counted there
+type CategoryShare struct {
+	CategoryID uuid.UUID
+	Amount     Money
+	// Percentage is set when the share was given as a percentage
+	Percentage *Percent
 }
 
 type ExpenseCategoryDetail struct {
 	ID        uuid.UUID `json:"id"`
 	Name      string    `json:"name"`
 	IsDefault bool      `json:"is_default"`
+	// Amount is the expense's share in this category; recurring expenses leave it out
+	Amount     Money    `json:"amount,omitempty"`
+	Percentage *Percent `json:"percentage,omitempty"`
 }
 
 type ExpenseDetailResponse struct {
@@ -116,7 +261,8 @@ type ExpenseDetailResponse struct {
 		UserID      uuid.UUID               `json:"user_id"`
 		Title       string                  `json:"title"`
 		Description *string                 `json:"description,omitempty"`
-		Amount      float64                 `json:"amount"`
+		Amount      Money                   `json:"amount"`
+		Currency    string                  `json:"currency"`
 		ExpenseDate string                  `json:"expense_date"`
 		ExpenseTime string                  `json:"expense_time"`
 		CreatedAt   string                  `json:"created_at"`
@@ -129,10 +275,33 @@ type ExpenseDetailResponse struct {
 type UpdateExpenseRequest struct {
 	Title       string      `json:"title" validate:"required"`
 	Description *string     `json:"description,omitempty"`
-	Amount      float64     `json:"amount" validate:"required,gt=0"`
+	Amount      Money       `json:"amount" validate:"required,gt=0"`
+	Currency    string      `json:"currency,omitempty"`
 	ExpenseDate string      `json:"expense_date" validate:"required"`
 	ExpenseTime string      `json:"expense_time" validate:"required"`
 	Categories  []uuid.UUID `json:"categories" validate:"required,dive,uuid"`
+	// Splits replace the expense's previous ones; without them the amount is split evenly
+	Splits []CategorySplit `json:"splits,omitempty"`
+}
+
+// RecurringExpenseRequest represents the request payload for creating or updating a recurring expense
+type RecurringExpenseRequest struct {
+	Title       string      `json:"title" validate:"required"`
+	Description *string     `json:"description,omitempty"`
+	Amount      Money       `json:"amount" validate:"required,gt=0"`
+	Currency    string      `json:"currency,omitempty"`
+	ExpenseTime string      `json:"expense_time" validate:"required"`
+	Categories  []uuid.UUID `json:"categories" validate:"required,dive,uuid"`
+	Frequency   string      `json:"frequency" validate:"required,oneof=daily weekly monthly yearly"`
+	Interval    int         `json:"interval,omitempty"`
+	StartDate   string      `json:"start_date" validate:"required"`
+	EndDate     *string     `json:"end_date,omitempty"`
+	Count       *int        `json:"count,omitempty"`
+}
+
+// SkipOccurrenceRequest represents the request payload for skipping one occurrence
+type SkipOccurrenceRequest struct {
+	Date string `json:"date,omitempty"`
 }
 
 // AddExpenseResponse represents the response for successful expense addition
@@ -175,6 +344,7 @@ type CreateCategoryResponse struct {
 type UpdateProfileRequest struct {
 	Name         string  `json:"name" validate:"required,min=2,max=255"`
 	ProfileImage *string `json:"profile_image,omitempty"`
+	HomeCurrency *string `json:"home_currency,omitempty"`
 }
 
 // ChangePasswordRequest represents the request payload for changing password
@@ -183,6 +353,46 @@ type ChangePasswordRequest struct {
 	NewPassword     string `json:"new_password" validate:"required,min=8"`
 }
 
+// ForgotPasswordRequest represents the request payload for starting a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest represents the request payload for completing a password reset
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+// ChangeEmailRequest represents the request payload for changing the account email
+type ChangeEmailRequest struct {
+	Email           string `json:"email" validate:"required,email"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+}
+
+// CreateAPITokenRequest represents the request payload for creating a personal access token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// UpdateRoleRequest represents the request payload for changing a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+// DeactivateAccountRequest represents the request payload for deactivating an account
+type DeactivateAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// ReactivateAccountRequest represents the request payload for reactivating an account
+type ReactivateAccountRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor units: hundredths of the currency (cents, paise).
+// Sums and comparisons are exact, unlike float64. JSON carries it as a decimal
+// string such as "12.30"; requests may send a string or a plain number, and
+// anything with more than two decimal places is rejected.
+type Money int64
+
+// maxMoney is the largest amount a single expense may have (999,999,999,999.99)
+const maxMoney = Money(99999999999999)
+
+// errInvalidAmount is returned for amounts that are not decimals with at most two places
+var errInvalidAmount = errors.New("amount must be a decimal number with at most two decimal places")
+
+// ParseMoney parses a decimal such as "12", "12.3" or "-0.05" exactly
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	units, cents, hasPoint := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if units == "" || !isDigits(units) || (hasPoint && (cents == "" || !isDigits(cents))) {
+		return 0, errInvalidAmount
+	}
+	if len(cents) > 2 {
+		return 0, fmt.Errorf("%w: %q", errInvalidAmount, s)
+	}
+	if len(strings.TrimLeft(units, "0")) > 12 {
+		return 0, fmt.Errorf("%w: %q is too large", errInvalidAmount, s)
+	}
+
+	n, _ := strconv.ParseInt(units+(cents + "00")[:2], 10, 64)
+	if negative {
+		n = -n
+	}
+	return Money(n), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount with exactly two decimal places
+func (m Money) String() string {
+	sign, n := "", int64(m)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// MarshalJSON writes the amount as a decimal string
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts "12.30" or 12.30; the number is parsed from its text, never as a float
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return errInvalidAmount
+		}
+	}
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as an integer number of minor units
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads minor units; Postgres returns SUM over BIGINT as NUMERIC text
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		*m = Money(v)
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	case nil:
+		*m = 0
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %v", s, err)
+	}
+	*m = Money(n)
+	return nil
+}
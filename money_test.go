@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	valid := map[string]Money{
+		"0":               0,
+		"12":              1200,
+		"12.3":            1230,
+		"12.30":           1230,
+		"0.05":            5,
+		"-0.05":           -5,
+		" 7.5 ":           750,
+		"999999999999.99": maxMoney,
+	}
+	for input, want := range valid {
+		got, err := ParseMoney(input)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, want, got, input)
+		}
+	}
+
+	for _, input := range []string{"", ".", "12.", ".5", "12.345", "1e3", "+1", "1,5", "abc", "1000000000000"} {
+		_, err := ParseMoney(input)
+		assert.ErrorIs(t, err, errInvalidAmount, input)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var v struct {
+		A Money `json:"a"`
+		B Money `json:"b"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": "0.10", "b": 0.2}`), &v))
+	assert.Equal(t, Money(30), v.A+v.B)
+
+	out, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": "0.10", "b": "0.20"}`, string(out))
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"a": 0.30000000000000004}`), &v), errInvalidAmount)
+	assert.Equal(t, "-1234.05", Money(-123405).String())
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	require.NoError(t, m.Scan(int64(1230)))
+	assert.Equal(t, Money(1230), m)
+	require.NoError(t, m.Scan([]byte("99999999999999999")))
+	assert.Equal(t, Money(99999999999999999), m)
+	assert.Error(t, m.Scan(12.3))
+}
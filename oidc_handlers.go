@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcStateTTL is how long a user has to finish signing in at the identity provider
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie binds a login attempt to the browser that started it. It holds the
+// state hash, so a callback URL replayed in another browser is refused.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+)
+
+var (
+	errOIDCEmailNotVerified = errors.New("identity provider did not return a verified email")
+	errOIDCSignupDisabled   = errors.New("no account exists for this email")
+	errOIDCAccountInactive  = errors.New("account is deactivated")
+)
+
+// OIDCHandler handles single sign-on through an OpenID Connect provider
+type OIDCHandler struct {
+	db       *sql.DB
+	stores   *Stores
+	provider *oidcProvider
+}
+
+// NewOIDCHandler creates a new OIDCHandler instance
+func NewOIDCHandler(db *sql.DB, stores *Stores, provider *oidcProvider) *OIDCHandler {
+	return &OIDCHandler{db: db, stores: stores, provider: provider}
+}
+
+// Login starts the authorization-code flow and redirects to the identity provider.
+// The state, nonce and PKCE verifier are kept server-side until the callback, and the
+// state hash is set in a cookie so only this browser can finish the login.
+func (h *OIDCHandler) Login(c echo.Context) error {
+	state, err := generateSecureToken()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+	nonce, err := generateSecureToken()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+	verifier, err := generateSecureToken()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+
+	if err := purgeExpiredOIDCStates(h.db); err != nil {
+		log.Printf("Failed to purge expired OIDC states: %v", err)
+	}
+
+	authURL, err := h.provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return SendCustomError(c, ErrorServiceUnavailable, "Identity provider is unavailable", http.StatusBadGateway)
+	}
+
+	_, err = h.db.Exec(
+		`INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4)`,
+		hashToken(state), verifier, nonce, time.Now().Add(oidcStateTTL),
+	)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	c.SetCookie(oidcCookie(hashToken(state), oidcStateTTL))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes the flow: it redeems the code, verifies the ID token, links or
+// creates the account and starts a normal session.
+func (h *OIDCHandler) Callback(c echo.Context) error {
+	if errCode := c.QueryParam("error"); errCode != "" {
+		// The description is provider-supplied text, so it is logged rather than shown
+		log.Printf("OIDC provider returned %q: %s", errCode, c.QueryParam("error_description"))
+		return SendCustomError(c, ErrorInvalidCredentials, "Sign-in was cancelled or refused by the identity provider", http.StatusUnauthorized)
+	}
+
+	code := c.QueryParam("code")
+	state := c.QueryParam("state")
+	if code == "" || state == "" {
+		return SendCustomError(c, ErrorMissingFields, "code and state are required", http.StatusBadRequest)
+	}
+
+	// The state must belong to this browser, or anyone could be signed in to an attacker's account
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashToken(state))) != 1 {
+		return SendCustomError(c, ErrorInvalidToken, "Login request is invalid or has expired. Please start again", http.StatusBadRequest)
+	}
+	c.SetCookie(oidcCookie("", -1))
+
+	// Each state can be redeemed once
+	var verifier, nonce string
+	err = h.db.QueryRow(
+		`DELETE FROM oidc_login_states WHERE state_hash = $1 AND expires_at > $2 RETURNING code_verifier, nonce`,
+		hashToken(state), time.Now(),
+	).Scan(&verifier, &nonce)
+	if err == sql.ErrNoRows {
+		return SendCustomError(c, ErrorInvalidToken, "Login request is invalid or has expired. Please start again", http.StatusBadRequest)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	identity, err := h.provider.Exchange(code, verifier, nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		return SendCustomError(c, ErrorInvalidCredentials, "Single sign-on failed", http.StatusUnauthorized)
+	}
+
+	userID, err := h.resolveUser(c, identity)
+	switch err {
+	case nil:
+	case errOIDCEmailNotVerified, errOIDCSignupDisabled:
+		return SendCustomError(c, ErrorForbidden, err.Error(), http.StatusForbidden)
+	case errOIDCAccountInactive:
+		return SendCustomError(c, ErrorForbidden, "Account is deactivated. Reactivate it before signing in", http.StatusForbidden)
+	default:
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	user, err := h.stores.Users.GetUser(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	// Accounts with 2FA finish at /api/login/2fa, exactly like a password login
+	if user.TwoFactorEnabled {
+		return sendTwoFactorChallenge(c, userID)
+	}
+
+	client := clientInfoFromContext(c)
+	tokens, err := startSession(h.stores.Sessions, userID, client)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error: "Failed to create session",
+		})
+	}
+
+	if err := recordLoginAttempt(h.stores.Users, user.Email, loginMethodOIDC, client, true); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+	auditLogin(h.stores.Audit, c, userID, tokens.SessionID, loginMethodOIDC)
+
+	return c.JSON(http.StatusOK, LoginResponse{
+		Message:      "Login successful.",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		SessionID:    tokens.SessionID.String(),
+	})
+}
+
+// resolveUser maps an identity to a user. A known (issuer, subject) pair wins; otherwise
+// the identity is linked to the account with the same verified email, or a new account
+// is created when signup is allowed.
+func (h *OIDCHandler) resolveUser(c echo.Context, identity *oidcIdentity) (uuid.UUID, error) {
+	var userID uuid.UUID
+	var isActive bool
+	err := h.db.QueryRow(`
+		SELECT u.id, u.is_active
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2`,
+		identity.Issuer, identity.Subject,
+	).Scan(&userID, &isActive)
+	if err == nil {
+		if !isActive {
+			return uuid.Nil, errOIDCAccountInactive
+		}
+		_, err = h.db.Exec(`UPDATE user_identities SET last_login_at = $3 WHERE issuer = $1 AND subject = $2`, identity.Issuer, identity.Subject, time.Now())
+		return userID, err
+	}
+	if err != sql.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	// Linking by email is only safe when the provider vouches for the address
+	email := normalizeEmail(identity.Email)
+	if email == "" || !identity.EmailVerified {
+		return uuid.Nil, errOIDCEmailNotVerified
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	action := "user.sso_link"
+	err = tx.QueryRow(`SELECT id, is_active FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&userID, &isActive)
+	switch {
+	case err == sql.ErrNoRows:
+		if !h.provider.AllowSignup {
+			return uuid.Nil, errOIDCSignupDisabled
+		}
+		if userID, err = createSSOUser(tx, identity.Name, email); err != nil {
+			return uuid.Nil, err
+		}
+		action = "user.sso_signup"
+	case err != nil:
+		return uuid.Nil, err
+	case !isActive:
+		return uuid.Nil, errOIDCAccountInactive
+	default:
+		// The provider has confirmed ownership of the address
+		if _, err := tx.Exec(`UPDATE users SET email_verified = true, updated_at = $2 WHERE id = $1 AND email_verified = false`, userID, time.Now()); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(
+		`INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at) VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+		uuid.New(), userID, identity.Issuer, identity.Subject, email, now,
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	entry := newAuditEntry(c, action, "user", userID)
+	entry.ActorID = userID
+	entry.Details = map[string]interface{}{"issuer": identity.Issuer, "subject": identity.Subject}
+	if err := recordAudit(tx, entry); err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// createSSOUser creates a verified account for a first-time SSO user. The password is
+// random and unknown; the user can set one later through the password reset flow.
+func createSSOUser(tx *sql.Tx, name, email string) (uuid.UUID, error) {
+	if strings.TrimSpace(name) == "" {
+		name = strings.Split(email, "@")[0]
+	}
+
+	random, err := generateSecureToken()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	unusable, err := bcrypt.GenerateFromPassword([]byte(random), bcrypt.DefaultCost)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userID := uuid.New()
+	_, err = tx.Exec(
+		`INSERT INTO users (id, name, email, password, email_verified, home_currency) VALUES ($1, $2, $3, $4, true, $5)`,
+		userID, name, email, string(unusable), defaultCurrency(),
+	)
+	return userID, err
+}
+
+// oidcCookie builds the state cookie; a negative maxAge deletes it. It must survive the
+// top-level redirect back from the provider, so SameSite is Lax rather than Strict.
+func oidcCookie(value string, maxAge time.Duration) *http.Cookie {
+	seconds := int(maxAge / time.Second)
+	if maxAge < 0 {
+		seconds = -1
+	}
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcStateCookiePath,
+		MaxAge:   seconds,
+		HttpOnly: true,
+		Secure:   !isDevMode(),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// purgeExpiredOIDCStates removes login attempts that were never completed
+func purgeExpiredOIDCStates(db *sql.DB) error {
+	_, err := db.Exec(`DELETE FROM oidc_login_states WHERE expires_at < $1`, time.Now())
+	return err
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIdP is an OpenID Connect provider serving discovery, JWKS and the token endpoint.
+// Codes are handed out by authorize, which plays the part of the user signing in.
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values // code -> authorization request
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &testIdP{key: key, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test", "kty": "RSA", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		idp.mu.Lock()
+		auth, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || auth.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            auth.Get("client_id"),
+			"sub":            "subject-1",
+			"email":          "sso@example.com",
+			"email_verified": true,
+			"name":           "SSO User",
+			"nonce":          auth.Get("nonce"),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize signs the user in at the provider and returns the code for the authorization URL
+func (idp *testIdP) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	code, err := generateSecureToken()
+	require.NoError(t, err)
+	idp.mu.Lock()
+	idp.codes[code] = u.Query()
+	idp.mu.Unlock()
+	return code
+}
+
+// oidcLogin starts a login and returns the state from the redirect and the state cookie
+func oidcLogin(t *testing.T, app *testApp) (*url.URL, *http.Cookie) {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil)
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, oidcStateCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	return location, cookies[0]
+}
+
+// oidcCallback finishes a login, sending cookie when it is set
+func oidcCallback(t *testing.T, app *testApp, code, state string, cookie *http.Cookie) (int, map[string]interface{}) {
+	query := url.Values{"code": {code}, "state": {state}}
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+
+	var out map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+func newTestOIDCHandler(app *testApp, idp *testIdP) {
+	provider := newOIDCProvider(OIDCConfig{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "expense-tracker",
+		RedirectURL: "http://localhost:3000/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		AllowSignup: true,
+	})
+	oidc := NewOIDCHandler(app.db, app.stores, provider)
+	app.e.GET("/api/auth/oidc/login", oidc.Login)
+	app.e.GET("/api/auth/oidc/callback", oidc.Callback)
+}
+
+func TestOIDCHandler_LoginAndCallback(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		idp := newTestIdP(t)
+		newTestOIDCHandler(app, idp)
+
+		location, cookie := oidcLogin(t, app)
+		assert.Equal(t, idp.server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+		assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+		state := location.Query().Get("state")
+
+		code, body := oidcCallback(t, app, idp.authorize(t, location.String()), state, cookie)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.NotEmpty(t, body["token"])
+
+		// The first login created a verified account linked to the subject
+		user, err := app.stores.Users.GetUserByEmail("sso@example.com")
+		require.NoError(t, err)
+		assert.True(t, user.EmailVerified)
+		assert.Contains(t, app.audit.actions, "auth.login")
+
+		// A state is redeemed once
+		code, _ = oidcCallback(t, app, idp.authorize(t, location.String()), state, cookie)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		// The next login finds the account by its subject
+		location, cookie = oidcLogin(t, app)
+		code, body = oidcCallback(t, app, idp.authorize(t, location.String()), location.Query().Get("state"), cookie)
+		require.Equal(t, http.StatusOK, code, body)
+		token, err := parseAccessToken(body["token"].(string))
+		require.NoError(t, err)
+		assert.Equal(t, user.ID.String(), token.Claims.(jwt.MapClaims)["user_id"])
+	})
+}
+
+func TestOIDCHandler_CallbackNeedsStateCookie(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		idp := newTestIdP(t)
+		newTestOIDCHandler(app, idp)
+
+		// An attacker starts a login and sends the victim the callback URL
+		attacker, _ := oidcLogin(t, app)
+		code := idp.authorize(t, attacker.String())
+
+		status, _ := oidcCallback(t, app, code, attacker.Query().Get("state"), nil)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		// The victim's own login cookie does not match the attacker's state either
+		_, victimCookie := oidcLogin(t, app)
+		status, _ = oidcCallback(t, app, code, attacker.Query().Get("state"), victimCookie)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		_, err := app.stores.Users.GetUserByEmail("sso@example.com")
+		assert.Error(t, err)
+	})
+}
+
+func TestOIDCHandler_TwoFactorAccountsGetAChallenge(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		idp := newTestIdP(t)
+		newTestOIDCHandler(app, idp)
+		token, _ := app.signUp(t, "sso@example.com")
+		secret, _ := enableTwoFactor(t, app, token)
+
+		location, cookie := oidcLogin(t, app)
+		code, body := oidcCallback(t, app, idp.authorize(t, location.String()), location.Query().Get("state"), cookie)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, true, body["two_factor_required"])
+		assert.Nil(t, body["token"])
+
+		// Confirming enrollment used the current code
+		code, body = app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": body["challenge_token"].(string), "code": totpAt(t, secret, 1)})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.NotEmpty(t, body["token"])
+	})
+}
+
+func TestOIDCHandler_ProviderErrorIsNotEchoed(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		newTestOIDCHandler(app, newTestIdP(t))
+
+		query := url.Values{"error": {"access_denied"}, "error_description": {"<script>alert(1)</script>"}}
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+query.Encode(), nil)
+		rec := httptest.NewRecorder()
+		app.e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "script")
+	})
+}
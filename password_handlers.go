@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHandler handles forgotten-password recovery
+type PasswordHandler struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+// NewPasswordHandler creates a new PasswordHandler instance
+func NewPasswordHandler(db *sql.DB, mailer Mailer) *PasswordHandler {
+	return &PasswordHandler{db: db, mailer: mailer}
+}
+
+// ForgotPassword emails a single-use reset link if the address belongs to an active account.
+// The response is the same either way so it cannot be used to discover accounts.
+func (h *PasswordHandler) ForgotPassword(c echo.Context) error {
+	var req ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	if strings.TrimSpace(req.Email) == "" {
+		return SendCustomError(c, ErrorMissingFields, "Email is required", http.StatusBadRequest)
+	}
+
+	var userID uuid.UUID
+	var name, email string
+	err := h.db.QueryRow(`SELECT id, name, email FROM users WHERE LOWER(email) = LOWER($1) AND is_active = true`, normalizeEmail(req.Email)).
+		Scan(&userID, &name, &email)
+	if err != nil && err != sql.ErrNoRows {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	if err == nil {
+		token, err := createResetToken(h.db, userID)
+		if err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+
+		if err := sendPasswordResetEmail(h.mailer, name, email, token); err != nil {
+			log.Printf("Failed to send password reset email: %v", err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "If an account exists for that email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out everywhere
+func (h *PasswordHandler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		return SendCustomError(c, ErrorMissingFields, "Reset token is required", http.StatusBadRequest)
+	}
+	if len(req.NewPassword) < 8 {
+		return SendCustomError(c, ErrorValidationFailed, "New password must be at least 8 characters", http.StatusBadRequest)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer tx.Rollback()
+
+	// Claiming the token in one statement keeps it single-use under concurrent resets
+	now := time.Now()
+	var userID uuid.UUID
+	err = tx.QueryRow(
+		`UPDATE password_reset_tokens SET used_at = $2
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		 RETURNING user_id`,
+		hashToken(req.Token), now,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return SendStandardError(c, ErrorInvalidResetToken)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET password = $2, updated_at = $3 WHERE id = $1`, userID, string(hashedPassword), now); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET is_active = false WHERE user_id = $1 AND is_active = true`, userID); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Password has been reset. Please login with your new password",
+	})
+}
+
+// sendPasswordResetEmail mails the reset link for token
+func sendPasswordResetEmail(mailer Mailer, name, email, token string) error {
+	link := fmt.Sprintf("%s/reset-password?token=%s", appBaseURL(), token)
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+		name, passwordResetTTL(), link)
+	return mailer.Send(email, "Reset your Expense Tracker password", body)
+}
+
+// createResetToken invalidates earlier unused reset tokens and stores a new one
+func createResetToken(db *sql.DB, userID uuid.UUID) (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE password_reset_tokens SET used_at = $2 WHERE user_id = $1 AND used_at IS NULL`, userID, now); err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO password_reset_tokens (id, user_id, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		uuid.New(), userID, hashToken(token), now, now.Add(passwordResetTTL()),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// passwordResetTTL returns how long reset links stay valid (PASSWORD_RESET_TTL, default 1h)
+func passwordResetTTL() time.Duration {
+	return config().Auth.PasswordResetTTL
+}
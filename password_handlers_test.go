@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHandler_ForgotAndReset(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		session, _ := app.signUp(t, "forgetful@example.com")
+
+		// The address matches in any case, and the link goes to the stored address
+		code, body := app.do(t, http.MethodPost, "/api/password/forgot", "", map[string]string{"email": " Forgetful@Example.COM "})
+		require.Equal(t, http.StatusOK, code, body)
+		token := app.mailedToken(t, "forgetful@example.com")
+		require.NotEmpty(t, token)
+
+		// Unknown addresses get the same answer and no mail
+		code, unknown := app.do(t, http.MethodPost, "/api/password/forgot", "", map[string]string{"email": "nobody@example.com"})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, body["message"], unknown["message"])
+		assert.Empty(t, app.mailedToken(t, "nobody@example.com"))
+
+		code, body = app.do(t, http.MethodPost, "/api/password/reset", "", map[string]string{"token": token, "new_password": "short"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorValidationFailed, body["error"])
+
+		code, body = app.do(t, http.MethodPost, "/api/password/reset", "", map[string]string{"token": token, "new_password": "new-password"})
+		require.Equal(t, http.StatusOK, code, body)
+
+		// The reset signed the user out everywhere
+		code, _ = app.do(t, http.MethodGet, "/api/profile", session, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// The link only works once
+		code, body = app.do(t, http.MethodPost, "/api/password/reset", "", map[string]string{"token": token, "new_password": "another-password"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidResetToken, body["error"])
+
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "forgetful@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "forgetful@example.com", "password": "new-password"})
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
+
+func TestPasswordHandler_ResetLinksExpire(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "slow@example.com")
+		forgot := map[string]string{"email": "slow@example.com"}
+
+		code, _ := app.do(t, http.MethodPost, "/api/password/forgot", "", forgot)
+		require.Equal(t, http.StatusOK, code)
+		first := app.mailedToken(t, "slow@example.com")
+
+		// Asking again replaces the earlier link
+		code, _ = app.do(t, http.MethodPost, "/api/password/forgot", "", forgot)
+		require.Equal(t, http.StatusOK, code)
+		second := app.mailedToken(t, "slow@example.com")
+		require.NotEqual(t, first, second)
+		code, body := app.do(t, http.MethodPost, "/api/password/reset", "", map[string]string{"token": first, "new_password": "new-password"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidResetToken, body["error"])
+
+		_, err := app.db.Exec(`UPDATE password_reset_tokens SET expires_at = $2 WHERE token_hash = $1`, hashToken(second), time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		code, body = app.do(t, http.MethodPost, "/api/password/reset", "", map[string]string{"token": second, "new_password": "new-password"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidResetToken, body["error"])
+
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "slow@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusOK, code)
+	})
+}
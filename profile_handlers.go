@@ -1,11 +1,10 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -14,12 +13,12 @@ import (
 
 // ProfileHandler handles user profile-related requests
 type ProfileHandler struct {
-	db *sql.DB
+	stores *Stores
 }
 
 // NewProfileHandler creates a new ProfileHandler instance
-func NewProfileHandler(db *sql.DB) *ProfileHandler {
-	return &ProfileHandler{db: db}
+func NewProfileHandler(stores *Stores) *ProfileHandler {
+	return &ProfileHandler{stores: stores}
 }
 
 // GetProfile handles getting user profile information
@@ -62,14 +61,33 @@ func (h *ProfileHandler) UpdateProfile(c echo.Context) error {
 		return SendCustomError(c, ErrorValidationFailed, "Name is required", http.StatusBadRequest)
 	}
 
+	// The home currency only changes when one is given
+	user, err := h.stores.Users.GetUser(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	homeCurrency := user.HomeCurrency
+	if req.HomeCurrency != nil {
+		var ok bool
+		if homeCurrency, ok = normalizeCurrency(*req.HomeCurrency); !ok {
+			return SendCustomError(c, ErrorValidationFailed, "Home currency must be an ISO 4217 code such as USD or EUR", http.StatusBadRequest)
+		}
+	}
+
+	entry := newAuditEntry(c, "profile.update", "user", userID)
+	entry.setBefore(profileSnapshot(h.stores.Users, userID))
+
 	// Update user profile in database
-	err := h.updateUserProfile(userID, req.Name, req.ProfileImage)
+	err = h.updateUserProfile(userID, req.Name, req.ProfileImage, homeCurrency)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: fmt.Sprintf("Failed to update profile: %v", err),
 		})
 	}
 
+	entry.setAfter(profileSnapshot(h.stores.Users, userID))
+	logAudit(h.stores.Audit, entry)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Profile updated successfully",
 	})
@@ -120,60 +138,113 @@ func (h *ProfileHandler) ChangePassword(c echo.Context) error {
 		})
 	}
 
+	logAudit(h.stores.Audit, newAuditEntry(c, "profile.change_password", "user", userID))
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "Password changed successfully",
 	})
 }
 
+// GetLoginHistory returns a page of the user's sign-in attempts, newest first.
+// ?success=true|false narrows it to successful or failed attempts.
+func (h *ProfileHandler) GetLoginHistory(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	// Parse pagination parameters
+	page := 1
+	limit := 20
+	if pageStr := c.QueryParam("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	var success *bool
+	if successStr := c.QueryParam("success"); successStr != "" {
+		value, err := strconv.ParseBool(successStr)
+		if err != nil {
+			return SendCustomError(c, ErrorValidationFailed, "success must be true or false", http.StatusBadRequest)
+		}
+		success = &value
+	}
+
+	attempts, total, err := h.stores.Users.LoginHistory(userID, success, limit, (page-1)*limit)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	history := make([]map[string]interface{}, 0, len(attempts))
+	for _, attempt := range attempts {
+		history = append(history, map[string]interface{}{
+			"id":         attempt.ID,
+			"login_at":   attempt.LoginAt.Format("02-01-2006 03:04:05 PM"),
+			"ip_address": attempt.IPAddress,
+			"user_agent": attempt.UserAgent,
+			"method":     attempt.Method,
+			"success":    attempt.Success,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":        history,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": (total + limit - 1) / limit,
+	})
+}
+
 // Helper functions for profile management
 
 // getUserProfile retrieves user profile information
 func (h *ProfileHandler) getUserProfile(userID uuid.UUID) (map[string]interface{}, error) {
-	query := `SELECT id, name, email, profile_image, created_at, updated_at FROM users WHERE id = $1 AND is_active = true`
-	
-	var id uuid.UUID
-	var name, email string
-	var profileImage *string
-	var createdAt, updatedAt time.Time
-	
-	err := h.db.QueryRow(query, userID).Scan(&id, &name, &email, &profileImage, &createdAt, &updatedAt)
+	user, err := h.stores.Users.GetUser(userID)
 	if err != nil {
 		return nil, err
 	}
 
 	profile := map[string]interface{}{
-		"id":         id,
-		"name":       name,
-		"email":      email,
-		"created_at": createdAt.Format("02-01-2006 03:04:05 PM"),
-		"updated_at": updatedAt.Format("02-01-2006 03:04:05 PM"),
+		"id":             user.ID,
+		"name":           user.Name,
+		"email":          user.Email,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+		"home_currency":  user.HomeCurrency,
+		"created_at":     user.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+		"updated_at":     user.UpdatedAt.Format("02-01-2006 03:04:05 PM"),
 	}
 
-	if profileImage != nil {
-		profile["profile_image"] = *profileImage
+	if user.PendingEmail != nil {
+		profile["pending_email"] = *user.PendingEmail
+	}
+	if user.ProfileImage != nil {
+		profile["profile_image"] = *user.ProfileImage
 	}
 
 	return profile, nil
 }
 
 // updateUserProfile updates user profile information
-func (h *ProfileHandler) updateUserProfile(userID uuid.UUID, name string, profileImage *string) error {
-	query := `UPDATE users SET name = $2, profile_image = $3, updated_at = $4 WHERE id = $1`
-	_, err := h.db.Exec(query, userID, name, profileImage, time.Now())
-	return err
+func (h *ProfileHandler) updateUserProfile(userID uuid.UUID, name string, profileImage *string, homeCurrency string) error {
+	return h.stores.Users.UpdateProfile(userID, name, profileImage, homeCurrency)
 }
 
 // verifyCurrentPassword checks if the provided current password is correct
 func (h *ProfileHandler) verifyCurrentPassword(userID uuid.UUID, currentPassword string) (bool, error) {
-	var hashedPassword string
-	query := `SELECT password FROM users WHERE id = $1 AND is_active = true`
-	
-	err := h.db.QueryRow(query, userID).Scan(&hashedPassword)
+	user, err := h.stores.Users.GetUser(userID)
 	if err != nil {
 		return false, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(currentPassword))
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword))
 	return err == nil, nil
 }
 
@@ -185,8 +256,5 @@ func (h *ProfileHandler) updateUserPassword(userID uuid.UUID, newPassword string
 		return err
 	}
 
-	// Update password in database
-	query := `UPDATE users SET password = $2, updated_at = $3 WHERE id = $1`
-	_, err = h.db.Exec(query, userID, string(hashedPassword), time.Now())
-	return err
+	return h.stores.Users.UpdatePassword(userID, string(hashedPassword))
 }
\ No newline at end of file
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Recurrence frequencies, as in an iCalendar RRULE's FREQ
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+)
+
+// validFrequency reports whether f is one of the supported frequencies
+func validFrequency(f string) bool {
+	switch f {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+		return true
+	}
+	return false
+}
+
+// occurrence returns the date of the nth occurrence, counting the start date as 0.
+// Monthly and yearly schedules keep the start's day of the month and fall on the
+// last day of months that are too short, so the 31st becomes the 30th in April and
+// 29 February becomes the 28th outside leap years.
+func (r *RecurringExpense) occurrence(n int) time.Time {
+	step := n * r.Interval
+	switch r.Frequency {
+	case FrequencyWeekly:
+		return r.StartDate.AddDate(0, 0, 7*step)
+	case FrequencyMonthly:
+		return addMonthsClamped(r.StartDate, step)
+	case FrequencyYearly:
+		return addMonthsClamped(r.StartDate, 12*step)
+	default:
+		return r.StartDate.AddDate(0, 0, step)
+	}
+}
+
+// addMonthsClamped moves t by months, keeping its day unless the month is shorter
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// occurrenceOnOrAfter returns the index of the first occurrence on or after day,
+// ignoring the end date and count
+func (r *RecurringExpense) occurrenceOnOrAfter(day time.Time) int {
+	if !day.After(r.StartDate) {
+		return 0
+	}
+	// Start just below the answer and step up; months vary in length
+	var n int
+	switch r.Frequency {
+	case FrequencyWeekly:
+		n = int(day.Sub(r.StartDate).Hours()/24) / (7 * r.Interval)
+	case FrequencyMonthly, FrequencyYearly:
+		months := (day.Year()-r.StartDate.Year())*12 + int(day.Month()) - int(r.StartDate.Month())
+		per := r.Interval
+		if r.Frequency == FrequencyYearly {
+			per *= 12
+		}
+		n = months/per - 1
+	default:
+		n = int(day.Sub(r.StartDate).Hours()/24) / r.Interval
+	}
+	if n < 0 {
+		n = 0
+	}
+	for r.occurrence(n).Before(day) {
+		n++
+	}
+	return n
+}
+
+// withinSchedule reports whether the nth occurrence is before the end date and count
+func (r *RecurringExpense) withinSchedule(n int) bool {
+	if r.Count != nil && n >= *r.Count {
+		return false
+	}
+	return r.EndDate == nil || !r.occurrence(n).After(*r.EndDate)
+}
+
+// nextOccurrence returns the first occurrence on or after day, or nil when the schedule ends before it
+func (r *RecurringExpense) nextOccurrence(day time.Time) *time.Time {
+	n := r.occurrenceOnOrAfter(day)
+	if !r.withinSchedule(n) {
+		return nil
+	}
+	next := r.occurrence(n)
+	return &next
+}
+
+// upcoming returns up to limit occurrences from NextDate on
+func (r *RecurringExpense) upcoming(limit int) []time.Time {
+	dates := make([]time.Time, 0, limit)
+	if r.NextDate == nil {
+		return dates
+	}
+	for n := r.occurrenceOnOrAfter(*r.NextDate); len(dates) < limit && r.withinSchedule(n); n++ {
+		dates = append(dates, r.occurrence(n))
+	}
+	return dates
+}
+
+// isSkipped reports whether the user skipped the occurrence on day
+func (r *RecurringExpense) isSkipped(day time.Time) bool {
+	for _, skipped := range r.Skipped {
+		if skipped.Equal(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// dueExpenses returns an expense for every occurrence from NextDate up to and including
+// on that was not skipped, and the occurrence the schedule continues from afterwards
+func (r *RecurringExpense) dueExpenses(on time.Time) ([]Expense, *time.Time) {
+	if r.Paused || r.NextDate == nil || r.NextDate.After(on) {
+		return nil, r.NextDate
+	}
+
+	var expenses []Expense
+	n := r.occurrenceOnOrAfter(*r.NextDate)
+	for ; r.withinSchedule(n) && !r.occurrence(n).After(on); n++ {
+		day := r.occurrence(n)
+		if r.isSkipped(day) {
+			continue
+		}
+		now := time.Now()
+		expenses = append(expenses, Expense{
+			ID:                 uuid.New(),
+			UserID:             r.UserID,
+			Title:              r.Title,
+			Description:        r.Description,
+			Amount:             r.Amount,
+			Currency:           r.Currency,
+			ExpenseDate:        day,
+			ExpenseTime:        r.ExpenseTime,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+			RecurringExpenseID: &r.ID,
+		})
+	}
+	if !r.withinSchedule(n) {
+		return expenses, nil
+	}
+	next := r.occurrence(n)
+	return expenses, &next
+}
+
+// materializeRecurring creates the expenses of every occurrence of the recurring
+// expense that is due on the given day. The store creates each occurrence at most
+// once, so running it again, or on two servers at once, adds nothing. A recurring
+// expense left without categories is paused rather than creating anything, and one
+// whose owner is not verified waits until they are.
+func materializeRecurring(stores *Stores, id uuid.UUID, on time.Time) (int, error) {
+	r, err := stores.Recurring.GetRecurring(id)
+	if err != nil {
+		return 0, err
+	}
+	owner, err := stores.Users.GetUser(r.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if !owner.EmailVerified {
+		return 0, nil
+	}
+
+	created, err := stores.Recurring.MaterializeRecurring(id, func(r *RecurringExpense) ([]Expense, *time.Time) {
+		return r.dueExpenses(on)
+	})
+	if errors.Is(err, errNoCategories) {
+		// Every category it was filed under has been deleted; the store paused it
+		log.Printf("Recurring expense %s has no categories left and was paused", id)
+		logAudit(stores.Audit, auditEntry{
+			Action: "recurring_expense.pause", EntityType: "recurring_expense", EntityID: id,
+			Details: map[string]interface{}{"reason": "no_categories"},
+		})
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, expense := range created {
+		entry := auditEntry{Action: "expense.create", EntityType: "expense", EntityID: expense.ID}
+		entry.Details = map[string]interface{}{"recurring_expense_id": id, "occurrence_date": expense.ExpenseDate.Format("2006-01-02")}
+		entry.setAfter(expenseSnapshot(stores.Expenses, expense.ID))
+		logAudit(stores.Audit, entry)
+	}
+	return len(created), nil
+}
+
+// materializeDueRecurring creates the due occurrences of every active recurring expense
+func materializeDueRecurring(stores *Stores, on time.Time) (int, error) {
+	ids, err := stores.Recurring.DueRecurring(on)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, id := range ids {
+		n, err := materializeRecurring(stores, id, on)
+		if err != nil {
+			log.Printf("Recurring expense %s failed: %v", id, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// runRecurringScheduler creates due recurring expenses every RECURRING_INTERVAL until ctx is done
+func runRecurringScheduler(ctx context.Context, stores *Stores) {
+	ticker := time.NewTicker(config().Recurring.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := materializeDueRecurring(stores, today())
+		if err != nil {
+			log.Printf("Recurring expense run failed: %v", err)
+		} else if n > 0 {
+			log.Printf("Created %d recurring expense(s)", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// RecurringExpenseHandler manages recurring expenses and their occurrences
+type RecurringExpenseHandler struct {
+	stores *Stores
+}
+
+// NewRecurringExpenseHandler creates a new RecurringExpenseHandler instance
+func NewRecurringExpenseHandler(stores *Stores) *RecurringExpenseHandler {
+	return &RecurringExpenseHandler{stores: stores}
+}
+
+// maxRecurringInterval caps the number of periods between occurrences
+const maxRecurringInterval = 999
+
+// CreateRecurring handles creating a recurring expense. Occurrences that are already
+// due, including past ones when start_date is in the past, are created straight away.
+func (h *RecurringExpenseHandler) CreateRecurring(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var req RecurringExpenseRequest
+	if err := c.Bind(&req); err != nil {
+		return sendRecurringBindError(c, err)
+	}
+	user, err := h.stores.Users.GetUser(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if !user.EmailVerified {
+		return sendRecurringNotVerified(c)
+	}
+
+	now := time.Now()
+	r := &RecurringExpense{ID: uuid.New(), UserID: userID, CreatedAt: now, UpdatedAt: now}
+	if err := applyRecurringRequest(r, req, user.HomeCurrency); err != nil {
+		return SendCustomError(c, ErrorValidationFailed, err.Error(), http.StatusBadRequest)
+	}
+	if ok, err := h.checkCategories(c, userID, req.Categories); !ok {
+		return err
+	}
+	r.NextDate = r.nextOccurrence(r.StartDate)
+	if err := h.stores.Recurring.CreateRecurring(r, req.Categories); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	entry := newAuditEntry(c, "recurring_expense.create", "recurring_expense", r.ID)
+	entry.setAfter(h.snapshot(r.ID))
+	logAudit(h.stores.Audit, entry)
+
+	created, err := materializeRecurring(h.stores, r.ID, today())
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	return h.respond(c, http.StatusCreated, "Recurring expense created successfully", r.ID, created)
+}
+
+// GetRecurringExpenses lists the user's recurring expenses
+func (h *RecurringExpenseHandler) GetRecurringExpenses(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	list, err := h.stores.Recurring.ListRecurring(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	views := make([]map[string]interface{}, 0, len(list))
+	for i := range list {
+		views = append(views, recurringView(&list[i]))
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":            "Recurring expenses retrieved successfully",
+		"count":              len(views),
+		"recurring_expenses": views,
+	})
+}
+
+// GetRecurring returns one recurring expense
+func (h *RecurringExpenseHandler) GetRecurring(c echo.Context) error {
+	r, err := h.loadOwned(c)
+	if err != nil || r == nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":           "Recurring expense retrieved successfully",
+		"recurring_expense": recurringView(r),
+	})
+}
+
+// UpdateRecurring replaces the expense fields and schedule. Occurrences already created
+// or skipped are left alone; the new schedule continues from the next one not yet due.
+func (h *RecurringExpenseHandler) UpdateRecurring(c echo.Context) error {
+	r, err := h.loadOwned(c)
+	if err != nil || r == nil {
+		return err
+	}
+
+	var req RecurringExpenseRequest
+	if err := c.Bind(&req); err != nil {
+		return sendRecurringBindError(c, err)
+	}
+	if ok, err := h.checkVerified(c, r.UserID); !ok {
+		return err
+	}
+	entry := newAuditEntry(c, "recurring_expense.update", "recurring_expense", r.ID)
+	entry.setBefore(h.snapshot(r.ID))
+
+	// Without a currency the recurring expense keeps the one it has
+	if err := applyRecurringRequest(r, req, r.Currency); err != nil {
+		return SendCustomError(c, ErrorValidationFailed, err.Error(), http.StatusBadRequest)
+	}
+	if ok, err := h.checkCategories(c, r.UserID, req.Categories); !ok {
+		return err
+	}
+	from := today().AddDate(0, 0, 1)
+	if r.NextDate != nil {
+		from = *r.NextDate
+	}
+	r.NextDate = r.nextOccurrence(from)
+	r.UpdatedAt = time.Now()
+	if err := h.stores.Recurring.UpdateRecurring(r, req.Categories); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	entry.setAfter(h.snapshot(r.ID))
+	logAudit(h.stores.Audit, entry)
+
+	created, err := materializeRecurring(h.stores, r.ID, today())
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	return h.respond(c, http.StatusOK, "Recurring expense updated successfully", r.ID, created)
+}
+
+// DeleteRecurring removes a recurring expense. The expenses it already created are kept.
+func (h *RecurringExpenseHandler) DeleteRecurring(c echo.Context) error {
+	r, err := h.loadOwned(c)
+	if err != nil || r == nil {
+		return err
+	}
+
+	entry := newAuditEntry(c, "recurring_expense.delete", "recurring_expense", r.ID)
+	entry.setBefore(h.snapshot(r.ID))
+	if err := h.stores.Recurring.DeleteRecurring(r.ID); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	logAudit(h.stores.Audit, entry)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Recurring expense deleted successfully",
+	})
+}
+
+// PauseRecurring stops a recurring expense from creating expenses until it is resumed
+func (h *RecurringExpenseHandler) PauseRecurring(c echo.Context) error {
+	return h.setPaused(c, true)
+}
+
+// ResumeRecurring restarts a paused recurring expense. Occurrences that fell due while
+// it was paused are not created; today's occurrence is.
+func (h *RecurringExpenseHandler) ResumeRecurring(c echo.Context) error {
+	return h.setPaused(c, false)
+}
+
+func (h *RecurringExpenseHandler) setPaused(c echo.Context, paused bool) error {
+	r, err := h.loadOwned(c)
+	if err != nil || r == nil {
+		return err
+	}
+	action, message := "recurring_expense.pause", "Recurring expense paused"
+	if !paused {
+		action, message = "recurring_expense.resume", "Recurring expense resumed"
+	}
+	if r.Paused == paused {
+		return h.respond(c, http.StatusOK, message, r.ID, 0)
+	}
+	if !paused && len(r.Categories) == 0 {
+		return SendCustomError(c, ErrorValidationFailed, "This recurring expense has no categories left; update it with at least one before resuming", http.StatusBadRequest)
+	}
+	if !paused {
+		if ok, err := h.checkVerified(c, r.UserID); !ok {
+			return err
+		}
+	}
+
+	entry := newAuditEntry(c, action, "recurring_expense", r.ID)
+	entry.setBefore(h.snapshot(r.ID))
+	r.Paused = paused
+	if !paused && r.NextDate != nil && r.NextDate.Before(today()) {
+		r.NextDate = r.nextOccurrence(today())
+	}
+	r.UpdatedAt = time.Now()
+	if err := h.stores.Recurring.UpdateRecurring(r, categoryIDs(r.Categories)); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	entry.setAfter(h.snapshot(r.ID))
+	logAudit(h.stores.Audit, entry)
+
+	created, err := materializeRecurring(h.stores, r.ID, today())
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	return h.respond(c, http.StatusOK, message, r.ID, created)
+}
+
+// SkipOccurrence keeps one upcoming occurrence from creating an expense. The body may
+// name the occurrence as {"date": "DD-MM-YYYY"}; without it the next one is skipped.
+func (h *RecurringExpenseHandler) SkipOccurrence(c echo.Context) error {
+	r, err := h.loadOwned(c)
+	if err != nil || r == nil {
+		return err
+	}
+
+	var req SkipOccurrenceRequest
+	if err := c.Bind(&req); err != nil {
+		return SendCustomError(c, ErrorInvalidRequest, "Invalid request body", http.StatusBadRequest)
+	}
+	if r.NextDate == nil {
+		return SendCustomError(c, ErrorValidationFailed, "This recurring expense has no upcoming occurrences", http.StatusBadRequest)
+	}
+	date := *r.NextDate
+	if strings.TrimSpace(req.Date) != "" {
+		date, err = time.Parse("02-01-2006", strings.TrimSpace(req.Date))
+		if err != nil {
+			return SendCustomError(c, ErrorValidationFailed, "Invalid date format. Use DD-MM-YYYY", http.StatusBadRequest)
+		}
+		n := r.occurrenceOnOrAfter(date)
+		if date.Before(*r.NextDate) || !r.occurrence(n).Equal(date) || !r.withinSchedule(n) {
+			return SendCustomError(c, ErrorValidationFailed, "Date is not an upcoming occurrence of this recurring expense", http.StatusBadRequest)
+		}
+	}
+
+	if err := h.stores.Recurring.SkipOccurrence(r.ID, date); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	entry := newAuditEntry(c, "recurring_expense.skip", "recurring_expense", r.ID)
+	entry.Details = map[string]interface{}{"occurrence_date": date.Format("2006-01-02")}
+	logAudit(h.stores.Audit, entry)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Occurrence skipped",
+		"date":    date.Format("02-01-2006"),
+	})
+}
+
+// PreviewOccurrences lists the next occurrences (count, default 5, at most 50),
+// including the skipped ones
+func (h *RecurringExpenseHandler) PreviewOccurrences(c echo.Context) error {
+	r, err := h.loadOwned(c)
+	if err != nil || r == nil {
+		return err
+	}
+
+	limit := 5
+	if countStr := c.QueryParam("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n < 1 || n > 50 {
+			return SendCustomError(c, ErrorValidationFailed, "count must be a number from 1 to 50", http.StatusBadRequest)
+		}
+		limit = n
+	}
+
+	occurrences := make([]map[string]interface{}, 0, limit)
+	for _, date := range r.upcoming(limit) {
+		occurrences = append(occurrences, map[string]interface{}{
+			"date":    date.Format("02-01-2006"),
+			"skipped": r.isSkipped(date),
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":     "Upcoming occurrences retrieved successfully",
+		"paused":      r.Paused,
+		"occurrences": occurrences,
+	})
+}
+
+// loadOwned returns the recurring expense named by the :id parameter. When it does not
+// exist or belongs to someone else the error response has been sent and both are nil.
+func (h *RecurringExpenseHandler) loadOwned(c echo.Context) (*RecurringExpense, error) {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return nil, SendStandardError(c, ErrorUnauthorized)
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, SendCustomError(c, ErrorValidationFailed, "Invalid recurring expense ID", http.StatusBadRequest)
+	}
+	r, err := h.stores.Recurring.GetRecurring(id)
+	if errors.Is(err, errNotFound) || (err == nil && r.UserID != userID) {
+		return nil, SendCustomError(c, ErrorNotFound, "Recurring expense not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, SendStandardError(c, ErrorDatabaseError)
+	}
+	return r, nil
+}
+
+// respond sends the recurring expense as it is now stored and how many expenses were created
+func (h *RecurringExpenseHandler) respond(c echo.Context, status int, message string, id uuid.UUID, created int) error {
+	r, err := h.stores.Recurring.GetRecurring(id)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	return c.JSON(status, map[string]interface{}{
+		"message":           message,
+		"recurring_expense": recurringView(r),
+		"created_expenses":  created,
+	})
+}
+
+// checkVerified reports whether the user's email address is verified. Recurring
+// expenses create expenses past the unverified account limit, so until then the
+// response has been sent and ok is false.
+func (h *RecurringExpenseHandler) checkVerified(c echo.Context, userID uuid.UUID) (bool, error) {
+	user, err := h.stores.Users.GetUser(userID)
+	if err != nil {
+		return false, SendStandardError(c, ErrorDatabaseError)
+	}
+	if !user.EmailVerified {
+		return false, sendRecurringNotVerified(c)
+	}
+	return true, nil
+}
+
+// checkCategories reports whether every category is named once and is the user's own
+// or a shared default. Otherwise the response has been sent and ok is false.
+func (h *RecurringExpenseHandler) checkCategories(c echo.Context, userID uuid.UUID, ids []uuid.UUID) (bool, error) {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		category, err := h.stores.Categories.GetCategory(id)
+		if err != nil && !errors.Is(err, errNotFound) {
+			return false, SendStandardError(c, ErrorDatabaseError)
+		}
+		if err != nil || seen[id] || (category.UserID != userID && !(category.IsDefault && category.UserID == uuid.Nil)) {
+			return false, SendCustomError(c, ErrorValidationFailed, fmt.Sprintf("Unknown or repeated category %s", id), http.StatusBadRequest)
+		}
+		seen[id] = true
+	}
+	return true, nil
+}
+
+// sendRecurringNotVerified refuses a recurring expense to an unverified account
+func sendRecurringNotVerified(c echo.Context) error {
+	return SendCustomError(c, ErrorEmailNotVerified, "Please verify your email address to set up recurring expenses", http.StatusForbidden)
+}
+
+// snapshot captures a recurring expense for the audit trail
+func (h *RecurringExpenseHandler) snapshot(id uuid.UUID) (map[string]interface{}, error) {
+	r, err := h.stores.Recurring.GetRecurring(id)
+	if err != nil {
+		return nil, err
+	}
+	return recurringView(r), nil
+}
+
+// sendRecurringBindError reports a request body that could not be decoded
+func sendRecurringBindError(c echo.Context, err error) error {
+	if errors.Is(err, errInvalidAmount) {
+		return SendCustomError(c, ErrorValidationFailed, "Amount must be a number with at most two decimal places", http.StatusBadRequest)
+	}
+	return SendCustomError(c, ErrorInvalidRequest, "Invalid request body", http.StatusBadRequest)
+}
+
+// applyRecurringRequest validates the request and copies it onto r. An empty currency
+// means defaultCurrency.
+func applyRecurringRequest(r *RecurringExpense, req RecurringExpenseRequest, defaultCurrency string) error {
+	if strings.TrimSpace(req.Title) == "" || req.Amount <= 0 || req.Amount > maxMoney || len(req.Categories) == 0 {
+		return errors.New("title, a positive amount and at least one category are required")
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	currency, ok := normalizeCurrency(currency)
+	if !ok {
+		return errInvalidCurrency
+	}
+	expenseTime, err := time.Parse("03:04 PM", strings.TrimSpace(req.ExpenseTime))
+	if err != nil {
+		return errors.New("expense_time must be HH:MM AM/PM")
+	}
+
+	frequency := strings.ToLower(strings.TrimSpace(req.Frequency))
+	if !validFrequency(frequency) {
+		return errors.New("frequency must be daily, weekly, monthly or yearly")
+	}
+	interval := req.Interval
+	if interval == 0 {
+		interval = 1
+	}
+	if interval < 1 || interval > maxRecurringInterval {
+		return fmt.Errorf("interval must be from 1 to %d", maxRecurringInterval)
+	}
+
+	startDate, err := time.Parse("02-01-2006", strings.TrimSpace(req.StartDate))
+	if err != nil {
+		return errors.New("start_date must be DD-MM-YYYY")
+	}
+	if startDate.Before(today().Add(-config().Recurring.MaxBackfill)) {
+		return fmt.Errorf("start_date can be at most %d days in the past", int(config().Recurring.MaxBackfill.Hours()/24))
+	}
+	var endDate *time.Time
+	if req.EndDate != nil && strings.TrimSpace(*req.EndDate) != "" {
+		end, err := time.Parse("02-01-2006", strings.TrimSpace(*req.EndDate))
+		if err != nil {
+			return errors.New("end_date must be DD-MM-YYYY")
+		}
+		if end.Before(startDate) {
+			return errors.New("end_date must not be before start_date")
+		}
+		endDate = &end
+	}
+	if req.Count != nil && *req.Count < 1 {
+		return errors.New("count must be at least 1")
+	}
+	if endDate != nil && req.Count != nil {
+		return errors.New("set either end_date or count, not both")
+	}
+
+	r.Title = req.Title
+	r.Description = req.Description
+	r.Amount = req.Amount
+	r.Currency = currency
+	r.ExpenseTime = expenseTime
+	r.Frequency = frequency
+	r.Interval = interval
+	r.StartDate = startDate
+	r.EndDate = endDate
+	r.Count = req.Count
+	return nil
+}
+
+// recurringView formats a recurring expense for responses and audit snapshots
+func recurringView(r *RecurringExpense) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":           r.ID,
+		"title":        r.Title,
+		"description":  r.Description,
+		"amount":       r.Amount,
+		"currency":     r.Currency,
+		"expense_time": r.ExpenseTime.Format("03:04 PM"),
+		"frequency":    r.Frequency,
+		"interval":     r.Interval,
+		"start_date":   r.StartDate.Format("02-01-2006"),
+		"end_date":     nil,
+		"count":        r.Count,
+		"next_date":    nil,
+		"paused":       r.Paused,
+		"categories":   r.Categories,
+		"created_at":   r.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+		"updated_at":   r.UpdatedAt.Format("02-01-2006 03:04:05 PM"),
+	}
+	if r.EndDate != nil {
+		view["end_date"] = r.EndDate.Format("02-01-2006")
+	}
+	if r.NextDate != nil {
+		view["next_date"] = r.NextDate.Format("02-01-2006")
+	}
+	skipped := make([]string, 0, len(r.Skipped))
+	for _, date := range r.Skipped {
+		skipped = append(skipped, date.Format("02-01-2006"))
+	}
+	view["skipped"] = skipped
+	return view
+}
+
+// categoryIDs returns the IDs of the categories
+func categoryIDs(categories []ExpenseCategoryDetail) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(categories))
+	for _, cat := range categories {
+		ids = append(ids, cat.ID)
+	}
+	return ids
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dates(t *testing.T, values ...string) []time.Time {
+	t.Helper()
+	out := make([]time.Time, len(values))
+	for i, v := range values {
+		out[i] = day(v)
+	}
+	return out
+}
+
+func TestRecurringExpense_Occurrences(t *testing.T) {
+	count := func(n int) *int { return &n }
+	end := day("2024-03-01")
+
+	tests := []struct {
+		name string
+		r    RecurringExpense
+		// want lists every occurrence of a schedule with an end, or the first few
+		want []time.Time
+	}{
+		{
+			name: "daily every third day",
+			r:    RecurringExpense{Frequency: FrequencyDaily, Interval: 3, StartDate: day("2024-02-27")},
+			want: dates(t, "2024-02-27", "2024-03-01", "2024-03-04", "2024-03-07"),
+		},
+		{
+			name: "fortnightly until an end date",
+			r:    RecurringExpense{Frequency: FrequencyWeekly, Interval: 2, StartDate: day("2024-01-05"), EndDate: &end},
+			want: dates(t, "2024-01-05", "2024-01-19", "2024-02-02", "2024-02-16", "2024-03-01"),
+		},
+		{
+			name: "month end falls on the last day of shorter months",
+			r:    RecurringExpense{Frequency: FrequencyMonthly, Interval: 1, StartDate: day("2024-01-31")},
+			want: dates(t, "2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30"),
+		},
+		{
+			name: "quarterly for three occurrences",
+			r:    RecurringExpense{Frequency: FrequencyMonthly, Interval: 3, StartDate: day("2024-11-15"), Count: count(3)},
+			want: dates(t, "2024-11-15", "2025-02-15", "2025-05-15"),
+		},
+		{
+			name: "leap day outside leap years",
+			r:    RecurringExpense{Frequency: FrequencyYearly, Interval: 1, StartDate: day("2024-02-29")},
+			want: dates(t, "2024-02-29", "2025-02-28", "2026-02-28", "2027-02-28"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.NextDate = &tt.r.StartDate
+			limit := len(tt.want)
+			if tt.r.EndDate != nil || tt.r.Count != nil {
+				limit += 2
+			}
+			assert.Equal(t, tt.want, tt.r.upcoming(limit))
+		})
+	}
+}
+
+func TestRecurringExpense_NextOccurrence(t *testing.T) {
+	r := RecurringExpense{Frequency: FrequencyMonthly, Interval: 1, StartDate: day("2024-01-31")}
+
+	assert.Equal(t, day("2024-01-31"), *r.nextOccurrence(day("2023-06-01")))
+	assert.Equal(t, day("2024-02-29"), *r.nextOccurrence(day("2024-02-01")))
+	assert.Equal(t, day("2024-04-30"), *r.nextOccurrence(day("2024-04-30")))
+	assert.Equal(t, day("2025-01-31"), *r.nextOccurrence(day("2024-12-31").AddDate(0, 0, 1)))
+
+	two := 2
+	r.Count = &two
+	assert.Nil(t, r.nextOccurrence(day("2024-03-01")))
+}
+
+func TestRecurringExpense_DueExpenses(t *testing.T) {
+	start := day("2024-01-01")
+	r := RecurringExpense{
+		Frequency: FrequencyDaily, Interval: 1, StartDate: start, NextDate: &start,
+		Title: "Coffee", Amount: 350, Currency: "EUR",
+		Skipped: dates(t, "2024-01-02"),
+	}
+
+	expenses, next := r.dueExpenses(day("2024-01-03"))
+	require.Len(t, expenses, 2)
+	assert.Equal(t, day("2024-01-01"), expenses[0].ExpenseDate)
+	assert.Equal(t, day("2024-01-03"), expenses[1].ExpenseDate)
+	assert.Equal(t, Money(350), expenses[1].Amount)
+	assert.Equal(t, "EUR", expenses[1].Currency)
+	assert.Equal(t, day("2024-01-04"), *next)
+
+	// Nothing is due before the next date or while paused
+	expenses, next = r.dueExpenses(day("2023-12-31"))
+	assert.Empty(t, expenses)
+	assert.Equal(t, start, *next)
+	r.Paused = true
+	expenses, _ = r.dueExpenses(day("2024-01-03"))
+	assert.Empty(t, expenses)
+
+	// The schedule ends after its last occurrence
+	r.Paused = false
+	three := 3
+	r.Count = &three
+	expenses, next = r.dueExpenses(day("2024-02-01"))
+	assert.Len(t, expenses, 2)
+	assert.Nil(t, next)
+}
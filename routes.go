@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/labstack/echo/v4"
+)
+
+// appHandlers holds every handler the API serves
+type appHandlers struct {
+	auth         *AuthHandler
+	expense      *ExpenseHandler
+	recurring    *RecurringExpenseHandler
+	attachment   *AttachmentHandler
+	category     *CategoryHandler
+	profile      *ProfileHandler
+	session      *SessionHandler
+	password     *PasswordHandler
+	verification *EmailVerificationHandler
+	twoFactor    *TwoFactorHandler
+	apiToken     *APITokenHandler
+	account      *AccountHandler
+	export       *ExportHandler
+	admin        *AdminHandler
+	exchangeRate *ExchangeRateHandler
+	audit        *AuditHandler
+	health       *HealthHandler
+	oidc         *OIDCHandler
+}
+
+// newAppHandlers creates the handlers. oidcProvider is nil when single sign-on is not configured.
+func newAppHandlers(ctx context.Context, db *sql.DB, dialect *sqlDialect, stores *Stores, mailer Mailer, oidcProvider *oidcProvider) *appHandlers {
+	h := &appHandlers{
+		auth:         NewAuthHandler(stores, mailer),
+		expense:      NewExpenseHandler(stores),
+		recurring:    NewRecurringExpenseHandler(stores),
+		attachment:   NewAttachmentHandler(stores),
+		category:     NewCategoryHandler(stores),
+		profile:      NewProfileHandler(stores),
+		session:      NewSessionHandler(stores.Sessions),
+		password:     NewPasswordHandler(db, mailer),
+		verification: NewEmailVerificationHandler(db, mailer),
+		twoFactor:    NewTwoFactorHandler(db, stores),
+		apiToken:     NewAPITokenHandler(stores.APITokens),
+		account:      NewAccountHandler(db, stores),
+		export:       NewExportHandler(ctx, db, stores),
+		admin:        NewAdminHandler(db, mailer),
+		exchangeRate: NewExchangeRateHandler(stores),
+		audit:        NewAuditHandler(stores.Users, stores.Audit),
+		health:       NewHealthHandler(db, dialect),
+	}
+	if oidcProvider != nil {
+		h.oidc = NewOIDCHandler(db, stores, oidcProvider)
+	}
+	return h
+}
+
+// registerRoutes mounts the API on e. The handler tests serve the same routes, so
+// they run behind the same session, role and token checks as the server.
+func registerRoutes(e *echo.Echo, stores *Stores, h *appHandlers) {
+	e.GET("/healthz", h.health.Liveness)
+	e.GET("/readyz", h.health.Readiness)
+	e.GET("/.well-known/jwks.json", JWKS)
+	api := e.Group("/api")
+
+	// Public routes
+	api.POST("/register", h.auth.Register)
+	api.POST("/login", h.auth.Login)
+	api.POST("/login/2fa", h.twoFactor.LoginTwoFactor)
+	api.POST("/token/refresh", h.auth.RefreshToken)
+	api.POST("/password/forgot", h.password.ForgotPassword)
+	api.POST("/password/reset", h.password.ResetPassword)
+	api.GET("/email/verify", h.verification.VerifyEmail)
+	api.POST("/account/reactivate", h.account.Reactivate)
+	if h.oidc != nil {
+		api.GET("/auth/oidc/login", h.oidc.Login)
+		api.GET("/auth/oidc/callback", h.oidc.Callback)
+	}
+
+	// Protected routes
+	protected := api.Group("", JWTMiddleware(stores.Sessions))
+	protected.POST("/logout", h.auth.Logout)
+	protected.GET("/sessions", h.session.GetSessions)
+	protected.DELETE("/sessions/others", h.session.RevokeOtherSessions)
+	protected.GET("/sessions/:id", h.session.GetSession)
+	protected.DELETE("/sessions/:id", h.session.RevokeSession)
+	protected.GET("/tokens", h.apiToken.GetTokens)
+	protected.POST("/tokens", h.apiToken.CreateToken)
+	protected.DELETE("/tokens/:id", h.apiToken.RevokeToken)
+	protected.GET("/profile", h.profile.GetProfile)
+	protected.PUT("/profile", h.profile.UpdateProfile)
+	protected.PUT("/profile/password", h.profile.ChangePassword)
+	protected.GET("/profile/login-history", h.profile.GetLoginHistory)
+	protected.POST("/profile/deactivate", h.account.Deactivate)
+	protected.GET("/profile/export", h.export.Export)
+	protected.GET("/profile/export/:id", h.export.ExportStatus)
+	protected.GET("/profile/export/:id/download", h.export.DownloadExport)
+	protected.POST("/profile/import", h.export.Import)
+	protected.GET("/audit", h.audit.GetAuditLog)
+	protected.PUT("/profile/email", h.verification.ChangeEmail)
+	protected.POST("/email/verification/resend", h.verification.ResendVerification)
+	protected.POST("/2fa/enroll", h.twoFactor.Enroll)
+	protected.POST("/2fa/confirm", h.twoFactor.Confirm)
+	protected.POST("/2fa/disable", h.twoFactor.Disable)
+
+	// Admin routes
+	admin := api.Group("/admin", JWTMiddleware(stores.Sessions), RequireRole(stores.Users, RoleAdmin))
+	admin.GET("/users", h.admin.ListUsers)
+	admin.GET("/users/:id", h.admin.GetUser)
+	admin.POST("/users/:id/deactivate", h.admin.DeactivateUser)
+	admin.POST("/users/:id/reactivate", h.admin.ReactivateUser)
+	admin.POST("/users/:id/password-reset", h.admin.ForcePasswordReset)
+	admin.DELETE("/users/:id/sessions", h.admin.RevokeUserSessions)
+	admin.PUT("/users/:id/role", h.admin.UpdateUserRole)
+	admin.POST("/exchange-rates", h.exchangeRate.ImportRates)
+
+	// Routes that also accept personal access tokens holding the given scope
+	scoped := func(scope string) echo.MiddlewareFunc { return TokenAuthMiddleware(stores, scope) }
+	api.GET("/categories", h.category.GetCategories, scoped(ScopeCategoriesRead))
+	api.POST("/categories", h.category.CreateCategory, scoped(ScopeCategoriesWrite))
+	api.PUT("/categories/:id", h.category.UpdateCategory, scoped(ScopeCategoriesWrite))
+	api.DELETE("/categories/:id", h.category.DeleteCategory, scoped(ScopeCategoriesWrite))
+	api.POST("/expenses", h.expense.AddExpense, scoped(ScopeExpensesWrite))
+	api.GET("/expenses/summary/daily", h.expense.GetDailySummaryPaginated, scoped(ScopeExpensesRead))
+	api.GET("/expenses/summary/monthly", h.expense.GetMonthlySummaryPaginated, scoped(ScopeExpensesRead))
+	api.GET("/expenses/summary/weekly", h.expense.GetWeeklySummaryPaginated, scoped(ScopeExpensesRead))
+	api.GET("/expenses/summary/categories", h.expense.GetCategorySummary, scoped(ScopeExpensesRead))
+	api.GET("/expenses", h.expense.GetExpenses, scoped(ScopeExpensesRead))
+	api.GET("/dashboard", h.expense.GetDashboard, scoped(ScopeExpensesRead))
+	api.PUT("/expenses/:id", h.expense.UpdateExpense, scoped(ScopeExpensesWrite))
+	api.DELETE("/expenses/:id", h.expense.DeleteExpense, scoped(ScopeExpensesWrite))
+	api.POST("/expenses/:id/attachments", h.attachment.UploadAttachment, scoped(ScopeExpensesWrite))
+	api.GET("/expenses/:id/attachments", h.attachment.GetAttachments, scoped(ScopeExpensesRead))
+	api.GET("/expenses/:id/attachments/:attachment_id", h.attachment.DownloadAttachment, scoped(ScopeExpensesRead))
+	api.DELETE("/expenses/:id/attachments/:attachment_id", h.attachment.DeleteAttachment, scoped(ScopeExpensesWrite))
+	api.POST("/recurring-expenses", h.recurring.CreateRecurring, scoped(ScopeExpensesWrite))
+	api.GET("/recurring-expenses", h.recurring.GetRecurringExpenses, scoped(ScopeExpensesRead))
+	api.GET("/recurring-expenses/:id", h.recurring.GetRecurring, scoped(ScopeExpensesRead))
+	api.PUT("/recurring-expenses/:id", h.recurring.UpdateRecurring, scoped(ScopeExpensesWrite))
+	api.DELETE("/recurring-expenses/:id", h.recurring.DeleteRecurring, scoped(ScopeExpensesWrite))
+	api.POST("/recurring-expenses/:id/pause", h.recurring.PauseRecurring, scoped(ScopeExpensesWrite))
+	api.POST("/recurring-expenses/:id/resume", h.recurring.ResumeRecurring, scoped(ScopeExpensesWrite))
+	api.POST("/recurring-expenses/:id/skip", h.recurring.SkipOccurrence, scoped(ScopeExpensesWrite))
+	api.GET("/recurring-expenses/:id/preview", h.recurring.PreviewOccurrences, scoped(ScopeExpensesRead))
+}
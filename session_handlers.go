@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// SessionHandler handles listing and revoking a user's sessions
+type SessionHandler struct {
+	sessions SessionStore
+}
+
+// NewSessionHandler creates a new SessionHandler instance
+func NewSessionHandler(sessions SessionStore) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+// clientInfo describes the device a session was created from
+type clientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// clientInfoFromContext reads the caller's user agent and IP address
+func clientInfoFromContext(c echo.Context) clientInfo {
+	return clientInfo{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+}
+
+// GetSessions lists the user's active sessions
+func (h *SessionHandler) GetSessions(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	list, err := h.sessions.ListActiveSessions(userID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	currentID := getSessionIDFromContext(c)
+	sessions := make([]map[string]interface{}, 0, len(list))
+	for i := range list {
+		sessions = append(sessions, sessionView(&list[i], currentID))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "Sessions retrieved successfully",
+		"count":    len(sessions),
+		"sessions": sessions,
+	})
+}
+
+// GetSession returns the details of one of the user's sessions
+func (h *SessionHandler) GetSession(c echo.Context) error {
+	session, err := h.loadOwned(c)
+	if err != nil || session == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Session retrieved successfully",
+		"session": sessionView(session, getSessionIDFromContext(c)),
+	})
+}
+
+// RevokeSession ends one of the user's sessions, including its refresh token chain
+func (h *SessionHandler) RevokeSession(c echo.Context) error {
+	session, err := h.loadOwned(c)
+	if err != nil || session == nil {
+		return err
+	}
+
+	if err := h.sessions.RevokeSession(session.ID); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions signs the user out everywhere except the current session
+func (h *SessionHandler) RevokeOtherSessions(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	// Without a known current session every session would be revoked
+	sessionID := getSessionIDFromContext(c)
+	if sessionID == uuid.Nil {
+		return SendCustomError(c, ErrorInvalidRequest, "The current session could not be identified. Please login again", http.StatusBadRequest)
+	}
+
+	revoked, err := h.sessions.RevokeOtherSessions(userID, sessionID)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Signed out of all other sessions",
+		"revoked": revoked,
+	})
+}
+
+// loadOwned returns the session named by the :id parameter. When it does not exist
+// or belongs to someone else the error response has been sent and both are nil.
+func (h *SessionHandler) loadOwned(c echo.Context) (*Session, error) {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return nil, SendStandardError(c, ErrorUnauthorized)
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, SendCustomError(c, ErrorInvalidRequest, "Invalid session ID", http.StatusBadRequest)
+	}
+
+	session, err := h.sessions.GetSession(sessionID)
+	if errors.Is(err, errNotFound) || (err == nil && session.UserID != userID) {
+		return nil, SendCustomError(c, ErrorNotFound, "Session not found", http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, SendStandardError(c, ErrorDatabaseError)
+	}
+	return session, nil
+}
+
+// sessionView formats a session for responses
+func sessionView(session *Session, currentID uuid.UUID) map[string]interface{} {
+	view := map[string]interface{}{
+		"id":                session.ID,
+		"user_agent":        "",
+		"ip_address":        "",
+		"signed_in_at":      session.SignedInAt.Format("02-01-2006 03:04:05 PM"),
+		"last_refreshed_at": session.CreatedAt.Format("02-01-2006 03:04:05 PM"),
+		"is_active":         session.IsActive,
+		"current":           session.ID == currentID,
+	}
+	if session.UserAgent != nil {
+		view["user_agent"] = *session.UserAgent
+	}
+	if session.IPAddress != nil {
+		view["ip_address"] = *session.IPAddress
+	}
+	if session.ExpiresAt != nil {
+		view["expires_at"] = session.ExpiresAt.Format("02-01-2006 03:04:05 PM")
+	}
+	return view
+}
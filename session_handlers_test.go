@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHandler_ListAndRevoke(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, app *testApp) {
+		first, _ := app.signUp(t, "devices@example.com")
+		code, body := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "devices@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, code)
+		second := body["token"].(string)
+		other, _ := app.signUp(t, "someone@example.com")
+
+		code, body = app.do(t, http.MethodGet, "/api/sessions", second, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		require.EqualValues(t, 2, body["count"])
+		var firstID string
+		for _, s := range body["sessions"].([]interface{}) {
+			session := s.(map[string]interface{})
+			if session["current"] != true {
+				firstID = session["id"].(string)
+			}
+		}
+		require.NotEmpty(t, firstID)
+
+		// Another user's session is not found rather than revealed
+		code, _ = app.do(t, http.MethodGet, "/api/sessions/"+firstID, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = app.do(t, http.MethodDelete, "/api/sessions/"+firstID, other, nil)
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, body = app.do(t, http.MethodGet, "/api/sessions/"+firstID, second, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, false, body["session"].(map[string]interface{})["current"])
+
+		code, _ = app.do(t, http.MethodDelete, "/api/sessions/"+firstID, second, nil)
+		require.Equal(t, http.StatusOK, code)
+		code, body = app.do(t, http.MethodGet, "/api/profile", first, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorSessionExpired, body["error"])
+		code, _ = app.do(t, http.MethodGet, "/api/profile", second, nil)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, body = app.do(t, http.MethodGet, "/api/sessions", second, nil)
+		require.Equal(t, http.StatusOK, code)
+		assert.EqualValues(t, 1, body["count"])
+	})
+}
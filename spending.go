@@ -0,0 +1,269 @@
+package main
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DailyTotal is the spending on one day
+type DailyTotal struct {
+	Date  time.Time
+	Total Money
+	Count int
+}
+
+// WeeklyTotal is the spending in one week; Start and End are the first and last
+// days in the week that have expenses
+type WeeklyTotal struct {
+	Year  int
+	Week  int
+	Start time.Time
+	End   time.Time
+	Total Money
+	Count int
+}
+
+// MonthlyTotal is the spending in one month; Month is formatted YYYY-MM
+type MonthlyTotal struct {
+	Month string
+	Total Money
+	Count int
+}
+
+// spending is a user's expenses totalled per day in their home currency, newest day
+// first. Each expense is converted with the rate for its own date; totals are kept
+// exact and only rounded to cents once per reported period.
+type spending struct {
+	Currency string
+	days     []daySpending
+}
+
+type daySpending struct {
+	date  time.Time
+	total *big.Rat
+	count int
+}
+
+// loadSpending converts the user's expenses dated in [from, to) to their home
+// currency; zero bounds are open. A missing rate returns a *missingRateError.
+func loadSpending(stores *Stores, userID uuid.UUID, from, to time.Time) (*spending, error) {
+	user, err := stores.Users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := stores.Expenses.SpendingByDay(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := loadRates(stores, user.HomeCurrency, totals)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spending{Currency: user.HomeCurrency}
+	for _, t := range totals {
+		amount, err := table.convert(t.Total, t.Currency, user.HomeCurrency, t.Date)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(s.days); n > 0 && s.days[n-1].date.Equal(t.Date) {
+			s.days[n-1].total.Add(s.days[n-1].total, amount)
+			s.days[n-1].count += t.Count
+			continue
+		}
+		s.days = append(s.days, daySpending{date: t.Date, total: amount, count: t.Count})
+	}
+	return s, nil
+}
+
+// loadRates loads what is needed to convert the totals to the home currency. Rates
+// are only loaded when something was paid in another currency.
+func loadRates(stores *Stores, home string, totals []DaySpending) (*rateTable, error) {
+	currencies := []string{home}
+	var first, last time.Time
+	for _, t := range totals {
+		if t.Currency == home {
+			continue
+		}
+		currencies = append(currencies, t.Currency)
+		if first.IsZero() || t.Date.Before(first) {
+			first = t.Date
+		}
+		if t.Date.After(last) {
+			last = t.Date
+		}
+	}
+	if len(currencies) == 1 {
+		return &rateTable{}, nil
+	}
+	rates, err := stores.Rates.ListRates(currencies, first.Add(-exchangeRateLookback), last)
+	if err != nil {
+		return nil, err
+	}
+	return newRateTable(rates)
+}
+
+// CategoryTotal is what the shares of the expenses filed under one category came to
+type CategoryTotal struct {
+	CategoryID uuid.UUID
+	Name       string
+	Total      Money
+	Count      int
+}
+
+// loadCategorySpending totals the category shares of the user's expenses dated in
+// [from, to) in their home currency, largest first; zero bounds are open. Only its
+// share of a multi-category expense counts in each category, so the totals add up to
+// what was spent. A missing rate returns a *missingRateError.
+func loadCategorySpending(stores *Stores, userID uuid.UUID, from, to time.Time) ([]CategoryTotal, error) {
+	user, err := stores.Users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := stores.Expenses.SpendingByCategory(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	days := make([]DaySpending, len(totals))
+	for i, t := range totals {
+		days[i] = t.DaySpending
+	}
+	table, err := loadRates(stores, user.HomeCurrency, days)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []CategoryTotal
+	sums := make(map[uuid.UUID]*big.Rat)
+	index := make(map[uuid.UUID]int)
+	for _, t := range totals {
+		amount, err := table.convert(t.Total, t.Currency, user.HomeCurrency, t.Date)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[t.CategoryID]
+		if !ok {
+			i = len(categories)
+			index[t.CategoryID] = i
+			categories = append(categories, CategoryTotal{CategoryID: t.CategoryID, Name: t.CategoryName})
+			sums[t.CategoryID] = new(big.Rat)
+		}
+		sums[t.CategoryID].Add(sums[t.CategoryID], amount)
+		categories[i].Count += t.Count
+	}
+	for i := range categories {
+		categories[i].Total = roundMoney(sums[categories[i].CategoryID])
+	}
+
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].Total != categories[j].Total {
+			return categories[i].Total > categories[j].Total
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	if categories == nil {
+		categories = []CategoryTotal{}
+	}
+	return categories, nil
+}
+
+// between returns the spending dated in [from, to); zero bounds are open
+func (s *spending) between(from, to time.Time) *spending {
+	sub := &spending{Currency: s.Currency}
+	for _, d := range s.days {
+		if (from.IsZero() || !d.date.Before(from)) && (to.IsZero() || d.date.Before(to)) {
+			sub.days = append(sub.days, d)
+		}
+	}
+	return sub
+}
+
+// total counts and sums every expense
+func (s *spending) total() (int, Money) {
+	count, sum := 0, new(big.Rat)
+	for _, d := range s.days {
+		count += d.count
+		sum.Add(sum, d.total)
+	}
+	return count, roundMoney(sum)
+}
+
+// daily groups by expense date, newest first
+func (s *spending) daily() []DailyTotal {
+	totals := make([]DailyTotal, 0, len(s.days))
+	for _, d := range s.days {
+		totals = append(totals, DailyTotal{Date: d.date, Total: roundMoney(d.total), Count: d.count})
+	}
+	return totals
+}
+
+// weekly groups by calendar year and ISO week number, newest first
+func (s *spending) weekly() []WeeklyTotal {
+	type bucket struct {
+		WeeklyTotal
+		sum *big.Rat
+	}
+	var buckets []*bucket
+	index := make(map[[2]int]*bucket)
+	for _, d := range s.days {
+		_, week := d.date.ISOWeek()
+		key := [2]int{d.date.Year(), week}
+		b, ok := index[key]
+		if !ok {
+			b = &bucket{WeeklyTotal: WeeklyTotal{Year: key[0], Week: key[1], Start: d.date, End: d.date}, sum: new(big.Rat)}
+			index[key] = b
+			buckets = append(buckets, b)
+		}
+		if d.date.Before(b.Start) {
+			b.Start = d.date
+		}
+		if d.date.After(b.End) {
+			b.End = d.date
+		}
+		b.sum.Add(b.sum, d.total)
+		b.Count += d.count
+	}
+
+	// Days are newest first, but early January can fall in week 52 or 53
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if buckets[i].Year != buckets[j].Year {
+			return buckets[i].Year > buckets[j].Year
+		}
+		return buckets[i].Week > buckets[j].Week
+	})
+	totals := make([]WeeklyTotal, 0, len(buckets))
+	for _, b := range buckets {
+		b.Total = roundMoney(b.sum)
+		totals = append(totals, b.WeeklyTotal)
+	}
+	return totals
+}
+
+// monthly groups by month, newest first
+func (s *spending) monthly() []MonthlyTotal {
+	var totals []MonthlyTotal
+	var sum *big.Rat
+	for _, d := range s.days {
+		month := d.date.Format("2006-01")
+		if n := len(totals); n == 0 || totals[n-1].Month != month {
+			if n > 0 {
+				totals[n-1].Total = roundMoney(sum)
+			}
+			totals = append(totals, MonthlyTotal{Month: month})
+			sum = new(big.Rat)
+		}
+		sum.Add(sum, d.total)
+		totals[len(totals)-1].Count += d.count
+	}
+	if n := len(totals); n > 0 {
+		totals[n-1].Total = roundMoney(sum)
+	}
+	if totals == nil {
+		totals = []MonthlyTotal{}
+	}
+	return totals
+}
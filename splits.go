@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Percent is a percentage in hundredths of a percent, so 12.5% is 1250. JSON carries
+// it as a number with two decimal places, such as 12.50; requests may also send a string.
+type Percent int64
+
+// errInvalidPercentage is returned for percentages that are not above 0 and at most 100
+// with at most two decimal places
+var errInvalidPercentage = errors.New("percentage must be a number above 0 and at most 100 with at most two decimal places")
+
+// errNoCategories is returned when there is no category to file an expense under
+var errNoCategories = errors.New("an expense needs at least one category")
+
+// MarshalJSON writes the percentage as a plain number
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(Money(p).String()), nil
+}
+
+// UnmarshalJSON accepts 12.5 or "12.5", parsed exactly like an amount
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var m Money
+	if err := m.UnmarshalJSON(data); err != nil || m <= 0 || m > 10000 {
+		return errInvalidPercentage
+	}
+	*p = Percent(m)
+	return nil
+}
+
+// splitExpense works out the share of total each category gets. Categories with a
+// split get its fixed amount or percentage; the others share what is left evenly.
+// Together the shares add up to total exactly: percentages and even parts are rounded
+// by largest remainder, ties going to the category listed first. A category listed
+// twice is filed once. Without splits it only fails with errNoCategories when there
+// are no categories; other errors are meant for the client.
+func splitExpense(total Money, categoryIDs []uuid.UUID, splits []CategorySplit) ([]CategoryShare, error) {
+	shares := make([]CategoryShare, 0, len(categoryIDs))
+	index := make(map[uuid.UUID]int, len(categoryIDs))
+	for _, id := range categoryIDs {
+		if _, ok := index[id]; !ok {
+			index[id] = len(shares)
+			shares = append(shares, CategoryShare{CategoryID: id})
+		}
+	}
+	if len(shares) == 0 {
+		return nil, errNoCategories
+	}
+
+	// Shares are worked out in ten-thousandths of a cent so that a percentage of an
+	// amount in cents is exact
+	const scale = 10000
+	exact := make([]int64, len(shares))
+	given := make([]bool, len(shares))
+	var assigned int64
+	for _, split := range splits {
+		i, ok := index[split.CategoryID]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("split for category %s, which is not one of the expense's categories", split.CategoryID)
+		case given[i]:
+			return nil, fmt.Errorf("more than one split for category %s", split.CategoryID)
+		case (split.Amount == nil) == (split.Percentage == nil):
+			return nil, fmt.Errorf("split for category %s needs either an amount or a percentage", split.CategoryID)
+		}
+		given[i] = true
+		if split.Amount != nil {
+			if *split.Amount <= 0 || *split.Amount > total {
+				return nil, fmt.Errorf("split amount for category %s must be above 0 and at most the expense amount", split.CategoryID)
+			}
+			exact[i] = int64(*split.Amount) * scale
+		} else {
+			percentage := *split.Percentage
+			shares[i].Percentage = &percentage
+			exact[i] = int64(total) * int64(percentage)
+		}
+		assigned += exact[i]
+		if assigned > int64(total)*scale {
+			return nil, fmt.Errorf("splits add up to more than the expense amount of %s", total)
+		}
+	}
+
+	var rest []int
+	for i := range shares {
+		if !given[i] {
+			rest = append(rest, i)
+		}
+	}
+	left := int64(total)*scale - assigned
+	if len(rest) == 0 && left != 0 {
+		return nil, fmt.Errorf("splits must add up to the expense amount of %s", total)
+	}
+	if len(rest) > 0 {
+		for k, i := range rest {
+			exact[i] = left / int64(len(rest))
+			// Units left over from the division go to the first categories
+			if int64(k) < left%int64(len(rest)) {
+				exact[i]++
+			}
+		}
+	}
+
+	// Round down to cents, then give the cents still missing to the largest remainders
+	missing := int64(total)
+	order := make([]int, len(shares))
+	for i := range shares {
+		shares[i].Amount = Money(exact[i] / scale)
+		missing -= int64(shares[i].Amount)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return exact[order[a]]%scale > exact[order[b]]%scale })
+	for _, i := range order[:missing] {
+		shares[i].Amount++
+	}
+	return shares, nil
+}
+
+// evenShares splits total evenly between the categories, failing only with errNoCategories
+func evenShares(total Money, categoryIDs []uuid.UUID) ([]CategoryShare, error) {
+	return splitExpense(total, categoryIDs, nil)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitExpense(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	amount := func(m Money) *Money { return &m }
+	percent := func(p Percent) *Percent { return &p }
+	amounts := func(shares []CategoryShare) []Money {
+		out := make([]Money, len(shares))
+		for i, share := range shares {
+			out[i] = share.Amount
+		}
+		return out
+	}
+
+	shares, err := splitExpense(1000, []uuid.UUID{a, b, c}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{334, 333, 333}, amounts(shares))
+
+	// A category listed twice is filed once
+	shares, err = splitExpense(1000, []uuid.UUID{a, b, a}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Money{500, 500}, amounts(shares))
+
+	// Thirds of 10.00 round to the largest remainders and still add up
+	shares, err = splitExpense(1000, []uuid.UUID{a, b, c}, []CategorySplit{
+		{CategoryID: a, Percentage: percent(3333)}, {CategoryID: b, Percentage: percent(3333)}, {CategoryID: c, Percentage: percent(3334)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Money{333, 333, 334}, amounts(shares))
+	assert.Equal(t, Percent(3334), *shares[2].Percentage)
+
+	shares, err = splitExpense(1001, []uuid.UUID{a, b, c}, []CategorySplit{{CategoryID: b, Amount: amount(1)}})
+	require.NoError(t, err)
+	assert.Equal(t, []Money{500, 1, 500}, amounts(shares))
+	assert.Nil(t, shares[1].Percentage)
+
+	_, err = splitExpense(1000, nil, nil)
+	assert.ErrorIs(t, err, errNoCategories)
+
+	for name, splits := range map[string][]CategorySplit{
+		"short":       {{CategoryID: a, Percentage: percent(5000)}, {CategoryID: b, Percentage: percent(4999)}},
+		"over":        {{CategoryID: a, Amount: amount(600)}, {CategoryID: b, Amount: amount(500)}},
+		"too large":   {{CategoryID: a, Amount: amount(1001)}},
+		"not listed":  {{CategoryID: c, Amount: amount(100)}},
+		"twice":       {{CategoryID: a, Amount: amount(100)}, {CategoryID: a, Amount: amount(100)}},
+		"both":        {{CategoryID: a, Amount: amount(100), Percentage: percent(1000)}},
+		"neither":     {{CategoryID: a}},
+		"zero amount": {{CategoryID: a, Amount: amount(0)}},
+	} {
+		_, err := splitExpense(1000, []uuid.UUID{a, b}, splits)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPercent_JSON(t *testing.T) {
+	var v struct {
+		P Percent `json:"p"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"p": 12.5}`), &v))
+	assert.Equal(t, Percent(1250), v.P)
+	require.NoError(t, json.Unmarshal([]byte(`{"p": "100"}`), &v))
+	assert.Equal(t, Percent(10000), v.P)
+
+	out, err := json.Marshal(v)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"p": 100.00}`, string(out))
+
+	for _, input := range []string{`0`, `-5`, `100.01`, `12.345`, `"abc"`} {
+		assert.ErrorIs(t, json.Unmarshal([]byte(`{"p": `+input+`}`), &v), errInvalidPercentage, input)
+	}
+}
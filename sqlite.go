@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQLite has no date or time types; values are stored as text and compared as text.
+// sqliteTimeFormat writes the wall clock without a zone, like a Postgres TIMESTAMP, and
+// its fixed width keeps text comparisons in chronological order.
+const (
+	sqliteTimeFormat = "2006-01-02 15:04:05.000000000"
+	sqliteTimeLayout = "2006-01-02 15:04:05.999999999"
+)
+
+// openSQLite opens (and creates if needed) the database file. Foreign keys are enforced so
+// ON DELETE CASCADE works, and transactions start IMMEDIATE so they never deadlock upgrading
+// a read lock; other writers wait up to busy_timeout.
+func openSQLite(path string) (*sql.DB, error) {
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db := sql.OpenDB(sqliteConnector{dsn: dsn})
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// sqliteConnector opens driver connections that bind times in sqliteTimeFormat
+type sqliteConnector struct {
+	dsn string
+}
+
+func (c sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteConn{conn.(sqliteDriverConn)}, nil
+}
+
+func (c sqliteConnector) Driver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+// sqliteDriverConn is the part of the driver's connection that database/sql uses
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+type sqliteConn struct {
+	sqliteDriverConn
+}
+
+// CheckNamedValue converts arguments as database/sql would, then formats times. The driver
+// would otherwise write them with their zone offset, which breaks text comparisons.
+func (sqliteConn) CheckNamedValue(arg *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(arg.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.Format(sqliteTimeFormat)
+	}
+	arg.Value = value
+	return nil
+}
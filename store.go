@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// errNotFound is returned by stores when the requested row does not exist
+// (or is not visible to the caller, e.g. a deactivated user)
+var errNotFound = errors.New("not found")
+
+// UserStore persists accounts and their sign-in history
+type UserStore interface {
+	// EmailExists reports whether any account, active or not, uses email
+	EmailExists(email string) (bool, error)
+	// CreateUser inserts an unverified account and fills in its timestamps
+	CreateUser(user *User) error
+	// GetUser returns an active account by ID, including the password hash
+	GetUser(id uuid.UUID) (*User, error)
+	// GetUserByEmail returns the active account with exactly this email
+	GetUserByEmail(email string) (*User, error)
+	// UpdateProfile changes the editable profile fields
+	UpdateProfile(id uuid.UUID, name string, profileImage *string, homeCurrency string) error
+	// UpdatePassword stores a new bcrypt hash
+	UpdatePassword(id uuid.UUID, passwordHash string) error
+
+	// RecordLogin appends a sign-in attempt. When attempt.UserID is nil the
+	// account is looked up by email so failures against it appear in its history.
+	RecordLogin(attempt *LoginHistory) error
+	// FailedLogins counts failures since the given time for the email and the IP.
+	// Email failures followed by a successful interactive login are not counted.
+	FailedLogins(email, ip string, since time.Time) (loginFailures, error)
+	// LoginHistory returns a page of the user's attempts, newest first, and the total
+	LoginHistory(userID uuid.UUID, success *bool, limit, offset int) ([]LoginHistory, int, error)
+}
+
+// loginFailures summarises recent failed sign-ins for the lockout check
+type loginFailures struct {
+	EmailCount int
+	EmailLast  *time.Time
+	IPCount    int
+	IPLast     *time.Time
+}
+
+// CategoryStore persists expense categories
+type CategoryStore interface {
+	// ListCategories returns the user's categories, defaults first, then by name
+	ListCategories(userID uuid.UUID) ([]Category, error)
+	GetCategory(id uuid.UUID) (*Category, error)
+	// CategoryNameTaken reports whether name (case-insensitive) is used by one of the
+	// user's categories or a default one, ignoring excludeID
+	CategoryNameTaken(userID uuid.UUID, name string, excludeID uuid.UUID) (bool, error)
+	CreateCategory(category *Category) error
+	UpdateCategory(category *Category) error
+	// DeleteCategory removes the category and unlinks it from expenses
+	DeleteCategory(id uuid.UUID) error
+}
+
+// ExpenseStore persists expenses, their category links and the summaries built on them
+type ExpenseStore interface {
+	// CreateExpense inserts the expense and links it to the categories with their shares
+	CreateExpense(expense *Expense, shares []CategoryShare) error
+	// GetExpense returns the expense with its categories
+	GetExpense(id uuid.UUID) (*Expense, error)
+	// UpdateExpense saves the editable fields and replaces the category links
+	UpdateExpense(expense *Expense, shares []CategoryShare) error
+	// DeleteExpense removes the expense with its attachments and returns the storage
+	// keys of their files, which are left for the caller to delete
+	DeleteExpense(id uuid.UUID) ([]string, error)
+	// ExpenseBelongsTo reports whether the expense exists and is owned by userID
+	ExpenseBelongsTo(expenseID, userID uuid.UUID) (bool, error)
+	CountExpenses(userID uuid.UUID) (int, error)
+	// ListExpenses returns matching expenses with categories, newest first
+	ListExpenses(userID uuid.UUID, filters *ExpenseFilters) ([]Expense, error)
+
+	// SpendingByDay totals expenses dated in [from, to) per day and currency, newest
+	// day first and then by currency; zero bounds are open
+	SpendingByDay(userID uuid.UUID, from, to time.Time) ([]DaySpending, error)
+	// SpendingByCategory totals the category shares of expenses dated in [from, to)
+	// per category, day and currency; zero bounds are open
+	SpendingByCategory(userID uuid.UUID, from, to time.Time) ([]CategorySpending, error)
+}
+
+// DaySpending is what was spent in one currency on one day
+type DaySpending struct {
+	Date     time.Time
+	Currency string
+	Total    Money
+	Count    int
+}
+
+// CategorySpending is what one category's shares of the expenses came to in one
+// currency on one day; Count is the number of expenses
+type CategorySpending struct {
+	CategoryID   uuid.UUID
+	CategoryName string
+	DaySpending
+}
+
+// RateStore persists exchange rates
+type RateStore interface {
+	// SaveRates stores the rates, replacing any already held for the same day and pair
+	SaveRates(rates []ExchangeRate) error
+	// ListRates returns the rates dated in [from, to] whose base or quote is one of currencies
+	ListRates(currencies []string, from, to time.Time) ([]ExchangeRate, error)
+	// LatestRateDate returns the newest day stored from source, or the zero time
+	LatestRateDate(source string) (time.Time, error)
+}
+
+// RecurringStore persists recurring expenses and creates their occurrences
+type RecurringStore interface {
+	// CreateRecurring inserts the recurring expense and links it to categoryIDs
+	CreateRecurring(r *RecurringExpense, categoryIDs []uuid.UUID) error
+	// GetRecurring returns the recurring expense with its categories and skipped occurrences
+	GetRecurring(id uuid.UUID) (*RecurringExpense, error)
+	// ListRecurring returns the user's recurring expenses, oldest first
+	ListRecurring(userID uuid.UUID) ([]RecurringExpense, error)
+	// UpdateRecurring saves the editable fields, next date and pause state and
+	// replaces the category links
+	UpdateRecurring(r *RecurringExpense, categoryIDs []uuid.UUID) error
+	// DeleteRecurring removes the recurring expense; the expenses it created are kept
+	DeleteRecurring(id uuid.UUID) error
+	// SkipOccurrence marks one occurrence so no expense is created for it
+	SkipOccurrence(id uuid.UUID, date time.Time) error
+	// DueRecurring returns the unpaused recurring expenses of active users with an
+	// occurrence due on or before the day
+	DueRecurring(on time.Time) ([]uuid.UUID, error)
+	// MaterializeRecurring locks the recurring expense, creates the expenses returned
+	// by due and moves its next date, all in one transaction. An occurrence that
+	// already has an expense is left alone. It returns the expenses created. A recurring
+	// expense whose categories were all deleted is paused instead and errNoCategories returned.
+	MaterializeRecurring(id uuid.UUID, due func(r *RecurringExpense) ([]Expense, *time.Time)) ([]Expense, error)
+}
+
+// AttachmentStore persists what is known about the files attached to expenses; the
+// files themselves are kept in a BlobStore
+type AttachmentStore interface {
+	CreateAttachment(attachment *Attachment) error
+	// GetAttachment returns the attachment when it belongs to the expense
+	GetAttachment(expenseID, id uuid.UUID) (*Attachment, error)
+	// ListAttachments returns the expense's attachments, oldest first
+	ListAttachments(expenseID uuid.UUID) ([]Attachment, error)
+	DeleteAttachment(id uuid.UUID) error
+}
+
+// SessionStore persists login sessions
+type SessionStore interface {
+	CreateSession(session *Session) error
+	// RotateSession locks the session owning refreshTokenHash, checks it with
+	// checkRotatable and replaces it with the session returned by next. A reused
+	// token revokes its whole family and returns errRefreshTokenReused.
+	RotateSession(refreshTokenHash string, next func(current *Session) (*Session, error)) error
+	// DeactivateSessionByTokenHash ends the session holding the access token
+	DeactivateSessionByTokenHash(tokenHash string) error
+	// ActiveSessionByTokenHash returns the active, unexpired session holding the
+	// access token, or errNotFound
+	ActiveSessionByTokenHash(tokenHash string) (*Session, error)
+	// GetSession returns a session with SignedInAt set to when its login started
+	GetSession(id uuid.UUID) (*Session, error)
+	// ListActiveSessions returns the user's active, unexpired sessions with
+	// SignedInAt set, newest first
+	ListActiveSessions(userID uuid.UUID) ([]Session, error)
+	// RevokeSession ends the session and every session of its refresh token family
+	RevokeSession(id uuid.UUID) error
+	// RevokeOtherSessions ends the user's active sessions except keepID and returns how many
+	RevokeOtherSessions(userID, keepID uuid.UUID) (int, error)
+}
+
+// APITokenStore persists personal access tokens
+type APITokenStore interface {
+	CreateAPIToken(token *APIToken) error
+	// ListAPITokens returns the user's tokens that are not revoked, newest first
+	ListAPITokens(userID uuid.UUID) ([]APIToken, error)
+	// RevokeAPIToken revokes one of the user's tokens, or returns errNotFound
+	RevokeAPIToken(userID, id uuid.UUID) error
+	// AuthenticateAPIToken returns the unrevoked, unexpired token with this hash whose
+	// owner is active, or errNotFound. It notes the use at most once a minute.
+	AuthenticateAPIToken(tokenHash string) (*APIToken, error)
+}
+
+// AuditStore persists audit entries
+type AuditStore interface {
+	RecordAudit(entry auditEntry) error
+	// ListAudit returns a page of the matching events, newest first, and the total
+	ListAudit(filter AuditFilter) ([]AuditEvent, int, error)
+}
+
+// AuditFilter selects audit events; zero fields match everything
+type AuditFilter struct {
+	ActorID    uuid.UUID
+	EntityType string
+	EntityID   uuid.UUID
+	Action     string
+	// From and To bound created_at to [From, To)
+	From, To      time.Time
+	Limit, Offset int
+}
+
+// AuditEvent is a stored audit entry; the snapshots and details are kept as JSON
+type AuditEvent struct {
+	ID         uuid.UUID
+	ActorID    uuid.UUID
+	Action     string
+	EntityType string
+	EntityID   uuid.UUID
+	Before     json.RawMessage
+	After      json.RawMessage
+	Details    json.RawMessage
+	IPAddress  string
+	RequestID  string
+	CreatedAt  time.Time
+	RedactedAt *time.Time
+}
+
+// ExportStore persists background data export jobs and their archives
+type ExportStore interface {
+	// StartExport returns the user's pending job, or creates one after deleting the
+	// user's expired jobs. created reports whether the job is new.
+	StartExport(userID uuid.UUID) (job *DataExport, created bool, err error)
+	// GetExport returns one of the user's jobs without its archive, or errNotFound
+	GetExport(userID, id uuid.UUID) (*DataExport, error)
+	// ExportArchive returns the archive of a completed job that has not expired, or errNotFound
+	ExportArchive(userID, id uuid.UUID) (*DataExport, error)
+	// HeartbeatExport notes that the job is still running
+	HeartbeatExport(id uuid.UUID) error
+	// CompleteExport stores the archive, which can be downloaded until expiresAt
+	CompleteExport(id uuid.UUID, archive []byte, expiresAt time.Time) error
+	// FailExport marks the job failed with a message for the user
+	FailExport(id uuid.UUID, message string) error
+	// FailStaleExports fails the pending jobs last heard from before staleBefore
+	FailStaleExports(staleBefore time.Time, message string) error
+}
+
+// Stores groups the storage the handlers are built on
+type Stores struct {
+	Users       UserStore
+	Categories  CategoryStore
+	Expenses    ExpenseStore
+	Sessions    SessionStore
+	APITokens   APITokenStore
+	Audit       AuditStore
+	Exports     ExportStore
+	Rates       RateStore
+	Recurring   RecurringStore
+	Attachments AttachmentStore
+	// Blobs holds attachment contents; it is set up separately from the database
+	Blobs BlobStore
+}
+
+// newSQLStores backs every store with the database, using the given dialect
+// for the queries that differ between Postgres and SQLite
+func newSQLStores(db *sql.DB, dialect *sqlDialect) *Stores {
+	s := &sqlStore{db: db, dialect: dialect}
+	return &Stores{Users: s, Categories: s, Expenses: s, Sessions: s, APITokens: s, Audit: s, Exports: s, Rates: s, Recurring: s, Attachments: s}
+}
+
+// newMemoryStores keeps everything in process memory; used by the handler tests
+func newMemoryStores() *Stores {
+	mem := newMemoryStore()
+	return &Stores{Users: mem, Categories: mem, Expenses: mem, Sessions: mem, APITokens: mem, Audit: mem, Exports: mem, Rates: mem, Recurring: mem, Attachments: mem}
+}
+
+// checkRotatable decides whether a session may be exchanged for a new one
+func checkRotatable(session *Session, now time.Time) error {
+	if session.RotatedAt != nil {
+		return errRefreshTokenReused
+	}
+	if !session.IsActive || session.ExpiresAt == nil || !session.ExpiresAt.After(now) {
+		return errInvalidRefreshToken
+	}
+	return nil
+}
@@ -0,0 +1,1142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore implements every store interface in process memory. It mirrors the
+// Postgres behaviour the handlers rely on (ordering, cascades, case rules) so the
+// handlers can be exercised without a database.
+type memoryStore struct {
+	mu           sync.Mutex
+	users        map[uuid.UUID]*User
+	categories   map[uuid.UUID]*Category
+	expenses     map[uuid.UUID]*Expense
+	expenseLinks map[uuid.UUID][]CategoryShare
+	sessions     map[uuid.UUID]*Session
+	apiTokens    map[uuid.UUID]*APIToken
+	exports      map[uuid.UUID]*DataExport
+	logins       []LoginHistory
+	audit        []AuditEvent
+	rates        map[rateKey]ExchangeRate
+	recurring    map[uuid.UUID]*RecurringExpense
+	// recurringLinks and recurringSkips hold the category links and skipped dates of
+	// recurring expenses; occurrences maps a created expense to its occurrence date
+	recurringLinks map[uuid.UUID][]uuid.UUID
+	recurringSkips map[uuid.UUID][]time.Time
+	occurrences    map[uuid.UUID]time.Time
+	attachments    map[uuid.UUID]*Attachment
+}
+
+// rateKey is the exchange_rates primary key
+type rateKey struct {
+	date        string
+	base, quote string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:        make(map[uuid.UUID]*User),
+		categories:   make(map[uuid.UUID]*Category),
+		expenses:     make(map[uuid.UUID]*Expense),
+		expenseLinks: make(map[uuid.UUID][]CategoryShare),
+		sessions:     make(map[uuid.UUID]*Session),
+		apiTokens:    make(map[uuid.UUID]*APIToken),
+		exports:      make(map[uuid.UUID]*DataExport),
+		rates:        make(map[rateKey]ExchangeRate),
+
+		recurring:      make(map[uuid.UUID]*RecurringExpense),
+		recurringLinks: make(map[uuid.UUID][]uuid.UUID),
+		recurringSkips: make(map[uuid.UUID][]time.Time),
+		occurrences:    make(map[uuid.UUID]time.Time),
+		attachments:    make(map[uuid.UUID]*Attachment),
+	}
+}
+
+func (s *memoryStore) EmailExists(email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if normalizeEmail(u.Email) == normalizeEmail(email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) CreateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if normalizeEmail(u.Email) == normalizeEmail(user.Email) {
+			return fmt.Errorf("email %s already exists", user.Email)
+		}
+	}
+	now := time.Now()
+	user.CreatedAt, user.UpdatedAt = now, now
+	user.IsActive, user.EmailVerified = true, false
+	if user.Role == "" {
+		user.Role = RoleUser
+	}
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) GetUser(id uuid.UUID) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok || !u.IsActive {
+		return nil, errNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (s *memoryStore) GetUserByEmail(email string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if normalizeEmail(u.Email) == normalizeEmail(email) && u.IsActive {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (s *memoryStore) UpdateProfile(id uuid.UUID, name string, profileImage *string, homeCurrency string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.Name, u.ProfileImage, u.HomeCurrency, u.UpdatedAt = name, profileImage, homeCurrency, time.Now()
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdatePassword(id uuid.UUID, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.Password, u.UpdatedAt = passwordHash, time.Now()
+	}
+	return nil
+}
+
+func (s *memoryStore) RecordLogin(attempt *LoginHistory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt.ID == uuid.Nil {
+		attempt.ID = uuid.New()
+	}
+	if attempt.UserID == nil {
+		for _, u := range s.users {
+			if normalizeEmail(u.Email) == attempt.Email {
+				id := u.ID
+				attempt.UserID = &id
+				break
+			}
+		}
+	}
+	s.logins = append(s.logins, *attempt)
+	return nil
+}
+
+func (s *memoryStore) FailedLogins(email, ip string, since time.Time) (loginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var f loginFailures
+	latest := func(last **time.Time, at time.Time) {
+		if *last == nil || at.After(**last) {
+			t := at
+			*last = &t
+		}
+	}
+	for _, attempt := range s.logins {
+		if attempt.Success || !attempt.LoginAt.After(since) {
+			continue
+		}
+		if attempt.IPAddress == ip {
+			f.IPCount++
+			latest(&f.IPLast, attempt.LoginAt)
+		}
+		if attempt.Email == email && !s.succeededAfter(email, attempt.LoginAt) {
+			f.EmailCount++
+			latest(&f.EmailLast, attempt.LoginAt)
+		}
+	}
+	return f, nil
+}
+
+// succeededAfter reports whether an interactive login for email succeeded after t
+func (s *memoryStore) succeededAfter(email string, t time.Time) bool {
+	for _, attempt := range s.logins {
+		if attempt.Email == email && attempt.Success && attempt.Method != loginMethodToken && attempt.LoginAt.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) LoginHistory(userID uuid.UUID, success *bool, limit, offset int) ([]LoginHistory, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches := make([]LoginHistory, 0)
+	for _, attempt := range s.logins {
+		if attempt.UserID == nil || *attempt.UserID != userID {
+			continue
+		}
+		if success != nil && attempt.Success != *success {
+			continue
+		}
+		matches = append(matches, attempt)
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].LoginAt.After(matches[j].LoginAt) })
+	return paginate(matches, limit, offset), len(matches), nil
+}
+
+func (s *memoryStore) ListCategories(userID uuid.UUID) ([]Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var categories []Category
+	for _, c := range s.categories {
+		if c.UserID == userID {
+			categories = append(categories, *c)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].IsDefault != categories[j].IsDefault {
+			return categories[i].IsDefault
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+func (s *memoryStore) GetCategory(id uuid.UUID) (*Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.categories[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	category := *c
+	return &category, nil
+}
+
+func (s *memoryStore) CategoryNameTaken(userID uuid.UUID, name string, excludeID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.categories {
+		if c.ID != excludeID && strings.EqualFold(c.Name, name) && (c.UserID == userID || c.IsDefault) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) CreateCategory(category *Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *category
+	s.categories[category.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) UpdateCategory(category *Category) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.categories[category.ID]; ok {
+		c.Name, c.IsDefault, c.UpdatedAt = category.Name, category.IsDefault, category.UpdatedAt
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteCategory(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.categories, id)
+	for expenseID, shares := range s.expenseLinks {
+		kept := shares[:0]
+		for _, share := range shares {
+			if share.CategoryID != id {
+				kept = append(kept, share)
+			}
+		}
+		s.expenseLinks[expenseID] = kept
+	}
+	for recurringID, categoryIDs := range s.recurringLinks {
+		kept := categoryIDs[:0]
+		for _, categoryID := range categoryIDs {
+			if categoryID != id {
+				kept = append(kept, categoryID)
+			}
+		}
+		s.recurringLinks[recurringID] = kept
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateExpense(expense *Expense, shares []CategoryShare) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkCategories(shareCategoryIDs(shares)); err != nil {
+		return err
+	}
+	stored := *expense
+	stored.Categories = nil
+	s.expenses[expense.ID] = &stored
+	s.expenseLinks[expense.ID] = append([]CategoryShare(nil), shares...)
+	return nil
+}
+
+// shareCategoryIDs lists the categories the shares are in
+func shareCategoryIDs(shares []CategoryShare) []uuid.UUID {
+	ids := make([]uuid.UUID, len(shares))
+	for i, share := range shares {
+		ids[i] = share.CategoryID
+	}
+	return ids
+}
+
+// checkCategories stands in for the expense_categories foreign key
+func (s *memoryStore) checkCategories(categoryIDs []uuid.UUID) error {
+	for _, id := range categoryIDs {
+		if _, ok := s.categories[id]; !ok {
+			return fmt.Errorf("linking category %s: category does not exist", id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) GetExpense(id uuid.UUID) (*Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.expenses[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	expense := s.withCategories(e)
+	return &expense, nil
+}
+
+// withCategories copies an expense and fills in its categories, ordered by name
+func (s *memoryStore) withCategories(e *Expense) Expense {
+	expense := *e
+	expense.Categories = []ExpenseCategoryDetail{}
+	for _, share := range s.expenseLinks[e.ID] {
+		if c, ok := s.categories[share.CategoryID]; ok {
+			expense.Categories = append(expense.Categories, ExpenseCategoryDetail{
+				ID: c.ID, Name: c.Name, IsDefault: c.IsDefault, Amount: share.Amount, Percentage: share.Percentage,
+			})
+		}
+	}
+	sort.Slice(expense.Categories, func(i, j int) bool { return expense.Categories[i].Name < expense.Categories[j].Name })
+	return expense
+}
+
+func (s *memoryStore) UpdateExpense(expense *Expense, shares []CategoryShare) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.expenses[expense.ID]
+	if !ok {
+		return nil
+	}
+	if err := s.checkCategories(shareCategoryIDs(shares)); err != nil {
+		return err
+	}
+	e.Title, e.Description, e.Amount, e.Currency = expense.Title, expense.Description, expense.Amount, expense.Currency
+	e.ExpenseDate, e.ExpenseTime, e.UpdatedAt = expense.ExpenseDate, expense.ExpenseTime, expense.UpdatedAt
+	s.expenseLinks[expense.ID] = append([]CategoryShare(nil), shares...)
+	return nil
+}
+
+func (s *memoryStore) DeleteExpense(id uuid.UUID) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expenses, id)
+	delete(s.expenseLinks, id)
+	delete(s.occurrences, id)
+	var keys []string
+	for attachmentID, a := range s.attachments {
+		if a.ExpenseID == id {
+			keys = append(keys, a.StorageKey)
+			delete(s.attachments, attachmentID)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) ExpenseBelongsTo(expenseID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.expenses[expenseID]
+	return ok && e.UserID == userID, nil
+}
+
+func (s *memoryStore) CountExpenses(userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.expensesInRange(userID, time.Time{}, time.Time{})), nil
+}
+
+func (s *memoryStore) ListExpenses(userID uuid.UUID, filters *ExpenseFilters) ([]Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expenses := make([]Expense, 0)
+	for _, e := range s.expenses {
+		if e.UserID != userID || !matchesFilters(e, shareCategoryIDs(s.expenseLinks[e.ID]), filters) {
+			continue
+		}
+		expenses = append(expenses, s.withCategories(e))
+	}
+	sort.Slice(expenses, func(i, j int) bool { return expenses[i].CreatedAt.After(expenses[j].CreatedAt) })
+	if filters.Limit > 0 && len(expenses) > filters.Limit {
+		expenses = expenses[:filters.Limit]
+	}
+	return expenses, nil
+}
+
+// matchesFilters applies ExpenseFilters the way the SQL WHERE clause does
+func matchesFilters(e *Expense, categoryIDs []uuid.UUID, filters *ExpenseFilters) bool {
+	if filters.CategoryID != nil {
+		found := false
+		for _, id := range categoryIDs {
+			if id == *filters.CategoryID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filters.StartDate != nil && e.ExpenseDate.Before(*filters.StartDate) {
+		return false
+	}
+	if filters.EndDate != nil && e.ExpenseDate.After(*filters.EndDate) {
+		return false
+	}
+	if filters.MinAmount != nil && e.Amount < *filters.MinAmount {
+		return false
+	}
+	if filters.MaxAmount != nil && e.Amount > *filters.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// expensesInRange returns the user's expenses dated in [from, to); zero bounds are open
+func (s *memoryStore) expensesInRange(userID uuid.UUID, from, to time.Time) []*Expense {
+	var matches []*Expense
+	for _, e := range s.expenses {
+		if e.UserID != userID {
+			continue
+		}
+		if !from.IsZero() && e.ExpenseDate.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.ExpenseDate.Before(to) {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	return matches
+}
+
+func (s *memoryStore) SpendingByDay(userID uuid.UUID, from, to time.Time) ([]DaySpending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type key struct {
+		date     time.Time
+		currency string
+	}
+	byDay := make(map[key]*DaySpending)
+	for _, e := range s.expensesInRange(userID, from, to) {
+		k := key{e.ExpenseDate, e.Currency}
+		d, ok := byDay[k]
+		if !ok {
+			d = &DaySpending{Date: e.ExpenseDate, Currency: e.Currency}
+			byDay[k] = d
+		}
+		d.Total += e.Amount
+		d.Count++
+	}
+
+	totals := make([]DaySpending, 0, len(byDay))
+	for _, d := range byDay {
+		totals = append(totals, *d)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if !totals[i].Date.Equal(totals[j].Date) {
+			return totals[i].Date.After(totals[j].Date)
+		}
+		return totals[i].Currency < totals[j].Currency
+	})
+	return totals, nil
+}
+
+func (s *memoryStore) SpendingByCategory(userID uuid.UUID, from, to time.Time) ([]CategorySpending, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type key struct {
+		categoryID uuid.UUID
+		date       time.Time
+		currency   string
+	}
+	byCategory := make(map[key]*CategorySpending)
+	for _, e := range s.expensesInRange(userID, from, to) {
+		counted := make(map[uuid.UUID]bool)
+		for _, share := range s.expenseLinks[e.ID] {
+			c, ok := s.categories[share.CategoryID]
+			if !ok {
+				continue
+			}
+			k := key{c.ID, e.ExpenseDate, e.Currency}
+			t, ok := byCategory[k]
+			if !ok {
+				t = &CategorySpending{CategoryID: c.ID, CategoryName: c.Name, DaySpending: DaySpending{Date: e.ExpenseDate, Currency: e.Currency}}
+				byCategory[k] = t
+			}
+			t.Total += share.Amount
+			if !counted[c.ID] {
+				counted[c.ID] = true
+				t.Count++
+			}
+		}
+	}
+
+	totals := make([]CategorySpending, 0, len(byCategory))
+	for _, t := range byCategory {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if !totals[i].Date.Equal(totals[j].Date) {
+			return totals[i].Date.After(totals[j].Date)
+		}
+		if totals[i].Currency != totals[j].Currency {
+			return totals[i].Currency < totals[j].Currency
+		}
+		return totals[i].CategoryName < totals[j].CategoryName
+	})
+	return totals, nil
+}
+
+// paginate returns the requested page of items; limit 0 returns everything
+func paginate[T any](items []T, limit, offset int) []T {
+	if limit <= 0 {
+		return items
+	}
+	if offset >= len(items) {
+		return items[:0]
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
+func (s *memoryStore) CreateSession(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) RotateSession(refreshTokenHash string, next func(current *Session) (*Session, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var current *Session
+	for _, session := range s.sessions {
+		if session.RefreshTokenHash == refreshTokenHash {
+			current = session
+			break
+		}
+	}
+	if current == nil {
+		return errInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if err := checkRotatable(current, now); err != nil {
+		if err == errRefreshTokenReused {
+			for _, session := range s.sessions {
+				if session.FamilyID == current.FamilyID {
+					session.IsActive = false
+				}
+			}
+		}
+		return err
+	}
+
+	snapshot := *current
+	replacement, err := next(&snapshot)
+	if err != nil {
+		return err
+	}
+	stored := *replacement
+	s.sessions[replacement.ID] = &stored
+	current.IsActive = false
+	current.RotatedAt = &now
+	return nil
+}
+
+func (s *memoryStore) DeactivateSessionByTokenHash(tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, session := range s.sessions {
+		if session.TokenHash == tokenHash {
+			session.IsActive = false
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ActiveSessionByTokenHash(tokenHash string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.TokenHash == tokenHash && session.IsActive && session.ExpiresAt != nil && session.ExpiresAt.After(now) {
+			return s.withSignedInAt(session), nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (s *memoryStore) GetSession(id uuid.UUID) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return s.withSignedInAt(session), nil
+}
+
+// withSignedInAt copies the session, setting SignedInAt from the first session of its family
+func (s *memoryStore) withSignedInAt(session *Session) *Session {
+	copied := *session
+	copied.SignedInAt = session.CreatedAt
+	if first, ok := s.sessions[session.FamilyID]; ok {
+		copied.SignedInAt = first.CreatedAt
+	}
+	return &copied
+}
+
+func (s *memoryStore) ListActiveSessions(userID uuid.UUID) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var sessions []Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.IsActive && session.ExpiresAt != nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *s.withSignedInAt(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+func (s *memoryStore) RevokeSession(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revoked, ok := s.sessions[id]
+	if !ok {
+		return errNotFound
+	}
+	for _, session := range s.sessions {
+		if session.FamilyID == revoked.FamilyID {
+			session.IsActive = false
+		}
+	}
+	revoked.IsActive = false
+	return nil
+}
+
+func (s *memoryStore) RevokeOtherSessions(userID, keepID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.IsActive && session.ID != keepID {
+			session.IsActive = false
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryStore) CreateAPIToken(token *APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *token
+	s.apiTokens[token.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) ListAPITokens(userID uuid.UUID) ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []APIToken
+	for _, token := range s.apiTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			tokens = append(tokens, *token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (s *memoryStore) RevokeAPIToken(userID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.apiTokens[id]
+	if !ok || token.UserID != userID || token.RevokedAt != nil {
+		return errNotFound
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	return nil
+}
+
+func (s *memoryStore) AuthenticateAPIToken(tokenHash string) (*APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, token := range s.apiTokens {
+		if token.TokenHash != tokenHash || token.RevokedAt != nil || (token.ExpiresAt != nil && !token.ExpiresAt.After(now)) {
+			continue
+		}
+		if owner, ok := s.users[token.UserID]; !ok || !owner.IsActive {
+			return nil, errNotFound
+		}
+		token.LastUsedAt = &now
+		found := *token
+		return &found, nil
+	}
+	return nil, errNotFound
+}
+
+func (s *memoryStore) RecordAudit(entry auditEntry) error {
+	event := AuditEvent{
+		ID: uuid.New(), ActorID: entry.ActorID, Action: entry.Action, EntityType: entry.EntityType, EntityID: entry.EntityID,
+		IPAddress: entry.IPAddress, RequestID: entry.RequestID, CreatedAt: time.Now(),
+	}
+	for _, field := range []struct {
+		value interface{}
+		dst   *json.RawMessage
+	}{{entry.Before, &event.Before}, {entry.After, &event.After}, {entry.Details, &event.Details}} {
+		data, err := auditJSON(field.value)
+		if err != nil {
+			return err
+		}
+		if data != nil {
+			*field.dst = json.RawMessage(data.(string))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, event)
+	return nil
+}
+
+func (s *memoryStore) ListAudit(filter AuditFilter) ([]AuditEvent, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []AuditEvent
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		e := s.audit[i]
+		if (filter.ActorID != uuid.Nil && e.ActorID != filter.ActorID) ||
+			(filter.EntityType != "" && e.EntityType != filter.EntityType) ||
+			(filter.EntityID != uuid.Nil && e.EntityID != filter.EntityID) ||
+			(filter.Action != "" && e.Action != filter.Action) ||
+			(!filter.From.IsZero() && e.CreatedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !e.CreatedAt.Before(filter.To)) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return paginate(events, filter.Limit, filter.Offset), len(events), nil
+}
+
+func (s *memoryStore) StartExport(userID uuid.UUID) (*DataExport, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for id, job := range s.exports {
+		if job.UserID != userID {
+			continue
+		}
+		if job.Status == exportStatusPending {
+			found := *job
+			return &found, false, nil
+		}
+		if job.ExpiresAt != nil && job.ExpiresAt.Before(now) {
+			delete(s.exports, id)
+		}
+	}
+	job := &DataExport{ID: uuid.New(), UserID: userID, Status: exportStatusPending, CreatedAt: now, HeartbeatAt: &now}
+	stored := *job
+	s.exports[job.ID] = &stored
+	return job, true, nil
+}
+
+func (s *memoryStore) GetExport(userID, id uuid.UUID) (*DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.exports[id]
+	if !ok || job.UserID != userID {
+		return nil, errNotFound
+	}
+	found := *job
+	found.Archive = nil
+	return &found, nil
+}
+
+func (s *memoryStore) ExportArchive(userID, id uuid.UUID) (*DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.exports[id]
+	if !ok || job.UserID != userID || job.Status != exportStatusCompleted || job.ExpiresAt == nil || !job.ExpiresAt.After(time.Now()) {
+		return nil, errNotFound
+	}
+	found := *job
+	return &found, nil
+}
+
+func (s *memoryStore) HeartbeatExport(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.exports[id]; ok {
+		now := time.Now()
+		job.HeartbeatAt = &now
+	}
+	return nil
+}
+
+func (s *memoryStore) CompleteExport(id uuid.UUID, archive []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.exports[id]; ok {
+		now := time.Now()
+		job.Status, job.Archive, job.CompletedAt, job.ExpiresAt = exportStatusCompleted, archive, &now, &expiresAt
+	}
+	return nil
+}
+
+func (s *memoryStore) FailExport(id uuid.UUID, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.exports[id]; ok {
+		now := time.Now()
+		job.Status, job.Error, job.CompletedAt = exportStatusFailed, &message, &now
+	}
+	return nil
+}
+
+func (s *memoryStore) FailStaleExports(staleBefore time.Time, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, job := range s.exports {
+		heartbeat := job.CreatedAt
+		if job.HeartbeatAt != nil {
+			heartbeat = *job.HeartbeatAt
+		}
+		if job.Status == exportStatusPending && heartbeat.Before(staleBefore) {
+			msg := message
+			job.Status, job.Error, job.CompletedAt = exportStatusFailed, &msg, &now
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) SaveRates(rates []ExchangeRate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range rates {
+		s.rates[rateKey{r.Date.Format("2006-01-02"), r.Base, r.Quote}] = r
+	}
+	return nil
+}
+
+func (s *memoryStore) ListRates(currencies []string, from, to time.Time) ([]ExchangeRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wanted := make(map[string]bool, len(currencies))
+	for _, c := range currencies {
+		wanted[c] = true
+	}
+	rates := make([]ExchangeRate, 0)
+	for _, r := range s.rates {
+		if r.Date.Before(from) || r.Date.After(to) || !(wanted[r.Base] || wanted[r.Quote]) {
+			continue
+		}
+		rates = append(rates, r)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if !rates[i].Date.Equal(rates[j].Date) {
+			return rates[i].Date.Before(rates[j].Date)
+		}
+		if rates[i].Base != rates[j].Base {
+			return rates[i].Base < rates[j].Base
+		}
+		return rates[i].Quote < rates[j].Quote
+	})
+	return rates, nil
+}
+
+func (s *memoryStore) LatestRateDate(source string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest time.Time
+	for _, r := range s.rates {
+		if r.Source == source && r.Date.After(latest) {
+			latest = r.Date
+		}
+	}
+	return latest, nil
+}
+
+func (s *memoryStore) CreateRecurring(r *RecurringExpense, categoryIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkCategories(categoryIDs); err != nil {
+		return err
+	}
+	stored := *r
+	stored.Categories, stored.Skipped = nil, nil
+	s.recurring[r.ID] = &stored
+	s.recurringLinks[r.ID] = append([]uuid.UUID(nil), categoryIDs...)
+	return nil
+}
+
+func (s *memoryStore) GetRecurring(id uuid.UUID) (*RecurringExpense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.recurring[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	recurring := s.withRecurringDetails(r)
+	return &recurring, nil
+}
+
+// withRecurringDetails copies a recurring expense and fills in its categories,
+// ordered by name, and the skipped occurrences still ahead of it
+func (s *memoryStore) withRecurringDetails(r *RecurringExpense) RecurringExpense {
+	recurring := *r
+	recurring.Categories = []ExpenseCategoryDetail{}
+	for _, id := range s.recurringLinks[r.ID] {
+		if c, ok := s.categories[id]; ok {
+			recurring.Categories = append(recurring.Categories, ExpenseCategoryDetail{ID: c.ID, Name: c.Name, IsDefault: c.IsDefault})
+		}
+	}
+	sort.Slice(recurring.Categories, func(i, j int) bool { return recurring.Categories[i].Name < recurring.Categories[j].Name })
+	recurring.Skipped = []time.Time{}
+	for _, date := range s.recurringSkips[r.ID] {
+		if r.NextDate != nil && !date.Before(*r.NextDate) {
+			recurring.Skipped = append(recurring.Skipped, date)
+		}
+	}
+	sort.Slice(recurring.Skipped, func(i, j int) bool { return recurring.Skipped[i].Before(recurring.Skipped[j]) })
+	return recurring
+}
+
+func (s *memoryStore) ListRecurring(userID uuid.UUID) ([]RecurringExpense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]RecurringExpense, 0)
+	for _, r := range s.recurring {
+		if r.UserID == userID {
+			list = append(list, s.withRecurringDetails(r))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID.String() < list[j].ID.String()
+	})
+	return list, nil
+}
+
+func (s *memoryStore) UpdateRecurring(r *RecurringExpense, categoryIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.recurring[r.ID]
+	if !ok {
+		return nil
+	}
+	if err := s.checkCategories(categoryIDs); err != nil {
+		return err
+	}
+	stored := *r
+	stored.UserID, stored.CreatedAt = current.UserID, current.CreatedAt
+	stored.Categories, stored.Skipped = nil, nil
+	s.recurring[r.ID] = &stored
+	s.recurringLinks[r.ID] = append([]uuid.UUID(nil), categoryIDs...)
+	return nil
+}
+
+func (s *memoryStore) DeleteRecurring(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for expenseID, e := range s.expenses {
+		if e.RecurringExpenseID != nil && *e.RecurringExpenseID == id {
+			e.RecurringExpenseID = nil
+			delete(s.occurrences, expenseID)
+		}
+	}
+	delete(s.recurring, id)
+	delete(s.recurringLinks, id)
+	delete(s.recurringSkips, id)
+	return nil
+}
+
+func (s *memoryStore) SkipOccurrence(id uuid.UUID, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, skipped := range s.recurringSkips[id] {
+		if skipped.Equal(date) {
+			return nil
+		}
+	}
+	s.recurringSkips[id] = append(s.recurringSkips[id], date)
+	return nil
+}
+
+func (s *memoryStore) DueRecurring(on time.Time) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*RecurringExpense
+	for _, r := range s.recurring {
+		user, ok := s.users[r.UserID]
+		if r.Paused || r.NextDate == nil || r.NextDate.After(on) || !ok || !user.IsActive {
+			continue
+		}
+		due = append(due, r)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextDate.Equal(*due[j].NextDate) {
+			return due[i].NextDate.Before(*due[j].NextDate)
+		}
+		return due[i].ID.String() < due[j].ID.String()
+	})
+	ids := make([]uuid.UUID, 0, len(due))
+	for _, r := range due {
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) MaterializeRecurring(id uuid.UUID, due func(r *RecurringExpense) ([]Expense, *time.Time)) ([]Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.recurring[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	r := s.withRecurringDetails(stored)
+	if len(s.recurringLinks[id]) == 0 {
+		stored.Paused = true
+		return nil, errNoCategories
+	}
+
+	expenses, next := due(&r)
+	created := make([]Expense, 0, len(expenses))
+	for _, e := range expenses {
+		if s.hasOccurrence(id, e.ExpenseDate) {
+			continue
+		}
+		expense := e
+		expense.Categories = nil
+		expense.RecurringExpenseID = &id
+		s.expenses[e.ID] = &expense
+		shares, err := evenShares(e.Amount, s.recurringLinks[id])
+		if err != nil {
+			return nil, err
+		}
+		s.expenseLinks[e.ID] = shares
+		s.occurrences[e.ID] = e.ExpenseDate
+		created = append(created, e)
+	}
+	stored.NextDate = next
+	return created, nil
+}
+
+// hasOccurrence stands in for the unique index on (recurring_expense_id, occurrence_date)
+func (s *memoryStore) hasOccurrence(id uuid.UUID, date time.Time) bool {
+	for expenseID, occurrence := range s.occurrences {
+		if e, ok := s.expenses[expenseID]; ok && e.RecurringExpenseID != nil && *e.RecurringExpenseID == id && occurrence.Equal(date) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) CreateAttachment(a *Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.expenses[a.ExpenseID]; !ok {
+		return fmt.Errorf("expense %s does not exist", a.ExpenseID)
+	}
+	stored := *a
+	s.attachments[a.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) GetAttachment(expenseID, id uuid.UUID) (*Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attachments[id]
+	if !ok || a.ExpenseID != expenseID {
+		return nil, errNotFound
+	}
+	out := *a
+	return &out, nil
+}
+
+func (s *memoryStore) ListAttachments(expenseID uuid.UUID) ([]Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attachments := make([]Attachment, 0)
+	for _, a := range s.attachments {
+		if a.ExpenseID == expenseID {
+			attachments = append(attachments, *a)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID.String() < attachments[j].ID.String()
+	})
+	return attachments, nil
+}
+
+func (s *memoryStore) DeleteAttachment(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attachments, id)
+	return nil
+}
@@ -0,0 +1,1346 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sqlStore implements every store interface on the application database.
+// The queries are shared by Postgres and SQLite; dialect supplies the few that are not.
+type sqlStore struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+const userColumns = `id, name, email, email_verified, pending_email, password, profile_image, created_at, updated_at, is_active, totp_enabled, role, home_currency`
+
+// scanUser reads a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var user User
+	err := row.Scan(
+		&user.ID, &user.Name, &user.Email, &user.EmailVerified, &user.PendingEmail, &user.Password, &user.ProfileImage,
+		&user.CreatedAt, &user.UpdatedAt, &user.IsActive, &user.TwoFactorEnabled, &user.Role, &user.HomeCurrency,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *sqlStore) EmailExists(email string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`, normalizeEmail(email)).Scan(&exists)
+	return exists, err
+}
+
+func (s *sqlStore) CreateUser(user *User) error {
+	return s.db.QueryRow(
+		`INSERT INTO users (id, name, email, password, email_verified, home_currency)
+		 VALUES ($1, $2, $3, $4, false, $5)
+		 RETURNING created_at, updated_at, is_active, email_verified, role`,
+		user.ID, user.Name, user.Email, user.Password, user.HomeCurrency,
+	).Scan(&user.CreatedAt, &user.UpdatedAt, &user.IsActive, &user.EmailVerified, &user.Role)
+}
+
+func (s *sqlStore) GetUser(id uuid.UUID) (*User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1 AND is_active = true`, id))
+}
+
+func (s *sqlStore) GetUserByEmail(email string) (*User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE LOWER(email) = LOWER($1) AND is_active = true`, normalizeEmail(email)))
+}
+
+func (s *sqlStore) UpdateProfile(id uuid.UUID, name string, profileImage *string, homeCurrency string) error {
+	_, err := s.db.Exec(`UPDATE users SET name = $2, profile_image = $3, home_currency = $4, updated_at = $5 WHERE id = $1`, id, name, profileImage, homeCurrency, time.Now())
+	return err
+}
+
+func (s *sqlStore) UpdatePassword(id uuid.UUID, passwordHash string) error {
+	_, err := s.db.Exec(`UPDATE users SET password = $2, updated_at = $3 WHERE id = $1`, id, passwordHash, time.Now())
+	return err
+}
+
+func (s *sqlStore) RecordLogin(attempt *LoginHistory) error {
+	if attempt.ID == uuid.Nil {
+		attempt.ID = uuid.New()
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO login_history (id, user_id, email, ip_address, user_agent, method, success, login_at)
+		VALUES ($1, COALESCE($2, (SELECT id FROM users WHERE LOWER(email) = $3)), $3, $4, $5, $6, $7, $8)`,
+		attempt.ID, attempt.UserID, attempt.Email, attempt.IPAddress, attempt.UserAgent, attempt.Method, attempt.Success, attempt.LoginAt,
+	)
+	return err
+}
+
+func (s *sqlStore) FailedLogins(email, ip string, since time.Time) (loginFailures, error) {
+	var f loginFailures
+	var emailLast, ipLast dbTime
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), MAX(f.login_at)
+		FROM login_history f
+		WHERE f.email = $1 AND f.success = false AND f.login_at > $2
+		  AND NOT EXISTS (
+			SELECT 1 FROM login_history s
+			WHERE s.email = f.email AND s.success = true AND s.method <> 'token' AND s.login_at > f.login_at
+		  )`,
+		email, since,
+	).Scan(&f.EmailCount, &emailLast)
+	if err != nil {
+		return f, err
+	}
+	err = s.db.QueryRow(
+		`SELECT COUNT(*), MAX(login_at) FROM login_history WHERE ip_address = $1 AND success = false AND login_at > $2`,
+		ip, since,
+	).Scan(&f.IPCount, &ipLast)
+	if err != nil {
+		return f, err
+	}
+	if emailLast.Valid {
+		f.EmailLast = &emailLast.Time
+	}
+	if ipLast.Valid {
+		f.IPLast = &ipLast.Time
+	}
+	return f, nil
+}
+
+func (s *sqlStore) LoginHistory(userID uuid.UUID, success *bool, limit, offset int) ([]LoginHistory, int, error) {
+	where := "user_id = $1"
+	args := []interface{}{userID}
+	if success != nil {
+		where += " AND success = $2"
+		args = append(args, *success)
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM login_history WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, user_id, email, ip_address, user_agent, method, success, login_at
+		FROM login_history
+		WHERE %s
+		ORDER BY login_at DESC
+		LIMIT %d OFFSET %d`, where, limit, offset)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	history := make([]LoginHistory, 0)
+	for rows.Next() {
+		var h LoginHistory
+		var ipAddress, userAgent sql.NullString
+		if err := rows.Scan(&h.ID, &h.UserID, &h.Email, &ipAddress, &userAgent, &h.Method, &h.Success, &h.LoginAt); err != nil {
+			return nil, 0, err
+		}
+		h.IPAddress, h.UserAgent = ipAddress.String, userAgent.String
+		history = append(history, h)
+	}
+	return history, total, rows.Err()
+}
+
+const categoryColumns = `id, name, user_id, is_default, created_at, updated_at`
+
+// scanCategory reads a row selected with categoryColumns; default categories have no owner
+func scanCategory(row interface{ Scan(...interface{}) error }) (*Category, error) {
+	var category Category
+	var owner uuid.NullUUID
+	err := row.Scan(&category.ID, &category.Name, &owner, &category.IsDefault, &category.CreatedAt, &category.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	category.UserID = owner.UUID
+	return &category, nil
+}
+
+func (s *sqlStore) ListCategories(userID uuid.UUID) ([]Category, error) {
+	rows, err := s.db.Query(`SELECT `+categoryColumns+` FROM categories WHERE user_id = $1 ORDER BY is_default DESC, name ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, *category)
+	}
+	return categories, rows.Err()
+}
+
+func (s *sqlStore) GetCategory(id uuid.UUID) (*Category, error) {
+	return scanCategory(s.db.QueryRow(`SELECT `+categoryColumns+` FROM categories WHERE id = $1`, id))
+}
+
+func (s *sqlStore) CategoryNameTaken(userID uuid.UUID, name string, excludeID uuid.UUID) (bool, error) {
+	var taken bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM categories
+			WHERE LOWER(name) = LOWER($1)
+			  AND id <> $2
+			  AND (user_id = $3 OR is_default = true)
+		)`,
+		name, excludeID, userID,
+	).Scan(&taken)
+	return taken, err
+}
+
+func (s *sqlStore) CreateCategory(category *Category) error {
+	_, err := s.db.Exec(
+		`INSERT INTO categories (id, name, user_id, is_default, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		category.ID, category.Name, category.UserID, category.IsDefault, category.CreatedAt, category.UpdatedAt,
+	)
+	return err
+}
+
+func (s *sqlStore) UpdateCategory(category *Category) error {
+	_, err := s.db.Exec(
+		`UPDATE categories SET name = $1, is_default = $2, updated_at = $3 WHERE id = $4`,
+		category.Name, category.IsDefault, category.UpdatedAt, category.ID,
+	)
+	return err
+}
+
+func (s *sqlStore) DeleteCategory(id uuid.UUID) error {
+	// ON DELETE CASCADE removes the expense_categories rows
+	_, err := s.db.Exec(`DELETE FROM categories WHERE id = $1`, id)
+	return err
+}
+
+func (s *sqlStore) CreateExpense(expense *Expense, shares []CategoryShare) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO expenses (id, user_id, title, description, amount_minor, currency, expense_date, expense_time, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		expense.ID, expense.UserID, expense.Title, expense.Description, expense.Amount, expense.Currency, expense.ExpenseDate, expense.ExpenseTime, expense.CreatedAt, expense.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := linkExpenseCategories(tx, expense.ID, shares); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// linkExpenseCategories inserts the expense_categories rows for an expense
+func linkExpenseCategories(exec sqlExecutor, expenseID uuid.UUID, shares []CategoryShare) error {
+	for _, share := range shares {
+		_, err := exec.Exec(
+			`INSERT INTO expense_categories (id, expense_id, category_id, share_minor, share_percent) VALUES ($1, $2, $3, $4, $5)`,
+			uuid.New(), expenseID, share.CategoryID, share.Amount, share.Percentage,
+		)
+		if err != nil {
+			return fmt.Errorf("linking category %s: %w", share.CategoryID, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) GetExpense(id uuid.UUID) (*Expense, error) {
+	var expense Expense
+	err := s.db.QueryRow(
+		`SELECT id, user_id, title, description, amount_minor, currency, expense_date, expense_time, created_at, updated_at, recurring_expense_id FROM expenses WHERE id = $1`,
+		id,
+	).Scan(&expense.ID, &expense.UserID, &expense.Title, &expense.Description, &expense.Amount, &expense.Currency, &expense.ExpenseDate, &expense.ExpenseTime, &expense.CreatedAt, &expense.UpdatedAt, &expense.RecurringExpenseID)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expenses := []Expense{expense}
+	if err := s.attachCategories(expenses); err != nil {
+		return nil, err
+	}
+	return &expenses[0], nil
+}
+
+func (s *sqlStore) UpdateExpense(expense *Expense, shares []CategoryShare) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE expenses SET title = $2, description = $3, amount_minor = $4, currency = $5, expense_date = $6, expense_time = $7, updated_at = $8 WHERE id = $1`,
+		expense.ID, expense.Title, expense.Description, expense.Amount, expense.Currency, expense.ExpenseDate, expense.ExpenseTime, expense.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM expense_categories WHERE expense_id = $1`, expense.ID); err != nil {
+		return err
+	}
+	if err := linkExpenseCategories(tx, expense.ID, shares); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) DeleteExpense(id uuid.UUID) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Deleting the attachment rows in the same transaction returns every key, including
+	// one uploaded while the expense was being deleted
+	rows, err := tx.Query(`DELETE FROM expense_attachments WHERE expense_id = $1 RETURNING storage_key`, id)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM expenses WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	return keys, tx.Commit()
+}
+
+func (s *sqlStore) ExpenseBelongsTo(expenseID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM expenses WHERE id = $1 AND user_id = $2)`, expenseID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (s *sqlStore) CountExpenses(userID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM expenses WHERE user_id = $1`, userID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlStore) ListExpenses(userID uuid.UUID, filters *ExpenseFilters) ([]Expense, error) {
+	// Build dynamic query based on provided filters
+	queryBuilder := strings.Builder{}
+	args := []interface{}{userID}
+	argIndex := 2
+
+	queryBuilder.WriteString(`
+		SELECT e.id, e.user_id, e.title, e.description, e.amount_minor, e.currency, e.expense_date, e.expense_time, e.created_at, e.updated_at, e.recurring_expense_id
+		FROM expenses e
+		WHERE e.user_id = $1`)
+
+	if filters.CategoryID != nil {
+		queryBuilder.WriteString(fmt.Sprintf(" AND EXISTS (SELECT 1 FROM expense_categories ec WHERE ec.expense_id = e.id AND ec.category_id = $%d)", argIndex))
+		args = append(args, *filters.CategoryID)
+		argIndex++
+	}
+	if filters.StartDate != nil {
+		queryBuilder.WriteString(fmt.Sprintf(" AND e.expense_date >= $%d", argIndex))
+		args = append(args, *filters.StartDate)
+		argIndex++
+	}
+	if filters.EndDate != nil {
+		queryBuilder.WriteString(fmt.Sprintf(" AND e.expense_date <= $%d", argIndex))
+		args = append(args, *filters.EndDate)
+		argIndex++
+	}
+	if filters.MinAmount != nil {
+		queryBuilder.WriteString(fmt.Sprintf(" AND e.amount_minor >= $%d", argIndex))
+		args = append(args, *filters.MinAmount)
+		argIndex++
+	}
+	if filters.MaxAmount != nil {
+		queryBuilder.WriteString(fmt.Sprintf(" AND e.amount_minor <= $%d", argIndex))
+		args = append(args, *filters.MaxAmount)
+		argIndex++
+	}
+
+	// Always order by creation date (newest first)
+	queryBuilder.WriteString(" ORDER BY e.created_at DESC")
+	if filters.Limit > 0 {
+		queryBuilder.WriteString(fmt.Sprintf(" LIMIT %d", filters.Limit))
+	}
+
+	rows, err := s.db.Query(queryBuilder.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expenses := make([]Expense, 0)
+	for rows.Next() {
+		var e Expense
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Title, &e.Description, &e.Amount, &e.Currency, &e.ExpenseDate, &e.ExpenseTime, &e.CreatedAt, &e.UpdatedAt, &e.RecurringExpenseID); err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachCategories(expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+// attachCategories loads the categories of every expense in one query, ordered by name
+func (s *sqlStore) attachCategories(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(expenses))
+	args := make([]interface{}, len(expenses))
+	indexByID := make(map[uuid.UUID]int, len(expenses))
+	for i, e := range expenses {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = e.ID
+		indexByID[e.ID] = i
+		expenses[i].Categories = []ExpenseCategoryDetail{}
+	}
+	query := fmt.Sprintf(`SELECT ec.expense_id, c.id, c.name, c.is_default, ec.share_minor, ec.share_percent FROM expense_categories ec JOIN categories c ON c.id = ec.category_id WHERE ec.expense_id IN (%s) ORDER BY c.name ASC`, strings.Join(placeholders, ","))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var expenseID uuid.UUID
+		var cat ExpenseCategoryDetail
+		if err := rows.Scan(&expenseID, &cat.ID, &cat.Name, &cat.IsDefault, &cat.Amount, &cat.Percentage); err != nil {
+			return err
+		}
+		if idx, ok := indexByID[expenseID]; ok {
+			expenses[idx].Categories = append(expenses[idx].Categories, cat)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlStore) SpendingByDay(userID uuid.UUID, from, to time.Time) ([]DaySpending, error) {
+	where := "user_id = $1"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		args = append(args, from)
+		where += fmt.Sprintf(" AND expense_date >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		where += fmt.Sprintf(" AND expense_date < $%d", len(args))
+	}
+
+	rows, err := s.db.Query(`
+		SELECT expense_date, currency, SUM(amount_minor), COUNT(*)
+		FROM expenses
+		WHERE `+where+`
+		GROUP BY expense_date, currency
+		ORDER BY expense_date DESC, currency`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make([]DaySpending, 0)
+	for rows.Next() {
+		var d DaySpending
+		if err := rows.Scan(&d.Date, &d.Currency, &d.Total, &d.Count); err != nil {
+			return nil, err
+		}
+		totals = append(totals, d)
+	}
+	return totals, rows.Err()
+}
+
+func (s *sqlStore) SpendingByCategory(userID uuid.UUID, from, to time.Time) ([]CategorySpending, error) {
+	where := "e.user_id = $1"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		args = append(args, from)
+		where += fmt.Sprintf(" AND e.expense_date >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		where += fmt.Sprintf(" AND e.expense_date < $%d", len(args))
+	}
+
+	rows, err := s.db.Query(`
+		SELECT c.id, c.name, e.expense_date, e.currency, SUM(ec.share_minor), COUNT(DISTINCT e.id)
+		FROM expense_categories ec
+		JOIN expenses e ON e.id = ec.expense_id
+		JOIN categories c ON c.id = ec.category_id
+		WHERE `+where+`
+		GROUP BY c.id, c.name, e.expense_date, e.currency
+		ORDER BY e.expense_date DESC, e.currency, c.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make([]CategorySpending, 0)
+	for rows.Next() {
+		var c CategorySpending
+		if err := rows.Scan(&c.CategoryID, &c.CategoryName, &c.Date, &c.Currency, &c.Total, &c.Count); err != nil {
+			return nil, err
+		}
+		totals = append(totals, c)
+	}
+	return totals, rows.Err()
+}
+
+func (s *sqlStore) CreateSession(session *Session) error {
+	return insertSession(s.db, session)
+}
+
+// insertSession writes a new session row
+func insertSession(exec sqlExecutor, session *Session) error {
+	_, err := exec.Exec(
+		`INSERT INTO sessions (id, user_id, token_hash, refresh_token_hash, family_id, parent_id, user_agent, ip_address, created_at, expires_at, is_active) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		session.ID, session.UserID, session.TokenHash, session.RefreshTokenHash, session.FamilyID, session.ParentID,
+		session.UserAgent, session.IPAddress, session.CreatedAt, session.ExpiresAt, session.IsActive,
+	)
+	return err
+}
+
+func (s *sqlStore) RotateSession(refreshTokenHash string, next func(current *Session) (*Session, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current Session
+	var expiresAt time.Time
+	var rotatedAt sql.NullTime
+	err = tx.QueryRow(
+		`SELECT id, user_id, COALESCE(family_id, id), is_active, expires_at, rotated_at FROM sessions WHERE refresh_token_hash = $1`+s.dialect.ForUpdate,
+		refreshTokenHash,
+	).Scan(&current.ID, &current.UserID, &current.FamilyID, &current.IsActive, &expiresAt, &rotatedAt)
+	if err == sql.ErrNoRows {
+		return errInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	current.ExpiresAt = &expiresAt
+	if rotatedAt.Valid {
+		current.RotatedAt = &rotatedAt.Time
+	}
+
+	now := time.Now()
+	if err := checkRotatable(&current, now); err != nil {
+		// An already rotated token means it leaked somewhere; end every session in the chain
+		if err == errRefreshTokenReused {
+			if err := revokeSessionFamily(tx, current.FamilyID); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	replacement, err := next(&current)
+	if err != nil {
+		return err
+	}
+	if err := insertSession(tx, replacement); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET is_active = false, rotated_at = $2 WHERE id = $1`, current.ID, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) DeactivateSessionByTokenHash(tokenHash string) error {
+	_, err := s.db.Exec(`UPDATE sessions SET is_active = false WHERE token_hash = $1`, tokenHash)
+	return err
+}
+
+// sessionSelect loads a session row with the time its login family started
+const sessionSelect = `
+	SELECT s.id, s.user_id, COALESCE(s.family_id, s.id), s.user_agent, s.ip_address,
+	       COALESCE(f.created_at, s.created_at), s.created_at, s.expires_at, s.is_active
+	FROM sessions s
+	LEFT JOIN sessions f ON f.id = COALESCE(s.family_id, s.id)
+`
+
+// scanSession reads a row selected with sessionSelect
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var session Session
+	var signedInAt dbTime
+	var expiresAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.FamilyID, &session.UserAgent, &session.IPAddress,
+		&signedInAt, &session.CreatedAt, &expiresAt, &session.IsActive)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.SignedInAt = signedInAt.Time
+	session.ExpiresAt = nullTime(expiresAt)
+	return &session, nil
+}
+
+func (s *sqlStore) ActiveSessionByTokenHash(tokenHash string) (*Session, error) {
+	return scanSession(s.db.QueryRow(sessionSelect+` WHERE s.token_hash = $1 AND s.is_active = true AND s.expires_at > $2`, tokenHash, time.Now()))
+}
+
+func (s *sqlStore) GetSession(id uuid.UUID) (*Session, error) {
+	return scanSession(s.db.QueryRow(sessionSelect+` WHERE s.id = $1`, id))
+}
+
+func (s *sqlStore) ListActiveSessions(userID uuid.UUID) ([]Session, error) {
+	rows, err := s.db.Query(sessionSelect+`
+		WHERE s.user_id = $1 AND s.is_active = true AND s.expires_at > $2
+		ORDER BY s.created_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlStore) RevokeSession(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var familyID uuid.UUID
+	if err := tx.QueryRow(`SELECT COALESCE(family_id, id) FROM sessions WHERE id = $1`, id).Scan(&familyID); err != nil {
+		if err == sql.ErrNoRows {
+			return errNotFound
+		}
+		return err
+	}
+	if err := revokeSessionFamily(tx, familyID); err != nil {
+		return err
+	}
+	// Legacy sessions have no family_id, so revoke the row itself as well
+	if _, err := tx.Exec(`UPDATE sessions SET is_active = false WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RevokeOtherSessions(userID, keepID uuid.UUID) (int, error) {
+	result, err := s.db.Exec(`UPDATE sessions SET is_active = false WHERE user_id = $1 AND is_active = true AND id <> $2`, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// nullTime returns the time of a nullable column, or nil
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+const apiTokenColumns = `id, user_id, name, token_hash, scopes, created_at, last_used_at, expires_at, revoked_at`
+
+// scanAPIToken reads a row selected with apiTokenColumns
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var token APIToken
+	var scopes string
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.TokenHash, &scopes, &token.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.Scopes = splitScopes(scopes)
+	token.LastUsedAt, token.ExpiresAt, token.RevokedAt = nullTime(lastUsedAt), nullTime(expiresAt), nullTime(revokedAt)
+	return &token, nil
+}
+
+func (s *sqlStore) CreateAPIToken(token *APIToken) error {
+	_, err := s.db.Exec(
+		`INSERT INTO api_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID, token.UserID, token.Name, token.TokenHash, strings.Join(token.Scopes, ","), token.CreatedAt, token.ExpiresAt,
+	)
+	return err
+}
+
+func (s *sqlStore) ListAPITokens(userID uuid.UUID) ([]APIToken, error) {
+	rows, err := s.db.Query(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) RevokeAPIToken(userID, id uuid.UUID) error {
+	result, err := s.db.Exec(`UPDATE api_tokens SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) AuthenticateAPIToken(tokenHash string) (*APIToken, error) {
+	now := time.Now()
+	token, err := scanAPIToken(s.db.QueryRow(`
+		SELECT t.id, t.user_id, t.name, t.token_hash, t.scopes, t.created_at, t.last_used_at, t.expires_at, t.revoked_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL
+		  AND (t.expires_at IS NULL OR t.expires_at > $2)
+		  AND u.is_active = true`,
+		tokenHash, now,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	// Only touch last_used_at once a minute to avoid a write on every request
+	s.db.Exec(`UPDATE api_tokens SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`, token.ID, now, now.Add(-time.Minute))
+	return token, nil
+}
+
+func (s *sqlStore) RecordAudit(entry auditEntry) error {
+	return recordAudit(s.db, entry)
+}
+
+func (s *sqlStore) ListAudit(filter AuditFilter) ([]AuditEvent, int, error) {
+	var where strings.Builder
+	where.WriteString("1 = 1")
+	args := []interface{}{}
+	addFilter := func(clause string, value interface{}) {
+		args = append(args, value)
+		where.WriteString(fmt.Sprintf(" AND "+clause, len(args)))
+	}
+	if filter.ActorID != uuid.Nil {
+		addFilter("actor_id = $%d", filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		addFilter("entity_type = $%d", filter.EntityType)
+	}
+	if filter.EntityID != uuid.Nil {
+		addFilter("entity_id = $%d", filter.EntityID)
+	}
+	if filter.Action != "" {
+		addFilter("action = $%d", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		addFilter("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addFilter("created_at < $%d", filter.To)
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_log WHERE "+where.String(), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, actor_id, action, entity_type, entity_id, before_data, after_data, details, ip_address, request_id, created_at, redacted_at
+		FROM audit_log
+		WHERE %s
+		ORDER BY created_at DESC
+		LIMIT %d OFFSET %d`, where.String(), filter.Limit, filter.Offset), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		var actorID, entityID uuid.NullUUID
+		var before, after, details, ipAddress, requestID sql.NullString
+		var redactedAt sql.NullTime
+		if err := rows.Scan(&event.ID, &actorID, &event.Action, &event.EntityType, &entityID, &before, &after, &details, &ipAddress, &requestID, &event.CreatedAt, &redactedAt); err != nil {
+			return nil, 0, err
+		}
+		event.ActorID, event.EntityID = actorID.UUID, entityID.UUID
+		event.Before, event.After, event.Details = rawJSON(before), rawJSON(after), rawJSON(details)
+		event.IPAddress, event.RequestID = ipAddress.String, requestID.String
+		event.RedactedAt = nullTime(redactedAt)
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+const exportColumns = `id, user_id, status, error, created_at, heartbeat_at, completed_at, expires_at`
+
+// scanExport reads a row selected with exportColumns, followed by any extra destinations
+func scanExport(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*DataExport, error) {
+	var job DataExport
+	var errMsg sql.NullString
+	var heartbeatAt, completedAt, expiresAt sql.NullTime
+	dest := append([]interface{}{&job.ID, &job.UserID, &job.Status, &errMsg, &job.CreatedAt, &heartbeatAt, &completedAt, &expiresAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+	if errMsg.Valid {
+		job.Error = &errMsg.String
+	}
+	job.HeartbeatAt, job.CompletedAt, job.ExpiresAt = nullTime(heartbeatAt), nullTime(completedAt), nullTime(expiresAt)
+	return &job, nil
+}
+
+func (s *sqlStore) StartExport(userID uuid.UUID) (*DataExport, bool, error) {
+	job, err := scanExport(s.db.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE user_id = $1 AND status = $2`, userID, exportStatusPending))
+	if err == nil || !errors.Is(err, errNotFound) {
+		return job, false, err
+	}
+
+	now := time.Now()
+	if _, err := s.db.Exec(`DELETE FROM data_exports WHERE user_id = $1 AND expires_at < $2`, userID, now); err != nil {
+		return nil, false, err
+	}
+	// A concurrent request may have started a job since; the unique index on pending
+	// jobs lets only one insert through and the other returns that job
+	job = &DataExport{ID: uuid.New(), UserID: userID, Status: exportStatusPending, CreatedAt: now, HeartbeatAt: &now}
+	result, err := s.db.Exec(
+		`INSERT INTO data_exports (id, user_id, status, created_at, heartbeat_at) VALUES ($1, $2, $3, $4, $4)
+		 ON CONFLICT (user_id) WHERE status = 'pending' DO NOTHING`,
+		job.ID, userID, exportStatusPending, now,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		job, err = scanExport(s.db.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE user_id = $1 AND status = $2`, userID, exportStatusPending))
+		return job, false, err
+	}
+	return job, true, nil
+}
+
+func (s *sqlStore) GetExport(userID, id uuid.UUID) (*DataExport, error) {
+	return scanExport(s.db.QueryRow(`SELECT `+exportColumns+` FROM data_exports WHERE id = $1 AND user_id = $2`, id, userID))
+}
+
+func (s *sqlStore) ExportArchive(userID, id uuid.UUID) (*DataExport, error) {
+	var archive []byte
+	job, err := scanExport(s.db.QueryRow(
+		`SELECT `+exportColumns+`, archive FROM data_exports WHERE id = $1 AND user_id = $2 AND status = $3 AND expires_at > $4`,
+		id, userID, exportStatusCompleted, time.Now(),
+	), &archive)
+	if err != nil {
+		return nil, err
+	}
+	job.Archive = archive
+	return job, nil
+}
+
+func (s *sqlStore) HeartbeatExport(id uuid.UUID) error {
+	_, err := s.db.Exec(`UPDATE data_exports SET heartbeat_at = $2 WHERE id = $1`, id, time.Now())
+	return err
+}
+
+func (s *sqlStore) CompleteExport(id uuid.UUID, archive []byte, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		`UPDATE data_exports SET status = $2, archive = $3, completed_at = $4, expires_at = $5 WHERE id = $1`,
+		id, exportStatusCompleted, archive, time.Now(), expiresAt,
+	)
+	return err
+}
+
+func (s *sqlStore) FailExport(id uuid.UUID, message string) error {
+	_, err := s.db.Exec(`UPDATE data_exports SET status = $2, error = $3, completed_at = $4 WHERE id = $1`, id, exportStatusFailed, message, time.Now())
+	return err
+}
+
+func (s *sqlStore) FailStaleExports(staleBefore time.Time, message string) error {
+	_, err := s.db.Exec(
+		`UPDATE data_exports SET status = $1, error = $2, completed_at = $3 WHERE status = $4 AND COALESCE(heartbeat_at, created_at) < $5`,
+		exportStatusFailed, message, time.Now(), exportStatusPending, staleBefore,
+	)
+	return err
+}
+
+func (s *sqlStore) SaveRates(rates []ExchangeRate) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range rates {
+		_, err := tx.Exec(`
+			INSERT INTO exchange_rates (rate_date, base_currency, quote_currency, rate, source, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (rate_date, base_currency, quote_currency)
+			DO UPDATE SET rate = excluded.rate, source = excluded.source, created_at = excluded.created_at`,
+			r.Date, r.Base, r.Quote, r.Rate, r.Source, time.Now(),
+		)
+		if err != nil {
+			return fmt.Errorf("saving %s/%s on %s: %w", r.Base, r.Quote, r.Date.Format("2006-01-02"), err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) ListRates(currencies []string, from, to time.Time) ([]ExchangeRate, error) {
+	if len(currencies) == 0 {
+		return []ExchangeRate{}, nil
+	}
+	placeholders := make([]string, len(currencies))
+	args := []interface{}{from, to}
+	for i, currency := range currencies {
+		args = append(args, currency)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	in := strings.Join(placeholders, ",")
+
+	rows, err := s.db.Query(`
+		SELECT rate_date, base_currency, quote_currency, CAST(rate AS TEXT), source
+		FROM exchange_rates
+		WHERE rate_date >= $1 AND rate_date <= $2
+		  AND (base_currency IN (`+in+`) OR quote_currency IN (`+in+`))
+		ORDER BY rate_date, base_currency, quote_currency`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]ExchangeRate, 0)
+	for rows.Next() {
+		var r ExchangeRate
+		if err := rows.Scan(&r.Date, &r.Base, &r.Quote, &r.Rate, &r.Source); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+func (s *sqlStore) LatestRateDate(source string) (time.Time, error) {
+	var latest dbTime
+	err := s.db.QueryRow(`SELECT MAX(rate_date) FROM exchange_rates WHERE source = $1`, source).Scan(&latest)
+	return latest.Time, err
+}
+
+const recurringColumns = `id, user_id, title, description, amount_minor, currency, expense_time, frequency, interval_count, start_date, end_date, occurrence_count, next_date, paused, created_at, updated_at`
+
+// scanRecurring reads a row selected with recurringColumns
+func scanRecurring(row interface{ Scan(...interface{}) error }) (*RecurringExpense, error) {
+	var r RecurringExpense
+	var endDate, nextDate sql.NullTime
+	var count sql.NullInt64
+	err := row.Scan(
+		&r.ID, &r.UserID, &r.Title, &r.Description, &r.Amount, &r.Currency, &r.ExpenseTime, &r.Frequency, &r.Interval,
+		&r.StartDate, &endDate, &count, &nextDate, &r.Paused, &r.CreatedAt, &r.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if endDate.Valid {
+		r.EndDate = &endDate.Time
+	}
+	if count.Valid {
+		n := int(count.Int64)
+		r.Count = &n
+	}
+	if nextDate.Valid {
+		r.NextDate = &nextDate.Time
+	}
+	return &r, nil
+}
+
+func (s *sqlStore) CreateRecurring(r *RecurringExpense, categoryIDs []uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO recurring_expenses (`+recurringColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		r.ID, r.UserID, r.Title, r.Description, r.Amount, r.Currency, r.ExpenseTime, r.Frequency, r.Interval,
+		r.StartDate, r.EndDate, r.Count, r.NextDate, r.Paused, r.CreatedAt, r.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := linkRecurringCategories(tx, r.ID, categoryIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// linkRecurringCategories inserts the recurring_expense_categories rows for a recurring expense
+func linkRecurringCategories(exec sqlExecutor, id uuid.UUID, categoryIDs []uuid.UUID) error {
+	for _, categoryID := range categoryIDs {
+		_, err := exec.Exec(`INSERT INTO recurring_expense_categories (recurring_expense_id, category_id) VALUES ($1, $2)`, id, categoryID)
+		if err != nil {
+			return fmt.Errorf("linking category %s: %w", categoryID, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) GetRecurring(id uuid.UUID) (*RecurringExpense, error) {
+	r, err := scanRecurring(s.db.QueryRow(`SELECT `+recurringColumns+` FROM recurring_expenses WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	list := []RecurringExpense{*r}
+	if err := s.attachRecurringDetails(list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+func (s *sqlStore) ListRecurring(userID uuid.UUID) ([]RecurringExpense, error) {
+	rows, err := s.db.Query(`SELECT `+recurringColumns+` FROM recurring_expenses WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]RecurringExpense, 0)
+	for rows.Next() {
+		r, err := scanRecurring(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.attachRecurringDetails(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// attachRecurringDetails loads the categories, ordered by name, and the skipped
+// occurrences still ahead of every recurring expense
+func (s *sqlStore) attachRecurringDetails(list []RecurringExpense) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(list))
+	args := make([]interface{}, len(list))
+	indexByID := make(map[uuid.UUID]int, len(list))
+	for i, r := range list {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = r.ID
+		indexByID[r.ID] = i
+		list[i].Categories = []ExpenseCategoryDetail{}
+		list[i].Skipped = []time.Time{}
+	}
+	in := strings.Join(placeholders, ",")
+
+	rows, err := s.db.Query(`SELECT rc.recurring_expense_id, c.id, c.name, c.is_default FROM recurring_expense_categories rc JOIN categories c ON c.id = rc.category_id WHERE rc.recurring_expense_id IN (`+in+`) ORDER BY c.name ASC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var cat ExpenseCategoryDetail
+		if err := rows.Scan(&id, &cat.ID, &cat.Name, &cat.IsDefault); err != nil {
+			return err
+		}
+		if idx, ok := indexByID[id]; ok {
+			list[idx].Categories = append(list[idx].Categories, cat)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	skips, err := s.db.Query(`SELECT s.recurring_expense_id, s.occurrence_date FROM recurring_expense_skips s JOIN recurring_expenses r ON r.id = s.recurring_expense_id WHERE s.recurring_expense_id IN (`+in+`) AND s.occurrence_date >= r.next_date ORDER BY s.occurrence_date`, args...)
+	if err != nil {
+		return err
+	}
+	defer skips.Close()
+	for skips.Next() {
+		var id uuid.UUID
+		var date time.Time
+		if err := skips.Scan(&id, &date); err != nil {
+			return err
+		}
+		if idx, ok := indexByID[id]; ok {
+			list[idx].Skipped = append(list[idx].Skipped, date)
+		}
+	}
+	return skips.Err()
+}
+
+func (s *sqlStore) UpdateRecurring(r *RecurringExpense, categoryIDs []uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE recurring_expenses SET title = $2, description = $3, amount_minor = $4, currency = $5, expense_time = $6, frequency = $7, interval_count = $8,
+		 start_date = $9, end_date = $10, occurrence_count = $11, next_date = $12, paused = $13, updated_at = $14 WHERE id = $1`,
+		r.ID, r.Title, r.Description, r.Amount, r.Currency, r.ExpenseTime, r.Frequency, r.Interval,
+		r.StartDate, r.EndDate, r.Count, r.NextDate, r.Paused, r.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recurring_expense_categories WHERE recurring_expense_id = $1`, r.ID); err != nil {
+		return err
+	}
+	if err := linkRecurringCategories(tx, r.ID, categoryIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) DeleteRecurring(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// SQLite has no foreign key to set NULL, so the link is cleared here on both databases
+	if _, err := tx.Exec(`UPDATE expenses SET recurring_expense_id = NULL WHERE recurring_expense_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SkipOccurrence(id uuid.UUID, date time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO recurring_expense_skips (recurring_expense_id, occurrence_date) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		id, date,
+	)
+	return err
+}
+
+func (s *sqlStore) DueRecurring(on time.Time) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(`
+		SELECT r.id FROM recurring_expenses r JOIN users u ON u.id = r.user_id
+		WHERE r.next_date <= $1 AND r.paused = false AND u.is_active = true
+		ORDER BY r.next_date, r.id`, on)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *sqlStore) MaterializeRecurring(id uuid.UUID, due func(r *RecurringExpense) ([]Expense, *time.Time)) ([]Expense, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	r, err := scanRecurring(tx.QueryRow(`SELECT `+recurringColumns+` FROM recurring_expenses WHERE id = $1`+s.dialect.ForUpdate, id))
+	if err != nil {
+		return nil, err
+	}
+	var categoryIDs []uuid.UUID
+	rows, err := tx.Query(`SELECT category_id FROM recurring_expense_categories WHERE recurring_expense_id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var categoryID uuid.UUID
+		if err := rows.Scan(&categoryID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if r.NextDate != nil {
+		rows, err := tx.Query(`SELECT occurrence_date FROM recurring_expense_skips WHERE recurring_expense_id = $1 AND occurrence_date >= $2`, id, *r.NextDate)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var date time.Time
+			if err := rows.Scan(&date); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			r.Skipped = append(r.Skipped, date)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(categoryIDs) == 0 {
+		if _, err := tx.Exec(`UPDATE recurring_expenses SET paused = true WHERE id = $1`, id); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, errNoCategories
+	}
+
+	expenses, next := due(r)
+	created := make([]Expense, 0, len(expenses))
+	for _, e := range expenses {
+		result, err := tx.Exec(
+			`INSERT INTO expenses (id, user_id, title, description, amount_minor, currency, expense_date, expense_time, created_at, updated_at, recurring_expense_id, occurrence_date)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			 ON CONFLICT (recurring_expense_id, occurrence_date) DO NOTHING`,
+			e.ID, e.UserID, e.Title, e.Description, e.Amount, e.Currency, e.ExpenseDate, e.ExpenseTime, e.CreatedAt, e.UpdatedAt, id, e.ExpenseDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			continue
+		}
+		shares, err := evenShares(e.Amount, categoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		if err := linkExpenseCategories(tx, e.ID, shares); err != nil {
+			return nil, err
+		}
+		created = append(created, e)
+	}
+	if _, err := tx.Exec(`UPDATE recurring_expenses SET next_date = $2 WHERE id = $1`, id, next); err != nil {
+		return nil, err
+	}
+	return created, tx.Commit()
+}
+
+const attachmentColumns = `id, expense_id, user_id, filename, content_type, size_bytes, sha256, storage_key, created_at`
+
+// scanAttachment reads a row selected with attachmentColumns
+func scanAttachment(row interface{ Scan(...interface{}) error }) (*Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.ExpenseID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.StorageKey, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *sqlStore) CreateAttachment(a *Attachment) error {
+	_, err := s.db.Exec(
+		`INSERT INTO expense_attachments (`+attachmentColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		a.ID, a.ExpenseID, a.UserID, a.Filename, a.ContentType, a.Size, a.SHA256, a.StorageKey, a.CreatedAt,
+	)
+	return err
+}
+
+func (s *sqlStore) GetAttachment(expenseID, id uuid.UUID) (*Attachment, error) {
+	return scanAttachment(s.db.QueryRow(`SELECT `+attachmentColumns+` FROM expense_attachments WHERE id = $1 AND expense_id = $2`, id, expenseID))
+}
+
+func (s *sqlStore) ListAttachments(expenseID uuid.UUID) ([]Attachment, error) {
+	rows, err := s.db.Query(`SELECT `+attachmentColumns+` FROM expense_attachments WHERE expense_id = $1 ORDER BY created_at, id`, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make([]Attachment, 0)
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *a)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *sqlStore) DeleteAttachment(id uuid.UUID) error {
+	_, err := s.db.Exec(`DELETE FROM expense_attachments WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// sessionTokens holds the credentials issued for a session
+type sessionTokens struct {
+	SessionID    uuid.UUID
+	UserID       uuid.UUID
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token pair
+func (h *AuthHandler) RefreshToken(c echo.Context) error {
+	var req RefreshTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	if strings.TrimSpace(req.RefreshToken) == "" {
+		return SendCustomError(c, ErrorMissingFields, "Refresh token is required", http.StatusBadRequest)
+	}
+
+	tokens, err := h.rotateSession(req.RefreshToken, clientInfoFromContext(c))
+	switch {
+	case errors.Is(err, errRefreshTokenReused):
+		return SendStandardError(c, ErrorRefreshTokenReused)
+	case errors.Is(err, errInvalidRefreshToken):
+		return SendStandardError(c, ErrorInvalidRefreshToken)
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error: "Failed to refresh token",
+		})
+	}
+
+	return c.JSON(http.StatusOK, LoginResponse{
+		Message:      "Token refreshed successfully.",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		SessionID:    tokens.SessionID.String(),
+	})
+}
+
+// rotateSession replaces the session owning refreshToken with a new one in the same family.
+// Presenting a refresh token that was already rotated revokes the whole family.
+func (h *AuthHandler) rotateSession(refreshToken string, client clientInfo) (*sessionTokens, error) {
+	var tokens *sessionTokens
+	err := h.stores.Sessions.RotateSession(hashToken(refreshToken), func(current *Session) (*Session, error) {
+		session, issued, err := newSession(current.UserID, current.FamilyID, &current.ID, client)
+		tokens = issued
+		return session, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// newSession builds a session and its tokens; the caller stores the session.
+// A nil familyID starts a new family rooted at the new session.
+func newSession(userID, familyID uuid.UUID, parentID *uuid.UUID, client clientInfo) (*Session, *sessionTokens, error) {
+	sessionID := uuid.New()
+	if familyID == uuid.Nil {
+		familyID = sessionID
+	}
+
+	accessToken, err := generateJWT(userID, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := generateSecureToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(refreshTokenTTL())
+	session := &Session{
+		ID:               sessionID,
+		UserID:           userID,
+		TokenHash:        hashToken(accessToken),
+		RefreshTokenHash: hashToken(refreshToken),
+		FamilyID:         familyID,
+		ParentID:         parentID,
+		UserAgent:        &client.UserAgent,
+		IPAddress:        &client.IPAddress,
+		CreatedAt:        now,
+		ExpiresAt:        &expiresAt,
+		IsActive:         true,
+	}
+
+	return session, &sessionTokens{
+		SessionID:    sessionID,
+		UserID:       userID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// revokeSessionFamily deactivates every session descended from the same login
+func revokeSessionFamily(exec sqlExecutor, familyID uuid.UUID) error {
+	_, err := exec.Exec(`UPDATE sessions SET is_active = false WHERE family_id = $1`, familyID)
+	return err
+}
+
+// generateSecureToken returns a random opaque token (refresh tokens, email links)
+func generateSecureToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// signPurposeToken signs a short-lived JWT that is only valid for one purpose
+// (email verification, 2FA challenge, ...). It is never accepted as an access token:
+// it has no session row, and its typ and aud differ from an access token's for
+// services that verify our tokens without one.
+func signPurposeToken(purpose string, userID uuid.UUID, extra jwt.MapClaims, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":     tokenTypePurpose,
+		"aud":     purposeAudience(purpose),
+		"purpose": purpose,
+		"user_id": userID.String(),
+		"exp":     time.Now().Add(ttl).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return signJWT(claims)
+}
+
+// parsePurposeToken validates a token from signPurposeToken and returns its user and claims
+func parsePurposeToken(tokenString, purpose string) (uuid.UUID, jwt.MapClaims, error) {
+	token, err := parseJWT(tokenString, jwt.WithAudience(purposeAudience(purpose)))
+	if err != nil || !token.Valid {
+		return uuid.Nil, nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != tokenTypePurpose || claims["purpose"] != purpose {
+		return uuid.Nil, nil, errors.New("invalid token purpose")
+	}
+	userIDStr, _ := claims["user_id"].(string)
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, nil, errors.New("invalid token subject")
+	}
+	return userID, claims, nil
+}
+
+// hashToken returns the keyed hash under which a session token is stored.
+// The key comes from SESSION_TOKEN_KEY and falls back to the JWT secret;
+// changing it invalidates every existing session.
+func hashToken(token string) string {
+	key := config().Auth.SessionTokenKey
+	if key == "" {
+		key = jwtSecret()
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// accessTokenTTL returns the lifetime of access tokens (ACCESS_TOKEN_TTL, default 15m)
+func accessTokenTTL() time.Duration {
+	return config().Auth.AccessTokenTTL
+}
+
+// refreshTokenTTL returns the lifetime of refresh tokens (REFRESH_TOKEN_TTL, default 30 days)
+func refreshTokenTTL() time.Duration {
+	return config().Auth.RefreshTokenTTL
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	twoFactorChallengePurpose = "2fa_challenge"
+	recoveryCodeCount         = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid second factor")
+
+// TwoFactorHandler handles TOTP enrollment, removal and the second login step
+type TwoFactorHandler struct {
+	db     *sql.DB
+	stores *Stores
+}
+
+// NewTwoFactorHandler creates a new TwoFactorHandler instance
+func NewTwoFactorHandler(db *sql.DB, stores *Stores) *TwoFactorHandler {
+	return &TwoFactorHandler{db: db, stores: stores}
+}
+
+// Enroll generates a new TOTP secret. 2FA stays off until Confirm succeeds.
+func (h *TwoFactorHandler) Enroll(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var email string
+	var enabled bool
+	err := h.db.QueryRow(`SELECT email, totp_enabled FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&email, &enabled)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if enabled {
+		return SendCustomError(c, ErrorAlreadyExists, "Two-factor authentication is already enabled", http.StatusConflict)
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+	if _, err := h.db.Exec(`UPDATE users SET totp_secret = $2, totp_last_step = NULL, updated_at = $3 WHERE id = $1`, userID, secret, time.Now()); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":     "Scan the QR code with your authenticator app, then confirm with a code",
+		"secret":      secret,
+		"otpauth_uri": totpURI(totpIssuer(), email, secret),
+	})
+}
+
+// Confirm turns 2FA on after the user proves their app produces valid codes.
+// The recovery codes are returned only once.
+func (h *TwoFactorHandler) Confirm(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	err := h.db.QueryRow(`SELECT totp_secret, totp_enabled FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&secret, &enabled)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if enabled {
+		return SendCustomError(c, ErrorAlreadyExists, "Two-factor authentication is already enabled", http.StatusConflict)
+	}
+	if !secret.Valid {
+		return SendCustomError(c, ErrorInvalidRequest, "Start enrollment before confirming", http.StatusBadRequest)
+	}
+
+	step, ok := validateTOTP(secret.String, req.Code, time.Now(), -1)
+	if !ok {
+		return SendStandardError(c, ErrorInvalidTwoFactorCode)
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return SendStandardError(c, ErrorInternalServer)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET totp_enabled = true, totp_last_step = $2, updated_at = $3 WHERE id = $1`, userID, step, time.Now()); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err := replaceRecoveryCodes(tx, userID, codes); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable turns 2FA off; it needs the password plus a TOTP or recovery code
+func (h *TwoFactorHandler) Disable(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+
+	var hashedPassword string
+	var enabled bool
+	err := h.db.QueryRow(`SELECT password, totp_enabled FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&hashedPassword, &enabled)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if !enabled {
+		return SendCustomError(c, ErrorInvalidRequest, "Two-factor authentication is not enabled", http.StatusBadRequest)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)) != nil {
+		return SendCustomError(c, ErrorInvalidCredentials, "Password is incorrect", http.StatusBadRequest)
+	}
+
+	if err := verifySecondFactor(h.db, userID, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			return SendStandardError(c, ErrorInvalidTwoFactorCode)
+		}
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = NULL, updated_at = $2 WHERE id = $1`, userID, time.Now()); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if _, err := tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if err := tx.Commit(); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// LoginTwoFactor finishes a login that was paused for a second factor
+func (h *TwoFactorHandler) LoginTwoFactor(c echo.Context) error {
+	var req TwoFactorLoginRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+
+	userID, _, err := parsePurposeToken(req.ChallengeToken, twoFactorChallengePurpose)
+	if err != nil {
+		return SendCustomError(c, ErrorInvalidToken, "Two-factor challenge is invalid or expired, please login again", http.StatusUnauthorized)
+	}
+
+	// An account deactivated since the password step is refused like a password login would be
+	user, err := h.stores.Users.GetUser(userID)
+	if errors.Is(err, errNotFound) {
+		return SendStandardError(c, ErrorInvalidCredentials)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	email := user.Email
+
+	// Guessing codes counts towards the same lockout as guessing passwords
+	client := clientInfoFromContext(c)
+	if wait, err := loginLockout(h.stores.Users, email, client.IPAddress); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	} else if wait > 0 {
+		return sendAccountLocked(c, wait)
+	}
+
+	if err := verifySecondFactor(h.db, userID, req.Code, req.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			if err := recordLoginAttempt(h.stores.Users, email, loginMethodTwoFactor, client, false); err != nil {
+				log.Printf("Failed to record login attempt: %v", err)
+			}
+			return SendStandardError(c, ErrorInvalidTwoFactorCode)
+		}
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	tokens, err := startSession(h.stores.Sessions, userID, client)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error: "Failed to create session",
+		})
+	}
+
+	// Record login history
+	if err := recordLoginAttempt(h.stores.Users, email, loginMethodTwoFactor, client, true); err != nil {
+		// Log error but don't fail the login
+	}
+	auditLogin(h.stores.Audit, c, userID, tokens.SessionID, loginMethodTwoFactor)
+
+	return c.JSON(http.StatusOK, LoginResponse{
+		Message:      "Login successful.",
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		SessionID:    tokens.SessionID.String(),
+	})
+}
+
+// sendTwoFactorChallenge pauses a login until the second factor is given at /api/login/2fa
+func sendTwoFactorChallenge(c echo.Context, userID uuid.UUID) error {
+	challenge, err := issueTwoFactorChallenge(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{
+			Error: "Internal server error",
+		})
+	}
+	return c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+		Message:           "Two-factor authentication required.",
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresIn:         int64(twoFactorChallengeTTL().Seconds()),
+	})
+}
+
+// issueTwoFactorChallenge returns a short-lived token that can only be used at /api/login/2fa
+func issueTwoFactorChallenge(userID uuid.UUID) (string, error) {
+	return signPurposeToken(twoFactorChallengePurpose, userID, nil, twoFactorChallengeTTL())
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+// Both are consumed so they cannot be replayed.
+func verifySecondFactor(db *sql.DB, userID uuid.UUID, code, recoveryCode string) error {
+	if strings.TrimSpace(recoveryCode) != "" {
+		result, err := db.Exec(
+			`UPDATE two_factor_recovery_codes SET used_at = $3 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+			userID, hashToken(normalizeRecoveryCode(recoveryCode)), time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n != 1 {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	var lastStep sql.NullInt64
+	err := db.QueryRow(`SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1 AND is_active = true`, userID).
+		Scan(&secret, &enabled, &lastStep)
+	if err == sql.ErrNoRows {
+		return errInvalidSecondFactor
+	}
+	if err != nil {
+		return err
+	}
+	if !enabled || !secret.Valid {
+		return errInvalidSecondFactor
+	}
+
+	last := int64(-1)
+	if lastStep.Valid {
+		last = lastStep.Int64
+	}
+	step, ok := validateTOTP(secret.String, code, time.Now(), last)
+	if !ok {
+		return errInvalidSecondFactor
+	}
+
+	// Record the step atomically so a concurrent request cannot reuse the same code
+	result, err := db.Exec(
+		`UPDATE users SET totp_last_step = $2 WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`,
+		userID, step,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n != 1 {
+		return errInvalidSecondFactor
+	}
+	return nil
+}
+
+// replaceRecoveryCodes discards old recovery codes and stores hashes of the new ones
+func replaceRecoveryCodes(exec sqlExecutor, userID uuid.UUID, codes []string) error {
+	if _, err := exec.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, code := range codes {
+		_, err := exec.Exec(
+			`INSERT INTO two_factor_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`,
+			uuid.New(), userID, hashToken(normalizeRecoveryCode(code)), now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// totpIssuer returns the issuer shown in authenticator apps (TOTP_ISSUER, default "Expense Tracker")
+func totpIssuer() string {
+	return config().Auth.TOTPIssuer
+}
+
+// twoFactorChallengeTTL returns how long a 2FA challenge stays valid (TWO_FACTOR_CHALLENGE_TTL, default 5m)
+func twoFactorChallengeTTL() time.Duration {
+	return config().Auth.TwoFactorChallengeTTL
+}
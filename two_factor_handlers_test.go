@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableTwoFactor enrolls the user and confirms with the current code. It returns
+// the TOTP secret and the recovery codes.
+func enableTwoFactor(t *testing.T, app *testApp, token string) (string, []string) {
+	t.Helper()
+	code, body := app.do(t, http.MethodPost, "/api/2fa/enroll", token, nil)
+	require.Equal(t, http.StatusOK, code, body)
+	secret := body["secret"].(string)
+
+	code, body = app.do(t, http.MethodPost, "/api/2fa/confirm", token, map[string]string{"code": totpAt(t, secret, 0)})
+	require.Equal(t, http.StatusOK, code, body)
+	var recovery []string
+	for _, c := range body["recovery_codes"].([]interface{}) {
+		recovery = append(recovery, c.(string))
+	}
+	require.Len(t, recovery, recoveryCodeCount)
+	return secret, recovery
+}
+
+// totpAt returns the code for the time step offset steps from now
+func totpAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totpCode(secret, time.Now().Unix()/totpPeriod+offset)
+	require.NoError(t, err)
+	return code
+}
+
+// twoFactorChallenge logs in with the password and returns the challenge token
+func twoFactorChallenge(t *testing.T, app *testApp, email string) string {
+	t.Helper()
+	code, body := app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": email, "password": "password123"})
+	require.Equal(t, http.StatusOK, code, body)
+	require.Equal(t, true, body["two_factor_required"])
+	assert.Nil(t, body["token"])
+	return body["challenge_token"].(string)
+}
+
+func TestTwoFactorHandler_TOTPCodesAreSingleUse(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "totp@example.com")
+		secret, _ := enableTwoFactor(t, app, token)
+
+		// The code used to confirm enrollment cannot sign in
+		challenge := twoFactorChallenge(t, app, "totp@example.com")
+		code, body := app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": totpAt(t, secret, 0)})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidTwoFactorCode, body["error"])
+
+		// The next step's code is inside the allowed skew and works once
+		next := totpAt(t, secret, 1)
+		code, body = app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": next})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.NotEmpty(t, body["token"])
+
+		challenge = twoFactorChallenge(t, app, "totp@example.com")
+		code, body = app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": next})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidTwoFactorCode, body["error"])
+
+		// Nor is an earlier step accepted once a later one was used
+		code, _ = app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": totpAt(t, secret, -1)})
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
+
+func TestTwoFactorHandler_RecoveryCodes(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "recovery@example.com")
+		_, recovery := enableTwoFactor(t, app, token)
+
+		// Recovery codes may be typed in upper case and without the dash
+		typed := strings.ToUpper(strings.ReplaceAll(recovery[0], "-", ""))
+		challenge := twoFactorChallenge(t, app, "recovery@example.com")
+		code, body := app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "recovery_code": typed})
+		require.Equal(t, http.StatusOK, code, body)
+
+		challenge = twoFactorChallenge(t, app, "recovery@example.com")
+		code, body = app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "recovery_code": recovery[0]})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidTwoFactorCode, body["error"])
+
+		// A challenge is no access token
+		code, _ = app.do(t, http.MethodPost, "/api/2fa/enroll", challenge, nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// Turning 2FA off needs the password as well as a second factor
+		code, _ = app.do(t, http.MethodPost, "/api/2fa/disable", token, map[string]string{"password": "wrong", "recovery_code": recovery[1]})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, body = app.do(t, http.MethodPost, "/api/2fa/disable", token, map[string]string{"password": "password123", "recovery_code": recovery[1]})
+		require.Equal(t, http.StatusOK, code, body)
+
+		code, body = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "recovery@example.com", "password": "password123"})
+		require.Equal(t, http.StatusOK, code)
+		assert.NotEmpty(t, body["token"])
+		assert.Nil(t, body["two_factor_required"])
+	})
+}
+
+func TestTwoFactorHandler_DeactivatedDuringLogin(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		token, _ := app.signUp(t, "gone@example.com")
+		secret, _ := enableTwoFactor(t, app, token)
+		challenge := twoFactorChallenge(t, app, "gone@example.com")
+
+		code, body := app.do(t, http.MethodPost, "/api/profile/deactivate", token, map[string]string{"password": "password123"})
+		require.Equal(t, http.StatusOK, code, body)
+
+		// The challenge gets the same answer as a password login to the deactivated account
+		code, body = app.do(t, http.MethodPost, "/api/login/2fa", "", map[string]string{"challenge_token": challenge, "code": totpAt(t, secret, 1)})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidCredentials, body["error"])
+		code, body = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "gone@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, ErrorInvalidCredentials, body["error"])
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const emailVerificationPurpose = "verify_email"
+
+// EmailVerificationHandler handles email address verification and email changes
+type EmailVerificationHandler struct {
+	db     *sql.DB
+	mailer Mailer
+}
+
+// NewEmailVerificationHandler creates a new EmailVerificationHandler instance
+func NewEmailVerificationHandler(db *sql.DB, mailer Mailer) *EmailVerificationHandler {
+	return &EmailVerificationHandler{db: db, mailer: mailer}
+}
+
+// VerifyEmail confirms the address in a signed verification link.
+// For a pending email change it also makes the new address the account email.
+func (h *EmailVerificationHandler) VerifyEmail(c echo.Context) error {
+	userID, email, err := parseVerificationToken(c.QueryParam("token"))
+	if err != nil {
+		return SendStandardError(c, ErrorInvalidVerificationToken)
+	}
+
+	var currentEmail string
+	var pendingEmail sql.NullString
+	err = h.db.QueryRow(`SELECT email, pending_email FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&currentEmail, &pendingEmail)
+	if err == sql.ErrNoRows {
+		return SendStandardError(c, ErrorInvalidVerificationToken)
+	}
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	switch {
+	case pendingEmail.Valid && strings.EqualFold(pendingEmail.String, email):
+		_, err = h.db.Exec(
+			`UPDATE users SET email = pending_email, pending_email = NULL, email_verified = true, updated_at = $2 WHERE id = $1`,
+			userID, time.Now(),
+		)
+		if err != nil {
+			if strings.Contains(err.Error(), "duplicate key") {
+				return SendCustomError(c, ErrorAlreadyExists, "Email already exists", http.StatusConflict)
+			}
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+	case strings.EqualFold(currentEmail, email):
+		if _, err := h.db.Exec(`UPDATE users SET email_verified = true, updated_at = $2 WHERE id = $1`, userID, time.Now()); err != nil {
+			return SendStandardError(c, ErrorDatabaseError)
+		}
+	default:
+		// The link was issued for an address the account no longer uses
+		return SendStandardError(c, ErrorInvalidVerificationToken)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Email verified successfully",
+		"email":   email,
+	})
+}
+
+// ResendVerification sends a fresh verification link for the unverified or pending address
+func (h *EmailVerificationHandler) ResendVerification(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var name, email string
+	var verified bool
+	var pendingEmail sql.NullString
+	err := h.db.QueryRow(`SELECT name, email, email_verified, pending_email FROM users WHERE id = $1 AND is_active = true`, userID).
+		Scan(&name, &email, &verified, &pendingEmail)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	target := email
+	if pendingEmail.Valid {
+		target = pendingEmail.String
+	} else if verified {
+		return SendCustomError(c, ErrorInvalidRequest, "Email is already verified", http.StatusBadRequest)
+	}
+
+	if err := sendVerificationEmail(h.mailer, userID, name, target); err != nil {
+		return SendCustomError(c, ErrorServiceUnavailable, "Failed to send verification email", http.StatusServiceUnavailable)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Verification email sent",
+		"email":   target,
+	})
+}
+
+// ChangeEmail starts an email change; the new address only takes effect once verified
+func (h *EmailVerificationHandler) ChangeEmail(c echo.Context) error {
+	userID := getUserIDFromContext(c)
+	if userID == uuid.Nil {
+		return SendStandardError(c, ErrorUnauthorized)
+	}
+
+	var req ChangeEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return SendStandardError(c, ErrorInvalidRequest)
+	}
+	req.Email = normalizeEmail(req.Email)
+	if req.Email == "" || req.CurrentPassword == "" {
+		return SendCustomError(c, ErrorMissingFields, "Email and current password are required", http.StatusBadRequest)
+	}
+	if !isValidEmail(req.Email) {
+		return SendCustomError(c, ErrorValidationFailed, "Invalid email format", http.StatusBadRequest)
+	}
+
+	var name, email, hashedPassword string
+	err := h.db.QueryRow(`SELECT name, email, password FROM users WHERE id = $1 AND is_active = true`, userID).
+		Scan(&name, &email, &hashedPassword)
+	if err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.CurrentPassword)) != nil {
+		return SendCustomError(c, ErrorInvalidCredentials, "Current password is incorrect", http.StatusBadRequest)
+	}
+	if strings.EqualFold(email, req.Email) {
+		return SendCustomError(c, ErrorValidationFailed, "New email must be different from the current one", http.StatusBadRequest)
+	}
+
+	var taken bool
+	if err := h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`, req.Email).Scan(&taken); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+	if taken {
+		return SendCustomError(c, ErrorAlreadyExists, "Email already exists", http.StatusConflict)
+	}
+
+	if _, err := h.db.Exec(`UPDATE users SET pending_email = $2, updated_at = $3 WHERE id = $1`, userID, req.Email, time.Now()); err != nil {
+		return SendStandardError(c, ErrorDatabaseError)
+	}
+
+	if err := sendVerificationEmail(h.mailer, userID, name, req.Email); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":       "Verification email sent to the new address. Your email changes once it is verified",
+		"pending_email": req.Email,
+	})
+}
+
+// sendVerificationEmail mails a signed verification link for email to the user
+func sendVerificationEmail(mailer Mailer, userID uuid.UUID, name, email string) error {
+	token, err := generateVerificationToken(userID, email)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/email/verify?token=%s", appBaseURL(), url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+		name, emailVerificationTTL(), link)
+	return mailer.Send(email, "Verify your Expense Tracker email", body)
+}
+
+// generateVerificationToken signs a token binding the user to the address being verified
+func generateVerificationToken(userID uuid.UUID, email string) (string, error) {
+	return signPurposeToken(emailVerificationPurpose, userID, jwt.MapClaims{"email": email}, emailVerificationTTL())
+}
+
+// parseVerificationToken validates a verification token and returns its user and address
+func parseVerificationToken(tokenString string) (uuid.UUID, string, error) {
+	userID, claims, err := parsePurposeToken(tokenString, emailVerificationPurpose)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return uuid.Nil, "", errors.New("invalid verification token")
+	}
+	return userID, email, nil
+}
+
+// emailVerificationTTL returns how long verification links stay valid (EMAIL_VERIFICATION_TTL, default 24h)
+func emailVerificationTTL() time.Duration {
+	return config().Auth.EmailVerificationTTL
+}
+
+// unverifiedExpenseLimit returns how many expenses an unverified user may create (UNVERIFIED_EXPENSE_LIMIT, default 10)
+func unverifiedExpenseLimit() int {
+	return config().Accounts.UnverifiedExpenseLimit
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// verifyEmail opens a verification link
+func verifyEmail(t *testing.T, app *testApp, token string) (int, map[string]interface{}) {
+	t.Helper()
+	return app.do(t, http.MethodGet, "/api/email/verify?token="+url.QueryEscape(token), "", nil)
+}
+
+func TestEmailVerificationHandler_VerifyAndResend(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		session, _ := app.signUp(t, "new@example.com")
+		registered := app.mailedToken(t, "new@example.com")
+		require.NotEmpty(t, registered)
+
+		code, body := verifyEmail(t, app, "not-a-token")
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidVerificationToken, body["error"])
+
+		code, body = app.do(t, http.MethodPost, "/api/email/verification/resend", session, nil)
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, "new@example.com", body["email"])
+		resent := app.mailedToken(t, "new@example.com")
+		require.NotEmpty(t, resent)
+
+		code, body = verifyEmail(t, app, resent)
+		require.Equal(t, http.StatusOK, code, body)
+		_, profile := app.do(t, http.MethodGet, "/api/profile", session, nil)
+		assert.Equal(t, true, profile["profile"].(map[string]interface{})["email_verified"])
+
+		code, body = app.do(t, http.MethodPost, "/api/email/verification/resend", session, nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidRequest, body["error"])
+	})
+}
+
+func TestEmailVerificationHandler_ChangeEmail(t *testing.T) {
+	forEachSQLBackend(t, func(t *testing.T, app *testApp) {
+		session, _ := app.signUp(t, "old@example.com")
+		app.signUp(t, "taken@example.com")
+		oldLink := app.mailedToken(t, "old@example.com")
+
+		code, body := app.do(t, http.MethodPut, "/api/profile/email", session, map[string]string{"email": "new@example.com", "current_password": "wrong-password"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidCredentials, body["error"])
+
+		// Addresses are taken regardless of case
+		code, body = app.do(t, http.MethodPut, "/api/profile/email", session, map[string]string{"email": "Taken@Example.com", "current_password": "password123"})
+		assert.Equal(t, http.StatusConflict, code)
+		assert.Equal(t, ErrorAlreadyExists, body["error"])
+		code, _ = app.do(t, http.MethodPut, "/api/profile/email", session, map[string]string{"email": "OLD@example.com", "current_password": "password123"})
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, body = app.do(t, http.MethodPut, "/api/profile/email", session, map[string]string{"email": " New@Example.com", "current_password": "password123"})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, "new@example.com", body["pending_email"])
+		changed := app.mailedToken(t, "new@example.com")
+		require.NotEmpty(t, changed)
+
+		// The email only changes once the new address is verified
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "new@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, body = verifyEmail(t, app, changed)
+		require.Equal(t, http.StatusOK, code, body)
+		_, profile := app.do(t, http.MethodGet, "/api/profile", session, nil)
+		user := profile["profile"].(map[string]interface{})
+		assert.Equal(t, "new@example.com", user["email"])
+		assert.Equal(t, true, user["email_verified"])
+		assert.Nil(t, user["pending_email"])
+
+		// The link sent at registration was for an address the account no longer uses
+		code, body = verifyEmail(t, app, oldLink)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, ErrorInvalidVerificationToken, body["error"])
+
+		code, _ = app.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "NEW@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusOK, code)
+	})
+}